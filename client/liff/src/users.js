@@ -0,0 +1,21 @@
+import axios from "axios";
+
+// listUsers gets every user from /userlist, which returns a page at a time
+// and the cursor of the next page in the X-Next-Cursor header.
+export function listUsers() {
+  const users = [];
+  const next = cursor =>
+    axios
+      .get("/userlist", {
+        params: { limit: 500, cursor },
+        headers: {
+          "Access-Control-Allow-Origin": "*"
+        }
+      })
+      .then(r => {
+        users.push(...r.data);
+        const cursor = r.headers["x-next-cursor"];
+        return cursor ? next(cursor) : users;
+      });
+  return next("");
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// serverError is returned when the server answers with an error status.
+type serverError struct {
+	Code    int
+	Message string
+}
+
+func (e *serverError) Error() string {
+	return e.Message
+}
+
+// serverClient sends requests to the server as a trusted client, which may
+// say which user it acts for, by sending the CLIENT_TOKEN the server shares.
+var serverClient = &http.Client{Transport: clientTokenTransport{}}
+
+// clientTokenTransport adds the CLIENT_TOKEN to requests as a bearer token.
+type clientTokenTransport struct{}
+
+func (clientTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+os.Getenv("CLIENT_TOKEN"))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// getJSON fetches path from the server and decodes the JSON response into v.
+func getJSON(path string, v interface{}) error {
+	res, err := serverClient.Get(serverUrl + path)
+	if err != nil {
+		return fmt.Errorf("could not get %s from the server: %v", path, err)
+	}
+	return decodeResponse(res, v)
+}
+
+// getPage gets a page of a list from path on the server, decodes it into v
+// and returns the cursor of the next page, which is empty on the last one.
+func getPage(path string, v interface{}) (string, error) {
+	res, err := serverClient.Get(serverUrl + path)
+	if err != nil {
+		return "", fmt.Errorf("could not get %s from the server: %v", path, err)
+	}
+	next := res.Header.Get("X-Next-Cursor")
+	return next, decodeResponse(res, v)
+}
+
+// postForm posts form values to path on the server and decodes the JSON
+// response into v, unless v is nil.
+func postForm(path string, form url.Values, v interface{}) error {
+	res, err := serverClient.PostForm(serverUrl+path, form)
+	if err != nil {
+		return fmt.Errorf("could not post to %s on the server: %v", path, err)
+	}
+	return decodeResponse(res, v)
+}
+
+func decodeResponse(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response body: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return &serverError{Code: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	if v == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// findEvent looks up a registered event the user may see by its name.
+func findEvent(userID, eventName string) (*db.Event, error) {
+	cursor := ""
+	for {
+		var events []*db.Event
+		query := url.Values{"viewer": {userID}, "limit": {"500"}, "cursor": {cursor}}
+		next, err := getPage("/event/list?"+query.Encode(), &events)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if e.EventName == eventName {
+				return e, nil
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	return nil, fmt.Errorf("イベント「%s」は見つかりませんでした。", eventName)
+}
+
+// eventForm returns the form the server registers an event from.
+func eventForm(e *db.Event) url.Values {
+	split := func(datetime string) (string, string) {
+		parts := strings.SplitN(strings.TrimSpace(datetime), " ", 2)
+		if len(parts) < 2 {
+			return parts[0], ""
+		}
+		return parts[0], parts[1]
+	}
+
+	form := url.Values{}
+	form.Set("hostID", e.HostID)
+	form.Set("eventName", e.EventName)
+	eventDate, eventTime := split(e.Date)
+	form.Set("eventDate", eventDate)
+	form.Set("eventTime", eventTime)
+	deadlineDate, deadlineTime := split(e.Deadline)
+	form.Set("deadlineDate", deadlineDate)
+	form.Set("deadlineTime", deadlineTime)
+	form.Set("location", e.Location)
+	form.Set("membersMax", fmt.Sprint(e.MembersMax))
+	form.Set("lottery", fmt.Sprint(e.Lottery))
+	form.Set("description", e.Description)
+	form.Set("groupID", e.GroupID)
+	form.Set("venue", e.Venue)
+	if e.Coordinates != nil {
+		form.Set("latitude", fmt.Sprint(e.Coordinates.Latitude))
+		form.Set("longitude", fmt.Sprint(e.Coordinates.Longitude))
+	}
+	return form
+}
+
+// replyText replies to an event with a text message.
+func replyText(bot *linebot.Client, event *linebot.Event, text string) *appError {
+	_, err := bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(text)).Do()
+	if err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
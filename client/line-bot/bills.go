@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/bill"
+)
+
+type billResponse struct {
+	Bills []*bill.Bill      `json:"bills"`
+	Names map[string]string `json:"names"`
+}
+
+// showBill replies with the user's share of the expenses of the event with a
+// given name and whom they have to pay or get paid by.
+func showBill(bot *linebot.Client, event *linebot.Event, eventName string) *appError {
+	e, err := findEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+
+	query := url.Values{}
+	query.Set("hostID", e.HostID)
+	query.Set("eventName", e.EventName)
+	query.Set("viewer", event.Source.UserID)
+
+	var res billResponse
+	if err := getJSON("/event/bill?"+query.Encode(), &res); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の精算内容を取得できませんでした。\n%v", eventName, err))
+	}
+	if len(res.Bills) == 0 {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の費用はまだ登録されていません。", eventName))
+	}
+
+	name := func(userID string) string {
+		if n, ok := res.Names[userID]; ok {
+			return n
+		}
+		return userID
+	}
+
+	userID := event.Source.UserID
+	lines := []string{fmt.Sprintf("イベント「%s」の精算", eventName)}
+	for _, b := range res.Bills {
+		lines = append(lines, fmt.Sprintf("\n合計: %s", formatAmount(b.Total, b.Currency)))
+		for _, s := range b.Shares {
+			if s.UserID == userID {
+				lines = append(lines, fmt.Sprintf("あなたの負担額: %s（支払済み %s）",
+					formatAmount(s.Owes, b.Currency), formatAmount(s.Paid, b.Currency)))
+			}
+		}
+
+		settled := true
+		for _, t := range b.Transfers {
+			switch userID {
+			case t.From:
+				lines = append(lines, fmt.Sprintf("%s さんに %s を支払ってください。", name(t.To), formatAmount(t.Amount, b.Currency)))
+				settled = false
+			case t.To:
+				lines = append(lines, fmt.Sprintf("%s さんから %s を受け取ってください。", name(t.From), formatAmount(t.Amount, b.Currency)))
+				settled = false
+			}
+		}
+		if settled {
+			lines = append(lines, "あなたの精算はありません。")
+		}
+	}
+
+	return replyText(bot, event, strings.Join(lines, "\n"))
+}
+
+// formatAmount formats an amount in the smallest unit of a currency.
+func formatAmount(amount int64, currency string) string {
+	if currency == "JPY" {
+		return fmt.Sprintf("¥%d", amount)
+	}
+	return fmt.Sprintf("%d %s", amount, currency)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// editedFields maps the Japanese names of the fields of an event a host may
+// edit to the form values they are sent in.
+var editedFields = map[string]string{
+	"日時": "eventDate",
+	"場所": "location",
+	"定員": "membersMax",
+}
+
+// editEvent changes the date, location or capacity of an event the sender
+// hosts or co-hosts. args is "<event name> <日時|場所|定員> <value> [通知なし]
+// [強制]": participants are told about the change unless 通知なし is given,
+// and 強制 lowers the capacity below the participants who have a seat.
+func editEvent(bot *linebot.Client, event *linebot.Event, args string) *appError {
+	usage := "「<イベント名> <日時|場所|定員> <変更後の値> [通知なし] [強制]」の形式で入力してください。"
+	fields := strings.Fields(args)
+	mode, force := "notify", false
+	for ; len(fields) > 0; fields = fields[:len(fields)-1] {
+		if option := fields[len(fields)-1]; option == "通知なし" {
+			mode = "silent"
+		} else if option == "強制" {
+			force = true
+		} else {
+			break
+		}
+	}
+	if len(fields) < 3 || editedFields[fields[1]] == "" {
+		return replyText(bot, event, usage)
+	}
+	eventName, name, value := fields[0], fields[1], strings.Join(fields[2:], " ")
+
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	formData := url.Values{}
+	formData.Set("hostID", e.HostID)
+	formData.Set("eventName", e.EventName)
+	formData.Set("actorID", event.Source.UserID)
+	formData.Set("mode", mode)
+	formData.Set("force", fmt.Sprint(force))
+	if name == "日時" {
+		date := fields[2:]
+		if len(date) != 2 {
+			return replyText(bot, event, "日時は「2019-06-01 10:00」の形式で入力してください。")
+		}
+		formData.Set("eventDate", date[0])
+		formData.Set("eventTime", date[1])
+	} else {
+		formData.Set(editedFields[name], value)
+	}
+	if err := postForm("/event/update", formData, nil); err != nil {
+		if serr, ok := err.(*serverError); ok && serr.Code == http.StatusConflict {
+			return replyText(bot, event, fmt.Sprintf("定員が確定済みの参加者数を下回ります。\nそれでも変更するには「変更 %s 定員 %s 強制」と送ってください。", eventName, value))
+		}
+		return replyText(bot, event, fmt.Sprintf("イベントを変更できませんでした。\n%v", err))
+	}
+
+	text := fmt.Sprintf("イベント「%s」の%sを%sに変更しました。", eventName, name, value)
+	if mode == "notify" {
+		text += "\n参加者に変更をお知らせします。"
+	}
+	return replyText(bot, event, text)
+}
+
+// cancelEvent calls off an event the sender hosts. args is "<event name>
+// [reason]". The event is kept, and its participants are told.
+func cancelEvent(bot *linebot.Client, event *linebot.Event, args string) *appError {
+	fields := strings.Fields(args)
+	if len(fields) < 1 {
+		return replyText(bot, event, "「<イベント名> [理由]」の形式で入力してください。")
+	}
+	eventName, reason := fields[0], strings.Join(fields[1:], " ")
+
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	formData := url.Values{}
+	formData.Set("hostID", e.HostID)
+	formData.Set("eventName", e.EventName)
+	formData.Set("actorID", event.Source.UserID)
+	formData.Set("reason", reason)
+	if err := postForm("/event/cancellation", formData, nil); err != nil {
+		if serr, ok := err.(*serverError); ok {
+			switch serr.Code {
+			case http.StatusForbidden:
+				return replyText(bot, event, "イベントを中止できるのは主催者だけです。")
+			case http.StatusConflict:
+				return replyText(bot, event, fmt.Sprintf("イベント「%s」はすでに中止されています。", eventName))
+			}
+		}
+		return replyText(bot, event, fmt.Sprintf("イベントを中止できませんでした。\n%v", err))
+	}
+	return replyText(bot, event, fmt.Sprintf("イベント「%s」を中止しました。\n参加者に中止をお知らせします。支払い済みの参加費は返金待ちになります。", eventName))
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// exportParticipants replies to the host or a co-host of an event with the
+// download link of its participant list.
+func exportParticipants(bot *linebot.Client, event *linebot.Event, eventName string) *appError {
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	query := url.Values{}
+	query.Set("hostID", e.HostID)
+	query.Set("eventName", e.EventName)
+	query.Set("actorID", event.Source.UserID)
+
+	var res struct {
+		URL string `json:"url"`
+	}
+	if err := getJSON("/event/export?"+query.Encode(), &res); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の参加者リストを取得できませんでした。\n%v", eventName, err))
+	}
+	return replyText(bot, event, fmt.Sprintf("イベント「%s」の参加者リスト（CSV）は以下のURLからダウンロードできます。Excelでそのまま開けます。\n%s", eventName, res.URL))
+}
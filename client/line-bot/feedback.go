@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/survey"
+)
+
+// answeringFeedback is the session state of a user responding to the survey
+// of an event they attended.
+const answeringFeedback = "answeringFeedback"
+
+const (
+	// feedbackRating and feedbackComment are the steps of the survey before
+	// its custom questions, which follow in order.
+	feedbackRating    = 0
+	feedbackComment   = 1
+	feedbackQuestions = 2
+)
+
+// recentComments is the number of comments shown in a survey summary.
+const recentComments = 3
+
+// startFeedback begins the survey of the event with a given name for the user,
+// who must have checked in to it.
+func startFeedback(bot *linebot.Client, event *linebot.Event, w http.ResponseWriter, req *http.Request, eventName string) *appError {
+	e, err := findEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+
+	userSession, err := SessionStore.New(req, event.Source.UserID)
+	if err != nil {
+		return appErrorf(err, "could not create session: %v", err)
+	}
+	userSession.Values["state"] = answeringFeedback
+	userSession.Values["hostID"] = e.HostID
+	userSession.Values["eventName"] = e.EventName
+	userSession.Values["step"] = feedbackRating
+	userSession.Values["rating"] = int64(0)
+	userSession.Values["comment"] = ""
+	userSession.Values["answers"] = "[]"
+	if err := userSession.Save(req, w); err != nil {
+		return appErrorf(err, "could not save session in startFeedback: %v", err)
+	}
+
+	intro := fmt.Sprintf("イベント「%s」のアンケートにご協力ください。\n途中でやめるには「%s」と送ってください。", e.EventName, cancelAnswers)
+	return askRating(bot, event, intro)
+}
+
+// answerFeedback records the user's answer to the step of the survey they
+// were asked last, and asks the next one. After the last step, the response
+// is submitted.
+func answerFeedback(bot *linebot.Client, event *linebot.Event, w http.ResponseWriter, req *http.Request, text string) *appError {
+	userSession, err := SessionStore.Get(req, event.Source.UserID)
+	if err != nil {
+		return appErrorf(err, "could not get session: %v", err)
+	}
+	if strings.TrimSpace(text) == cancelAnswers {
+		userSession.Options.MaxAge = -1
+		if err := userSession.Save(req, w); err != nil {
+			return appErrorf(err, "could not save session in answerFeedback: %v", err)
+		}
+		return replyText(bot, event, "アンケートを中止しました。")
+	}
+
+	hostID, _ := userSession.Values["hostID"].(string)
+	eventName, _ := userSession.Values["eventName"].(string)
+	step, _ := userSession.Values["step"].(int)
+	rating, _ := userSession.Values["rating"].(int64)
+	comment, _ := userSession.Values["comment"].(string)
+	var answers []*db.Answer
+	if s, ok := userSession.Values["answers"].(string); ok {
+		if err := json.Unmarshal([]byte(s), &answers); err != nil {
+			return appErrorf(err, "could not decode answers: %v", err)
+		}
+	}
+
+	questions, err := listQuestions(hostID, eventName, db.FormFeedback, event.Source.UserID)
+	if err != nil {
+		return appErrorf(err, "could not get questions: %v", err)
+	}
+	text = strings.TrimSpace(text)
+	switch {
+	case step == feedbackRating:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil || n < db.MinRating || n > db.MaxRating {
+			return askRating(bot, event, fmt.Sprintf("%dから%dの数字で答えてください。", db.MinRating, db.MaxRating))
+		}
+		rating = n
+	case step == feedbackComment:
+		if text != skipAnswer {
+			comment = text
+		}
+	case step-feedbackQuestions < len(questions):
+		answer, err := parseAnswer(questions[step-feedbackQuestions], text)
+		if err != nil {
+			return askQuestion(bot, event, err.Error(), questions, step-feedbackQuestions)
+		}
+		if answer != nil {
+			answers = append(answers, answer)
+		}
+	}
+	step++
+
+	if step-feedbackQuestions < len(questions) {
+		answersJSON, err := json.Marshal(answers)
+		if err != nil {
+			return appErrorf(err, "could not encode answers: %v", err)
+		}
+		userSession.Values["step"] = step
+		userSession.Values["rating"] = rating
+		userSession.Values["comment"] = comment
+		userSession.Values["answers"] = string(answersJSON)
+		if err := userSession.Save(req, w); err != nil {
+			return appErrorf(err, "could not save session in answerFeedback: %v", err)
+		}
+		if step == feedbackComment {
+			return askComment(bot, event)
+		}
+		return askQuestion(bot, event, "", questions, step-feedbackQuestions)
+	}
+
+	userSession.Options.MaxAge = -1
+	if err := userSession.Save(req, w); err != nil {
+		return appErrorf(err, "could not save session in answerFeedback: %v", err)
+	}
+	formData := url.Values{}
+	formData.Set("hostID", hostID)
+	formData.Set("eventName", eventName)
+	formData.Set("userID", event.Source.UserID)
+	formData.Set("rating", strconv.FormatInt(rating, 10))
+	formData.Set("comment", comment)
+	if len(answers) > 0 {
+		answersJSON, err := json.Marshal(answers)
+		if err != nil {
+			return appErrorf(err, "could not encode answers: %v", err)
+		}
+		formData.Set("answers", string(answersJSON))
+	}
+	if err := postForm("/event/feedback", formData, nil); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」のアンケートを送信できませんでした。\n%v", eventName, err))
+	}
+	return replyText(bot, event, fmt.Sprintf("イベント「%s」のアンケートにご回答いただきありがとうございました。", eventName))
+}
+
+// askRating replies asking for a rating of the event, after a given text, with
+// a quick reply for each rating.
+func askRating(bot *linebot.Client, event *linebot.Event, text string) *appError {
+	var buttons []*linebot.QuickReplyButton
+	for n := db.MinRating; n <= db.MaxRating; n++ {
+		label := strconv.Itoa(n)
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewMessageAction(strings.Repeat("★", n), label)))
+	}
+	question := fmt.Sprintf("イベントの満足度を%d（不満）から%d（満足）で教えてください。", db.MinRating, db.MaxRating)
+	message := linebot.NewTextMessage(text + "\n\n" + question).WithQuickReplies(linebot.NewQuickReplyItems(buttons...))
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
+
+// askComment replies asking for a comment on the event, which may be skipped.
+func askComment(bot *linebot.Client, event *linebot.Event) *appError {
+	message := linebot.NewTextMessage("ご感想やご意見があればお書きください。").
+		WithQuickReplies(linebot.NewQuickReplyItems(
+			linebot.NewQuickReplyButton("", linebot.NewMessageAction(skipAnswer, skipAnswer))))
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
+
+// showFeedback replies to the host or a co-host of an event with a summary of
+// the responses to its survey.
+func showFeedback(bot *linebot.Client, event *linebot.Event, eventName string) *appError {
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	query := url.Values{}
+	query.Set("hostID", e.HostID)
+	query.Set("eventName", e.EventName)
+	query.Set("actorID", event.Source.UserID)
+
+	var summary survey.Summary
+	if err := getJSON("/event/feedback?"+query.Encode(), &summary); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」のアンケート結果を取得できませんでした。\n%v", eventName, err))
+	}
+	if summary.Responses == 0 {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」のアンケートにはまだ回答がありません。", eventName))
+	}
+
+	summaryFormat := `{
+	  "type": "bubble",
+	  "body": {
+		"type": "box",
+		"layout": "vertical",
+		"spacing": "md",
+		"contents": [
+		  {
+			"type": "text",
+			"text": %s,
+			"weight": "bold",
+			"size": "xl",
+			"wrap": true
+		  },
+		  {
+			"type": "text",
+			"text": %s,
+			"size": "3xl",
+			"weight": "bold",
+			"color": "#F5A623"
+		  },
+		  {
+			"type": "text",
+			"text": %s,
+			"size": "sm",
+			"color": "#999999"
+		  },
+		  {
+			"type": "separator"
+		  },
+		  {
+			"type": "box",
+			"layout": "vertical",
+			"spacing": "sm",
+			"contents": [%s]
+		  }%s
+		]
+	  }
+	}`
+	rowFormat := `{
+	  "type": "box",
+	  "layout": "baseline",
+	  "contents": [
+		{
+		  "type": "text",
+		  "text": %s,
+		  "color": "#F5A623",
+		  "size": "sm",
+		  "flex": 2
+		},
+		{
+		  "type": "text",
+		  "text": %s,
+		  "size": "sm",
+		  "align": "end",
+		  "flex": 1
+		}
+	  ]
+	}`
+	commentsFormat := `,
+	  {
+		"type": "separator"
+	  },
+	  {
+		"type": "box",
+		"layout": "vertical",
+		"spacing": "sm",
+		"contents": [%s]
+	  }`
+	commentFormat := `{
+	  "type": "text",
+	  "text": %s,
+	  "size": "sm",
+	  "wrap": true
+	}`
+
+	var rows []string
+	for i := len(summary.Ratings) - 1; i >= 0; i-- {
+		stars := strings.Repeat("★", i+db.MinRating)
+		rows = append(rows, fmt.Sprintf(rowFormat, jsonString(stars), jsonString(fmt.Sprintf("%d件", summary.Ratings[i]))))
+	}
+	comments := ""
+	if len(summary.Comments) > 0 {
+		items := []string{fmt.Sprintf(commentFormat, jsonString("最近のコメント"))}
+		for i, c := range summary.Comments {
+			if i == recentComments {
+				break
+			}
+			// Flex texts are limited; long comments are cut short.
+			items = append(items, fmt.Sprintf(commentFormat, jsonString(fmt.Sprintf("%s %s", strings.Repeat("★", int(c.Rating)), truncate(c.Comment, 100)))))
+		}
+		comments = fmt.Sprintf(commentsFormat, strings.Join(items, ","))
+	}
+
+	summaryJSON := []byte(fmt.Sprintf(summaryFormat,
+		jsonString(fmt.Sprintf("「%s」アンケート結果", e.EventName)),
+		jsonString(fmt.Sprintf("★ %.1f", summary.AverageRating)),
+		jsonString(fmt.Sprintf("回答 %d件 / 参加者 %d人", summary.Responses, summary.Invited)),
+		strings.Join(rows, ","), comments))
+	container, err := linebot.UnmarshalFlexMessageJSON(summaryJSON)
+	if err != nil {
+		return appErrorf(err, "could not build survey summary: %v", err)
+	}
+	alt := fmt.Sprintf("イベント「%s」のアンケート結果: 平均 %.1f（%d件）", e.EventName, summary.AverageRating, summary.Responses)
+	if _, err := bot.ReplyMessage(event.ReplyToken, linebot.NewFlexMessage(alt, container)).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// groupHelp lists the commands members of a group can send.
+const groupHelp = `このグループのイベントは次のように使えます。
+・イベント一覧: 募集中のイベントを表示します
+・参加 <イベント名>: イベントに参加します
+・イベント登録: このグループのイベントを登録します`
+
+// chatID returns the ID of the group or room an event was sent from, or an
+// empty string for a one-on-one chat.
+func chatID(source *linebot.EventSource) string {
+	switch source.Type {
+	case linebot.EventSourceTypeGroup:
+		return source.GroupID
+	case linebot.EventSourceTypeRoom:
+		return source.RoomID
+	}
+	return ""
+}
+
+// listViewer returns the user to list events to: the sender in a one-on-one
+// chat, and nobody in a group or room, where everyone sees the reply and only
+// public events are listed.
+func listViewer(source *linebot.EventSource) string {
+	if chatID(source) != "" {
+		return ""
+	}
+	return source.UserID
+}
+
+// joinGroup records that the bot was invited to a group or room and
+// introduces itself.
+func joinGroup(bot *linebot.Client, event *linebot.Event) *appError {
+	groupID := chatID(event.Source)
+	if groupID == "" {
+		return nil
+	}
+	formData := url.Values{}
+	formData.Set("groupID", groupID)
+	formData.Set("kind", string(event.Source.Type))
+	if err := postForm("/group/join", formData, nil); err != nil {
+		return appErrorf(err, "could not record group %s: %v", groupID, err)
+	}
+	return replyText(bot, event, "招待ありがとうございます。\n"+groupHelp)
+}
+
+// leaveGroup records that the bot left or was removed from a group or room,
+// so that nothing is posted to it any more.
+func leaveGroup(event *linebot.Event) *appError {
+	groupID := chatID(event.Source)
+	if groupID == "" {
+		return nil
+	}
+	formData := url.Values{}
+	formData.Set("groupID", groupID)
+	formData.Set("kind", string(event.Source.Type))
+	if err := postForm("/group/leave", formData, nil); err != nil {
+		return appErrorf(err, "could not record leaving group %s: %v", groupID, err)
+	}
+	return nil
+}
+
+// welcomeMembers greets members who joined a group and tells them about the
+// group's events.
+func welcomeMembers(bot *linebot.Client, event *linebot.Event) *appError {
+	events, err := listChatEvents(event.Source)
+	if err != nil {
+		return appErrorf(err, "could not list events of group: %v", err)
+	}
+	text := "ようこそ！\n"
+	if len(events) > 0 {
+		text += fmt.Sprintf("このグループでは %d 件のイベントを募集中です。\n", len(events))
+	}
+	return replyText(bot, event, text+groupHelp)
+}
+
+// showChatEvents replies with a carousel of the events taking applications,
+// limited to those of the group or room the message was sent from.
+func showChatEvents(bot *linebot.Client, event *linebot.Event) *appError {
+	events, err := listChatEvents(event.Source)
+	if err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベントを取得できませんでした。\n%v", err))
+	}
+	if len(events) == 0 {
+		return replyText(bot, event, "募集中のイベントはありません。")
+	}
+
+	recordViews(event.Source.UserID, events)
+	message := eventCarousel("募集中のイベント", events, func(e *db.Event) string {
+		return fmt.Sprintf("%s\n%s", e.Date, venueName(e))
+	})
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
+
+// listChatEvents returns the first events taking applications, soonest
+// first, of the group or room of source, or of everyone in a one-on-one chat.
+func listChatEvents(source *linebot.EventSource) ([]*db.Event, error) {
+	query := url.Values{}
+	query.Set("status", db.EventOpen)
+	query.Set("sort", db.SortDate)
+	query.Set("limit", fmt.Sprint(maxCarouselColumns))
+	query.Set("viewer", listViewer(source))
+	if groupID := chatID(source); groupID != "" {
+		query.Set("group", groupID)
+	}
+
+	var events []*db.Event
+	if err := getJSON("/event/list?"+query.Encode(), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// findChatEvent looks up an event the sender may see by its name, preferring
+// the events of the group or room of source to events of the same name
+// elsewhere.
+func findChatEvent(source *linebot.EventSource, eventName string) (*db.Event, error) {
+	groupID := chatID(source)
+	if groupID == "" {
+		return findEvent(source.UserID, eventName)
+	}
+
+	cursor := ""
+	for {
+		var events []*db.Event
+		query := url.Values{"group": {groupID}, "viewer": {source.UserID}, "limit": {"500"}, "cursor": {cursor}}
+		next, err := getPage("/event/list?"+query.Encode(), &events)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			if e.EventName == eventName {
+				return e, nil
+			}
+		}
+		if next == "" {
+			return findEvent(source.UserID, eventName)
+		}
+		cursor = next
+	}
+}
+
+// ensureMember signs up the sender of a message in a group or room if they
+// have not signed up yet, so that group members can join events without
+// befriending the bot first.
+func ensureMember(bot *linebot.Client, event *linebot.Event) error {
+	userID := event.Source.UserID
+	if userID == "" {
+		return fmt.Errorf("メッセージの送信者を確認できませんでした。")
+	}
+	if err := getJSON("/user/"+url.PathEscape(userID), nil); err == nil {
+		return nil
+	}
+
+	var (
+		profile *linebot.UserProfileResponse
+		err     error
+	)
+	switch event.Source.Type {
+	case linebot.EventSourceTypeGroup:
+		profile, err = bot.GetGroupMemberProfile(event.Source.GroupID, userID).Do()
+	case linebot.EventSourceTypeRoom:
+		profile, err = bot.GetRoomMemberProfile(event.Source.RoomID, userID).Do()
+	default:
+		profile, err = bot.GetProfile(userID).Do()
+	}
+	if err != nil {
+		return fmt.Errorf("could not get profile of %s: %v", userID, err)
+	}
+
+	formData := url.Values{}
+	formData.Set("userID", userID)
+	formData.Set("userName", strings.TrimSpace(profile.DisplayName))
+	return postForm("/signup", formData, nil)
+}
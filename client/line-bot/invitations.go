@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// visibilities maps the Japanese names of visibilities to them.
+var visibilities = map[string]string{
+	"公開":   db.VisibilityPublic,
+	"限定公開": db.VisibilityUnlisted,
+	"非公開":  db.VisibilityPrivate,
+}
+
+type invitationResponse struct {
+	Code      string
+	MaxUses   int64
+	ExpiresAt string
+	URL       string `json:"url"`
+}
+
+// setVisibility changes who sees an event the sender hosts or co-hosts. args
+// is "<event name> <公開|限定公開|非公開>".
+func setVisibility(bot *linebot.Client, event *linebot.Event, args string) *appError {
+	fields := strings.Fields(args)
+	if len(fields) != 2 || visibilities[fields[1]] == "" {
+		return replyText(bot, event, "「<イベント名> <公開|限定公開|非公開>」の形式で入力してください。")
+	}
+	eventName, name := fields[0], fields[1]
+
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	formData := url.Values{}
+	formData.Set("hostID", e.HostID)
+	formData.Set("eventName", e.EventName)
+	formData.Set("actorID", event.Source.UserID)
+	formData.Set("visibility", visibilities[name])
+	if err := postForm("/event/visibility", formData, nil); err != nil {
+		return replyText(bot, event, fmt.Sprintf("公開範囲を変更できませんでした。\n%v", err))
+	}
+
+	text := fmt.Sprintf("イベント「%s」を%sにしました。", eventName, name)
+	if name != "公開" {
+		text += fmt.Sprintf("\n「招待コード %s」と送ると招待コードを発行します。", eventName)
+	}
+	return replyText(bot, event, text)
+}
+
+// createInvitation issues an invitation code to an event the sender hosts or
+// co-hosts. args is "<event name> [uses] [days]": the code can be used by at
+// most uses users, and for days days. Both are unlimited if omitted or zero.
+func createInvitation(bot *linebot.Client, event *linebot.Event, args string) *appError {
+	fields := strings.Fields(args)
+	if len(fields) < 1 || len(fields) > 3 {
+		return replyText(bot, event, "「<イベント名> [使用回数] [有効日数]」の形式で入力してください。")
+	}
+	limits := make([]int64, 2)
+	for i, v := range fields[1:] {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return replyText(bot, event, "使用回数と有効日数は数字で入力してください。")
+		}
+		limits[i] = n
+	}
+	eventName := fields[0]
+
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	formData := url.Values{}
+	formData.Set("hostID", e.HostID)
+	formData.Set("eventName", e.EventName)
+	formData.Set("actorID", event.Source.UserID)
+	if limits[0] > 0 {
+		formData.Set("maxUses", fmt.Sprint(limits[0]))
+	}
+	if limits[1] > 0 {
+		expires := time.Now().In(db.Timezone).AddDate(0, 0, int(limits[1]))
+		formData.Set("expiresAt", expires.Format(db.TimeLayout))
+	}
+
+	var invitation invitationResponse
+	if err := postForm("/event/invitation", formData, &invitation); err != nil {
+		if serr, ok := err.(*serverError); ok && serr.Code == http.StatusForbidden {
+			return replyText(bot, event, "招待コードを発行する権限がありません。")
+		}
+		return replyText(bot, event, fmt.Sprintf("招待コードを発行できませんでした。\n%v", err))
+	}
+
+	lines := []string{
+		fmt.Sprintf("イベント「%s」の招待コード: %s", eventName, invitation.Code),
+		fmt.Sprintf("招待された人は「招待 %s」と送ると参加できます。", invitation.Code),
+	}
+	if invitation.MaxUses > 0 {
+		lines = append(lines, fmt.Sprintf("使用回数: %d回まで", invitation.MaxUses))
+	}
+	if invitation.ExpiresAt != "" {
+		lines = append(lines, fmt.Sprintf("有効期限: %s", invitation.ExpiresAt))
+	}
+	lines = append(lines, invitation.URL)
+	return replyText(bot, event, strings.Join(lines, "\n"))
+}
+
+// redeemInvitation lets the sender see and join the event of an invitation
+// code, and replies with the event.
+func redeemInvitation(bot *linebot.Client, event *linebot.Event, code string) *appError {
+	if err := ensureMember(bot, event); err != nil {
+		return replyText(bot, event, fmt.Sprintf("招待コードを使えませんでした。\n%v", err))
+	}
+
+	formData := url.Values{}
+	formData.Set("code", code)
+	formData.Set("userID", event.Source.UserID)
+	var res struct {
+		Event *db.Event `json:"event"`
+	}
+	if err := postForm("/invitation/redeem", formData, &res); err != nil {
+		if serr, ok := err.(*serverError); ok {
+			switch serr.Code {
+			case http.StatusGone:
+				return replyText(bot, event, "この招待コードは有効期限が切れたか、使用回数の上限に達しています。")
+			case http.StatusNotFound:
+				return replyText(bot, event, fmt.Sprintf("招待コード「%s」は見つかりませんでした。", code))
+			}
+		}
+		return replyText(bot, event, fmt.Sprintf("招待コードを使えませんでした。\n%v", err))
+	}
+
+	message := eventCarousel(fmt.Sprintf("イベント「%s」に招待されました", res.Event.EventName), []*db.Event{res.Event}, func(e *db.Event) string {
+		return fmt.Sprintf("%s\n%s", e.Date, venueName(e))
+	})
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// roleNames are the Japanese names of the roles of organizers.
+var roleNames = map[string]string{
+	db.RoleOwner:  "主催者",
+	db.RoleCoHost: "共同主催者",
+	db.RoleStaff:  "スタッフ",
+}
+
+type organizedEvent struct {
+	db.Event
+	Role string `json:"role"`
+}
+
+type organizerResponse struct {
+	UserID   string `json:"userID"`
+	UserName string `json:"userName"`
+	Role     string `json:"role"`
+}
+
+// findOrganizedEvent looks up an event the user hosts or helps to organize by
+// its name.
+func findOrganizedEvent(userID, eventName string) (*organizedEvent, error) {
+	var events []*organizedEvent
+	if err := getJSON("/event/organizing?"+url.Values{"userID": {userID}}.Encode(), &events); err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		if e.EventName == eventName {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("あなたが主催するイベント「%s」は見つかりませんでした。", eventName)
+}
+
+// findUserByName looks up a signed-up user by their exact name.
+func findUserByName(userName string) (*db.User, error) {
+	var users []*db.User
+	if err := getJSON("/userlist?"+url.Values{"name": {userName}, "limit": {"500"}}.Encode(), &users); err != nil {
+		return nil, err
+	}
+	var found []*db.User
+	for _, u := range users {
+		if u.UserName == userName {
+			found = append(found, u)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("ユーザー「%s」は見つかりませんでした。", userName)
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("「%s」という名前のユーザーが複数います。", userName)
+}
+
+// showOrganizers replies with the organizers of an event and their roles.
+func showOrganizers(bot *linebot.Client, event *linebot.Event, eventName string) *appError {
+	e, err := findChatEvent(event.Source, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+
+	query := url.Values{"hostID": {e.HostID}, "eventName": {e.EventName}, "viewer": {listViewer(event.Source)}}
+	var organizers []*organizerResponse
+	if err := getJSON("/event/organizers?"+query.Encode(), &organizers); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の主催者を取得できませんでした。\n%v", eventName, err))
+	}
+
+	lines := []string{fmt.Sprintf("イベント「%s」の主催者", eventName)}
+	for _, o := range organizers {
+		lines = append(lines, fmt.Sprintf("%s: %s", o.UserName, roleNames[o.Role]))
+	}
+	return replyText(bot, event, strings.Join(lines, "\n"))
+}
+
+// addOrganizer makes a user a co-host or staff of an event the sender
+// organizes. args is "<event name> <user name>".
+func addOrganizer(bot *linebot.Client, event *linebot.Event, role, args string) *appError {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return replyText(bot, event, "「<イベント名> <ユーザー名>」の形式で入力してください。")
+	}
+	eventName := fields[0]
+	userName := strings.Join(fields[1:], " ")
+
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	user, err := findUserByName(userName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+
+	formData := url.Values{}
+	formData.Set("hostID", e.HostID)
+	formData.Set("eventName", e.EventName)
+	formData.Set("actorID", event.Source.UserID)
+	formData.Set("userID", user.UserID)
+	formData.Set("role", role)
+	if err := postForm("/event/organizer", formData, nil); err != nil {
+		if serr, ok := err.(*serverError); ok && serr.Code == http.StatusForbidden {
+			return replyText(bot, event, fmt.Sprintf("%sを追加する権限がありません。", roleNames[role]))
+		}
+		return replyText(bot, event, fmt.Sprintf("%sを追加できませんでした。\n%v", roleNames[role], err))
+	}
+
+	return replyText(bot, event, fmt.Sprintf("%s さんをイベント「%s」の%sにしました。", user.UserName, eventName, roleNames[role]))
+}
+
+// removeOrganizer removes a co-host or staff from an event the sender
+// organizes. args is "<event name> <user name>".
+func removeOrganizer(bot *linebot.Client, event *linebot.Event, args string) *appError {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return replyText(bot, event, "「<イベント名> <ユーザー名>」の形式で入力してください。")
+	}
+	eventName := fields[0]
+	userName := strings.Join(fields[1:], " ")
+
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	user, err := findUserByName(userName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+
+	formData := url.Values{}
+	formData.Set("hostID", e.HostID)
+	formData.Set("eventName", e.EventName)
+	formData.Set("actorID", event.Source.UserID)
+	formData.Set("userID", user.UserID)
+	if err := postForm("/event/organizer/delete", formData, nil); err != nil {
+		if serr, ok := err.(*serverError); ok {
+			switch serr.Code {
+			case http.StatusForbidden:
+				return replyText(bot, event, "主催者を外す権限がありません。")
+			case http.StatusNotFound:
+				return replyText(bot, event, fmt.Sprintf("%s さんはイベント「%s」の主催者ではありません。", user.UserName, eventName))
+			}
+		}
+		return replyText(bot, event, fmt.Sprintf("主催者を外せませんでした。\n%v", err))
+	}
+
+	return replyText(bot, event, fmt.Sprintf("%s さんをイベント「%s」の主催者から外しました。", user.UserName, eventName))
+}
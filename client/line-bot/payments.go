@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/ledger"
+)
+
+// paymentStatusNames are the Japanese names of payment statuses.
+var paymentStatusNames = map[string]string{
+	db.PaymentDue:      "未払い",
+	db.PaymentPaid:     "支払済み",
+	db.PaymentWaived:   "免除",
+	db.PaymentRefunded: "返金済み",
+}
+
+// getLedger fetches the ledger of an event on behalf of one of its
+// organizers.
+func getLedger(e *organizedEvent, actorID string) ([]*ledger.Entry, error) {
+	query := url.Values{}
+	query.Set("hostID", e.HostID)
+	query.Set("eventName", e.EventName)
+	query.Set("actorID", actorID)
+
+	var entries []*ledger.Entry
+	if err := getJSON("/event/ledger?"+query.Encode(), &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// showPayments replies to the host or a co-host of an event with who has
+// paid its fee.
+func showPayments(bot *linebot.Client, event *linebot.Event, eventName string) *appError {
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	entries, err := getLedger(e, event.Source.UserID)
+	if err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の支払い状況を取得できませんでした。\n%v", eventName, err))
+	}
+	if len(entries) == 0 {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」に参加費の支払い対象者はいません。", eventName))
+	}
+
+	lines := []string{fmt.Sprintf("イベント「%s」の支払い状況", eventName)}
+	for _, e := range entries {
+		lines = append(lines, fmt.Sprintf("%s: %s（%d %s）", e.UserName, paymentStatusNames[e.PaymentStatus], e.Amount, e.Currency))
+	}
+	return replyText(bot, event, strings.Join(lines, "\n"))
+}
+
+// markPayment lets the host or a co-host of an event set the payment status
+// of a participant. args is "<event name> <participant name>".
+func markPayment(bot *linebot.Client, event *linebot.Event, status, args string) *appError {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return replyText(bot, event, "「<イベント名> <参加者名>」の形式で入力してください。")
+	}
+	eventName := fields[0]
+	userName := strings.Join(fields[1:], " ")
+
+	e, err := findOrganizedEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	entries, err := getLedger(e, event.Source.UserID)
+	if err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の支払い状況を取得できませんでした。\n%v", eventName, err))
+	}
+	var entry *ledger.Entry
+	for _, x := range entries {
+		if x.UserName == userName {
+			entry = x
+		}
+	}
+	if entry == nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」に参加者「%s」は見つかりませんでした。", eventName, userName))
+	}
+
+	formData := url.Values{}
+	formData.Set("hostID", e.HostID)
+	formData.Set("eventName", e.EventName)
+	formData.Set("actorID", event.Source.UserID)
+	formData.Set("userID", entry.UserID)
+	formData.Set("status", status)
+	if err := postForm("/event/payment", formData, nil); err != nil {
+		return replyText(bot, event, fmt.Sprintf("支払い状況を更新できませんでした。\n%v", err))
+	}
+
+	return replyText(bot, event, fmt.Sprintf("%s さんの支払い状況を「%s」にしました。", userName, paymentStatusNames[status]))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/geo"
+)
+
+// nearbyRadius is how far from a location sent to the bot events are looked
+// for.
+const nearbyRadius = "3km"
+
+// showNearbyEvents replies to a location message with a carousel of the
+// events still taking applications within nearbyRadius of it, nearest first.
+func showNearbyEvents(bot *linebot.Client, event *linebot.Event, location *linebot.LocationMessage) *appError {
+	here := geo.Point{Latitude: location.Latitude, Longitude: location.Longitude}
+	query := url.Values{}
+	query.Set("lat", fmt.Sprint(here.Latitude))
+	query.Set("lng", fmt.Sprint(here.Longitude))
+	query.Set("radius", nearbyRadius)
+	query.Set("sort", db.SortDistance)
+	query.Set("status", db.EventOpen)
+	query.Set("limit", fmt.Sprint(maxCarouselColumns))
+	query.Set("viewer", listViewer(event.Source))
+
+	var events []*db.Event
+	if err := getJSON("/event/list?"+query.Encode(), &events); err != nil {
+		return replyText(bot, event, fmt.Sprintf("近くのイベントを探せませんでした。\n%v", err))
+	}
+	if len(events) == 0 {
+		return replyText(bot, event, fmt.Sprintf("%s以内に募集中のイベントは見つかりませんでした。", nearbyRadius))
+	}
+
+	message := eventCarousel("近くのイベント", events, func(e *db.Event) string {
+		text := fmt.Sprintf("%s\n%s", e.Date, venueName(e))
+		if e.Coordinates != nil {
+			text += fmt.Sprintf("（約%.1fkm）", geo.Distance(here, *e.Coordinates)/1000)
+		}
+		return text
+	})
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
+
+// showVenue replies with the venue of an event on a map, or with its
+// location as text if it was not located.
+func showVenue(bot *linebot.Client, event *linebot.Event, eventName string) *appError {
+	e, err := findEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+	if e.Coordinates == nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の開催場所は「%s」です。", e.EventName, e.Location))
+	}
+
+	message := linebot.NewLocationMessage(truncate(venueName(e), 100), truncate(e.Location, 100),
+		e.Coordinates.Latitude, e.Coordinates.Longitude)
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
+
+// venueName returns the venue of an event, or its location if the venue has
+// no name.
+func venueName(e *db.Event) string {
+	if e.Venue != "" {
+		return e.Venue
+	}
+	return e.Location
+}
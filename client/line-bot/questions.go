@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// answeringQuestions is the session state of a user answering the questions
+// of an event they join.
+const answeringQuestions = "answeringQuestions"
+
+const (
+	// skipAnswer skips an optional question.
+	skipAnswer = "スキップ"
+	// cancelAnswers stops joining the event.
+	cancelAnswers = "キャンセル"
+)
+
+// answerSeparators separate the options chosen in answer to a multiple
+// choice question.
+var answerSeparators = []string{"、", ",", "，"}
+
+// listQuestions returns the questions of a form of an event in the order they
+// are asked to a given user.
+func listQuestions(hostID, eventName, form, viewer string) ([]*db.Question, error) {
+	var questions []*db.Question
+	query := url.Values{"hostID": {hostID}, "eventName": {eventName}, "form": {form}, "viewer": {viewer}}
+	if err := getJSON("/event/questions?"+query.Encode(), &questions); err != nil {
+		return nil, err
+	}
+	return questions, nil
+}
+
+// startQuestions begins asking the questions of an event the user joins with
+// a given tier, whose fee is given. The user is applied once they answered
+// the last question.
+func startQuestions(bot *linebot.Client, event *linebot.Event, w http.ResponseWriter, req *http.Request, e *db.Event, tierName string, fee int64, questions []*db.Question) *appError {
+	userSession, err := SessionStore.New(req, event.Source.UserID)
+	if err != nil {
+		return appErrorf(err, "could not create session: %v", err)
+	}
+	userSession.Values["state"] = answeringQuestions
+	userSession.Values["hostID"] = e.HostID
+	userSession.Values["eventName"] = e.EventName
+	userSession.Values["currency"] = e.Currency
+	userSession.Values["tier"] = tierName
+	userSession.Values["fee"] = fee
+	userSession.Values["question"] = 0
+	userSession.Values["answers"] = "[]"
+	if err := userSession.Save(req, w); err != nil {
+		return appErrorf(err, "could not save session in startQuestions: %v", err)
+	}
+
+	intro := fmt.Sprintf("イベント「%s」の参加登録のため、%d件の質問にお答えください。\n途中でやめるには「%s」と送ってください。",
+		e.EventName, len(questions), cancelAnswers)
+	return askQuestion(bot, event, intro, questions, 0)
+}
+
+// answerQuestion records the user's answer to the question they were asked
+// last, and asks the next one. After the last question, the user is applied
+// to the event with their answers.
+func answerQuestion(bot *linebot.Client, event *linebot.Event, w http.ResponseWriter, req *http.Request, text string) *appError {
+	userSession, err := SessionStore.Get(req, event.Source.UserID)
+	if err != nil {
+		return appErrorf(err, "could not get session: %v", err)
+	}
+	if strings.TrimSpace(text) == cancelAnswers {
+		userSession.Options.MaxAge = -1
+		if err := userSession.Save(req, w); err != nil {
+			return appErrorf(err, "could not save session in answerQuestion: %v", err)
+		}
+		return replyText(bot, event, "参加登録を中止しました。")
+	}
+
+	e := &db.Event{}
+	e.HostID, _ = userSession.Values["hostID"].(string)
+	e.EventName, _ = userSession.Values["eventName"].(string)
+	e.Currency, _ = userSession.Values["currency"].(string)
+	tierName, _ := userSession.Values["tier"].(string)
+	fee, _ := userSession.Values["fee"].(int64)
+	index, _ := userSession.Values["question"].(int)
+	var answers []*db.Answer
+	if s, ok := userSession.Values["answers"].(string); ok {
+		if err := json.Unmarshal([]byte(s), &answers); err != nil {
+			return appErrorf(err, "could not decode answers: %v", err)
+		}
+	}
+
+	questions, err := listQuestions(e.HostID, e.EventName, db.FormRegistration, event.Source.UserID)
+	if err != nil {
+		return appErrorf(err, "could not get questions: %v", err)
+	}
+	if index < len(questions) {
+		q := questions[index]
+		answer, err := parseAnswer(q, text)
+		if err != nil {
+			return askQuestion(bot, event, err.Error(), questions, index)
+		}
+		if answer != nil {
+			answers = append(answers, answer)
+		}
+		index++
+	}
+
+	if index < len(questions) {
+		answersJSON, err := json.Marshal(answers)
+		if err != nil {
+			return appErrorf(err, "could not encode answers: %v", err)
+		}
+		userSession.Values["question"] = index
+		userSession.Values["answers"] = string(answersJSON)
+		if err := userSession.Save(req, w); err != nil {
+			return appErrorf(err, "could not save session in answerQuestion: %v", err)
+		}
+		return askQuestion(bot, event, "", questions, index)
+	}
+
+	userSession.Options.MaxAge = -1
+	if err := userSession.Save(req, w); err != nil {
+		return appErrorf(err, "could not save session in answerQuestion: %v", err)
+	}
+	return applyToEvent(bot, event, e, tierName, fee, answers)
+}
+
+// parseAnswer reads the answer to a question from a message. Options may be
+// chosen by their number. It returns nil if an optional question is skipped.
+func parseAnswer(q *db.Question, text string) (*db.Answer, error) {
+	text = strings.TrimSpace(text)
+	if text == skipAnswer && !q.Required {
+		return nil, nil
+	}
+
+	answer := &db.Answer{QuestionID: q.QuestionID}
+	switch q.Type {
+	case db.QuestionNumber:
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return nil, errors.New("数字で答えてください。")
+		}
+		answer.Values = []string{text}
+	case db.QuestionChoice:
+		option, ok := matchOption(q, text)
+		if !ok {
+			return nil, errors.New("選択肢から選んでください。")
+		}
+		answer.Values = []string{option}
+	case db.QuestionMultipleChoice:
+		fields := []string{text}
+		for _, sep := range answerSeparators {
+			var split []string
+			for _, f := range fields {
+				split = append(split, strings.Split(f, sep)...)
+			}
+			fields = split
+		}
+		chosen := make(map[string]bool)
+		for _, f := range fields {
+			if f = strings.TrimSpace(f); f == "" {
+				continue
+			}
+			option, ok := matchOption(q, f)
+			if !ok {
+				return nil, fmt.Errorf("「%s」は選択肢にありません。", f)
+			}
+			chosen[option] = true
+		}
+		if len(chosen) == 0 {
+			return nil, errors.New("選択肢から選んでください。")
+		}
+		// Keep the order of the options.
+		for _, o := range q.Options {
+			if chosen[o] {
+				answer.Values = append(answer.Values, o)
+			}
+		}
+	default:
+		if text == "" {
+			return nil, errors.New("回答を入力してください。")
+		}
+		answer.Values = []string{text}
+	}
+	return answer, nil
+}
+
+// matchOption returns the option of a question given by its text or number.
+func matchOption(q *db.Question, text string) (string, bool) {
+	for _, o := range q.Options {
+		if o == text {
+			return o, true
+		}
+	}
+	if n, err := strconv.Atoi(text); err == nil && n >= 1 && n <= len(q.Options) {
+		return q.Options[n-1], true
+	}
+	return "", false
+}
+
+// askQuestion replies with the question at a given index, after a given text
+// if it is not empty. Options of single choice questions and skipping
+// optional questions are offered as quick replies.
+func askQuestion(bot *linebot.Client, event *linebot.Event, text string, questions []*db.Question, index int) *appError {
+	q := questions[index]
+	var lines []string
+	if text != "" {
+		lines = append(lines, text, "")
+	}
+	label := fmt.Sprintf("Q%d/%d. %s", index+1, len(questions), q.Label)
+	if q.Required {
+		label += "（必須）"
+	}
+	lines = append(lines, label)
+	for i, o := range q.Options {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, o))
+	}
+	if q.Type == db.QuestionMultipleChoice {
+		lines = append(lines, "複数選ぶときは「、」で区切ってください。")
+	}
+
+	var buttons []*linebot.QuickReplyButton
+	if q.Type == db.QuestionChoice {
+		for _, o := range q.Options {
+			// Quick reply labels are limited to 20 characters.
+			buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewMessageAction(truncate(o, 20), o)))
+		}
+	}
+	if !q.Required {
+		buttons = append(buttons, linebot.NewQuickReplyButton("", linebot.NewMessageAction(skipAnswer, skipAnswer)))
+	}
+	// A message takes at most 13 quick reply buttons; the options are
+	// listed above anyway.
+	if len(buttons) > 13 {
+		buttons = nil
+	}
+
+	var message linebot.SendingMessage = linebot.NewTextMessage(strings.Join(lines, "\n"))
+	if len(buttons) > 0 {
+		message = linebot.NewTextMessage(strings.Join(lines, "\n")).WithQuickReplies(linebot.NewQuickReplyItems(buttons...))
+	}
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// linePusher sends reminders as LINE push messages.
+type linePusher struct {
+	bot *linebot.Client
+}
+
+func (p linePusher) Push(to, text string) error {
+	_, err := p.bot.PushMessage(to, linebot.NewTextMessage(text)).Do()
+	return err
+}
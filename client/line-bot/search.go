@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// maxCarouselColumns is the number of columns LINE allows in a carousel.
+const maxCarouselColumns = 10
+
+// searchEvents replies with a carousel of the events still taking
+// applications that match the keywords, best matches first.
+func searchEvents(bot *linebot.Client, event *linebot.Event, keywords string) *appError {
+	query := url.Values{}
+	query.Set("q", keywords)
+	query.Set("status", db.EventOpen)
+	query.Set("limit", fmt.Sprint(maxCarouselColumns))
+	query.Set("viewer", listViewer(event.Source))
+
+	var events []*db.Event
+	if err := getJSON("/event/search?"+query.Encode(), &events); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベントを検索できませんでした。\n%v", err))
+	}
+	if len(events) == 0 {
+		return replyText(bot, event, fmt.Sprintf("「%s」に一致する募集中のイベントは見つかりませんでした。", keywords))
+	}
+
+	recordViews(event.Source.UserID, events)
+	message := eventCarousel(fmt.Sprintf("「%s」の検索結果", keywords), events, func(e *db.Event) string {
+		return fmt.Sprintf("%s\n%s", e.Date, e.Location)
+	})
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
+
+// eventCarousel returns a carousel with a column for each event, showing its
+// name and a text. Each column has a button that sends "参加 <event name>".
+func eventCarousel(altText string, events []*db.Event, text func(*db.Event) string) *linebot.TemplateMessage {
+	columns := make([]*linebot.CarouselColumn, len(events))
+	for i, e := range events {
+		columns[i] = linebot.NewCarouselColumn(
+			"",
+			truncate(e.EventName, 40),
+			truncate(text(e), 60),
+			linebot.NewMessageAction("参加する", "参加 "+e.EventName),
+		)
+	}
+	return linebot.NewTemplateMessage(altText, linebot.NewCarouselTemplate(columns...))
+}
+
+// recordViews tells the server that the user was shown events, for the
+// analytics of their hosts. Failing to is only logged.
+func recordViews(userID string, events []*db.Event) {
+	formData := url.Values{"userID": {userID}}
+	for _, e := range events {
+		formData.Add("hostID", e.HostID)
+		formData.Add("eventName", e.EventName)
+	}
+	if err := postForm("/event/view", formData, nil); err != nil {
+		log.Print(err)
+	}
+}
+
+// truncate shortens s to at most n characters, as LINE rejects templates
+// with longer titles and texts.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
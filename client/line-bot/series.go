@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+)
+
+// repeatNames maps the words hosts use for a recurrence to the server's
+// "repeat" values.
+var repeatNames = map[string]string{
+	"毎週": "weekly",
+	"毎月": "monthly",
+}
+
+// carryKeyword asks for the participants of an occurrence to be carried over
+// to the next one.
+const carryKeyword = "固定メンバー"
+
+// repeatEvent turns an event the user hosts into a recurring series. The text
+// is "<event name> 毎週" or "<event name> 毎月", optionally followed by
+// "固定メンバー" to keep the same participants every time.
+func repeatEvent(bot *linebot.Client, event *linebot.Event, text string) *appError {
+	carry := false
+	if strings.HasSuffix(text, " "+carryKeyword) {
+		carry = true
+		text = strings.TrimSuffix(text, " "+carryKeyword)
+	}
+	i := strings.LastIndex(text, " ")
+	if i < 0 {
+		return replyText(bot, event, "「繰り返し <イベント名> 毎週」または「繰り返し <イベント名> 毎月」と送ってください。")
+	}
+	eventName, repeatName := text[:i], text[i+1:]
+	repeat, ok := repeatNames[repeatName]
+	if !ok {
+		return replyText(bot, event, fmt.Sprintf("「%s」は指定できません。「毎週」または「毎月」を指定してください。", repeatName))
+	}
+
+	formData := url.Values{}
+	formData.Set("hostID", event.Source.UserID)
+	formData.Set("actorID", event.Source.UserID)
+	formData.Set("seriesName", eventName)
+	formData.Set("fromEvent", eventName)
+	formData.Set("repeat", repeat)
+	formData.Set("carryParticipants", fmt.Sprint(carry))
+
+	var res struct {
+		Occurrences []struct {
+			EventName string
+			Date      string
+		} `json:"occurrences"`
+	}
+	if err := postForm("/series/register", formData, &res); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」を繰り返しイベントにできませんでした。\n%v", eventName, err))
+	}
+
+	lines := []string{fmt.Sprintf("イベント「%s」を%s開催するように登録しました。", eventName, repeatName)}
+	if carry {
+		lines = append(lines, "参加が確定したメンバーは次回にも自動で参加登録されます。")
+	}
+	lines = append(lines, "", "予定されている回:")
+	for _, o := range res.Occurrences {
+		lines = append(lines, fmt.Sprintf("・%s（%s）", o.EventName, o.Date))
+	}
+	return replyText(bot, event, strings.Join(lines, "\n"))
+}
@@ -22,10 +22,13 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/sessions"
 	"github.com/line/line-bot-sdk-go/linebot"
 	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/geo"
+	"github.com/shinyamizuno1008/hashbill/server/reminder"
 )
 
 var SessionStore sessions.Store
@@ -37,6 +40,10 @@ const (
 )
 
 func main() {
+	if err := db.Open(); err != nil {
+		log.Fatal(err)
+	}
+
 	bot, err := linebot.New(
 		Keys.ChannelSecret,
 		Keys.ChannelToken,
@@ -51,6 +58,10 @@ func main() {
 	}
 	SessionStore = cookieStore
 
+	// Push reminders about upcoming events and deadlines.
+	scheduler := reminder.New(db.DB, linePusher{bot: bot})
+	go scheduler.Run(nil)
+
 	// Setup HTTP Server for receiving requests from LINE platform
 	http.HandleFunc("/callback", func(w http.ResponseWriter, req *http.Request) {
 		events, err := bot.ParseRequest(req)
@@ -70,9 +81,39 @@ func main() {
 			if event.Source.UserID == ownerID {
 				return
 			}
+			switch event.Type {
+			case linebot.EventTypeJoin:
+				if err := joinGroup(bot, event); err != nil {
+					log.Print(err.Message)
+				}
+			case linebot.EventTypeLeave:
+				if err := leaveGroup(event); err != nil {
+					log.Print(err.Message)
+				}
+			case linebot.EventTypeMemberJoined:
+				if err := welcomeMembers(bot, event); err != nil {
+					log.Print(err.Message)
+				}
+			}
 			if event.Type == linebot.EventTypeMessage {
 				switch message := event.Message.(type) {
 				case *linebot.TextMessage:
+					// A user answering the questions of an event they join
+					// answers with whatever they send.
+					if userSession, err := SessionStore.Get(req, event.Source.UserID); err == nil && userSession.Values["state"] == answeringQuestions {
+						if err := answerQuestion(bot, event, w, req, message.Text); err != nil {
+							log.Print(err.Message)
+						}
+						continue
+					}
+					// Likewise for a user responding to the survey of an
+					// event.
+					if userSession, err := SessionStore.Get(req, event.Source.UserID); err == nil && userSession.Values["state"] == answeringFeedback {
+						if err := answerFeedback(bot, event, w, req, message.Text); err != nil {
+							log.Print(err.Message)
+						}
+						continue
+					}
 					if message.Text == "会員登録" {
 						if err := signupwithLINE(bot, event, w, req, message.Text); err != nil {
 							log.Fatal(err)
@@ -83,6 +124,121 @@ func main() {
 							log.Fatal(err)
 						}
 					}
+					if strings.HasPrefix(message.Text, "参加 ") {
+						if err := joinEvent(bot, event, w, req, strings.TrimPrefix(message.Text, "参加 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "チケット ") {
+						if err := showTicket(bot, event, strings.TrimPrefix(message.Text, "チケット ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "チェックイン ") {
+						if err := checkIn(bot, event, strings.TrimPrefix(message.Text, "チェックイン ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "精算 ") {
+						if err := showBill(bot, event, strings.TrimPrefix(message.Text, "精算 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "支払い状況 ") {
+						if err := showPayments(bot, event, strings.TrimPrefix(message.Text, "支払い状況 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "支払い済み ") {
+						if err := markPayment(bot, event, db.PaymentPaid, strings.TrimPrefix(message.Text, "支払い済み ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "支払い免除 ") {
+						if err := markPayment(bot, event, db.PaymentWaived, strings.TrimPrefix(message.Text, "支払い免除 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "参加者リスト ") {
+						if err := exportParticipants(bot, event, strings.TrimPrefix(message.Text, "参加者リスト ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "主催者 ") {
+						if err := showOrganizers(bot, event, strings.TrimPrefix(message.Text, "主催者 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "共同主催 ") {
+						if err := addOrganizer(bot, event, db.RoleCoHost, strings.TrimPrefix(message.Text, "共同主催 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "スタッフ ") {
+						if err := addOrganizer(bot, event, db.RoleStaff, strings.TrimPrefix(message.Text, "スタッフ ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "主催解除 ") {
+						if err := removeOrganizer(bot, event, strings.TrimPrefix(message.Text, "主催解除 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "変更 ") {
+						if err := editEvent(bot, event, strings.TrimPrefix(message.Text, "変更 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "中止 ") {
+						if err := cancelEvent(bot, event, strings.TrimPrefix(message.Text, "中止 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "公開範囲 ") {
+						if err := setVisibility(bot, event, strings.TrimPrefix(message.Text, "公開範囲 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "招待コード ") {
+						if err := createInvitation(bot, event, strings.TrimPrefix(message.Text, "招待コード ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "招待 ") {
+						if err := redeemInvitation(bot, event, strings.TrimPrefix(message.Text, "招待 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "アンケート ") {
+						if err := startFeedback(bot, event, w, req, strings.TrimPrefix(message.Text, "アンケート ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "アンケート結果 ") {
+						if err := showFeedback(bot, event, strings.TrimPrefix(message.Text, "アンケート結果 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "繰り返し ") {
+						if err := repeatEvent(bot, event, strings.TrimPrefix(message.Text, "繰り返し ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if message.Text == "イベント一覧" {
+						if err := showChatEvents(bot, event); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "場所 ") {
+						if err := showVenue(bot, event, strings.TrimPrefix(message.Text, "場所 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
+					if strings.HasPrefix(message.Text, "検索 ") {
+						if err := searchEvents(bot, event, strings.TrimPrefix(message.Text, "検索 ")); err != nil {
+							log.Print(err.Message)
+						}
+					}
 					if message.Text == "イベント登録" {
 						userSession, err := SessionStore.Get(req, event.Source.UserID)
 						if err != nil {
@@ -109,6 +265,20 @@ func main() {
 							log.Fatal(err)
 						}
 					}
+				case *linebot.LocationMessage:
+					userSession, err := SessionStore.Get(req, event.Source.UserID)
+					if err != nil {
+						log.Fatal(err)
+					}
+					if userSession.Values["state"] == "registeringEvent" && userSession.Values["step"] == "location" {
+						if err := registerEvent(bot, event, w, req, message.Address); err != nil {
+							log.Fatal(err)
+						}
+						continue
+					}
+					if err := showNearbyEvents(bot, event, message); err != nil {
+						log.Print(err.Message)
+					}
 				}
 			}
 		}
@@ -134,7 +304,7 @@ func signupwithLINE(bot *linebot.Client, event *linebot.Event, w http.ResponseWr
 	formData.Set("userID", userID)
 	formData.Add("userName", userName)
 
-	_, err = http.PostForm(serverUrl+"/signup", formData)
+	_, err = serverClient.PostForm(serverUrl+"/signup", formData)
 	if err != nil {
 		return appErrorf(err, "could not post user infor to the server: %v", err)
 	}
@@ -143,7 +313,7 @@ func signupwithLINE(bot *linebot.Client, event *linebot.Event, w http.ResponseWr
 }
 
 func showUser(bot *linebot.Client, event *linebot.Event) *appError {
-	res, err := http.Get(serverUrl + "/user/" + event.Source.UserID)
+	res, err := serverClient.Get(serverUrl + "/user/" + event.Source.UserID)
 	if err != nil {
 		return appErrorf(err, "could not get user info from the server: %v", err)
 	}
@@ -166,7 +336,7 @@ func showUser(bot *linebot.Client, event *linebot.Event) *appError {
 }
 
 func showEvents(bot *linebot.Client, event *linebot.Event) *appError {
-	res, err := http.Get(serverUrl + "/events")
+	res, err := serverClient.Get(serverUrl + "/events")
 	if err != nil {
 		return appErrorf(err, "could not get events info from the server: %v", err)
 	}
@@ -213,6 +383,8 @@ func registerEvent(bot *linebot.Client, event *linebot.Event, w http.ResponseWri
 		}
 
 		userSession.Values["hostID"] = event.Source.UserID
+		// Events registered in a group or room belong to it.
+		userSession.Values["groupID"] = chatID(event.Source)
 		userSession.Values["step"] = "eventName"
 
 		err = userSession.Save(req, w)
@@ -251,7 +423,7 @@ func registerEvent(bot *linebot.Client, event *linebot.Event, w http.ResponseWri
 	case "deadline":
 		userSession.Values["deadline"] = message
 
-		_, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(fmt.Sprintf(inputFormat, "開催場所"))).Do()
+		_, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(fmt.Sprintf(inputFormat, "開催場所")+"\n位置情報を送ると地図から会場を指定できます。")).Do()
 		if err != nil {
 			return appErrorf(err, "could not reply to user in deadline step: %v", err)
 		}
@@ -264,6 +436,17 @@ func registerEvent(bot *linebot.Client, event *linebot.Event, w http.ResponseWri
 		return nil
 	case "location":
 		userSession.Values["location"] = message
+		userSession.Values["venue"] = ""
+		delete(userSession.Values, "latitude")
+		delete(userSession.Values, "longitude")
+		if location, ok := event.Message.(*linebot.LocationMessage); ok {
+			if location.Address == "" {
+				userSession.Values["location"] = location.Title
+			}
+			userSession.Values["venue"] = location.Title
+			userSession.Values["latitude"] = location.Latitude
+			userSession.Values["longitude"] = location.Longitude
+		}
 
 		_, err = bot.ReplyMessage(event.ReplyToken, linebot.NewTextMessage(fmt.Sprintf(inputFormat, "参加者の上限"))).Do()
 		if err != nil {
@@ -359,8 +542,19 @@ func registerEvent(bot *linebot.Client, event *linebot.Event, w http.ResponseWri
 			Lottery:     lottery,
 			Description: userSession.Values["description"].(string),
 		}
+		eventDetail.HostID, _ = userSession.Values["hostID"].(string)
+		eventDetail.GroupID, _ = userSession.Values["groupID"].(string)
+		eventDetail.Venue, _ = userSession.Values["venue"].(string)
+		latitude, located := userSession.Values["latitude"].(float64)
+		longitude, _ := userSession.Values["longitude"].(float64)
+		if located {
+			eventDetail.Coordinates = &geo.Point{Latitude: latitude, Longitude: longitude}
+		}
+		if err := postForm("/event/register", eventForm(eventDetail), nil); err != nil {
+			return replyText(bot, event, fmt.Sprintf("イベント「%s」を登録できませんでした。\n%v", eventDetail.EventName, err))
+		}
 
-		flexMessage, err := replyEventTicket(bot, eventDetail)
+		flexMessage, err := replyEventTicket(bot, eventDetail, nil)
 		if err != nil {
 			return appErrorf(err, "%v", err)
 		}
@@ -412,7 +606,10 @@ func appErrorf(err error, format string, v ...interface{}) *appError {
 	}
 }
 
-func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessage, error) {
+// replyEventTicket renders an event as a Flex bubble. If a ticket is given,
+// the bubble shows its QR code, its tier, if any, and buttons to add the
+// event to a calendar.
+func replyEventTicket(bot *linebot.Client, event *db.Event, ticket *ticketResponse) (*linebot.FlexMessage, error) {
 	const eventFormat = `{
 		"type": "bubble",
 		"hero": {
@@ -433,7 +630,7 @@ func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessag
 		  "contents": [
 			{
 			  "type": "text",
-			  "text": %s, 
+			  "text": %s,
 			  "wrap": true,
 			  "weight": "bold",
 			  "gravity": "center",
@@ -496,7 +693,7 @@ func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessag
 				  "contents": [
 					{
 					  "type": "text",
-					  "text": 開催場所,
+					  "text": "開催場所",
 					  "color": "#aaaaaa",
 					  "size": "sm",
 					  "flex": 1
@@ -518,7 +715,7 @@ func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessag
 				  "contents": [
 					{
 					  "type": "text",
-					  "text": 上限,
+					  "text": "上限",
 					  "color": "#aaaaaa",
 					  "size": "sm",
 					  "flex": 1
@@ -526,7 +723,7 @@ func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessag
 					{
 					  "type": "text",
 					  "text": %s,
-					  "wrap": tdue,
+					  "wrap": true,
 					  "color": "#666666",
 					  "size": "sm",
 					  "flex": 3
@@ -576,7 +773,7 @@ func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessag
 					  "flex": 3
 					}
 				  ]
-				}
+				}%s
 			  ]
 			},
 			{
@@ -586,16 +783,10 @@ func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessag
 			  "contents": [
 				{
 				  "type": "spacer"
-				},
-				{
-				  "type": "image",
-				  "url": "https://scdn.line-apps.com/n/channel_devcenter/img/fx/linecorp_code_withborder.png",
-				  "aspectMode": "cover",
-				  "size": "xl"
-				},
+				},%s
 				{
 				  "type": "text",
-				  "text": "この表示されたものがあなたが参加しようとしているイベントのチケットとなります。",
+				  "text": %s,
 				  "color": "#aaaaaa",
 				  "wrap": true,
 				  "margin": "xxl",
@@ -604,14 +795,93 @@ func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessag
 			  ]
 			}
 		  ]
-		}
+		}%s
 	  }`
 
+	const qrCodeFormat = `
+				{
+				  "type": "image",
+				  "url": %s,
+				  "aspectMode": "cover",
+				  "size": "xl"
+				},`
+
+	const tierFormat = `,
+				{
+				  "type": "box",
+				  "layout": "baseline",
+				  "spacing": "sm",
+				  "contents": [
+					{
+					  "type": "text",
+					  "text": "チケット種別",
+					  "color": "#aaaaaa",
+					  "size": "sm",
+					  "flex": 1
+					},
+					{
+					  "type": "text",
+					  "text": %s,
+					  "wrap": true,
+					  "weight": "bold",
+					  "size": "sm",
+					  "flex": 3
+					}
+				  ]
+				}`
+
+	const footerFormat = `,
+		"footer": {
+		  "type": "box",
+		  "layout": "vertical",
+		  "spacing": "sm",
+		  "contents": [
+			{
+			  "type": "button",
+			  "style": "secondary",
+			  "height": "sm",
+			  "action": {
+				"type": "uri",
+				"label": "カレンダーに追加",
+				"uri": %s
+			  }
+			},
+			{
+			  "type": "button",
+			  "style": "link",
+			  "height": "sm",
+			  "action": {
+				"type": "uri",
+				"label": "参加予定を購読",
+				"uri": %s
+			  }
+			}
+		  ]
+		}`
+
 	// parse members max (int64) and lottery (bool) to string.
 	membersMax := strconv.FormatInt(event.MembersMax, 10)
 	lottery := strconv.FormatBool(event.Lottery)
 
-	eventJSON := []byte(fmt.Sprintf(eventFormat, event.EventName, event.Date, event.Deadline, event.Location, membersMax, lottery, event.Description))
+	// Only participants get a QR code; the host sees the event details.
+	qrCode := ""
+	note := "イベントの内容は以上です。"
+	tierRow := ""
+	footer := ""
+	if ticket != nil {
+		qrCode = fmt.Sprintf(qrCodeFormat, jsonString(ticket.QRURL))
+		note = "この表示されたものがあなたが参加しようとしているイベントのチケットとなります。受付でQRコードを提示してください。"
+		if ticket.Tier != "" {
+			tierRow = fmt.Sprintf(tierFormat, jsonString(ticket.Tier))
+		}
+		if ticket.CalendarURL != "" && ticket.FeedURL != "" {
+			footer = fmt.Sprintf(footerFormat, jsonString(ticket.CalendarURL), jsonString(ticket.FeedURL))
+		}
+	}
+
+	eventJSON := []byte(fmt.Sprintf(eventFormat, jsonString(event.EventName), jsonString(event.Date),
+		jsonString(event.Deadline), jsonString(event.Location), jsonString(membersMax), jsonString(lottery),
+		jsonString(event.Description), tierRow, qrCode, jsonString(note), footer))
 	container, err := linebot.UnmarshalFlexMessageJSON(eventJSON)
 	if err != nil {
 		return nil, fmt.Errorf("could not unmarshal flex message: %v", err)
@@ -620,3 +890,9 @@ func replyEventTicket(bot *linebot.Client, event *db.Event) (*linebot.FlexMessag
 	message := linebot.NewFlexMessage("Event ticket", container)
 	return message, nil
 }
+
+// jsonString quotes s as a JSON string to be embedded in a Flex message template.
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
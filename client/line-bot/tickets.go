@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+type tierResponse struct {
+	TierName  string
+	Price     int64
+	OnSale    bool  `json:"onSale"`
+	SeatsLeft int64 `json:"seatsLeft"`
+}
+
+// joinEvent applies the user to the event with a given name, which may be
+// followed by the name of a ticket tier. If the event has tiers and none was
+// given, the user is asked to pick one. If the event has questions, the user
+// is asked them first.
+func joinEvent(bot *linebot.Client, event *linebot.Event, w http.ResponseWriter, req *http.Request, text string) *appError {
+	eventName, tierName := text, ""
+	e, err := findChatEvent(event.Source, eventName)
+	if err != nil {
+		i := strings.LastIndex(text, " ")
+		if i < 0 {
+			return replyText(bot, event, err.Error())
+		}
+		eventName, tierName = text[:i], text[i+1:]
+		if e, err = findChatEvent(event.Source, eventName); err != nil {
+			return replyText(bot, event, err.Error())
+		}
+	}
+
+	var tiers []tierResponse
+	query := url.Values{"hostID": {e.HostID}, "eventName": {e.EventName}, "viewer": {event.Source.UserID}}
+	if err := getJSON("/event/tiers?"+query.Encode(), &tiers); err != nil {
+		return appErrorf(err, "could not get tiers: %v", err)
+	}
+	if len(tiers) > 0 && tierName == "" {
+		return askTier(bot, event, e, tiers)
+	}
+
+	fee := e.Fee
+	for _, t := range tiers {
+		if t.TierName == tierName {
+			fee = t.Price
+		}
+	}
+
+	if chatID(event.Source) != "" {
+		if err := ensureMember(bot, event); err != nil {
+			return replyText(bot, event, fmt.Sprintf("イベント「%s」に参加できませんでした。\n%v", eventName, err))
+		}
+	}
+
+	questions, err := listQuestions(e.HostID, e.EventName, db.FormRegistration, event.Source.UserID)
+	if err != nil {
+		return appErrorf(err, "could not get questions: %v", err)
+	}
+	if len(questions) > 0 {
+		return startQuestions(bot, event, w, req, e, tierName, fee, questions)
+	}
+	return applyToEvent(bot, event, e, tierName, fee, nil)
+}
+
+// applyToEvent applies the user to an event with a given tier, whose fee is
+// given, and their answers to the questions of the event.
+func applyToEvent(bot *linebot.Client, event *linebot.Event, e *db.Event, tierName string, fee int64, answers []*db.Answer) *appError {
+	eventName := e.EventName
+	formData := url.Values{}
+	formData.Set("hostID", e.HostID)
+	formData.Set("eventName", e.EventName)
+	formData.Set("userID", event.Source.UserID)
+	formData.Set("tier", tierName)
+	if len(answers) > 0 {
+		answersJSON, err := json.Marshal(answers)
+		if err != nil {
+			return appErrorf(err, "could not encode answers: %v", err)
+		}
+		formData.Set("answers", string(answersJSON))
+	}
+
+	var participant db.Participant
+	if err := postForm("/event/join", formData, &participant); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」に参加できませんでした。\n%v", eventName, err))
+	}
+
+	switch participant.Status {
+	case db.StatusConfirmed:
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」への参加が確定しました。\n「チケット %s」と送るとチケットを表示します。", eventName, eventName))
+	case db.StatusPendingPayment:
+		var charge struct {
+			PaymentURL string `json:"paymentURL"`
+		}
+		if err := postForm("/payment/charge", formData, &charge); err != nil {
+			return replyText(bot, event, fmt.Sprintf("イベント「%s」の参加費の支払いを開始できませんでした。\n%v", eventName, err))
+		}
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の席を確保しました。\n参加費 %s を以下のURLからお支払いいただくと参加が確定します。\n%s",
+			eventName, formatAmount(fee, e.Currency), charge.PaymentURL))
+	case db.StatusWaitlisted:
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」は定員に達しているため、キャンセル待ちに登録しました。", eventName))
+	default:
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」の抽選に申し込みました。結果をお待ちください。", eventName))
+	}
+}
+
+// askTier replies with a button for each ticket tier of an event on sale.
+func askTier(bot *linebot.Client, event *linebot.Event, e *db.Event, tiers []tierResponse) *appError {
+	var buttons []*linebot.QuickReplyButton
+	lines := []string{fmt.Sprintf("イベント「%s」のチケット種別を選んでください。", e.EventName)}
+	for _, t := range tiers {
+		if !t.OnSale {
+			continue
+		}
+		line := fmt.Sprintf("・%s %s", t.TierName, formatAmount(t.Price, e.Currency))
+		if t.SeatsLeft == 0 {
+			line += "（キャンセル待ち）"
+		}
+		lines = append(lines, line)
+		// Quick reply labels are limited to 20 characters.
+		label := []rune(t.TierName)
+		if len(label) > 20 {
+			label = label[:20]
+		}
+		buttons = append(buttons, linebot.NewQuickReplyButton("",
+			linebot.NewMessageAction(string(label), fmt.Sprintf("参加 %s %s", e.EventName, t.TierName))))
+	}
+	if len(buttons) == 0 {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」は現在チケットを販売していません。", e.EventName))
+	}
+
+	message := linebot.NewTextMessage(strings.Join(lines, "\n")).WithQuickReplies(linebot.NewQuickReplyItems(buttons...))
+	if _, err := bot.ReplyMessage(event.ReplyToken, message).Do(); err != nil {
+		return appErrorf(err, "could not reply to user: %v", err)
+	}
+	return nil
+}
+
+type ticketResponse struct {
+	Token       string `json:"token"`
+	QRURL       string `json:"qrURL"`
+	Tier        string `json:"tier"`
+	CalendarURL string `json:"calendarURL"`
+	FeedURL     string `json:"feedURL"`
+}
+
+// showTicket replies with the user's ticket for the event with a given name.
+func showTicket(bot *linebot.Client, event *linebot.Event, eventName string) *appError {
+	e, err := findEvent(event.Source.UserID, eventName)
+	if err != nil {
+		return replyText(bot, event, err.Error())
+	}
+
+	var ticket ticketResponse
+	path := fmt.Sprintf("/ticket/%s/%s/%s?%s", url.PathEscape(e.HostID), url.PathEscape(e.EventName), url.PathEscape(event.Source.UserID),
+		url.Values{"actorID": {event.Source.UserID}}.Encode())
+	if err := getJSON(path, &ticket); err != nil {
+		return replyText(bot, event, fmt.Sprintf("イベント「%s」のチケットはありません。", eventName))
+	}
+
+	flexMessage, err := replyEventTicket(bot, e, &ticket)
+	if err != nil {
+		return appErrorf(err, "%v", err)
+	}
+	_, err = bot.ReplyMessage(event.ReplyToken, flexMessage).Do()
+	if err != nil {
+		return appErrorf(err, "could not reply ticket to the user: %v", err)
+	}
+	return nil
+}
+
+type checkInResponse struct {
+	ParticipantID string `json:"participantID"`
+	UserName      string `json:"userName"`
+	EventName     string `json:"eventName"`
+	CheckedInAt   string `json:"checkedInAt"`
+}
+
+// checkIn checks in the holder of a scanned ticket token. The sender must
+// organize the event the ticket is for.
+func checkIn(bot *linebot.Client, event *linebot.Event, token string) *appError {
+	formData := url.Values{}
+	formData.Set("actorID", event.Source.UserID)
+	formData.Set("token", token)
+
+	var res checkInResponse
+	if err := postForm("/event/checkin", formData, &res); err != nil {
+		if serr, ok := err.(*serverError); ok {
+			switch serr.Code {
+			case http.StatusConflict:
+				return replyText(bot, event, "このチケットはすでに使用されています。")
+			case http.StatusForbidden:
+				return replyText(bot, event, "このチケットをチェックインする権限がありません。")
+			case http.StatusBadRequest:
+				return replyText(bot, event, "無効なチケットです。")
+			}
+		}
+		return replyText(bot, event, fmt.Sprintf("チェックインできませんでした。\n%v", err))
+	}
+
+	return replyText(bot, event, fmt.Sprintf("%s さんのイベント「%s」へのチェックインが完了しました。", res.UserName, res.EventName))
+}
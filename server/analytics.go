@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/analytics"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// recordActivity adds an entry to the history of an event, timed now. The
+// history only feeds analytics, so failing to record it does not fail the
+// request and is only logged.
+func recordActivity(a *db.Activity) {
+	if a.At == "" {
+		a.At = time.Now().In(db.Timezone).Format(db.TimeLayout)
+	}
+	if err := db.DB.AddActivity(a); err != nil {
+		log.Printf("could not record %s activity of %s on event %s: %v", a.Kind, a.UserID, a.EventName, err)
+	}
+}
+
+// recordPayment records money paid for, or refunded from, the fee of a
+// participant.
+func recordPayment(p *db.Payment, kind string, amount int64) {
+	recordActivity(&db.Activity{
+		HostID:    p.HostID,
+		EventName: p.EventName,
+		UserID:    p.ParticipantID,
+		Kind:      kind,
+		Amount:    amount,
+	})
+}
+
+// viewEventsHandler records that the user in "userID" was shown events they
+// may apply to. The events are given by the "hostID" and "eventName" values
+// at the same positions.
+func viewEventsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if err := r.ParseForm(); err != nil {
+		return appErrorf(err, "could not parse form: %v", err).withCode(http.StatusBadRequest)
+	}
+	hostIDs, eventNames := r.Form["hostID"], r.Form["eventName"]
+	if len(hostIDs) != len(eventNames) {
+		return appErrorf(nil, "%d host IDs given for %d events", len(hostIDs), len(eventNames)).withCode(http.StatusBadRequest)
+	}
+
+	userID := r.FormValue("userID")
+	for i := range hostIDs {
+		recordActivity(&db.Activity{
+			HostID:    hostIDs[i],
+			EventName: eventNames[i],
+			UserID:    userID,
+			Kind:      db.ActivityView,
+		})
+	}
+	return nil
+}
+
+// eventAnalyticsHandler shows the host and co-hosts of an event how it
+// performs.
+func eventAnalyticsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	res, err := eventAnalytics(event, time.Now())
+	if err != nil {
+		return appErrorf(err, "could not get activity from database: %v", err)
+	}
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode analytics: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// hostAnalyticsHandler shows a host how their events perform, altogether and
+// each. Only the host may see them.
+func hostAnalyticsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	hostID := r.FormValue("hostID")
+	if aerr := authorizeHost(r, hostID); aerr != nil {
+		return aerr
+	}
+	events, err := db.DB.ListEventsHostedBy(hostID)
+	if err != nil {
+		return appErrorf(err, "could not get events from database: %v", err)
+	}
+
+	now := time.Now()
+	perEvent := []*analytics.Event{}
+	for _, event := range events {
+		e, err := eventAnalytics(event, now)
+		if err != nil {
+			return appErrorf(err, "could not get activity from database: %v", err)
+		}
+		perEvent = append(perEvent, e)
+	}
+
+	resJSON, err := json.Marshal(analytics.Total(hostID, perEvent))
+	if err != nil {
+		return appErrorf(err, "could not encode analytics: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// eventAnalytics computes how an event performs from its history.
+func eventAnalytics(event *db.Event, now time.Time) (*analytics.Event, error) {
+	activity, err := db.DB.ListActivity(event.HostID, event.EventName)
+	if err != nil {
+		return nil, err
+	}
+	return analytics.Compute(event, activity, now), nil
+}
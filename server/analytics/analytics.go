@@ -0,0 +1,326 @@
+// Package analytics computes how events perform from their history, so that
+// past states, e.g. how long the waitlist once was, count as well as the
+// current one.
+package analytics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// dateLayout is the date part of db.TimeLayout, by which applications are
+// counted.
+const dateLayout = "2006-01-02"
+
+// Day counts the applications to events on a day.
+type Day struct {
+	Date         string `json:"date"`
+	Applications int    `json:"applications"`
+}
+
+// Event is how an event performs.
+type Event struct {
+	HostID    string `json:"hostID"`
+	EventName string `json:"eventName"`
+	Date      string `json:"date"`
+	Currency  string `json:"currency"`
+
+	// Held tells whether the event has started. Events that were cancelled
+	// are never held.
+	Held      bool `json:"held"`
+	Cancelled bool `json:"cancelled"`
+
+	// Views counts the times the event was shown to users; Viewers counts
+	// the users it was shown to.
+	Views   int `json:"views"`
+	Viewers int `json:"viewers"`
+
+	// Applications counts applications, including applying again after
+	// cancelling; Applicants counts the users who applied.
+	Applications int `json:"applications"`
+	Applicants   int `json:"applicants"`
+
+	// ConvertedViewers counts the viewers who applied after viewing the
+	// event, and Conversion is their share of the viewers.
+	ConvertedViewers int     `json:"convertedViewers"`
+	Conversion       float64 `json:"conversion"`
+
+	ApplicationsByDay []*Day `json:"applicationsByDay"`
+
+	// Waitlist is the length of the waitlist now, and PeakWaitlist the
+	// longest it has been.
+	Waitlist     int `json:"waitlist"`
+	PeakWaitlist int `json:"peakWaitlist"`
+
+	// CancellationRate is the share of applications that were cancelled.
+	Cancellations    int     `json:"cancellations"`
+	CancellationRate float64 `json:"cancellationRate"`
+
+	// Seated counts the participants who held a confirmed seat when the
+	// event started, or hold one now if it has not started yet.
+	// AttendanceRate is the share of them who checked in, and is 0 until
+	// the event started.
+	Seated         int     `json:"seated"`
+	CheckedIn      int     `json:"checkedIn"`
+	AttendanceRate float64 `json:"attendanceRate"`
+
+	// Revenue is the fees paid less those refunded, in Currency.
+	Revenue  int64 `json:"revenue"`
+	Refunded int64 `json:"refunded"`
+}
+
+// Host is how the events of a host perform altogether.
+type Host struct {
+	HostID string `json:"hostID"`
+
+	Views             int     `json:"views"`
+	Viewers           int     `json:"viewers"`
+	Applications      int     `json:"applications"`
+	ConvertedViewers  int     `json:"convertedViewers"`
+	Conversion        float64 `json:"conversion"`
+	ApplicationsByDay []*Day  `json:"applicationsByDay"`
+	Waitlist          int     `json:"waitlist"`
+	Cancellations     int     `json:"cancellations"`
+	CancellationRate  float64 `json:"cancellationRate"`
+	Seated            int     `json:"seated"`
+	CheckedIn         int     `json:"checkedIn"`
+	AttendanceRate    float64 `json:"attendanceRate"`
+
+	// Revenue maps currencies to the fees paid less those refunded.
+	Revenue map[string]int64 `json:"revenue"`
+
+	// Events are the events of the host, soonest first.
+	Events []*Event `json:"events"`
+}
+
+// Compute replays the history of an event, oldest first, as of a given time.
+func Compute(event *db.Event, activity []*db.Activity, now time.Time) *Event {
+	e := &Event{
+		HostID:    event.HostID,
+		EventName: event.EventName,
+		Date:      event.Date,
+		Currency:  event.Currency,
+		Cancelled: event.Cancelled(),
+	}
+
+	start, err := event.StartTime()
+	started := err == nil && !now.Before(start) && !event.Cancelled()
+	startAt := start.In(db.Timezone).Format(db.TimeLayout)
+
+	viewed := make(map[string]bool)
+	applied := make(map[string]bool)
+	converted := make(map[string]bool)
+	checkedIn := make(map[string]bool)
+	status := make(map[string]string)
+	byDay := make(map[string]int)
+	waiting := 0
+	seated := -1
+	for _, a := range activity {
+		if started && seated < 0 && a.At >= startAt {
+			seated = countStatus(status, db.StatusConfirmed)
+		}
+
+		switch a.Kind {
+		case db.ActivityView:
+			e.Views++
+			viewed[a.UserID] = true
+		case db.ActivityStatus:
+			previous, ok := status[a.UserID]
+			if !ok || previous == db.StatusCancelled {
+				e.Applications++
+				applied[a.UserID] = true
+				if viewed[a.UserID] {
+					converted[a.UserID] = true
+				}
+				if len(a.At) >= len(dateLayout) {
+					byDay[a.At[:len(dateLayout)]]++
+				}
+			}
+			if a.Status == db.StatusCancelled && ok && previous != db.StatusCancelled {
+				e.Cancellations++
+			}
+			if previous == db.StatusWaitlisted {
+				waiting--
+			}
+			if a.Status == db.StatusWaitlisted {
+				waiting++
+			}
+			if waiting > e.PeakWaitlist {
+				e.PeakWaitlist = waiting
+			}
+			status[a.UserID] = a.Status
+		case db.ActivityCheckIn:
+			checkedIn[a.UserID] = true
+		case db.ActivityPayment:
+			e.Revenue += a.Amount
+		case db.ActivityRefund:
+			e.Revenue -= a.Amount
+			e.Refunded += a.Amount
+		}
+	}
+	if seated < 0 {
+		seated = countStatus(status, db.StatusConfirmed)
+	}
+
+	e.Viewers = len(viewed)
+	e.Applicants = len(applied)
+	e.ConvertedViewers = len(converted)
+	e.Conversion = ratio(e.ConvertedViewers, e.Viewers)
+	e.ApplicationsByDay = days(byDay)
+	e.Waitlist = waiting
+	e.CancellationRate = ratio(e.Cancellations, e.Applications)
+	e.Seated = seated
+	e.CheckedIn = len(checkedIn)
+	e.Held = started
+	if started {
+		e.AttendanceRate = ratio(e.CheckedIn, e.Seated)
+	}
+	return e
+}
+
+// Total adds up how the events of a host perform.
+func Total(hostID string, events []*Event) *Host {
+	h := &Host{
+		HostID:  hostID,
+		Revenue: make(map[string]int64),
+		Events:  events,
+	}
+
+	byDay := make(map[string]int)
+	for _, e := range events {
+		h.Views += e.Views
+		h.Viewers += e.Viewers
+		h.Applications += e.Applications
+		h.ConvertedViewers += e.ConvertedViewers
+		for _, d := range e.ApplicationsByDay {
+			byDay[d.Date] += d.Applications
+		}
+		h.Waitlist += e.Waitlist
+		h.Cancellations += e.Cancellations
+		if e.Held {
+			// Only events that were held count towards attendance.
+			h.Seated += e.Seated
+			h.CheckedIn += e.CheckedIn
+		}
+		if e.Revenue != 0 {
+			h.Revenue[e.Currency] += e.Revenue
+		}
+	}
+	h.Conversion = ratio(h.ConvertedViewers, h.Viewers)
+	h.ApplicationsByDay = days(byDay)
+	h.CancellationRate = ratio(h.Cancellations, h.Applications)
+	h.AttendanceRate = ratio(h.CheckedIn, h.Seated)
+
+	sort.SliceStable(h.Events, func(i, j int) bool {
+		return h.Events[i].Date < h.Events[j].Date
+	})
+	return h
+}
+
+// Backfill adds the history of participants who have none to the history of
+// their events, as far as their current rows tell it: when they applied,
+// cancelled and checked in. It covers participants added before their
+// changes were recorded, and is safe to run again. It returns how many
+// entries it added.
+func Backfill(database db.EventListDatabase) (int, error) {
+	events, err := database.ListEvents()
+	if err != nil {
+		return 0, err
+	}
+	added := 0
+	for _, event := range events {
+		activity, err := database.ListActivity(event.HostID, event.EventName)
+		if err != nil {
+			return added, err
+		}
+		tracked := make(map[string]bool)
+		checkedIn := make(map[string]bool)
+		for _, a := range activity {
+			switch a.Kind {
+			case db.ActivityStatus:
+				tracked[a.UserID] = true
+			case db.ActivityCheckIn:
+				checkedIn[a.UserID] = true
+			}
+		}
+
+		participants, err := database.ListParticipantsHostedBy(event.HostID, event.EventName)
+		if err != nil {
+			return added, err
+		}
+		for _, p := range participants {
+			var history []*db.Activity
+			entry := func(kind, status, at string) {
+				history = append(history, &db.Activity{
+					HostID:    p.HostID,
+					EventName: p.EventName,
+					UserID:    p.ParticipantID,
+					Kind:      kind,
+					Status:    status,
+					At:        at,
+				})
+			}
+			if !tracked[p.ParticipantID] {
+				appliedAt := p.AppliedAt
+				if appliedAt == "" {
+					appliedAt = event.CreatedAt
+				}
+				if p.Status == db.StatusCancelled {
+					// What they held before cancelling is lost; that they
+					// applied is enough to count the cancellation.
+					entry(db.ActivityStatus, db.StatusApplied, appliedAt)
+					cancelledAt := p.CancelledAt
+					if cancelledAt == "" {
+						cancelledAt = appliedAt
+					}
+					entry(db.ActivityStatus, db.StatusCancelled, cancelledAt)
+				} else {
+					entry(db.ActivityStatus, p.Status, appliedAt)
+				}
+			}
+			if p.CheckedInAt != "" && !checkedIn[p.ParticipantID] {
+				entry(db.ActivityCheckIn, "", p.CheckedInAt)
+			}
+			for _, a := range history {
+				if err := database.AddActivity(a); err != nil {
+					return added, err
+				}
+				added++
+			}
+		}
+	}
+	return added, nil
+}
+
+// countStatus counts the users with a given status.
+func countStatus(status map[string]string, want string) int {
+	n := 0
+	for _, s := range status {
+		if s == want {
+			n++
+		}
+	}
+	return n
+}
+
+// days lists the applications counted per date, in order of date.
+func days(byDay map[string]int) []*Day {
+	list := []*Day{}
+	for date, n := range byDay {
+		list = append(list, &Day{Date: date, Applications: n})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date < list[j].Date
+	})
+	return list
+}
+
+// ratio returns n/d, or 0 if d is 0.
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
@@ -0,0 +1,126 @@
+// Package attendance records whether participants attended an event once it
+// is over and summarizes how reliably users show up.
+package attendance
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// EndDelay is how long after its start an event is considered over. Events
+// have no end time, so attendance is recorded this long after they start.
+const EndDelay = 6 * time.Hour
+
+// LateCancellation is how long before the start of an event a cancellation
+// counts as late.
+const LateCancellation = 24 * time.Hour
+
+// Outcome returns the attendance to record for a participant of an event
+// that started at start, or "" if there is nothing to record.
+func Outcome(p *db.Participant, start time.Time) string {
+	switch {
+	case p.CheckedInAt != "":
+		return db.AttendanceAttended
+	case p.Status == db.StatusConfirmed:
+		return db.AttendanceNoShow
+	case p.Status == db.StatusCancelled && p.CancelledAt != "":
+		cancelledAt, err := db.ParseTime(p.CancelledAt)
+		if err == nil && start.Sub(cancelledAt) < LateCancellation {
+			return db.AttendanceCancelledLate
+		}
+	}
+	return ""
+}
+
+// Record sets the attendance of every participant of events that are over
+// and have not been recorded yet. Nobody attends cancelled events, so their
+// participants are left alone.
+func Record(database db.EventListDatabase, now time.Time) error {
+	events, err := database.ListEvents()
+	if err != nil {
+		return fmt.Errorf("could not list events: %v", err)
+	}
+
+	for _, event := range events {
+		if event.Cancelled() {
+			continue
+		}
+		start, err := event.StartTime()
+		if err != nil || now.Before(start.Add(EndDelay)) {
+			continue
+		}
+
+		participants, err := database.ListParticipantsHostedBy(event.HostID, event.EventName)
+		if err != nil {
+			return fmt.Errorf("could not list participants of %s: %v", event.EventName, err)
+		}
+		for _, p := range participants {
+			if p.Attendance != "" {
+				continue
+			}
+			outcome := Outcome(p, start)
+			if outcome == "" {
+				continue
+			}
+			p.Attendance = outcome
+			if err := database.UpdateParticipant(p); err != nil {
+				return fmt.Errorf("could not record attendance of %s: %v", p.ParticipantID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Run records attendance every interval, forever.
+func Run(database db.EventListDatabase, interval time.Duration) {
+	for {
+		if err := Record(database, time.Now()); err != nil {
+			log.Printf("attendance: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Stats summarizes the attendance of a user over all events.
+type Stats struct {
+	Attended      int `json:"attended"`
+	NoShows       int `json:"noShows"`
+	CancelledLate int `json:"cancelledLate"`
+
+	// Reliability is the share of recorded events the user attended, from 0
+	// to 1. It is 1 for users with no recorded events.
+	Reliability float64 `json:"reliability"`
+}
+
+// StatsOf summarizes a user's participations.
+func StatsOf(participations []*db.Participant) Stats {
+	var s Stats
+	for _, p := range participations {
+		switch p.Attendance {
+		case db.AttendanceAttended:
+			s.Attended++
+		case db.AttendanceNoShow:
+			s.NoShows++
+		case db.AttendanceCancelledLate:
+			s.CancelledLate++
+		}
+	}
+
+	s.Reliability = 1
+	if total := s.Attended + s.NoShows + s.CancelledLate; total > 0 {
+		s.Reliability = float64(s.Attended) / float64(total)
+	}
+	return s
+}
+
+// UserStats looks up the participations of a user and summarizes them.
+func UserStats(database db.EventListDatabase, userID string) (Stats, error) {
+	participations, err := database.ListParticipationsOf(userID)
+	if err != nil {
+		return Stats{}, err
+	}
+	return StatsOf(participations), nil
+}
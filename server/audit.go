@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// requestIDHeader carries the ID of a request, which the audit log records
+// with the changes made in it. One is made up for requests without it.
+const requestIDHeader = "X-Request-ID"
+
+// withRequestID makes sure a request has an ID, and echoes it in the
+// response.
+func withRequestID(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(requestIDHeader)
+	if id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+		r.Header.Set(requestIDHeader, id)
+	}
+	w.Header().Set(requestIDHeader, id)
+}
+
+// requestActor returns the user a request acts for: the authenticated actor,
+// or else the user in "userID" or the host in "hostID", in that order.
+func requestActor(r *http.Request) string {
+	if actorID := actorFromForm(r); actorID != "" {
+		return actorID
+	}
+	for _, key := range []string{"userID", "hostID"} {
+		if actorID := r.FormValue(key); actorID != "" {
+			return actorID
+		}
+	}
+	return ""
+}
+
+// audited returns the database to change users, events, participants and
+// payments through in a request, so that the changes are recorded in the
+// audit log.
+func audited(r *http.Request) db.EventListDatabase {
+	return db.Audited(db.DB, requestActor(r), r.Header.Get(requestIDHeader))
+}
+
+type auditResponse struct {
+	AuditID   int64           `json:"auditID"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"requestID,omitempty"`
+	Entity    string          `json:"entity"`
+	Action    string          `json:"action"`
+	HostID    string          `json:"hostID,omitempty"`
+	EventName string          `json:"eventName,omitempty"`
+	UserID    string          `json:"userID,omitempty"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	Diff      json.RawMessage `json:"diff"`
+	At        string          `json:"at"`
+}
+
+// auditLogHandler shows the audit log, newest first, a page at a time. It
+// can be filtered by actor, request, kind of record, event, user and time.
+// Only administrators, who send the ADMIN_TOKEN as a bearer token, may see
+// it; without ADMIN_TOKEN nobody may.
+func auditLogHandler(w http.ResponseWriter, r *http.Request) *appError {
+	token := os.Getenv("ADMIN_TOKEN")
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		return appErrorf(nil, "administrators only").withCode(http.StatusForbidden)
+	}
+
+	limit, err := pageLimit(r)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	page, err := db.DB.QueryAudit(&db.AuditQuery{
+		Actor:     r.FormValue("actor"),
+		RequestID: r.FormValue("requestID"),
+		Entity:    r.FormValue("entity"),
+		HostID:    r.FormValue("hostID"),
+		EventName: r.FormValue("eventName"),
+		UserID:    r.FormValue("userID"),
+		From:      r.FormValue("from"),
+		To:        r.FormValue("to"),
+		Limit:     limit,
+		Cursor:    r.FormValue("cursor"),
+	})
+	if err == db.ErrInvalidCursor {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	if err != nil {
+		return appErrorf(err, "could not get audit log from database: %v", err)
+	}
+
+	res := []*auditResponse{}
+	for _, a := range page.Entries {
+		res = append(res, &auditResponse{
+			AuditID:   a.AuditID,
+			Actor:     a.Actor,
+			RequestID: a.RequestID,
+			Entity:    a.Entity,
+			Action:    a.Action,
+			HostID:    a.HostID,
+			EventName: a.EventName,
+			UserID:    a.UserID,
+			Before:    a.Before,
+			After:     a.After,
+			Diff:      a.Diff,
+			At:        a.At,
+		})
+	}
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode audit log: %v", err)
+	}
+	w.Header().Set(nextCursorHeader, page.NextCursor)
+	w.Write(resJSON)
+	return nil
+}
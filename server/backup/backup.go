@@ -0,0 +1,568 @@
+// Package backup dumps a database to a portable archive and restores it into
+// any EventListDatabase, e.g. to move data between MySQL and the in-memory
+// database or to seed a staging server.
+//
+// An archive is a stream of JSON lines. The first line is a header with the
+// version of the format, and every following line is one record:
+//
+//	{"version":9,"createdAt":"2019-06-01 10:00:00","sanitized":false}
+//	{"kind":"user","data":{"UserID":"U1","UserName":"Aoi"}}
+//	{"kind":"event","data":{"HostID":"U1","EventName":"BBQ",...}}
+//
+// Records are written in an order they can be restored in. An archive holds
+// users, events with their series, tiers, questions, revisions and activity,
+// participants with their payments and feedback, invitations and the guests
+// who redeemed them, expenses, notifications, tombstones, LINE groups and
+// organizers. Archives of earlier versions, which lack some of these, can
+// still be restored.
+//
+// The audit log is not archived: it belongs to the database it was recorded
+// in, and restoring an archive through a database that audits records the
+// restore itself.
+package backup
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// Version is the version of the archive format written by Dump.
+const Version = 9
+
+// Kinds of records.
+const (
+	KindUser         = "user"
+	KindEvent        = "event"
+	KindSeries       = "series"
+	KindTier         = "tier"
+	KindParticipant  = "participant"
+	KindPayment      = "payment"
+	KindExpense      = "expense"
+	KindNotification = "notification"
+	KindTombstone    = "tombstone"
+	KindGroup        = "group"
+	KindOrganizer    = "organizer"
+	KindInvitation   = "invitation"
+	KindGuest        = "guest"
+	KindQuestion     = "question"
+	KindFeedback     = "feedback"
+	KindActivity     = "activity"
+	KindRevision     = "revision"
+)
+
+// Header is the first line of an archive.
+type Header struct {
+	Version   int    `json:"version"`
+	CreatedAt string `json:"createdAt,omitempty"`
+
+	// Sanitized is set if user IDs and names were replaced.
+	Sanitized bool `json:"sanitized,omitempty"`
+}
+
+type record struct {
+	Kind string          `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Counts is how many records of each kind were dumped or restored.
+type Counts map[string]int
+
+// Options change what Dump writes.
+type Options struct {
+	// Sanitize replaces user and LINE group IDs with pseudonyms and user
+	// names with placeholders, and drops the charge and order IDs of payment
+	// providers, comments and free text answers to questions, so that a copy
+	// of production data can be used for staging.
+	// The same user gets the same pseudonym everywhere in the archive.
+	Sanitize bool
+}
+
+// Dump writes every record of a database to w. Tiers, questions, organizers,
+// invitations, guests, feedback, payments, expenses and activity are written
+// for existing events only.
+func Dump(w io.Writer, database db.EventListDatabase, opts Options) (Counts, error) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(Header{
+		Version:   Version,
+		CreatedAt: time.Now().In(db.Timezone).Format(db.TimeLayout),
+		Sanitized: opts.Sanitize,
+	}); err != nil {
+		return nil, err
+	}
+
+	s := newSanitizer(opts.Sanitize)
+	counts := Counts{}
+	write := func(kind string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		counts[kind]++
+		return enc.Encode(record{Kind: kind, Data: data})
+	}
+
+	groups, err := database.ListGroups()
+	if err != nil {
+		return nil, fmt.Errorf("could not list groups: %v", err)
+	}
+	for _, g := range groups {
+		g.GroupID = s.id(g.GroupID)
+		if err := write(KindGroup, g); err != nil {
+			return nil, err
+		}
+	}
+
+	users, err := database.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("could not list users: %v", err)
+	}
+	for _, u := range users {
+		s.user(u)
+		if err := write(KindUser, u); err != nil {
+			return nil, err
+		}
+	}
+
+	events, err := database.ListEvents()
+	if err != nil {
+		return nil, fmt.Errorf("could not list events: %v", err)
+	}
+	for _, e := range events {
+		hostID, eventName := e.HostID, e.EventName
+		e.HostID = s.id(e.HostID)
+		e.GroupID = s.id(e.GroupID)
+		if err := write(KindEvent, e); err != nil {
+			return nil, err
+		}
+
+		tiers, err := database.ListTiers(hostID, eventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list tiers of %s: %v", eventName, err)
+		}
+		for _, t := range tiers {
+			t.HostID = s.id(t.HostID)
+			if err := write(KindTier, t); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, form := range []string{db.FormRegistration, db.FormFeedback} {
+			questions, err := database.ListQuestions(hostID, eventName, form)
+			if err != nil {
+				return nil, fmt.Errorf("could not list questions of %s: %v", eventName, err)
+			}
+			for _, q := range questions {
+				s.question(q)
+				q.HostID = s.id(q.HostID)
+				if err := write(KindQuestion, q); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		organizers, err := database.ListOrganizers(hostID, eventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list organizers of %s: %v", eventName, err)
+		}
+		for _, o := range organizers {
+			o.HostID = s.id(o.HostID)
+			o.UserID = s.id(o.UserID)
+			o.AddedBy = s.id(o.AddedBy)
+			if err := write(KindOrganizer, o); err != nil {
+				return nil, err
+			}
+		}
+
+		invitations, err := database.ListInvitations(hostID, eventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list invitations of %s: %v", eventName, err)
+		}
+		for _, i := range invitations {
+			i.HostID = s.id(i.HostID)
+			i.CreatedBy = s.id(i.CreatedBy)
+			if err := write(KindInvitation, i); err != nil {
+				return nil, err
+			}
+		}
+
+		guests, err := database.ListGuests(hostID, eventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list guests of %s: %v", eventName, err)
+		}
+		for _, g := range guests {
+			g.HostID = s.id(g.HostID)
+			g.UserID = s.id(g.UserID)
+			if err := write(KindGuest, g); err != nil {
+				return nil, err
+			}
+		}
+
+		feedback, err := database.ListFeedback(hostID, eventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list feedback on %s: %v", eventName, err)
+		}
+		for _, f := range feedback {
+			f.HostID = s.id(f.HostID)
+			f.UserID = s.id(f.UserID)
+			s.feedback(f)
+			if err := write(KindFeedback, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	all, err := database.ListSeries()
+	if err != nil {
+		return nil, fmt.Errorf("could not list series: %v", err)
+	}
+	for _, series := range all {
+		series.HostID = s.id(series.HostID)
+		if err := write(KindSeries, series); err != nil {
+			return nil, err
+		}
+	}
+
+	participants, err := database.ListParticipants()
+	if err != nil {
+		return nil, fmt.Errorf("could not list participants: %v", err)
+	}
+	for _, p := range participants {
+		p.HostID = s.id(p.HostID)
+		p.ParticipantID = s.id(p.ParticipantID)
+		p.Answers = s.answers(p.HostID, p.EventName, p.Answers)
+		if err := write(KindParticipant, p); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range events {
+		payments, err := database.ListPayments(s.original(e.HostID), e.EventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list payments of %s: %v", e.EventName, err)
+		}
+		for _, p := range payments {
+			s.payment(p)
+			if err := write(KindPayment, p); err != nil {
+				return nil, err
+			}
+		}
+
+		expenses, err := database.ListExpenses(s.original(e.HostID), e.EventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list expenses of %s: %v", e.EventName, err)
+		}
+		for _, x := range expenses {
+			x.HostID = s.id(x.HostID)
+			x.PayerID = s.id(x.PayerID)
+			if err := write(KindExpense, x); err != nil {
+				return nil, err
+			}
+		}
+
+		activity, err := database.ListActivity(s.original(e.HostID), e.EventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list activity on %s: %v", e.EventName, err)
+		}
+		for _, a := range activity {
+			a.HostID = s.id(a.HostID)
+			a.UserID = s.id(a.UserID)
+			if err := write(KindActivity, a); err != nil {
+				return nil, err
+			}
+		}
+
+		revisions, err := database.ListRevisions(s.original(e.HostID), e.EventName)
+		if err != nil {
+			return nil, fmt.Errorf("could not list revisions of %s: %v", e.EventName, err)
+		}
+		for _, v := range revisions {
+			v.HostID = s.id(v.HostID)
+			v.EditorID = s.id(v.EditorID)
+			if err := write(KindRevision, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	notifications, err := database.ListNotifications()
+	if err != nil {
+		return nil, fmt.Errorf("could not list notifications: %v", err)
+	}
+	for _, n := range notifications {
+		n.HostID = s.id(n.HostID)
+		n.RecipientID = s.id(n.RecipientID)
+		if err := write(KindNotification, n); err != nil {
+			return nil, err
+		}
+	}
+
+	tombstones, err := database.ListTombstones()
+	if err != nil {
+		return nil, fmt.Errorf("could not list tombstones: %v", err)
+	}
+	for _, t := range tombstones {
+		t.HostID = s.id(t.HostID)
+		if err := write(KindTombstone, t); err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
+
+// sanitizer replaces user IDs and names. It does nothing if disabled.
+type sanitizer struct {
+	enabled bool
+	names   int
+
+	// originals maps pseudonyms back to user IDs.
+	originals map[string]string
+
+	// texts holds the free text questions of each event, keyed by the
+	// pseudonym of its host, its name and the question ID.
+	texts map[string]bool
+}
+
+func newSanitizer(enabled bool) *sanitizer {
+	return &sanitizer{enabled: enabled, originals: make(map[string]string), texts: make(map[string]bool)}
+}
+
+// id returns the pseudonym of a user ID.
+func (s *sanitizer) id(userID string) string {
+	if !s.enabled || userID == "" {
+		return userID
+	}
+	sum := sha256.Sum256([]byte(userID))
+	pseudonym := fmt.Sprintf("U%x", sum[:16])
+	s.originals[pseudonym] = userID
+	return pseudonym
+}
+
+// original returns the user ID a pseudonym was made from.
+func (s *sanitizer) original(pseudonym string) string {
+	if userID, ok := s.originals[pseudonym]; ok {
+		return userID
+	}
+	return pseudonym
+}
+
+func (s *sanitizer) user(u *db.User) {
+	if !s.enabled {
+		return
+	}
+	s.names++
+	u.UserID = s.id(u.UserID)
+	u.UserName = fmt.Sprintf("user%d", s.names)
+}
+
+// question remembers whether a question is answered with free text, which
+// answers drops. It must see a question before its host ID is replaced.
+func (s *sanitizer) question(q *db.Question) {
+	if !s.enabled || q.Type != db.QuestionText {
+		return
+	}
+	s.texts[fmt.Sprintf("%s\x00%s\x00%d", s.id(q.HostID), q.EventName, q.QuestionID)] = true
+}
+
+// answers drops the free text answers to the questions of an event, whose
+// host ID has been replaced, as they may tell who answered them.
+func (s *sanitizer) answers(hostID, eventName string, answers []*db.Answer) []*db.Answer {
+	if !s.enabled {
+		return answers
+	}
+	var kept []*db.Answer
+	for _, a := range answers {
+		if !s.texts[fmt.Sprintf("%s\x00%s\x00%d", hostID, eventName, a.QuestionID)] {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// feedback drops the comment and free text answers of a response whose IDs
+// have been replaced.
+func (s *sanitizer) feedback(f *db.Feedback) {
+	if !s.enabled {
+		return
+	}
+	f.Comment = ""
+	f.Answers = s.answers(f.HostID, f.EventName, f.Answers)
+}
+
+func (s *sanitizer) payment(p *db.Payment) {
+	if !s.enabled {
+		return
+	}
+	p.HostID = s.id(p.HostID)
+	p.ParticipantID = s.id(p.ParticipantID)
+	// UpdatedBy is either a user or a payment provider.
+	if p.UpdatedBy != p.Provider {
+		p.UpdatedBy = s.id(p.UpdatedBy)
+	}
+	p.ChargeID = ""
+	p.OrderID = ""
+}
+
+// Restore adds the records of an archive to a database, which should be
+// empty. It stops at the first record that cannot be added. Expenses get new
+// IDs. The history of events is restored from the archive rather than
+// recorded anew as participants are added.
+func Restore(r io.Reader, database db.EventListDatabase) (*Header, Counts, error) {
+	database = db.Untracked(database)
+	scanner := bufio.NewScanner(r)
+	// Descriptions of events may make lines longer than the default limit.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("backup: empty archive")
+	}
+	var h Header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		return nil, nil, fmt.Errorf("backup: invalid header: %v", err)
+	}
+	if h.Version < 1 || h.Version > Version {
+		return nil, nil, fmt.Errorf("backup: unsupported version %d", h.Version)
+	}
+
+	counts := Counts{}
+	for line := 2; scanner.Scan(); line++ {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return &h, counts, fmt.Errorf("backup: line %d: %v", line, err)
+		}
+		if err := restoreRecord(database, rec); err != nil {
+			return &h, counts, fmt.Errorf("backup: line %d: %v", line, err)
+		}
+		counts[rec.Kind]++
+	}
+	return &h, counts, scanner.Err()
+}
+
+func restoreRecord(database db.EventListDatabase, rec record) error {
+	switch rec.Kind {
+	case KindUser:
+		var u db.User
+		if err := json.Unmarshal(rec.Data, &u); err != nil {
+			return err
+		}
+		return database.AddUser(&u)
+	case KindEvent:
+		var e db.Event
+		if err := json.Unmarshal(rec.Data, &e); err != nil {
+			return err
+		}
+		return database.AddEvent(&e)
+	case KindSeries:
+		var s db.Series
+		if err := json.Unmarshal(rec.Data, &s); err != nil {
+			return err
+		}
+		return database.AddSeries(&s)
+	case KindTier:
+		var t db.Tier
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			return err
+		}
+		return database.AddTier(&t)
+	case KindQuestion:
+		var q db.Question
+		if err := json.Unmarshal(rec.Data, &q); err != nil {
+			return err
+		}
+		if q.Form == "" {
+			q.Form = db.FormRegistration
+		}
+		questions, err := database.ListQuestions(q.HostID, q.EventName, q.Form)
+		if err != nil {
+			return err
+		}
+		return database.SetQuestions(q.HostID, q.EventName, q.Form, append(questions, &q))
+	case KindParticipant:
+		var p db.Participant
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		if err := database.AddParticipant(&p); err != nil {
+			return err
+		}
+		// Adding a participant does not save their check-in, cancellation
+		// and attendance.
+		return database.UpdateParticipant(&p)
+	case KindPayment:
+		var p db.Payment
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		return database.SetPayment(&p)
+	case KindExpense:
+		var e db.Expense
+		if err := json.Unmarshal(rec.Data, &e); err != nil {
+			return err
+		}
+		return database.AddExpense(&e)
+	case KindNotification:
+		var n db.Notification
+		if err := json.Unmarshal(rec.Data, &n); err != nil {
+			return err
+		}
+		return database.AddNotification(&n)
+	case KindTombstone:
+		var t db.Tombstone
+		if err := json.Unmarshal(rec.Data, &t); err != nil {
+			return err
+		}
+		return database.AddTombstone(&t)
+	case KindGroup:
+		var g db.Group
+		if err := json.Unmarshal(rec.Data, &g); err != nil {
+			return err
+		}
+		return database.SetGroup(&g)
+	case KindOrganizer:
+		var o db.Organizer
+		if err := json.Unmarshal(rec.Data, &o); err != nil {
+			return err
+		}
+		return database.SetOrganizer(&o)
+	case KindInvitation:
+		var i db.Invitation
+		if err := json.Unmarshal(rec.Data, &i); err != nil {
+			return err
+		}
+		return database.AddInvitation(&i)
+	case KindGuest:
+		var g db.Guest
+		if err := json.Unmarshal(rec.Data, &g); err != nil {
+			return err
+		}
+		return database.AddGuest(&g)
+	case KindFeedback:
+		var f db.Feedback
+		if err := json.Unmarshal(rec.Data, &f); err != nil {
+			return err
+		}
+		return database.SetFeedback(&f)
+	case KindActivity:
+		var a db.Activity
+		if err := json.Unmarshal(rec.Data, &a); err != nil {
+			return err
+		}
+		return database.AddActivity(&a)
+	case KindRevision:
+		var v db.Revision
+		if err := json.Unmarshal(rec.Data, &v); err != nil {
+			return err
+		}
+		return database.AddRevision(&v)
+	}
+	return fmt.Errorf("unknown kind %q", rec.Kind)
+}
@@ -0,0 +1,237 @@
+// Package bill splits the expenses of an event among its participants and
+// works out who has to pay whom to settle up.
+package bill
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// Share is what a user paid for an event and what they owe of its expenses.
+type Share struct {
+	UserID string `json:"userID"`
+	Paid   int64  `json:"paid"`
+	Owes   int64  `json:"owes"`
+
+	// Balance is Paid minus Owes: positive if the user gets money back,
+	// negative if they have to pay.
+	Balance int64 `json:"balance"`
+}
+
+// Transfer is a payment from one user to another that settles their balances.
+type Transfer struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int64  `json:"amount"`
+}
+
+// Bill is the settlement of the expenses of an event in one currency.
+type Bill struct {
+	Currency  string      `json:"currency"`
+	Total     int64       `json:"total"`
+	Shares    []*Share    `json:"shares"`
+	Transfers []*Transfer `json:"transfers"`
+}
+
+// Compute splits the expenses of an event among its confirmed participants
+// using the event's split method. Expenses in different currencies are
+// settled separately, so one bill is returned per currency.
+func Compute(event *db.Event, participants []*db.Participant, expenses []*db.Expense) ([]*Bill, error) {
+	var members []*db.Participant
+	for _, p := range participants {
+		if p.Status == db.StatusConfirmed {
+			members = append(members, p)
+		}
+	}
+	if len(members) == 0 && len(expenses) > 0 {
+		return nil, fmt.Errorf("event %s has no confirmed participants to split expenses among", event.EventName)
+	}
+
+	byCurrency := make(map[string][]*db.Expense)
+	var currencies []string
+	for _, e := range expenses {
+		if _, ok := byCurrency[e.Currency]; !ok {
+			currencies = append(currencies, e.Currency)
+		}
+		byCurrency[e.Currency] = append(byCurrency[e.Currency], e)
+	}
+
+	var bills []*Bill
+	for _, currency := range currencies {
+		b, err := compute(event, members, currency, byCurrency[currency])
+		if err != nil {
+			return nil, err
+		}
+		bills = append(bills, b)
+	}
+	return bills, nil
+}
+
+func compute(event *db.Event, members []*db.Participant, currency string, expenses []*db.Expense) (*Bill, error) {
+	b := &Bill{Currency: currency}
+
+	shares := make(map[string]*Share)
+	share := func(userID string) *Share {
+		s, ok := shares[userID]
+		if !ok {
+			s = &Share{UserID: userID}
+			shares[userID] = s
+			b.Shares = append(b.Shares, s)
+		}
+		return s
+	}
+
+	for _, m := range members {
+		share(m.ParticipantID)
+	}
+	for _, e := range expenses {
+		share(e.PayerID).Paid += e.Amount
+		b.Total += e.Amount
+	}
+
+	owes, err := split(event, members, b.Total)
+	if err != nil {
+		return nil, err
+	}
+	for userID, amount := range owes {
+		share(userID).Owes += amount
+	}
+
+	balances := make(map[string]int64)
+	for _, s := range b.Shares {
+		s.Balance = s.Paid - s.Owes
+		balances[s.UserID] = s.Balance
+	}
+	b.Transfers = Settle(balances)
+	return b, nil
+}
+
+// split returns how much of total each member owes.
+func split(event *db.Event, members []*db.Participant, total int64) (map[string]int64, error) {
+	owes := make(map[string]int64)
+
+	switch event.SplitMethod {
+	case db.SplitFixed:
+		var collected int64
+		for _, m := range members {
+			owes[m.ParticipantID] = event.FixedShare
+			collected += event.FixedShare
+		}
+		// The host covers whatever the fixed shares do not, or keeps the surplus.
+		owes[event.HostID] += total - collected
+		return owes, nil
+	case db.SplitWeighted:
+		weights := make([]int64, len(members))
+		for i, m := range members {
+			weights[i] = m.ShareWeight
+			if weights[i] <= 0 {
+				weights[i] = 1
+			}
+		}
+		for i, amount := range apportion(total, weights) {
+			owes[members[i].ParticipantID] = amount
+		}
+		return owes, nil
+	case db.SplitEqual, "":
+		weights := make([]int64, len(members))
+		for i := range weights {
+			weights[i] = 1
+		}
+		for i, amount := range apportion(total, weights) {
+			owes[members[i].ParticipantID] = amount
+		}
+		return owes, nil
+	default:
+		return nil, fmt.Errorf("unknown split method %q", event.SplitMethod)
+	}
+}
+
+// apportion divides total in proportion to weights. Amounts are whole units;
+// the units left over by rounding down go to the largest remainders, so the
+// amounts always add up to total.
+func apportion(total int64, weights []int64) []int64 {
+	amounts := make([]int64, len(weights))
+	if len(weights) == 0 {
+		return amounts
+	}
+
+	var sum int64
+	for _, w := range weights {
+		sum += w
+	}
+
+	remainders := make([]int, len(weights))
+	var assigned int64
+	for i, w := range weights {
+		amounts[i] = total * w / sum
+		assigned += amounts[i]
+		remainders[i] = i
+	}
+	sort.SliceStable(remainders, func(a, b int) bool {
+		i, j := remainders[a], remainders[b]
+		return total*weights[i]%sum > total*weights[j]%sum
+	})
+	for k := int64(0); k < total-assigned; k++ {
+		amounts[remainders[int(k)%len(remainders)]]++
+	}
+	return amounts
+}
+
+// Settle returns transfers that bring every balance to zero. Users with
+// matching debts and credits are paired first; the rest are settled by
+// letting the largest debtor pay the largest creditor, which needs at most
+// one transfer fewer than the number of users with a balance.
+func Settle(balances map[string]int64) []*Transfer {
+	type account struct {
+		userID  string
+		balance int64
+	}
+	var creditors, debtors []*account
+	for userID, balance := range balances {
+		switch {
+		case balance > 0:
+			creditors = append(creditors, &account{userID, balance})
+		case balance < 0:
+			debtors = append(debtors, &account{userID, -balance})
+		}
+	}
+	byAmount := func(accounts []*account) {
+		sort.Slice(accounts, func(i, j int) bool {
+			if accounts[i].balance != accounts[j].balance {
+				return accounts[i].balance > accounts[j].balance
+			}
+			return accounts[i].userID < accounts[j].userID
+		})
+	}
+	byAmount(creditors)
+	byAmount(debtors)
+
+	var transfers []*Transfer
+	for _, d := range debtors {
+		for _, c := range creditors {
+			if c.balance > 0 && c.balance == d.balance {
+				transfers = append(transfers, &Transfer{From: d.userID, To: c.userID, Amount: d.balance})
+				c.balance, d.balance = 0, 0
+				break
+			}
+		}
+	}
+
+	for {
+		byAmount(creditors)
+		byAmount(debtors)
+		if len(creditors) == 0 || len(debtors) == 0 || creditors[0].balance == 0 || debtors[0].balance == 0 {
+			return transfers
+		}
+		c, d := creditors[0], debtors[0]
+		amount := c.balance
+		if d.balance < amount {
+			amount = d.balance
+		}
+		transfers = append(transfers, &Transfer{From: d.userID, To: c.userID, Amount: amount})
+		c.balance -= amount
+		d.balance -= amount
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shinyamizuno1008/hashbill/server/bill"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// defaultCurrency is the currency of expenses registered without one.
+const defaultCurrency = "JPY"
+
+// addExpenseHandler adds an expense paid by a user to an event. Only its host
+// and co-hosts may add expenses.
+func addExpenseHandler(w http.ResponseWriter, r *http.Request) *appError {
+	expense, err := expenseFromForm(r)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	event, err := db.DB.GetEvent(expense.HostID, expense.EventName)
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	if err := db.DB.AddExpense(expense); err != nil {
+		return appErrorf(err, "could not add expense: %v", err)
+	}
+
+	expenseJSON, err := json.Marshal(expense)
+	if err != nil {
+		return appErrorf(err, "could not encode expense: %v", err)
+	}
+	w.Write(expenseJSON)
+	return nil
+}
+
+// expenseFromForm populates the fields of an expense from form values.
+func expenseFromForm(r *http.Request) (*db.Expense, error) {
+	amount, err := strconv.ParseInt(r.FormValue("amount"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse amount: %v", err)
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive, got %d", amount)
+	}
+	currency := strings.ToUpper(r.FormValue("currency"))
+	if currency == "" {
+		currency = defaultCurrency
+	}
+
+	expense := &db.Expense{
+		HostID:      r.FormValue("hostID"),
+		EventName:   r.FormValue("eventName"),
+		PayerID:     r.FormValue("payerID"),
+		Amount:      amount,
+		Currency:    currency,
+		Description: r.FormValue("description"),
+	}
+	return expense, nil
+}
+
+// listExpensesHandler shows the expenses of an event. The expenses of private
+// events are only shown to the user in "viewer" if they may see the event.
+func listExpensesHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil || !canView(event, viewerFromForm(r)) {
+		return appErrorf(err, "could not find event %s", r.FormValue("eventName")).withCode(http.StatusNotFound)
+	}
+	expenses, err := db.DB.ListExpenses(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get expenses from database: %v", err)
+	}
+
+	expensesJSON, err := json.Marshal(expenses)
+	if err != nil {
+		return appErrorf(err, "could not encode expenses: %v", err)
+	}
+	w.Write(expensesJSON)
+	return nil
+}
+
+// deleteExpenseHandler removes an expense of an event by its ID. Only its
+// host and co-hosts may remove expenses.
+func deleteExpenseHandler(w http.ResponseWriter, r *http.Request) *appError {
+	expenseID, err := strconv.ParseInt(r.FormValue("expenseID"), 10, 64)
+	if err != nil {
+		return appErrorf(err, "could not parse expense ID: %v", err).withCode(http.StatusBadRequest)
+	}
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	if err := db.DB.DeleteExpense(event.HostID, event.EventName, expenseID); err != nil {
+		return appErrorf(err, "could not delete expense: %v", err).withCode(http.StatusNotFound)
+	}
+	return nil
+}
+
+// splitSettingsHandler sets how the expenses of an event are split. Weights
+// for the weighted method are given as repeated "weight" values of the form
+// "userID:weight".
+func splitSettingsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	switch method := r.FormValue("splitMethod"); method {
+	case db.SplitEqual, db.SplitWeighted:
+		event.SplitMethod = method
+	case db.SplitFixed:
+		fixedShare, err := strconv.ParseInt(r.FormValue("fixedShare"), 10, 64)
+		if err != nil {
+			return appErrorf(err, "could not parse fixed share: %v", err).withCode(http.StatusBadRequest)
+		}
+		event.SplitMethod = method
+		event.FixedShare = fixedShare
+	default:
+		return appErrorf(nil, "unknown split method %q", method).withCode(http.StatusBadRequest)
+	}
+	if err := audited(r).UpdateEvent(event); err != nil {
+		return appErrorf(err, "could not save event: %v", err)
+	}
+
+	for _, value := range r.Form["weight"] {
+		i := strings.LastIndex(value, ":")
+		if i < 0 {
+			return appErrorf(nil, "weight %q is not of the form userID:weight", value).withCode(http.StatusBadRequest)
+		}
+		weight, err := strconv.ParseInt(value[i+1:], 10, 64)
+		if err != nil || weight <= 0 {
+			return appErrorf(err, "invalid weight %q", value).withCode(http.StatusBadRequest)
+		}
+
+		participant, err := db.DB.GetParticipant(&db.Participant{
+			HostID:        event.HostID,
+			EventName:     event.EventName,
+			ParticipantID: value[:i],
+		})
+		if err != nil {
+			return appErrorf(err, "could not find participant: %v", err).withCode(http.StatusNotFound)
+		}
+		participant.ShareWeight = weight
+		if err := audited(r).UpdateParticipant(participant); err != nil {
+			return appErrorf(err, "could not save participant: %v", err)
+		}
+	}
+	return nil
+}
+
+type billResponse struct {
+	Bills []*bill.Bill `json:"bills"`
+
+	// Names maps the IDs of the users in the bills to their names.
+	Names map[string]string `json:"names"`
+}
+
+// getBillHandler shows each participant's share of the expenses of an event
+// and the transfers that settle them. Bills of private events are only shown
+// to the user in "viewer" if they may see the event.
+func getBillHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil || !canView(event, viewerFromForm(r)) {
+		return appErrorf(err, "could not find event %s", r.FormValue("eventName")).withCode(http.StatusNotFound)
+	}
+	participants, err := db.DB.ListParticipantsHostedBy(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get participants from database: %v", err)
+	}
+	expenses, err := db.DB.ListExpenses(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get expenses from database: %v", err)
+	}
+
+	bills, err := bill.Compute(event, participants, expenses)
+	if err != nil {
+		return appErrorf(err, "could not compute bill: %v", err).withCode(http.StatusBadRequest)
+	}
+
+	res := billResponse{Bills: bills, Names: make(map[string]string)}
+	for _, b := range bills {
+		for _, s := range b.Shares {
+			if user, err := db.DB.GetUser(s.UserID); err == nil {
+				res.Names[s.UserID] = user.UserName
+			}
+		}
+	}
+
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode bill: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/ical"
+)
+
+// eventICSHandler serves an event as an .ics file. A deleted event is served
+// as cancelled. Private events are only served to the users in "viewer" who
+// may see them.
+func eventICSHandler(w http.ResponseWriter, r *http.Request) *appError {
+	hostID := r.FormValue("hostID")
+	eventName := r.FormValue("eventName")
+
+	var entry *ical.Event
+	if event, err := db.DB.GetEvent(hostID, eventName); err == nil {
+		if !canView(event, viewerFromForm(r)) {
+			return appErrorf(nil, "could not find event %s", eventName).withCode(http.StatusNotFound)
+		}
+		entry, err = ical.FromEvent(event)
+		if err != nil {
+			return appErrorf(err, "could not read event date: %v", err)
+		}
+	} else if tombstone, err := db.DB.GetTombstone(hostID, eventName); err == nil {
+		entry, err = ical.FromTombstone(tombstone)
+		if err != nil {
+			return appErrorf(err, "could not read event date: %v", err)
+		}
+	} else {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s.ics", url.PathEscape(eventName)))
+	if err := ical.Write(w, eventName, []*ical.Event{entry}, time.Now()); err != nil {
+		return appErrorf(err, "could not write calendar: %v", err)
+	}
+	return nil
+}
+
+// userFeedHandler serves the calendar feed of a user: the events they host
+// and the events they have a seat in or applied for. Events that were deleted
+// or that the user cancelled are listed as cancelled, so that subscribed
+// calendars remove them.
+func userFeedHandler(w http.ResponseWriter, r *http.Request) *appError {
+	vars := mux.Vars(r)
+	userID := vars["userID"]
+	if !ticketSigner.VerifyFeedKey(userID, strings.TrimSuffix(vars["key"], ".ics")) {
+		return appErrorf(nil, "invalid feed key").withCode(http.StatusNotFound)
+	}
+
+	entries, err := userCalendar(userID)
+	if err != nil {
+		return appErrorf(err, "could not get calendar: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err := ical.Write(w, "hashbill", entries, time.Now()); err != nil {
+		return appErrorf(err, "could not write calendar: %v", err)
+	}
+	return nil
+}
+
+// userCalendar returns the calendar entries of a user.
+func userCalendar(userID string) ([]*ical.Event, error) {
+	var entries []*ical.Event
+	seen := make(map[string]bool)
+	add := func(e *ical.Event, err error) error {
+		if err != nil {
+			return err
+		}
+		uid := ical.UID(e.HostID, e.EventName)
+		if seen[uid] {
+			return nil
+		}
+		seen[uid] = true
+		e.URL = calendarURL(e.HostID, e.EventName, userID)
+		entries = append(entries, e)
+		return nil
+	}
+
+	hosted, err := db.DB.ListEventsHostedBy(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range hosted {
+		if err := add(ical.FromEvent(e)); err != nil {
+			return nil, err
+		}
+	}
+	tombstones, err := db.DB.ListTombstonesHostedBy(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tombstones {
+		if err := add(ical.FromTombstone(t)); err != nil {
+			return nil, err
+		}
+	}
+
+	participations, err := db.DB.ListParticipationsOf(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range participations {
+		if p.Status == db.StatusWaitlisted {
+			continue
+		}
+		event, err := db.DB.GetEvent(p.HostID, p.EventName)
+		if err != nil {
+			tombstone, err := db.DB.GetTombstone(p.HostID, p.EventName)
+			if err != nil {
+				continue
+			}
+			if err := add(ical.FromTombstone(tombstone)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entry, err := ical.FromEvent(event)
+		if err == nil && p.Status == db.StatusCancelled {
+			entry.Status = ical.StatusCancelled
+		}
+		if err := add(entry, err); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// calendarURL returns the URL of the .ics file of an event for a user, who
+// may need to see it if the event is private.
+func calendarURL(hostID, eventName, viewer string) string {
+	query := url.Values{"hostID": {hostID}, "eventName": {eventName}, "viewer": {viewer}}
+	return serverURL() + "/event/ics?" + query.Encode()
+}
+
+// feedURL returns the URL of the calendar feed of a user.
+func feedURL(userID string) string {
+	return fmt.Sprintf("%s/calendar/%s/%s.ics", serverURL(), url.PathEscape(userID), ticketSigner.FeedKey(userID))
+}
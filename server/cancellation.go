@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// cancelledError is the error of acting on an event that was cancelled.
+func cancelledError(event *db.Event) *appError {
+	return appErrorf(nil, "event %s was cancelled", event.EventName).withCode(http.StatusGone)
+}
+
+// cancelEventHandler calls off an event for the reason in "reason". Unlike a
+// deleted event, a cancelled event is kept, but it is no longer listed and
+// can no longer be joined, and its tickets are void. Its participants are
+// told, and the fees they paid are marked to be refunded along with the
+// cancellation. Only its owner may cancel it.
+func cancelEventHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	actorID, aerr := authorize(r, event, permOwn)
+	if aerr != nil {
+		return aerr
+	}
+	if event.Cancelled() {
+		return appErrorf(nil, "event %s has already been cancelled", event.EventName).withCode(http.StatusConflict)
+	}
+
+	payments, err := db.DB.ListPayments(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get payments from database: %v", err)
+	}
+	now := time.Now().In(db.Timezone).Format(db.TimeLayout)
+	event.CancelledAt = now
+	event.CancelReason = strings.TrimSpace(r.FormValue("reason"))
+	var refunds []*db.Payment
+	for _, p := range payments {
+		if p.Status != db.PaymentPaid {
+			continue
+		}
+		p.Status = db.PaymentRefundDue
+		p.UpdatedAt = now
+		p.UpdatedBy = actorID
+		refunds = append(refunds, p)
+	}
+	if err := audited(r).CancelEvent(event, refunds...); err != nil {
+		return appErrorf(err, "could not save event: %v", err)
+	}
+	for _, p := range refunds {
+		recordPayment(p, db.ActivityRefund, p.Amount)
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return appErrorf(err, "could not encode event: %v", err)
+	}
+	w.Write(eventJSON)
+	return nil
+}
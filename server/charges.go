@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/payment"
+)
+
+// paymentProvider collects fees. It is nil when hosts mark payments by hand.
+var paymentProvider payment.Provider
+
+// paymentHold is how long the seat of a participant who has to pay is held
+// for them. Seats that are not paid for by then are given to the waitlist.
+const paymentHold = time.Hour
+
+// configurePayments sets up the payment provider named by PAYMENT_PROVIDER:
+// "linepay", "fake" for the in-process fake, or empty for none.
+func configurePayments(r *mux.Router) {
+	callbackURL := serverURL() + "/payment/callback"
+
+	switch name := os.Getenv("PAYMENT_PROVIDER"); name {
+	case "":
+	case "linepay":
+		paymentProvider = payment.NewLinePay(payment.LinePayConfig{
+			ChannelID:     os.Getenv("LINE_PAY_CHANNEL_ID"),
+			ChannelSecret: os.Getenv("LINE_PAY_CHANNEL_SECRET"),
+			Sandbox:       os.Getenv("LINE_PAY_SANDBOX") != "",
+			ConfirmURL:    callbackURL,
+			CancelURL:     serverURL() + "/payment/cancelled",
+		})
+	case "fake":
+		fake := payment.NewFake("fake-webhook-secret", serverURL()+"/payment/fake/pay", callbackURL)
+		r.Methods("GET").Path("/payment/fake/pay").Handler(fake)
+		paymentProvider = fake
+	default:
+		log.Fatalf("unknown payment provider %q", name)
+	}
+}
+
+type chargeResponse struct {
+	PaymentURL string `json:"paymentURL"`
+}
+
+// chargeHandler starts collecting the fee of a participant through the
+// payment provider and returns the URL they pay at.
+func chargeHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if paymentProvider == nil {
+		return appErrorf(nil, "no payment provider is configured").withCode(http.StatusNotImplemented)
+	}
+
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if event.Cancelled() {
+		return cancelledError(event)
+	}
+	participant, err := db.DB.GetParticipant(&db.Participant{
+		HostID:        event.HostID,
+		EventName:     event.EventName,
+		ParticipantID: r.FormValue("userID"),
+	})
+	if err != nil {
+		return appErrorf(err, "could not find participant: %v", err).withCode(http.StatusNotFound)
+	}
+	if participant.Status != db.StatusPendingPayment && participant.Status != db.StatusConfirmed {
+		return appErrorf(nil, "participant %s has no seat to pay for", participant.ParticipantID).withCode(http.StatusBadRequest)
+	}
+	if previous, err := db.DB.GetPayment(event.HostID, event.EventName, participant.ParticipantID); err == nil && previous.Status != db.PaymentDue {
+		return appErrorf(nil, "the fee of participant %s is %s", participant.ParticipantID, previous.Status).withCode(http.StatusConflict)
+	}
+
+	fee, err := participantFee(event, participant)
+	if err != nil {
+		return appErrorf(err, "could not get fee: %v", err)
+	}
+
+	now := time.Now()
+	charge, err := paymentProvider.CreateCharge(&payment.Charge{
+		OrderID:     payment.NewOrderID(event.HostID, event.EventName, participant.ParticipantID, now),
+		Description: event.EventName,
+		Amount:      fee,
+		Currency:    event.Currency,
+	})
+	if err != nil {
+		return appErrorf(err, "could not create charge: %v", err)
+	}
+
+	if err := db.DB.SetPayment(&db.Payment{
+		HostID:        event.HostID,
+		EventName:     event.EventName,
+		ParticipantID: participant.ParticipantID,
+		Amount:        charge.Amount,
+		Currency:      charge.Currency,
+		Status:        db.PaymentDue,
+		UpdatedAt:     now.In(db.Timezone).Format(db.TimeLayout),
+		UpdatedBy:     paymentProvider.Name(),
+		Provider:      paymentProvider.Name(),
+		ChargeID:      charge.ID,
+		OrderID:       charge.OrderID,
+	}); err != nil {
+		return appErrorf(err, "could not save payment: %v", err)
+	}
+
+	resJSON, err := json.Marshal(chargeResponse{PaymentURL: charge.PaymentURL})
+	if err != nil {
+		return appErrorf(err, "could not encode charge: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// lookupCharge returns the charge of a payment record by its order ID.
+func lookupCharge(orderID string) (*payment.Charge, error) {
+	p, err := db.DB.GetPaymentByOrderID(orderID)
+	if err != nil {
+		return nil, payment.ErrUnknownCharge
+	}
+	return &payment.Charge{
+		ID:       p.ChargeID,
+		OrderID:  p.OrderID,
+		Amount:   p.Amount,
+		Currency: p.Currency,
+		Status:   payment.ChargePending,
+	}, nil
+}
+
+// paymentCallbackHandler handles the provider's notification that a payment
+// was completed. A participant whose seat was held gets it confirmed. If the
+// payment failed, the seat is released.
+func paymentCallbackHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if paymentProvider == nil {
+		return appErrorf(nil, "no payment provider is configured").withCode(http.StatusNotImplemented)
+	}
+
+	database := db.Audited(db.DB, paymentProvider.Name(), r.Header.Get(requestIDHeader))
+	charge, err := paymentProvider.HandleCallback(r, lookupCharge)
+	if err != nil {
+		// The payment could not be finished with the provider, so the seat
+		// held for it is given up rather than left until the hold expires.
+		if charge != nil && charge.Status == payment.ChargeFailed {
+			if err := abandonCharge(database, charge.OrderID); err != nil {
+				log.Printf("could not release seat of order %s: %v", charge.OrderID, err)
+			}
+		}
+		return appErrorf(err, "could not handle payment callback: %v", err).withCode(http.StatusBadRequest)
+	}
+	if charge.Status != payment.ChargeCaptured {
+		if charge.Status == payment.ChargeFailed {
+			if err := abandonCharge(database, charge.OrderID); err != nil {
+				return appErrorf(err, "could not release seat: %v", err)
+			}
+		}
+		fmt.Fprintln(w, "お支払いは完了していません。")
+		return nil
+	}
+
+	p, err := db.DB.GetPaymentByOrderID(charge.OrderID)
+	if err != nil {
+		return appErrorf(err, "could not find payment: %v", err)
+	}
+	participant, err := db.DB.GetParticipant(&db.Participant{
+		HostID:        p.HostID,
+		EventName:     p.EventName,
+		ParticipantID: p.ParticipantID,
+	})
+	if err != nil {
+		return appErrorf(err, "could not find participant: %v", err)
+	}
+	// The provider may notify a payment more than once, also after the fee
+	// was marked to be refunded. A fee paid for an event that was cancelled
+	// meanwhile, or for a seat that is no longer held, is to be refunded.
+	if p.Status != db.PaymentRefundDue && p.Status != db.PaymentRefunded {
+		wasPaid := p.Status == db.PaymentPaid
+		p.Status = db.PaymentPaid
+		if event, err := db.DB.GetEvent(p.HostID, p.EventName); err == nil && event.Cancelled() {
+			p.Status = db.PaymentRefundDue
+		}
+		if participant.Status == db.StatusCancelled {
+			p.Status = db.PaymentRefundDue
+		}
+		p.UpdatedAt = time.Now().In(db.Timezone).Format(db.TimeLayout)
+		p.UpdatedBy = paymentProvider.Name()
+		if err := db.DB.SetPayment(p); err != nil {
+			return appErrorf(err, "could not save payment: %v", err)
+		}
+		if !wasPaid {
+			recordPayment(p, db.ActivityPayment, p.Amount)
+		}
+		if p.Status == db.PaymentRefundDue {
+			recordPayment(p, db.ActivityRefund, p.Amount)
+		}
+	}
+
+	if participant.Status == db.StatusPendingPayment {
+		participant.Status = db.StatusConfirmed
+		if err := database.UpdateParticipant(participant); err != nil {
+			return appErrorf(err, "could not confirm participant: %v", err)
+		}
+	}
+
+	if p.Status == db.PaymentRefundDue {
+		fmt.Fprintf(w, "イベント「%s」の参加費は返金されます。\n", p.EventName)
+		return nil
+	}
+	fmt.Fprintf(w, "イベント「%s」の参加費のお支払いが完了しました。\n", p.EventName)
+	return nil
+}
+
+// paymentCancelledHandler is where the provider sends payers who cancelled.
+// Once the provider verified the request, the seat held for them is released.
+func paymentCancelledHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if paymentProvider == nil {
+		return appErrorf(nil, "no payment provider is configured").withCode(http.StatusNotImplemented)
+	}
+	charge, err := paymentProvider.HandleCancel(r, lookupCharge)
+	if err != nil {
+		return appErrorf(err, "could not handle cancelled payment: %v", err).withCode(http.StatusBadRequest)
+	}
+	database := db.Audited(db.DB, paymentProvider.Name(), r.Header.Get(requestIDHeader))
+	if err := abandonCharge(database, charge.OrderID); err != nil {
+		return appErrorf(err, "could not release seat: %v", err)
+	}
+	fmt.Fprintln(w, "お支払いをキャンセルしました。")
+	return nil
+}
+
+// abandonCharge releases the seat held for the participant whose charge with
+// a given order ID was not completed. Charges that were replaced by a newer
+// one, or whose fee was paid after all, are ignored.
+func abandonCharge(database db.EventListDatabase, orderID string) error {
+	p, err := db.DB.GetPaymentByOrderID(orderID)
+	if err != nil || p.Status != db.PaymentDue {
+		return nil
+	}
+	participant, err := db.DB.GetParticipant(&db.Participant{
+		HostID:        p.HostID,
+		EventName:     p.EventName,
+		ParticipantID: p.ParticipantID,
+	})
+	if err != nil {
+		return err
+	}
+	return releaseHold(database, participant, time.Now())
+}
+
+// releaseHold cancels the participation of a participant whose seat was held
+// until they pay, and gives the seat to the next participant on the
+// waitlist. Participants whose seat is not held are left alone.
+func releaseHold(database db.EventListDatabase, participant *db.Participant, now time.Time) error {
+	if participant.Status != db.StatusPendingPayment {
+		return nil
+	}
+	participant.Status = db.StatusCancelled
+	participant.CancelledAt = now.In(db.Timezone).Format(db.TimeLayout)
+	if err := database.UpdateParticipant(participant); err != nil {
+		return err
+	}
+
+	_, err := promoteFromWaitlist(database, participant.HostID, participant.EventName)
+	return err
+}
+
+// expireHolds releases the seats that were held longer than paymentHold
+// without being paid for. Seats held before it was recorded when they were
+// count from when the participant applied.
+func expireHolds(database db.EventListDatabase, now time.Time) error {
+	participants, err := database.ListParticipants()
+	if err != nil {
+		return fmt.Errorf("could not list participants: %v", err)
+	}
+	for _, p := range participants {
+		if p.Status != db.StatusPendingPayment {
+			continue
+		}
+		heldAt := p.HeldAt
+		if heldAt == "" {
+			heldAt = p.AppliedAt
+		}
+		held, err := db.ParseTime(heldAt)
+		if err != nil || now.Before(held.Add(paymentHold)) {
+			continue
+		}
+		if err := releaseHold(database, p, now); err != nil {
+			return fmt.Errorf("could not release seat of %s: %v", p.ParticipantID, err)
+		}
+	}
+	return nil
+}
+
+// runHoldExpiry releases expired seat holds every interval, forever.
+func runHoldExpiry(database db.EventListDatabase, interval time.Duration) {
+	for {
+		if err := expireHolds(database, time.Now()); err != nil {
+			log.Printf("payment: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// refundHandler lets the host or a co-host of an event refund the fee a
+// participant paid through the payment provider, including fees to be
+// refunded because the event was cancelled.
+func refundHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if paymentProvider == nil {
+		return appErrorf(nil, "no payment provider is configured").withCode(http.StatusNotImplemented)
+	}
+
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	actorID, aerr := authorize(r, event, permManage)
+	if aerr != nil {
+		return aerr
+	}
+	p, err := db.DB.GetPayment(event.HostID, event.EventName, r.FormValue("userID"))
+	if err != nil {
+		return appErrorf(err, "could not find payment: %v", err).withCode(http.StatusNotFound)
+	}
+	if p.Status != db.PaymentPaid && p.Status != db.PaymentRefundDue || p.ChargeID == "" || p.Provider != paymentProvider.Name() {
+		return appErrorf(nil, "the fee of participant %s was not paid through %s", p.ParticipantID, paymentProvider.Name()).withCode(http.StatusBadRequest)
+	}
+
+	if err := paymentProvider.Refund(&payment.Charge{
+		ID:       p.ChargeID,
+		OrderID:  p.OrderID,
+		Amount:   p.Amount,
+		Currency: p.Currency,
+		Status:   payment.ChargeCaptured,
+	}); err != nil {
+		return appErrorf(err, "could not refund payment: %v", err)
+	}
+
+	// A fee due to be refunded no longer counted from when it was marked.
+	wasPaid := p.Status == db.PaymentPaid
+	p.Status = db.PaymentRefunded
+	p.UpdatedAt = time.Now().In(db.Timezone).Format(db.TimeLayout)
+	p.UpdatedBy = actorID
+	if err := db.DB.SetPayment(p); err != nil {
+		return appErrorf(err, "could not save payment: %v", err)
+	}
+	if wasPaid {
+		recordPayment(p, db.ActivityRefund, p.Amount)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/payment"
+)
+
+func TestPaymentCallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		approve bool
+
+		// The statuses of alice, who pays for the only seat, and of bob, who
+		// waits for it, and of the fee of alice afterwards.
+		alice, bob, fee string
+	}{
+		{"approved", true, db.StatusConfirmed, db.StatusWaitlisted, db.PaymentPaid},
+		{"cancelled", false, db.StatusCancelled, db.StatusPendingPayment, db.PaymentDue},
+	}
+
+	database, provider := db.DB, paymentProvider
+	defer func() { db.DB, paymentProvider = database, provider }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db.DB = db.NewMemoryDB()
+			for _, id := range []string{"host", "alice", "bob"} {
+				if err := db.DB.AddUser(&db.User{UserID: id, UserName: id}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := db.DB.AddEvent(&db.Event{
+				HostID:     "host",
+				EventName:  "hash",
+				Date:       "2030-06-10 19:00:00",
+				MembersMax: 1,
+				Fee:        1000,
+				Currency:   "JPY",
+			}); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range []*db.Participant{
+				{ParticipantID: "alice", Status: db.StatusPendingPayment, AppliedAt: "2030-06-01 12:00:00", HeldAt: "2030-06-01 12:00:00"},
+				{ParticipantID: "bob", Status: db.StatusWaitlisted, AppliedAt: "2030-06-01 13:00:00"},
+			} {
+				p.HostID, p.EventName = "host", "hash"
+				if err := db.DB.AddParticipant(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := mux.NewRouter()
+			r.Methods("POST").Path("/payment/charge").Handler(appHandler(chargeHandler))
+			r.Methods("GET", "POST").Path("/payment/callback").Handler(appHandler(paymentCallbackHandler))
+			server := httptest.NewServer(r)
+			defer server.Close()
+			fake := payment.NewFake("secret", server.URL+"/payment/fake/pay", server.URL+"/payment/callback")
+			paymentProvider = fake
+
+			res, err := http.PostForm(server.URL+"/payment/charge", url.Values{
+				"hostID":    {"host"},
+				"eventName": {"hash"},
+				"userID":    {"alice"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var charged chargeResponse
+			err = json.NewDecoder(res.Body).Decode(&charged)
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK || err != nil {
+				t.Fatalf("charge failed with %s: %v", res.Status, err)
+			}
+			paymentURL, err := url.Parse(charged.PaymentURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := fake.Simulate(paymentURL.Query().Get("chargeID"), tt.approve); err != nil {
+				t.Fatal(err)
+			}
+
+			for userID, want := range map[string]string{"alice": tt.alice, "bob": tt.bob} {
+				p, err := db.DB.GetParticipant(&db.Participant{HostID: "host", EventName: "hash", ParticipantID: userID})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.Status != want {
+					t.Errorf("%s is %s, want %s", userID, p.Status, want)
+				}
+			}
+			fee, err := db.DB.GetPayment("host", "hash", "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fee.Status != tt.fee || fee.Amount != 1000 {
+				t.Errorf("fee of alice is %s of %d, want %s of 1000", fee.Status, fee.Amount, tt.fee)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/shinyamizuno1008/hashbill/server/analytics"
+	"github.com/shinyamizuno1008/hashbill/server/backup"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// migrateCommand brings the schema of the database up to date.
+func migrateCommand(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Parse(args)
+
+	applied, err := db.Migrate()
+	for _, name := range applied {
+		fmt.Printf("applied %s\n", name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("schema is up to date")
+	return nil
+}
+
+// backfillCommand records the history of participants who were added before
+// their changes were recorded, for analytics.
+func backfillCommand(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fs.Parse(args)
+
+	added, err := analytics.Backfill(db.DB)
+	fmt.Printf("added %d activity entries\n", added)
+	return err
+}
+
+// dumpCommand writes a backup archive of the database.
+func dumpCommand(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	out := fs.String("o", "", "file to write the archive to instead of standard output")
+	sanitize := fs.Bool("sanitize", false, "replace user IDs and names, e.g. for a staging copy")
+	fs.Parse(args)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	counts, err := backup.Dump(w, db.DB, backup.Options{Sanitize: *sanitize})
+	if err != nil {
+		return err
+	}
+	printCounts("dumped", counts)
+	return nil
+}
+
+// restoreCommand adds the records of a backup archive to the database.
+func restoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hashbill restore <archive>")
+		fmt.Fprintln(os.Stderr, "Use - to read the archive from standard input.")
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	header, counts, err := backup.Restore(r, db.DB)
+	if header != nil {
+		fmt.Fprintf(os.Stderr, "archive version %d created at %s\n", header.Version, header.CreatedAt)
+	}
+	printCounts("restored", counts)
+	return err
+}
+
+// printCounts prints how many records of each kind were dumped or restored,
+// to standard error so as not to mix with an archive on standard output.
+func printCounts(verb string, counts backup.Counts) {
+	var kinds []string
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(os.Stderr, "%s %d %s records\n", verb, counts[kind], kind)
+	}
+}
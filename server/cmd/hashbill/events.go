@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// eventsCommand lists, shows or deletes events.
+func eventsCommand(args []string) error {
+	fs := flag.NewFlagSet("events", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hashbill events list [-host hostID]")
+		fmt.Fprintln(os.Stderr, "       hashbill events show <hostID> <eventName>")
+		fmt.Fprintln(os.Stderr, "       hashbill events delete <hostID> <eventName>")
+		fs.PrintDefaults()
+	}
+	host := fs.String("host", "", "list: only events hosted by this user")
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+
+	switch {
+	case args[0] == "list" && fs.NArg() == 0:
+		return listEvents(*host)
+	case args[0] == "show" && fs.NArg() == 2:
+		return showEvent(fs.Arg(0), fs.Arg(1))
+	case args[0] == "delete" && fs.NArg() == 2:
+		return deleteEvent(fs.Arg(0), fs.Arg(1))
+	}
+	fs.Usage()
+	os.Exit(2)
+	return nil
+}
+
+func listEvents(hostID string) error {
+	var (
+		events []*db.Event
+		err    error
+	)
+	if hostID != "" {
+		events, err = db.DB.ListEventsHostedBy(hostID)
+	} else {
+		events, err = db.DB.ListEvents()
+	}
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST ID\tEVENT\tDATE\tLOCATION")
+	for _, e := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.HostID, e.EventName, e.Date, e.Location)
+	}
+	return tw.Flush()
+}
+
+func showEvent(hostID, eventName string) error {
+	event, err := db.DB.GetEvent(hostID, eventName)
+	if err != nil {
+		return err
+	}
+	participants, err := db.DB.ListParticipantsHostedBy(hostID, eventName)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Host ID:\t%s\n", event.HostID)
+	fmt.Fprintf(tw, "Event:\t%s\n", event.EventName)
+	fmt.Fprintf(tw, "Date:\t%s\n", event.Date)
+	fmt.Fprintf(tw, "Deadline:\t%s\n", event.Deadline)
+	fmt.Fprintf(tw, "Location:\t%s\n", event.Location)
+	fmt.Fprintf(tw, "Capacity:\t%d\n", event.MembersMax)
+	fmt.Fprintf(tw, "Lottery:\t%t\n", event.Lottery)
+	fmt.Fprintf(tw, "Fee:\t%d %s\n", event.Fee, event.Currency)
+	if event.SeriesName != "" {
+		fmt.Fprintf(tw, "Series:\t%s\n", event.SeriesName)
+	}
+	fmt.Fprintf(tw, "Participants:\t%d\n", len(participants))
+	for _, p := range participants {
+		fmt.Fprintf(tw, "\t%s\t%s\t%s\n", p.ParticipantID, p.Status, p.Tier)
+	}
+	return tw.Flush()
+}
+
+// deleteEvent deletes an event and its participants.
+func deleteEvent(hostID, eventName string) error {
+	if _, err := db.DB.GetEvent(hostID, eventName); err != nil {
+		return err
+	}
+	participants, err := db.DB.ListParticipantsHostedBy(hostID, eventName)
+	if err != nil {
+		return err
+	}
+	for _, p := range participants {
+		if err := db.DB.DeleteParticipant(p); err != nil {
+			return err
+		}
+	}
+	if err := db.DB.DeleteEvent(hostID, eventName); err != nil {
+		return err
+	}
+	fmt.Printf("deleted event %s and %d participants\n", eventName, len(participants))
+	return nil
+}
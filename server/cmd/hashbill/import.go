@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/importer"
+)
+
+// importCommand imports events and participants from CSV files. Errors of
+// rows are printed and the valid rows saved, unless -dry-run is given.
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	eventsPath := fs.String("events", "", "CSV file of events")
+	participantsPath := fs.String("participants", "", "CSV file of participants")
+	dryRun := fs.Bool("dry-run", false, "validate the files without saving anything")
+	fs.Parse(args)
+	if *eventsPath == "" && *participantsPath == "" {
+		return fmt.Errorf("-events or -participants is required")
+	}
+
+	var files [2]io.Reader
+	for i, path := range []string{*eventsPath, *participantsPath} {
+		if path == "" {
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files[i] = f
+	}
+
+	plan, err := importer.Prepare(db.DB, files[0], files[1])
+	if err != nil {
+		return err
+	}
+	for _, e := range plan.Errors {
+		fmt.Fprintln(os.Stderr, e)
+	}
+
+	verb := "imported"
+	if *dryRun {
+		verb = "would import"
+	} else if err := plan.Apply(db.DB); err != nil {
+		return err
+	}
+	fmt.Printf("%s %d events, %d users and %d participants; %d rows skipped\n",
+		verb, len(plan.Events), len(plan.Users), len(plan.Participants), len(plan.Errors))
+	return nil
+}
@@ -0,0 +1,83 @@
+// Command hashbill operates the hashbill database. It connects to the same
+// database as the server.
+//
+// Usage:
+//
+//	hashbill <command> [flags]
+//
+// Run a command with -h to see its flags.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// command is a subcommand of hashbill.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]*command{
+	"users":    {"list, show or delete users", usersCommand},
+	"events":   {"list, show or delete events", eventsCommand},
+	"move":     {"move participants to another event", moveCommand},
+	"lottery":  {"draw the seats of a lottery event", lotteryCommand},
+	"migrate":  {"bring the database schema up to date", migrateCommand},
+	"backfill": {"record the history of participants from their rows", backfillCommand},
+	"dump":     {"write a backup archive of the database", dumpCommand},
+	"restore":  {"restore a backup archive into the database", restoreCommand},
+	"import":   {"import events and participants from CSV files", importCommand},
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "hashbill: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if err := db.Open(); err != nil {
+		fmt.Fprintf(os.Stderr, "hashbill: %v\n", err)
+		os.Exit(1)
+	}
+	db.DB = db.Audited(db.DB, "cli:"+operator(), "")
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "hashbill %s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: hashbill <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].usage)
+	}
+}
+
+// operator returns the name of the user running the command, which the audit
+// log records as the actor of the changes it makes.
+func operator() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/lottery"
+)
+
+// moveCommand moves participants from one event to another. They keep their
+// status and application time, and their tier if the other event has it.
+func moveCommand(args []string) error {
+	fs := flag.NewFlagSet("move", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hashbill move -host hostID -from eventName -to eventName [-to-host hostID] <userID>...")
+		fs.PrintDefaults()
+	}
+	hostID := fs.String("host", "", "host of the event to move from")
+	from := fs.String("from", "", "event to move from")
+	to := fs.String("to", "", "event to move to")
+	toHostID := fs.String("to-host", "", "host of the event to move to, if not the same")
+	fs.Parse(args)
+	if *hostID == "" || *from == "" || *to == "" || fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *toHostID == "" {
+		*toHostID = *hostID
+	}
+
+	if _, err := db.DB.GetEvent(*hostID, *from); err != nil {
+		return err
+	}
+	if _, err := db.DB.GetEvent(*toHostID, *to); err != nil {
+		return err
+	}
+	tiers, err := db.DB.ListTiers(*toHostID, *to)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range fs.Args() {
+		p, err := db.DB.GetParticipant(&db.Participant{HostID: *hostID, EventName: *from, ParticipantID: userID})
+		if err != nil {
+			return err
+		}
+		moved := *p
+		moved.HostID, moved.EventName = *toHostID, *to
+		if moved.Tier != "" && !hasTier(tiers, moved.Tier) {
+			moved.Tier = ""
+		}
+		if _, err := db.DB.GetParticipant(&moved); err == nil {
+			return fmt.Errorf("user %s already joined event %s", userID, *to)
+		}
+
+		if err := db.DB.AddParticipant(&moved); err != nil {
+			return err
+		}
+		if err := db.DB.UpdateParticipant(&moved); err != nil {
+			return err
+		}
+		if err := db.DB.DeleteParticipant(p); err != nil {
+			return err
+		}
+		fmt.Printf("moved %s from %s to %s\n", userID, *from, *to)
+	}
+	return nil
+}
+
+func hasTier(tiers []*db.Tier, tierName string) bool {
+	for _, t := range tiers {
+		if t.TierName == tierName {
+			return true
+		}
+	}
+	return false
+}
+
+// lotteryCommand draws the seats of a lottery event, as its host would.
+func lotteryCommand(args []string) error {
+	fs := flag.NewFlagSet("lottery", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hashbill lottery [-seed n] <hostID> <eventName>")
+		fs.PrintDefaults()
+	}
+	seed := fs.Int64("seed", time.Now().UnixNano(), "seed of the draw, to repeat it")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	event, err := db.DB.GetEvent(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if !event.Lottery {
+		return fmt.Errorf("event %s is not decided by lottery", event.EventName)
+	}
+	// Seats are held until winners pay when the server collects fees, which
+	// it does when a payment provider is configured.
+	collectsFees := os.Getenv("PAYMENT_PROVIDER") != ""
+	winners, losers, err := lottery.DrawEvent(db.DB, event, rand.New(rand.NewSource(*seed)), collectsFees)
+	if err != nil {
+		return err
+	}
+	for _, p := range winners {
+		fmt.Printf("%s\t%s\n", p.Status, p.ParticipantID)
+	}
+	for _, p := range losers {
+		fmt.Printf("waitlisted\t%s\n", p.ParticipantID)
+	}
+	fmt.Printf("%d won, %d waitlisted\n", len(winners), len(losers))
+	return nil
+}
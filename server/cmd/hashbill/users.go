@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/shinyamizuno1008/hashbill/server/attendance"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// usersCommand lists, shows or deletes users.
+func usersCommand(args []string) error {
+	fs := flag.NewFlagSet("users", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: hashbill users list")
+		fmt.Fprintln(os.Stderr, "       hashbill users show <userID>")
+		fmt.Fprintln(os.Stderr, "       hashbill users delete [-force] <userID>")
+		fs.PrintDefaults()
+	}
+	force := fs.Bool("force", false, "delete: also remove the user's participations")
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+
+	switch {
+	case args[0] == "list" && fs.NArg() == 0:
+		return listUsers()
+	case args[0] == "show" && fs.NArg() == 1:
+		return showUser(fs.Arg(0))
+	case args[0] == "delete" && fs.NArg() == 1:
+		return deleteUser(fs.Arg(0), *force)
+	}
+	fs.Usage()
+	os.Exit(2)
+	return nil
+}
+
+func listUsers() error {
+	users, err := db.DB.ListUsers()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER ID\tNAME")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%s\t%s\n", u.UserID, u.UserName)
+	}
+	return tw.Flush()
+}
+
+func showUser(userID string) error {
+	user, err := db.DB.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	stats, err := attendance.UserStats(db.DB, userID)
+	if err != nil {
+		return err
+	}
+	hosted, err := db.DB.ListEventsHostedBy(userID)
+	if err != nil {
+		return err
+	}
+	participations, err := db.DB.ListParticipationsOf(userID)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "User ID:\t%s\n", user.UserID)
+	fmt.Fprintf(tw, "Name:\t%s\n", user.UserName)
+	fmt.Fprintf(tw, "Attendance:\t%d attended, %d no-shows, %d cancelled late\n", stats.Attended, stats.NoShows, stats.CancelledLate)
+	fmt.Fprintf(tw, "Hosts:\t%d events\n", len(hosted))
+	for _, e := range hosted {
+		fmt.Fprintf(tw, "\t%s\t%s\n", e.Date, e.EventName)
+	}
+	fmt.Fprintf(tw, "Joined:\t%d events\n", len(participations))
+	for _, p := range participations {
+		fmt.Fprintf(tw, "\t%s\t%s (%s)\n", p.Status, p.EventName, p.HostID)
+	}
+	return tw.Flush()
+}
+
+// deleteUser deletes a user. Users who host events must have them deleted
+// first; users who joined events only with force, which removes them from
+// the events.
+func deleteUser(userID string, force bool) error {
+	if _, err := db.DB.GetUser(userID); err != nil {
+		return err
+	}
+	hosted, err := db.DB.ListEventsHostedBy(userID)
+	if err != nil {
+		return err
+	}
+	if len(hosted) > 0 {
+		return fmt.Errorf("user %s hosts %d events; delete them first", userID, len(hosted))
+	}
+	participations, err := db.DB.ListParticipationsOf(userID)
+	if err != nil {
+		return err
+	}
+	if len(participations) > 0 && !force {
+		return fmt.Errorf("user %s joined %d events; use -force to remove them from the events", userID, len(participations))
+	}
+	for _, p := range participations {
+		if err := db.DB.DeleteParticipant(p); err != nil {
+			return err
+		}
+	}
+	if err := db.DB.DeleteUser(userID); err != nil {
+		return err
+	}
+	fmt.Printf("deleted user %s\n", userID)
+	return nil
+}
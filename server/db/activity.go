@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type activityDB struct {
+	*mysqlDB
+}
+
+// newMySQLActivityDB creates a new ActivityDatabase backed by a given MySQL server.
+func newMySQLActivityDB(config MySQLConfig) (*activityDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(activityTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	activityDB := &activityDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. addActivity)
+
+	if activityDB.list, err = conn.Prepare(listActivityStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in activity db: %v", err)
+	}
+	if activityDB.insert, err = conn.Prepare(insertActivityStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in activity db: %v", err)
+	}
+
+	return activityDB, nil
+}
+
+// scanActivity reads an entry of the history of an event from a sql.Row or sql.Rows
+func scanActivity(s rowScanner) (*Activity, error) {
+	var (
+		activityID int64
+		hostID     string
+		eventName  string
+		userID     string
+		kind       string
+		status     string
+		amount     int64
+		at         string
+	)
+	if err := s.Scan(&activityID, &hostID, &eventName, &userID, &kind, &status, &amount, &at); err != nil {
+		return nil, err
+	}
+
+	activity := &Activity{
+		ActivityID: activityID,
+		HostID:     hostID,
+		EventName:  eventName,
+		UserID:     userID,
+		Kind:       kind,
+		Status:     status,
+		Amount:     amount,
+		At:         at,
+	}
+	return activity, nil
+}
+
+const listActivityStatement = `
+	SELECT * FROM event_activity
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY at, activity_id
+`
+
+// ListActivity returns the history of a given event, oldest first.
+func (activityDB *activityDB) ListActivity(hostID, eventName string) ([]*Activity, error) {
+	rows, err := activityDB.list.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []*Activity
+	for rows.Next() {
+		entry, err := scanActivity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		activity = append(activity, entry)
+	}
+
+	return activity, nil
+}
+
+const insertActivityStatement = `
+	INSERT INTO event_activity (
+	host_id, event_name, user_id, kind, status, amount, at
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+// AddActivity saves a given entry and assigns its ID.
+func (activityDB *activityDB) AddActivity(a *Activity) error {
+	if a.HostID == "" || a.EventName == "" {
+		return errors.New("mysql: activity with unassigned event passed into addActivity")
+	}
+
+	r, err := execAffectingOneRow(activityDB.insert, a.HostID, a.EventName, a.UserID, a.Kind, a.Status, a.Amount, a.At)
+	if err != nil {
+		return err
+	}
+
+	lastInsertID, err := r.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("mysql: could not get last insert ID: %v", err)
+	}
+	a.ActivityID = lastInsertID
+	return nil
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type auditDB struct {
+	*mysqlDB
+}
+
+// newMySQLAuditDB creates a new AuditDatabase backed by a given MySQL server.
+func newMySQLAuditDB(config MySQLConfig) (*auditDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(auditTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	auditDB := &auditDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. addAudit)
+
+	if auditDB.insert, err = conn.Prepare(insertAuditStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in audit db: %v", err)
+	}
+	if auditDB.delete, err = conn.Prepare(deleteAuditStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare delete in audit db: %v", err)
+	}
+
+	return auditDB, nil
+}
+
+// scanAudit reads an entry of the audit log from a sql.Row or sql.Rows
+func scanAudit(s rowScanner) (*AuditEntry, error) {
+	var (
+		auditID   int64
+		actor     string
+		requestID string
+		entity    string
+		action    string
+		hostID    string
+		eventName string
+		userID    string
+		before    sql.NullString
+		after     sql.NullString
+		diff      sql.NullString
+		at        string
+	)
+	err := s.Scan(&auditID, &actor, &requestID, &entity, &action, &hostID, &eventName, &userID,
+		&before, &after, &diff, &at)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &AuditEntry{
+		AuditID:   auditID,
+		Actor:     actor,
+		RequestID: requestID,
+		Entity:    entity,
+		Action:    action,
+		HostID:    hostID,
+		EventName: eventName,
+		UserID:    userID,
+		Before:    rawJSON(before),
+		After:     rawJSON(after),
+		Diff:      rawJSON(diff),
+		At:        at,
+	}
+	return entry, nil
+}
+
+// rawJSON returns the JSON stored in a nullable column, or null.
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid || s.String == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s.String)
+}
+
+// QueryAudit returns a page of the entries matching a query, newest first.
+func (auditDB *auditDB) QueryAudit(q *AuditQuery) (*AuditPage, error) {
+	c, err := decodeCursor(q.Cursor, "", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	for _, filter := range []struct{ column, value string }{
+		{"actor", q.Actor},
+		{"request_id", q.RequestID},
+		{"entity", q.Entity},
+		{"host_id", q.HostID},
+		{"event_name", q.EventName},
+		{"user_id", q.UserID},
+	} {
+		if filter.value != "" {
+			where = append(where, filter.column+" = ?")
+			args = append(args, filter.value)
+		}
+	}
+	if q.From != "" {
+		where = append(where, "at >= ?")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where = append(where, "at < ?")
+		args = append(args, q.To)
+	}
+	if c != nil {
+		lastID, err := strconv.ParseInt(c.Key[0], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		where = append(where, "audit_id < ?")
+		args = append(args, lastID)
+	}
+
+	query := "SELECT * FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY audit_id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := auditDB.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not query audit log: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		entry, err := scanAudit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: could not read rows: %v", err)
+	}
+	return auditPage(entries, q.Limit), nil
+}
+
+const insertAuditStatement = `
+	INSERT INTO audit_log (
+	actor, request_id, entity, action, host_id, event_name, user_id, before_data, after_data, diff, at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+// AddAudit saves a given entry and assigns its ID.
+func (auditDB *auditDB) AddAudit(a *AuditEntry) error {
+	r, err := execAffectingOneRow(auditDB.insert, a.Actor, a.RequestID, a.Entity, a.Action,
+		a.HostID, a.EventName, a.UserID, nullJSON(a.Before), nullJSON(a.After), nullJSON(a.Diff), a.At)
+	if err != nil {
+		return err
+	}
+
+	lastInsertID, err := r.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("mysql: could not get last insert ID: %v", err)
+	}
+	a.AuditID = lastInsertID
+	return nil
+}
+
+const deleteAuditStatement = "DELETE FROM audit_log WHERE audit_id = ?"
+
+// DeleteAudit removes a given entry by its ID.
+func (auditDB *auditDB) DeleteAudit(auditID int64) error {
+	_, err := execAffectingOneRow(auditDB.delete, auditID)
+	return err
+}
+
+// nullJSON stores JSON null as SQL NULL.
+func nullJSON(v json.RawMessage) sql.NullString {
+	if len(v) == 0 || string(v) == "null" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(v), Valid: true}
+}
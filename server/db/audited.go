@@ -0,0 +1,411 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+// auditedDB records the changes made through it to users, events,
+// participants and payments in the audit log of the database it wraps, and
+// the changes to participants in the history of their events.
+type auditedDB struct {
+	EventListDatabase
+	actor     string
+	requestID string
+
+	// untracked is set if the history of events is not to be recorded.
+	untracked bool
+}
+
+// Audited returns a database that records every change made through it to
+// users, events, participants and payments in the audit log of inner, as
+// made by a given actor in the request with a given ID, which may be empty.
+// Changes of the status of participants and their check-ins are also
+// recorded in the history of their events, for analytics. Everything else
+// passes through to inner.
+func Audited(inner EventListDatabase, actor, requestID string) EventListDatabase {
+	return &auditedDB{EventListDatabase: inner, actor: actor, requestID: requestID}
+}
+
+// Untracked returns a database like database that does not record the
+// history of events, e.g. to restore a backup that contains the history
+// already. Changes are still audited if they were.
+func Untracked(database EventListDatabase) EventListDatabase {
+	if audited, ok := database.(*auditedDB); ok {
+		untracked := *audited
+		untracked.untracked = true
+		return &untracked
+	}
+	return database
+}
+
+// unwrap returns the database that database audits changes to, or database
+// itself if it does not.
+func unwrap(database EventListDatabase) EventListDatabase {
+	for {
+		audited, ok := database.(*auditedDB)
+		if !ok {
+			return database
+		}
+		database = audited.EventListDatabase
+	}
+}
+
+// track adds an entry to the history of an event if a participant of it,
+// before and after a change, changed their status or checked in. before is
+// nil if they were added; additions are timed when the participant applied.
+// The history only feeds analytics, so failing to record it is only logged.
+func (db *auditedDB) track(before, after *Participant) {
+	if db.untracked || after == nil {
+		return
+	}
+	a := &Activity{
+		HostID:    after.HostID,
+		EventName: after.EventName,
+		UserID:    after.ParticipantID,
+		At:        time.Now().In(Timezone).Format(TimeLayout),
+	}
+	switch {
+	case before == nil:
+		a.Kind = ActivityStatus
+		a.Status = after.Status
+		if after.AppliedAt != "" {
+			a.At = after.AppliedAt
+		}
+	case before.Status != after.Status:
+		a.Kind = ActivityStatus
+		a.Status = after.Status
+	case before.CheckedInAt == "" && after.CheckedInAt != "":
+		a.Kind = ActivityCheckIn
+		a.At = after.CheckedInAt
+	default:
+		return
+	}
+	if err := db.EventListDatabase.AddActivity(a); err != nil {
+		log.Printf("could not record %s activity of %s on event %s: %v", a.Kind, a.UserID, a.EventName, err)
+	}
+}
+
+// record adds an entry for a change to the audit log and returns its ID.
+// before and after are the record before and after the change, or nil if
+// it did not exist.
+func (db *auditedDB) record(entity, action, hostID, eventName, userID string, before, after interface{}) (int64, error) {
+	entry := &AuditEntry{
+		Actor:     db.actor,
+		RequestID: db.requestID,
+		Entity:    entity,
+		Action:    action,
+		HostID:    hostID,
+		EventName: eventName,
+		UserID:    userID,
+		At:        time.Now().In(Timezone).Format(TimeLayout),
+	}
+	var err error
+	if entry.Before, err = json.Marshal(before); err != nil {
+		return 0, fmt.Errorf("audit: could not encode %s: %v", entity, err)
+	}
+	if entry.After, err = json.Marshal(after); err != nil {
+		return 0, fmt.Errorf("audit: could not encode %s: %v", entity, err)
+	}
+	if entry.Diff, err = jsonDiff(entry.Before, entry.After); err != nil {
+		return 0, fmt.Errorf("audit: could not compare %s: %v", entity, err)
+	}
+	if err := db.EventListDatabase.AddAudit(entry); err != nil {
+		return 0, fmt.Errorf("audit: could not record %s of %s: %v", action, entity, err)
+	}
+	return entry.AuditID, nil
+}
+
+// audit adds an entry for a change to the audit log, then makes the change
+// with change and removes the entry again if it fails, so that the log
+// holds every change that was made and no other.
+func (db *auditedDB) audit(entity, action, hostID, eventName, userID string, before, after interface{}, change func() error) error {
+	auditID, err := db.record(entity, action, hostID, eventName, userID, before, after)
+	if err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		db.unrecord(auditID)
+		return err
+	}
+	return nil
+}
+
+// unrecord removes an entry for a change that could not be made from the
+// audit log. The change failed already, so failing to remove it is only
+// logged.
+func (db *auditedDB) unrecord(auditID int64) {
+	if err := db.EventListDatabase.DeleteAudit(auditID); err != nil {
+		log.Printf("audit: could not remove entry %d of a failed change: %v", auditID, err)
+	}
+}
+
+// jsonDiff maps the fields that differ between two JSON objects, either of
+// which may be null, to their values before and after.
+func jsonDiff(before, after json.RawMessage) (json.RawMessage, error) {
+	var was, now map[string]interface{}
+	if err := json.Unmarshal(before, &was); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &now); err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string][2]interface{})
+	for field, value := range was {
+		if !reflect.DeepEqual(value, now[field]) {
+			diff[field] = [2]interface{}{value, now[field]}
+		}
+	}
+	for field, value := range now {
+		if _, ok := was[field]; !ok {
+			diff[field] = [2]interface{}{nil, value}
+		}
+	}
+	return json.Marshal(diff)
+}
+
+// user returns a user as it is stored, or nil if there is none.
+func (db *auditedDB) user(userID string) *User {
+	u, err := db.EventListDatabase.GetUser(userID)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// event returns an event as it is stored, or nil if there is none.
+func (db *auditedDB) event(hostID, eventName string) *Event {
+	e, err := db.EventListDatabase.GetEvent(hostID, eventName)
+	if err != nil {
+		return nil
+	}
+	return e
+}
+
+// participant returns a participant as it is stored, or nil if there is none.
+func (db *auditedDB) participant(p *Participant) *Participant {
+	stored, err := db.EventListDatabase.GetParticipant(&Participant{
+		HostID:        p.HostID,
+		EventName:     p.EventName,
+		ParticipantID: p.ParticipantID,
+	})
+	if err != nil {
+		return nil
+	}
+	return stored
+}
+
+// payment returns the payment record of a participant as it is stored, or
+// nil if there is none.
+func (db *auditedDB) payment(p *Payment) *Payment {
+	stored, err := db.EventListDatabase.GetPayment(p.HostID, p.EventName, p.ParticipantID)
+	if err != nil {
+		return nil
+	}
+	return stored
+}
+
+// AddUser saves a given user.
+func (db *auditedDB) AddUser(u *User) error {
+	return db.audit(AuditUser, AuditAdd, "", "", u.UserID, nil, u, func() error {
+		return db.EventListDatabase.AddUser(u)
+	})
+}
+
+// UpdateUser updates the entry for a given user.
+func (db *auditedDB) UpdateUser(u *User) error {
+	return db.audit(AuditUser, AuditUpdate, "", "", u.UserID, db.user(u.UserID), u, func() error {
+		return db.EventListDatabase.UpdateUser(u)
+	})
+}
+
+// DeleteUser removes a given user by its ID.
+func (db *auditedDB) DeleteUser(userID string) error {
+	return db.audit(AuditUser, AuditDelete, "", "", userID, db.user(userID), nil, func() error {
+		return db.EventListDatabase.DeleteUser(userID)
+	})
+}
+
+// AddEvent saves a given event.
+func (db *auditedDB) AddEvent(e *Event) error {
+	return db.audit(AuditEvent, AuditAdd, e.HostID, e.EventName, "", nil, e, func() error {
+		return db.EventListDatabase.AddEvent(e)
+	})
+}
+
+// DeleteEvent removes a given event by its host and name.
+func (db *auditedDB) DeleteEvent(hostID, eventName string) error {
+	return db.audit(AuditEvent, AuditDelete, hostID, eventName, "", db.event(hostID, eventName), nil, func() error {
+		return db.EventListDatabase.DeleteEvent(hostID, eventName)
+	})
+}
+
+// DiscardEvent removes a given event without leaving a tombstone.
+func (db *auditedDB) DiscardEvent(hostID, eventName string) error {
+	return db.audit(AuditEvent, AuditDelete, hostID, eventName, "", db.event(hostID, eventName), nil, func() error {
+		return db.EventListDatabase.DiscardEvent(hostID, eventName)
+	})
+}
+
+// UpdateEvent updates the entry for a given event.
+func (db *auditedDB) UpdateEvent(e *Event) error {
+	return db.audit(AuditEvent, AuditUpdate, e.HostID, e.EventName, "", db.event(e.HostID, e.EventName), e, func() error {
+		return db.EventListDatabase.UpdateEvent(e)
+	})
+}
+
+// EditEvent updates the entry for a given event and saves given versions of
+// it, all or nothing.
+func (db *auditedDB) EditEvent(e *Event, revisions ...*Revision) error {
+	return db.audit(AuditEvent, AuditUpdate, e.HostID, e.EventName, "", db.event(e.HostID, e.EventName), e, func() error {
+		return db.EventListDatabase.EditEvent(e, revisions...)
+	})
+}
+
+// CancelEvent updates the entry for a given event and saves given payment
+// records of it, all or nothing.
+func (db *auditedDB) CancelEvent(e *Event, payments ...*Payment) error {
+	auditID, err := db.record(AuditEvent, AuditUpdate, e.HostID, e.EventName, "", db.event(e.HostID, e.EventName), e)
+	if err != nil {
+		return err
+	}
+	auditIDs := []int64{auditID}
+	unrecord := func() {
+		for _, auditID := range auditIDs {
+			db.unrecord(auditID)
+		}
+	}
+	for _, p := range payments {
+		before := db.payment(p)
+		action := AuditUpdate
+		if before == nil {
+			action = AuditAdd
+		}
+		auditID, err := db.record(AuditPayment, action, p.HostID, p.EventName, p.ParticipantID, before, p)
+		if err != nil {
+			unrecord()
+			return err
+		}
+		auditIDs = append(auditIDs, auditID)
+	}
+	if err := db.EventListDatabase.CancelEvent(e, payments...); err != nil {
+		unrecord()
+		return err
+	}
+	return nil
+}
+
+// AddParticipant saves a given participant of an event.
+func (db *auditedDB) AddParticipant(p *Participant) error {
+	err := db.audit(AuditParticipant, AuditAdd, p.HostID, p.EventName, p.ParticipantID, nil, p, func() error {
+		return db.EventListDatabase.AddParticipant(p)
+	})
+	if err != nil {
+		return err
+	}
+	db.track(nil, db.participant(p))
+	return nil
+}
+
+// DeleteParticipant removes a given participant of an event.
+func (db *auditedDB) DeleteParticipant(p *Participant) error {
+	return db.audit(AuditParticipant, AuditDelete, p.HostID, p.EventName, p.ParticipantID, db.participant(p), nil, func() error {
+		return db.EventListDatabase.DeleteParticipant(p)
+	})
+}
+
+// UpdateParticipant updates the entry for a given participant of an event.
+func (db *auditedDB) UpdateParticipant(p *Participant) error {
+	before := db.participant(p)
+	err := db.audit(AuditParticipant, AuditUpdate, p.HostID, p.EventName, p.ParticipantID, before, p, func() error {
+		return db.EventListDatabase.UpdateParticipant(p)
+	})
+	if err != nil {
+		return err
+	}
+	if before != nil {
+		db.track(before, db.participant(p))
+	}
+	return nil
+}
+
+// AllocateSeats calls allocate with the participants of an event and saves
+// the participants it returns.
+func (db *auditedDB) AllocateSeats(hostID, eventName string, allocate func(participants []*Participant) ([]*Participant, error)) error {
+	before := make(map[string]*Participant)
+	var changed []*Participant
+	var auditIDs []int64
+	err := db.EventListDatabase.AllocateSeats(hostID, eventName, func(participants []*Participant) ([]*Participant, error) {
+		for _, p := range participants {
+			stored := *p
+			before[p.ParticipantID] = &stored
+		}
+		var err error
+		if changed, err = allocate(participants); err != nil {
+			return nil, err
+		}
+		for _, p := range changed {
+			var auditID int64
+			if stored, ok := before[p.ParticipantID]; ok {
+				auditID, err = db.record(AuditParticipant, AuditUpdate, hostID, eventName, p.ParticipantID, stored, p)
+			} else {
+				auditID, err = db.record(AuditParticipant, AuditAdd, hostID, eventName, p.ParticipantID, nil, p)
+			}
+			if err != nil {
+				return nil, err
+			}
+			auditIDs = append(auditIDs, auditID)
+		}
+		return changed, nil
+	})
+	if err != nil {
+		for _, auditID := range auditIDs {
+			db.unrecord(auditID)
+		}
+		return err
+	}
+
+	for _, p := range changed {
+		db.track(before[p.ParticipantID], db.participant(p))
+	}
+	return nil
+}
+
+// SetPayment saves a given payment record, replacing any previous record of
+// the same participant.
+func (db *auditedDB) SetPayment(p *Payment) error {
+	before := db.payment(p)
+	action := AuditUpdate
+	if before == nil {
+		action = AuditAdd
+	}
+	return db.audit(AuditPayment, action, p.HostID, p.EventName, p.ParticipantID, before, p, func() error {
+		return db.EventListDatabase.SetPayment(p)
+	})
+}
+
+// CheckInParticipant records that a given participant arrived at the venue
+// at a given time.
+func (db *auditedDB) CheckInParticipant(p *Participant, at string) error {
+	before := db.participant(p)
+	var after *Participant
+	if before != nil {
+		checkedIn := *before
+		checkedIn.CheckedInAt = at
+		after = &checkedIn
+	}
+	err := db.audit(AuditParticipant, AuditCheckIn, p.HostID, p.EventName, p.ParticipantID, before, after, func() error {
+		return db.EventListDatabase.CheckInParticipant(p, at)
+	})
+	if err != nil {
+		return err
+	}
+	if before != nil {
+		db.track(before, after)
+	}
+	return nil
+}
@@ -2,22 +2,36 @@ package db
 
 import (
 	"context"
-	"log"
 	"os"
 
 	"cloud.google.com/go/storage"
 )
 
 var (
+	// DB is the database opened by Open.
 	DB EventListDatabase
 
+	// mysqlConfig is the configuration DB was opened with.
+	mysqlConfig MySQLConfig
+
 	StorageBucket     *storage.BucketHandle
 	StorageBucketName string
 )
 
-func init() {
+// Open connects DB to the Cloud SQL database and StorageBucket to Cloud
+// Storage. Programs call it before anything else; packages that are only
+// imported, e.g. by tests, do not connect anywhere.
+func Open() error {
 	var err error
 
+	// HASHBILL_DB=memory keeps the database in memory instead, e.g. to run
+	// the server without MySQL. Cloud Storage is not configured either, so
+	// tickets need TICKET_DIR.
+	if os.Getenv("HASHBILL_DB") == "memory" {
+		DB = NewMemoryDB()
+		return nil
+	}
+
 	DB, err = configureCloudSQL(cloudSQLConfig{
 		// The connection name of the Cloud SQL v2 instance, i.e.,
 		// "project:region:instance-id"
@@ -28,16 +42,12 @@ func init() {
 	})
 
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	StorageBucketName = "user-infor"
 	StorageBucket, err = configureStorage(StorageBucketName)
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
+	return err
 }
 
 type cloudSQLConfig struct {
@@ -56,18 +66,29 @@ func configureStorage(bucketID string) (*storage.BucketHandle, error) {
 func configureCloudSQL(config cloudSQLConfig) (EventListDatabase, error) {
 	if os.Getenv("GAE_INSTANCE") != "" {
 		// Running in production.
-		return newMySQLDB(MySQLConfig{
+		mysqlConfig = MySQLConfig{
 			Username:   config.Username,
 			Password:   config.Password,
 			UnixSocket: "/cloudsql/" + config.Instance,
-		})
+		}
+	} else {
+		// Running locally.
+		mysqlConfig = MySQLConfig{
+			Username: config.Username,
+			Password: config.Password,
+			Host:     "localhost",
+			Port:     3306,
+		}
 	}
+	return newMySQLDB(mysqlConfig)
+}
 
-	// Running locally.
-	return newMySQLDB(MySQLConfig{
-		Username: config.Username,
-		Password: config.Password,
-		Host:     "localhost",
-		Port:     3306,
-	})
+// Migrate brings the schema of the database up to date and returns the names
+// of the migrations it applied. Opening the database already migrates it, so
+// this only finds something to do if the schema changed since.
+func Migrate() ([]string, error) {
+	if _, ok := unwrap(DB).(*memoryDB); ok {
+		return nil, nil
+	}
+	return mysqlConfig.migrate()
 }
@@ -0,0 +1,1772 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/geo"
+)
+
+// memoryDB keeps the event list in memory. It is meant for development and
+// staging, where a MySQL server is not at hand, and is lost when the process
+// exits. It behaves like the MySQL database, including its foreign keys.
+type memoryDB struct {
+	mu sync.Mutex
+
+	// seats is held while seats are allocated, so that they are allocated
+	// one at a time.
+	seats sync.Mutex
+
+	users         map[string]*User
+	events        map[string]*Event
+	tombstones    map[string]*Tombstone
+	participants  map[string]*Participant
+	notifications map[string]*Notification
+	expenses      map[int64]*Expense
+	payments      map[string]*Payment
+	tiers         map[string]*Tier
+	series        map[string]*Series
+	groups        map[string]*Group
+	organizers    map[string]*Organizer
+	invitations   map[string]*Invitation
+	guests        map[string]*Guest
+	questions     map[string][]*Question
+	feedback      map[string]*Feedback
+	activity      []*Activity
+	audit         []*AuditEntry
+	revisions     map[string][]*Revision
+
+	lastExpenseID int64
+	lastAuditID   int64
+}
+
+// Ensure memoryDB conforms to the EventListDatabase interface.
+var _ EventListDatabase = &memoryDB{}
+
+// NewMemoryDB returns a new, empty EventListDatabase kept in memory.
+func NewMemoryDB() EventListDatabase {
+	return &memoryDB{
+		users:         make(map[string]*User),
+		events:        make(map[string]*Event),
+		tombstones:    make(map[string]*Tombstone),
+		participants:  make(map[string]*Participant),
+		notifications: make(map[string]*Notification),
+		expenses:      make(map[int64]*Expense),
+		payments:      make(map[string]*Payment),
+		tiers:         make(map[string]*Tier),
+		series:        make(map[string]*Series),
+		groups:        make(map[string]*Group),
+		organizers:    make(map[string]*Organizer),
+		invitations:   make(map[string]*Invitation),
+		guests:        make(map[string]*Guest),
+		questions:     make(map[string][]*Question),
+		revisions:     make(map[string][]*Revision),
+		feedback:      make(map[string]*Feedback),
+	}
+}
+
+// memoryKey joins the columns of a primary key.
+func memoryKey(ids ...string) string {
+	return strings.Join(ids, "\x00")
+}
+
+// datetime returns a time the way a MySQL DATETIME column returns it, with
+// seconds.
+func datetime(value string) string {
+	if t, err := ParseTime(value); err == nil {
+		return t.Format(TimeLayout)
+	}
+	return value
+}
+
+// ListUsers returns the users, ordered by name.
+func (db *memoryDB) ListUsers() ([]*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var users []*User
+	for _, u := range db.users {
+		u := *u
+		users = append(users, &u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserName < users[j].UserName })
+	return users, nil
+}
+
+// QueryUsers returns a page of the users matching a query, ordered by name.
+func (db *memoryDB) QueryUsers(q *UserQuery) (*UserPage, error) {
+	c, err := decodeCursor(q.Cursor, "", 1)
+	if err != nil {
+		return nil, err
+	}
+	users, err := db.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	less := func(u *User, name, userID string) bool {
+		if u.UserName != name {
+			return u.UserName < name
+		}
+		return u.UserID < userID
+	}
+	sort.Slice(users, func(i, j int) bool { return less(users[i], users[j].UserName, users[j].UserID) })
+
+	var matched []*User
+	for _, u := range users {
+		if q.Name != "" && !strings.Contains(u.UserName, q.Name) {
+			continue
+		}
+		if c != nil && !less(&User{UserName: c.Value, UserID: c.Key[0]}, u.UserName, u.UserID) {
+			continue
+		}
+		matched = append(matched, u)
+		if q.Limit > 0 && len(matched) > q.Limit {
+			break
+		}
+	}
+	return userPage(matched, q.Limit), nil
+}
+
+// GetUser retrieves a user by its ID.
+func (db *memoryDB) GetUser(userID string) (*User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find user with id %s", userID)
+	}
+	user := *u
+	return &user, nil
+}
+
+// AddUser saves a given user.
+func (db *memoryDB) AddUser(u *User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[u.UserID]; ok {
+		return fmt.Errorf("memory: user %s already exists", u.UserID)
+	}
+	user := *u
+	db.users[u.UserID] = &user
+	return nil
+}
+
+// DeleteUser removes a given user by its ID. Users who joined an event or
+// paid an expense cannot be removed.
+func (db *memoryDB) DeleteUser(userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[userID]; !ok {
+		return fmt.Errorf("memory: could not find user with id %s", userID)
+	}
+	for _, p := range db.participants {
+		if p.HostID == userID || p.ParticipantID == userID {
+			return fmt.Errorf("memory: user %s is referenced by participants", userID)
+		}
+	}
+	for _, e := range db.expenses {
+		if e.PayerID == userID {
+			return fmt.Errorf("memory: user %s is referenced by expenses", userID)
+		}
+	}
+	delete(db.users, userID)
+	return nil
+}
+
+// UpdateUser updates the entry for a given user.
+func (db *memoryDB) UpdateUser(u *User) error {
+	if u.UserID == "" {
+		return errors.New("memory: user with unassigned ID passed into updateUser")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[u.UserID]; !ok {
+		return fmt.Errorf("memory: could not find user with id %s", u.UserID)
+	}
+	user := *u
+	db.users[u.UserID] = &user
+	return nil
+}
+
+// sortEvents orders events by host and name.
+func sortEvents(events []*Event) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].HostID != events[j].HostID {
+			return events[i].HostID < events[j].HostID
+		}
+		return events[i].EventName < events[j].EventName
+	})
+}
+
+// listEvents returns copies of the events for which keep returns true.
+func (db *memoryDB) listEvents(keep func(e *Event) bool) []*Event {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var events []*Event
+	for _, e := range db.events {
+		if keep(e) {
+			e := *e
+			events = append(events, &e)
+		}
+	}
+	sortEvents(events)
+	return events
+}
+
+// ListEvents returns the events, ordered by host.
+func (db *memoryDB) ListEvents() ([]*Event, error) {
+	return db.listEvents(func(*Event) bool { return true }), nil
+}
+
+// ListEventsHostedBy returns the events of a given host, ordered by name.
+func (db *memoryDB) ListEventsHostedBy(hostID string) ([]*Event, error) {
+	if hostID == "" {
+		return db.ListEvents()
+	}
+	return db.listEvents(func(e *Event) bool { return e.HostID == hostID }), nil
+}
+
+// QueryEvents returns a page of the events matching a query.
+func (db *memoryDB) QueryEvents(q *EventQuery) (*EventPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	column, desc, _ := sortColumn(q.Sort)
+	keyLen := 2
+	if computed(column) {
+		keyLen = 0
+	}
+	c, err := decodeCursor(q.Cursor, q.Sort, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	now := q.Now.In(Timezone).Format(TimeLayout)
+	terms := searchTerms(q.Keywords)
+	// ranks orders events by a computed column, lowest first.
+	ranks := make(map[string]float64)
+	from, to := datetime(q.From), datetime(q.To)
+
+	db.mu.Lock()
+	seated := make(map[string]int64)
+	// related holds the events the viewer organizes, joined or was invited
+	// to.
+	related := make(map[string]bool)
+	for _, p := range db.participants {
+		if p.Status == StatusConfirmed || p.Status == StatusPendingPayment {
+			seated[memoryKey(p.HostID, p.EventName)]++
+		}
+		if q.Viewer != "" && p.ParticipantID == q.Viewer {
+			related[memoryKey(p.HostID, p.EventName)] = true
+		}
+	}
+	for _, o := range db.organizers {
+		if q.Viewer != "" && o.UserID == q.Viewer {
+			related[memoryKey(o.HostID, o.EventName)] = true
+		}
+	}
+	for _, g := range db.guests {
+		if q.Viewer != "" && g.UserID == q.Viewer {
+			related[memoryKey(g.HostID, g.EventName)] = true
+		}
+	}
+	db.mu.Unlock()
+
+	// compare orders an event against a position by the sort value and
+	// then the key.
+	compare := func(e *Event, value, hostID, eventName string) int {
+		for _, pair := range [][2]string{{sortValue(e, column), value}, {e.HostID, hostID}, {e.EventName, eventName}} {
+			if pair[0] != pair[1] {
+				if pair[0] < pair[1] {
+					return -1
+				}
+				return 1
+			}
+		}
+		return 0
+	}
+
+	events := db.listEvents(func(e *Event) bool {
+		switch {
+		case e.Visibility != VisibilityPublic && (q.Viewer == "" ||
+			e.HostID != q.Viewer && !related[memoryKey(e.HostID, e.EventName)]),
+			!q.IncludeCancelled && e.Cancelled(),
+			q.HostID != "" && e.HostID != q.HostID,
+			q.GroupID != "" && e.GroupID != q.GroupID,
+			from != "" && e.Date < from,
+			to != "" && e.Date >= to,
+			q.Location != "" && !strings.Contains(e.Location, q.Location),
+			q.Status == EventOpen && e.Deadline <= now,
+			q.Status == EventClosed && e.Deadline > now,
+			q.HasCapacity && e.MembersMax > 0 && seated[memoryKey(e.HostID, e.EventName)] >= e.MembersMax:
+			return false
+		}
+		key := memoryKey(e.HostID, e.EventName)
+		if len(terms) > 0 {
+			score := matchEvent(e, terms)
+			if score == 0 {
+				return false
+			}
+			if column == relevance {
+				ranks[key] = -float64(score)
+			}
+		}
+		if q.Near != nil {
+			meters := math.Inf(1)
+			if e.Coordinates != nil {
+				meters = geo.Distance(*q.Near, *e.Coordinates)
+			}
+			if q.Radius > 0 && meters > q.Radius {
+				return false
+			}
+			if column == distance {
+				ranks[key] = meters
+			}
+		}
+		if computed(column) {
+			return true
+		}
+		if c != nil {
+			cmp := compare(e, c.Value, c.Key[0], c.Key[1])
+			return (!desc && cmp > 0) || (desc && cmp < 0)
+		}
+		return true
+	})
+	sort.Slice(events, func(i, j int) bool {
+		ri := ranks[memoryKey(events[i].HostID, events[i].EventName)]
+		rj := ranks[memoryKey(events[j].HostID, events[j].EventName)]
+		if ri != rj {
+			return ri < rj
+		}
+		cmp := compare(events[i], sortValue(events[j], column), events[j].HostID, events[j].EventName)
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	offset := 0
+	if c != nil && computed(column) {
+		offset = c.Offset
+		if offset > len(events) {
+			offset = len(events)
+		}
+		events = events[offset:]
+	}
+	if q.Limit > 0 && len(events) > q.Limit+1 {
+		events = events[:q.Limit+1]
+	}
+	return eventPage(events, q.Limit, q.Sort, column, offset), nil
+}
+
+// matchEvent returns how often search terms appear in the name, description
+// and location of an event, or 0 unless every term appears. Matches in the
+// name count double.
+func matchEvent(e *Event, terms []string) int {
+	name := strings.ToLower(e.EventName)
+	text := strings.ToLower(e.Description + "\n" + e.Location)
+	score := 0
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		n := 2*strings.Count(name, term) + strings.Count(text, term)
+		if n == 0 {
+			return 0
+		}
+		score += n
+	}
+	return score
+}
+
+// GetEvent retrieves an event by its host ID and name.
+func (db *memoryDB) GetEvent(hostID, eventName string) (*Event, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, ok := db.events[memoryKey(hostID, eventName)]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find event %s hosted by %s", eventName, hostID)
+	}
+	event := *e
+	return &event, nil
+}
+
+// storedEvent returns the copy of an event to store, with the defaults the
+// MySQL database fills in.
+func storedEvent(e *Event) *Event {
+	event := *e
+	event.Date = datetime(e.Date)
+	event.Deadline = datetime(e.Deadline)
+	event.SplitMethod = splitMethod(e)
+	event.Currency = currency(e)
+	event.Visibility = visibility(e)
+	event.CancelledAt = datetime(e.CancelledAt)
+	if e.Coordinates != nil {
+		point := *e.Coordinates
+		event.Coordinates = &point
+	}
+	return &event
+}
+
+// AddEvent saves a given event.
+func (db *memoryDB) AddEvent(e *Event) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(e.HostID, e.EventName)
+	if _, ok := db.events[key]; ok {
+		return fmt.Errorf("memory: event %s hosted by %s already exists", e.EventName, e.HostID)
+	}
+	event := storedEvent(e)
+	event.CreatedAt = datetime(createdAt(e))
+	db.events[key] = event
+	return nil
+}
+
+// DeleteEvent removes a given event and leaves a tombstone in its place.
+func (db *memoryDB) DeleteEvent(hostID, eventName string) error {
+	if hostID == "" && eventName == "" {
+		return errors.New("memory: event with unassigned ID passed into deleteEvent")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(hostID, eventName)
+	e, ok := db.events[key]
+	if !ok {
+		return fmt.Errorf("memory: could not find event %s hosted by %s", eventName, hostID)
+	}
+	db.tombstones[key] = &Tombstone{
+		HostID:    e.HostID,
+		EventName: e.EventName,
+		Date:      e.Date,
+		Location:  e.Location,
+		DeletedAt: time.Now().In(Timezone).Format(TimeLayout),
+	}
+	delete(db.events, key)
+	return nil
+}
+
+// DiscardEvent removes a given event without leaving a tombstone.
+func (db *memoryDB) DiscardEvent(hostID, eventName string) error {
+	if hostID == "" && eventName == "" {
+		return errors.New("memory: event with unassigned ID passed into discardEvent")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(hostID, eventName)
+	if _, ok := db.events[key]; !ok {
+		return fmt.Errorf("memory: could not find event %s hosted by %s", eventName, hostID)
+	}
+	delete(db.events, key)
+	return nil
+}
+
+// UpdateEvent updates the entry for a given event.
+func (db *memoryDB) UpdateEvent(e *Event) error {
+	if e.HostID == "" && e.EventName == "" {
+		return errors.New("memory: event with unassigned host ID and event name passed into updateEvent")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(e.HostID, e.EventName)
+	stored, ok := db.events[key]
+	if !ok {
+		return fmt.Errorf("memory: could not find event %s hosted by %s", e.EventName, e.HostID)
+	}
+	event := storedEvent(e)
+	event.CreatedAt = stored.CreatedAt
+	db.events[key] = event
+	return nil
+}
+
+// EditEvent updates the entry for a given event and saves given versions of
+// it, all or nothing.
+func (db *memoryDB) EditEvent(e *Event, revisions ...*Revision) error {
+	if e.HostID == "" && e.EventName == "" {
+		return errors.New("memory: event with unassigned host ID and event name passed into editEvent")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(e.HostID, e.EventName)
+	stored, ok := db.events[key]
+	if !ok {
+		return fmt.Errorf("memory: could not find event %s hosted by %s", e.EventName, e.HostID)
+	}
+	versions := make(map[int64]bool)
+	for _, existing := range db.revisions[key] {
+		versions[existing.Version] = true
+	}
+	for _, r := range revisions {
+		if r.HostID != e.HostID || r.EventName != e.EventName {
+			return fmt.Errorf("memory: revision of event %s passed into editEvent of %s", r.EventName, e.EventName)
+		}
+		if versions[r.Version] {
+			return fmt.Errorf("memory: event %s already has version %d", r.EventName, r.Version)
+		}
+		versions[r.Version] = true
+	}
+
+	event := storedEvent(e)
+	event.CreatedAt = stored.CreatedAt
+	db.events[key] = event
+	if len(revisions) == 0 {
+		return nil
+	}
+	saved := db.revisions[key]
+	for _, r := range revisions {
+		revision := *r
+		revision.Date = datetime(r.Date)
+		revision.EditedAt = datetime(r.EditedAt)
+		saved = append(saved, &revision)
+	}
+	sort.Slice(saved, func(i, j int) bool {
+		return saved[i].Version < saved[j].Version
+	})
+	db.revisions[key] = saved
+	return nil
+}
+
+// CancelEvent updates the entry for a given event and saves given payment
+// records of it, all or nothing.
+func (db *memoryDB) CancelEvent(e *Event, payments ...*Payment) error {
+	if e.HostID == "" && e.EventName == "" {
+		return errors.New("memory: event with unassigned host ID and event name passed into cancelEvent")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(e.HostID, e.EventName)
+	stored, ok := db.events[key]
+	if !ok {
+		return fmt.Errorf("memory: could not find event %s hosted by %s", e.EventName, e.HostID)
+	}
+	for _, p := range payments {
+		if p.HostID != e.HostID || p.EventName != e.EventName || p.ParticipantID == "" {
+			return fmt.Errorf("memory: payment of event %s passed into cancelEvent of %s", p.EventName, e.EventName)
+		}
+		if p.OrderID == "" {
+			continue
+		}
+		for k, other := range db.payments {
+			if k != memoryKey(p.HostID, p.EventName, p.ParticipantID) && other.OrderID == p.OrderID {
+				return fmt.Errorf("memory: order ID %s is already used", p.OrderID)
+			}
+		}
+	}
+
+	event := storedEvent(e)
+	event.CreatedAt = stored.CreatedAt
+	db.events[key] = event
+	for _, p := range payments {
+		payment := *p
+		db.payments[memoryKey(p.HostID, p.EventName, p.ParticipantID)] = &payment
+	}
+	return nil
+}
+
+// listTombstones returns copies of the tombstones for which keep returns
+// true, ordered by host and date.
+func (db *memoryDB) listTombstones(keep func(t *Tombstone) bool) []*Tombstone {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var tombstones []*Tombstone
+	for _, t := range db.tombstones {
+		if keep(t) {
+			t := *t
+			tombstones = append(tombstones, &t)
+		}
+	}
+	sort.Slice(tombstones, func(i, j int) bool {
+		if tombstones[i].HostID != tombstones[j].HostID {
+			return tombstones[i].HostID < tombstones[j].HostID
+		}
+		return tombstones[i].Date < tombstones[j].Date
+	})
+	return tombstones
+}
+
+// ListTombstonesHostedBy returns the tombstones of the events a given host
+// deleted.
+func (db *memoryDB) ListTombstonesHostedBy(hostID string) ([]*Tombstone, error) {
+	return db.listTombstones(func(t *Tombstone) bool { return t.HostID == hostID }), nil
+}
+
+// ListTombstones returns the tombstones of all deleted events.
+func (db *memoryDB) ListTombstones() ([]*Tombstone, error) {
+	return db.listTombstones(func(*Tombstone) bool { return true }), nil
+}
+
+// GetTombstone retrieves the tombstone of a deleted event.
+func (db *memoryDB) GetTombstone(hostID, eventName string) (*Tombstone, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, ok := db.tombstones[memoryKey(hostID, eventName)]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find tombstone of event %s hosted by %s", eventName, hostID)
+	}
+	tombstone := *t
+	return &tombstone, nil
+}
+
+// AddTombstone saves a given tombstone.
+func (db *memoryDB) AddTombstone(t *Tombstone) error {
+	if t.HostID == "" || t.EventName == "" {
+		return errors.New("memory: tombstone with unassigned host ID and event name passed into addTombstone")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tombstone := *t
+	db.tombstones[memoryKey(t.HostID, t.EventName)] = &tombstone
+	return nil
+}
+
+// sortParticipants orders participants by application time and ID.
+func sortParticipants(participants []*Participant) {
+	sort.Slice(participants, func(i, j int) bool {
+		if participants[i].AppliedAt != participants[j].AppliedAt {
+			return participants[i].AppliedAt < participants[j].AppliedAt
+		}
+		return participants[i].ParticipantID < participants[j].ParticipantID
+	})
+}
+
+// listParticipants returns copies of the participants for which keep
+// returns true, in no particular order.
+func (db *memoryDB) listParticipants(keep func(p *Participant) bool) []*Participant {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var participants []*Participant
+	for _, p := range db.participants {
+		if keep(p) {
+			p := *p
+			participants = append(participants, &p)
+		}
+	}
+	return participants
+}
+
+// ListParticipants returns the participants of all events, ordered by ID.
+func (db *memoryDB) ListParticipants() ([]*Participant, error) {
+	participants := db.listParticipants(func(*Participant) bool { return true })
+	sort.SliceStable(participants, func(i, j int) bool {
+		return participants[i].ParticipantID < participants[j].ParticipantID
+	})
+	return participants, nil
+}
+
+// ListParticipantsHostedBy returns the participants of a given event, in
+// order of application.
+func (db *memoryDB) ListParticipantsHostedBy(hostID, eventName string) ([]*Participant, error) {
+	if hostID == "" || eventName == "" {
+		return db.ListParticipants()
+	}
+	participants := db.listParticipants(func(p *Participant) bool {
+		return p.HostID == hostID && p.EventName == eventName
+	})
+	sortParticipants(participants)
+	return participants, nil
+}
+
+// ListParticipationsOf returns every participation of a given user, in order
+// of application.
+func (db *memoryDB) ListParticipationsOf(userID string) ([]*Participant, error) {
+	participants := db.listParticipants(func(p *Participant) bool { return p.ParticipantID == userID })
+	sortParticipants(participants)
+	return participants, nil
+}
+
+// ScanAttendees calls fn for each participant of an event, joined with their
+// user and payment, in order of application.
+func (db *memoryDB) ScanAttendees(hostID, eventName string, fn func(*Attendee) error) error {
+	participants, err := db.ListParticipantsHostedBy(hostID, eventName)
+	if err != nil {
+		return err
+	}
+	for _, p := range participants {
+		attendee := &Attendee{Participant: p}
+		if u, err := db.GetUser(p.ParticipantID); err == nil {
+			attendee.UserName = u.UserName
+		}
+		if payment, err := db.GetPayment(hostID, eventName, p.ParticipantID); err == nil {
+			attendee.Payment = payment
+		}
+		if err := fn(attendee); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetParticipant retrieves a participant of an event by their ID.
+func (db *memoryDB) GetParticipant(p *Participant) (*Participant, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.participants[memoryKey(p.HostID, p.EventName, p.ParticipantID)]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find participant with ID %s in event %s hosted by host %s", p.ParticipantID, p.EventName, p.HostID)
+	}
+	participant := *stored
+	return &participant, nil
+}
+
+// AddParticipant saves a given participant. Like the MySQL database, it
+// saves neither their check-in, cancellation nor attendance.
+func (db *memoryDB) AddParticipant(p *Participant) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[p.HostID]; !ok {
+		return fmt.Errorf("memory: host %s is not a user", p.HostID)
+	}
+	if _, ok := db.users[p.ParticipantID]; !ok {
+		return fmt.Errorf("memory: participant %s is not a user", p.ParticipantID)
+	}
+	key := memoryKey(p.HostID, p.EventName, p.ParticipantID)
+	if _, ok := db.participants[key]; ok {
+		return fmt.Errorf("memory: participant %s of event %s already exists", p.ParticipantID, p.EventName)
+	}
+	status := p.Status
+	if status == "" {
+		status = StatusConfirmed
+	}
+	db.participants[key] = &Participant{
+		HostID:        p.HostID,
+		EventName:     p.EventName,
+		ParticipantID: p.ParticipantID,
+		Status:        status,
+		AppliedAt:     datetime(p.AppliedAt),
+		HeldAt:        datetime(p.HeldAt),
+		ShareWeight:   shareWeight(p),
+		Tier:          p.Tier,
+		Answers:       copyAnswers(p.Answers),
+	}
+	return nil
+}
+
+// copyAnswers copies answers, so that the caller's do not alias the stored ones.
+func copyAnswers(answers []*Answer) []*Answer {
+	if len(answers) == 0 {
+		return nil
+	}
+	copied := make([]*Answer, len(answers))
+	for i, a := range answers {
+		copied[i] = &Answer{QuestionID: a.QuestionID, Values: append([]string(nil), a.Values...)}
+	}
+	return copied
+}
+
+// DeleteParticipant removes a given participant of an event.
+func (db *memoryDB) DeleteParticipant(p *Participant) error {
+	if p.ParticipantID == "" {
+		return errors.New("memory: participant with unassigned ID passed into deleteParticipant")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(p.HostID, p.EventName, p.ParticipantID)
+	if _, ok := db.participants[key]; !ok {
+		return fmt.Errorf("memory: could not find participant with ID %s in event %s hosted by host %s", p.ParticipantID, p.EventName, p.HostID)
+	}
+	delete(db.participants, key)
+	return nil
+}
+
+// UpdateParticipant updates the entry for a given participant.
+func (db *memoryDB) UpdateParticipant(p *Participant) error {
+	if p.ParticipantID == "" {
+		return errors.New("memory: participant with unassigned ID passed into updateParticipant")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(p.HostID, p.EventName, p.ParticipantID)
+	if _, ok := db.participants[key]; !ok {
+		return fmt.Errorf("memory: could not find participant with ID %s in event %s hosted by host %s", p.ParticipantID, p.EventName, p.HostID)
+	}
+	participant := *p
+	participant.CheckedInAt = datetime(p.CheckedInAt)
+	participant.AppliedAt = datetime(p.AppliedAt)
+	participant.CancelledAt = datetime(p.CancelledAt)
+	participant.HeldAt = datetime(p.HeldAt)
+	participant.ShareWeight = shareWeight(p)
+	participant.Answers = copyAnswers(p.Answers)
+	db.participants[key] = &participant
+	return nil
+}
+
+// AllocateSeats calls allocate with the participants of an event and saves
+// the participants it returns, one allocation at a time.
+func (db *memoryDB) AllocateSeats(hostID, eventName string, allocate func(participants []*Participant) ([]*Participant, error)) error {
+	db.seats.Lock()
+	defer db.seats.Unlock()
+
+	if _, err := db.GetEvent(hostID, eventName); err != nil {
+		return err
+	}
+	participants, err := db.ListParticipantsHostedBy(hostID, eventName)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, p := range participants {
+		existing[p.ParticipantID] = true
+	}
+
+	changed, err := allocate(participants)
+	if err != nil {
+		return err
+	}
+	for _, p := range changed {
+		if existing[p.ParticipantID] {
+			err = db.UpdateParticipant(p)
+		} else {
+			err = db.AddParticipant(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckInParticipant records the time a given participant arrived at the venue.
+func (db *memoryDB) CheckInParticipant(p *Participant, at string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, ok := db.participants[memoryKey(p.HostID, p.EventName, p.ParticipantID)]
+	if !ok {
+		return fmt.Errorf("memory: could not find participant with ID %s in event %s hosted by host %s", p.ParticipantID, p.EventName, p.HostID)
+	}
+	if stored.CheckedInAt != "" {
+		return ErrAlreadyCheckedIn
+	}
+	stored.CheckedInAt = datetime(at)
+	return nil
+}
+
+func notificationKey(n *Notification) string {
+	return memoryKey(n.HostID, n.EventName, n.Kind, n.RecipientID)
+}
+
+// ListNotifications returns all recorded notifications, in the order they
+// were sent.
+func (db *memoryDB) ListNotifications() ([]*Notification, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var notifications []*Notification
+	for _, n := range db.notifications {
+		n := *n
+		notifications = append(notifications, &n)
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].SentAt < notifications[j].SentAt })
+	return notifications, nil
+}
+
+// HasNotification reports whether a given notification has already been recorded.
+func (db *memoryDB) HasNotification(n *Notification) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, ok := db.notifications[notificationKey(n)]
+	return ok, nil
+}
+
+// AddNotification records a given notification.
+func (db *memoryDB) AddNotification(n *Notification) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := notificationKey(n)
+	if _, ok := db.notifications[key]; ok {
+		return fmt.Errorf("memory: notification %s to %s already exists", n.Kind, n.RecipientID)
+	}
+	notification := *n
+	db.notifications[key] = &notification
+	return nil
+}
+
+// DeleteNotification removes a given notification.
+func (db *memoryDB) DeleteNotification(n *Notification) error {
+	if n.HostID == "" || n.EventName == "" || n.Kind == "" || n.RecipientID == "" {
+		return errors.New("memory: notification with unassigned ID passed into deleteNotification")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := notificationKey(n)
+	if _, ok := db.notifications[key]; !ok {
+		return fmt.Errorf("memory: could not find notification %s to %s", n.Kind, n.RecipientID)
+	}
+	delete(db.notifications, key)
+	return nil
+}
+
+// ListExpenses returns the expenses of a given event, in the order they were added.
+func (db *memoryDB) ListExpenses(hostID, eventName string) ([]*Expense, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var expenses []*Expense
+	for _, e := range db.expenses {
+		if e.HostID == hostID && e.EventName == eventName {
+			e := *e
+			expenses = append(expenses, &e)
+		}
+	}
+	sort.Slice(expenses, func(i, j int) bool { return expenses[i].ExpenseID < expenses[j].ExpenseID })
+	return expenses, nil
+}
+
+// AddExpense saves a given expense and assigns its ID.
+func (db *memoryDB) AddExpense(e *Expense) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[e.PayerID]; !ok {
+		return fmt.Errorf("memory: payer %s is not a user", e.PayerID)
+	}
+	db.lastExpenseID++
+	e.ExpenseID = db.lastExpenseID
+	expense := *e
+	db.expenses[e.ExpenseID] = &expense
+	return nil
+}
+
+// DeleteExpense removes an expense of a given event by its ID.
+func (db *memoryDB) DeleteExpense(hostID, eventName string, expenseID int64) error {
+	if expenseID == 0 {
+		return errors.New("memory: expense with unassigned ID passed into deleteExpense")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	e, ok := db.expenses[expenseID]
+	if !ok || e.HostID != hostID || e.EventName != eventName {
+		return fmt.Errorf("memory: could not find expense %d of event %s", expenseID, eventName)
+	}
+	delete(db.expenses, expenseID)
+	return nil
+}
+
+// ListPayments returns the payment records of a given event.
+func (db *memoryDB) ListPayments(hostID, eventName string) ([]*Payment, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var payments []*Payment
+	for _, p := range db.payments {
+		if p.HostID == hostID && p.EventName == eventName {
+			p := *p
+			payments = append(payments, &p)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].ParticipantID < payments[j].ParticipantID })
+	return payments, nil
+}
+
+// GetPayment retrieves the payment record of a given participant.
+func (db *memoryDB) GetPayment(hostID, eventName, participantID string) (*Payment, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p, ok := db.payments[memoryKey(hostID, eventName, participantID)]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find payment of %s for event %s hosted by %s", participantID, eventName, hostID)
+	}
+	payment := *p
+	return &payment, nil
+}
+
+// GetPaymentByOrderID retrieves the payment record of a given provider order.
+func (db *memoryDB) GetPaymentByOrderID(orderID string) (*Payment, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, p := range db.payments {
+		if orderID != "" && p.OrderID == orderID {
+			payment := *p
+			return &payment, nil
+		}
+	}
+	return nil, fmt.Errorf("memory: could not find payment with order ID %s", orderID)
+}
+
+// SetPayment saves a given payment record.
+func (db *memoryDB) SetPayment(p *Payment) error {
+	if p.HostID == "" || p.EventName == "" || p.ParticipantID == "" {
+		return errors.New("memory: payment with unassigned ID passed into setPayment")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(p.HostID, p.EventName, p.ParticipantID)
+	if p.OrderID != "" {
+		for k, other := range db.payments {
+			if k != key && other.OrderID == p.OrderID {
+				return fmt.Errorf("memory: order ID %s is already used", p.OrderID)
+			}
+		}
+	}
+	payment := *p
+	db.payments[key] = &payment
+	return nil
+}
+
+// ListTiers returns the ticket tiers of a given event, cheapest first.
+func (db *memoryDB) ListTiers(hostID, eventName string) ([]*Tier, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var tiers []*Tier
+	for _, t := range db.tiers {
+		if t.HostID == hostID && t.EventName == eventName {
+			t := *t
+			tiers = append(tiers, &t)
+		}
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		if tiers[i].Price != tiers[j].Price {
+			return tiers[i].Price < tiers[j].Price
+		}
+		return tiers[i].TierName < tiers[j].TierName
+	})
+	return tiers, nil
+}
+
+// AddTier saves a given tier.
+func (db *memoryDB) AddTier(t *Tier) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(t.HostID, t.EventName, t.TierName)
+	if _, ok := db.tiers[key]; ok {
+		return fmt.Errorf("memory: tier %s of event %s already exists", t.TierName, t.EventName)
+	}
+	tier := *t
+	tier.SaleStart = datetime(t.SaleStart)
+	tier.SaleEnd = datetime(t.SaleEnd)
+	db.tiers[key] = &tier
+	return nil
+}
+
+// UpdateTier updates the entry for a given tier.
+func (db *memoryDB) UpdateTier(t *Tier) error {
+	if t.HostID == "" || t.EventName == "" || t.TierName == "" {
+		return errors.New("memory: tier with unassigned ID passed into updateTier")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(t.HostID, t.EventName, t.TierName)
+	if _, ok := db.tiers[key]; !ok {
+		return fmt.Errorf("memory: could not find tier %s of event %s", t.TierName, t.EventName)
+	}
+	tier := *t
+	tier.SaleStart = datetime(t.SaleStart)
+	tier.SaleEnd = datetime(t.SaleEnd)
+	db.tiers[key] = &tier
+	return nil
+}
+
+// DeleteTier removes a given tier by its name.
+func (db *memoryDB) DeleteTier(hostID, eventName, tierName string) error {
+	if hostID == "" || eventName == "" || tierName == "" {
+		return errors.New("memory: tier with unassigned ID passed into deleteTier")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(hostID, eventName, tierName)
+	if _, ok := db.tiers[key]; !ok {
+		return fmt.Errorf("memory: could not find tier %s of event %s", tierName, eventName)
+	}
+	delete(db.tiers, key)
+	return nil
+}
+
+// listSeries returns copies of the series for which keep returns true,
+// ordered by host and name.
+func (db *memoryDB) listSeries(keep func(s *Series) bool) []*Series {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var series []*Series
+	for _, s := range db.series {
+		if keep(s) {
+			s := *s
+			series = append(series, &s)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].HostID != series[j].HostID {
+			return series[i].HostID < series[j].HostID
+		}
+		return series[i].SeriesName < series[j].SeriesName
+	})
+	return series
+}
+
+// ListSeries returns all series.
+func (db *memoryDB) ListSeries() ([]*Series, error) {
+	return db.listSeries(func(*Series) bool { return true }), nil
+}
+
+// ListSeriesHostedBy returns the series of a given host.
+func (db *memoryDB) ListSeriesHostedBy(hostID string) ([]*Series, error) {
+	return db.listSeries(func(s *Series) bool { return s.HostID == hostID }), nil
+}
+
+// GetSeries retrieves a series by its host ID and name.
+func (db *memoryDB) GetSeries(hostID, seriesName string) (*Series, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	s, ok := db.series[memoryKey(hostID, seriesName)]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find series %s hosted by %s", seriesName, hostID)
+	}
+	series := *s
+	return &series, nil
+}
+
+// AddSeries saves a given series.
+func (db *memoryDB) AddSeries(s *Series) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(s.HostID, s.SeriesName)
+	if _, ok := db.series[key]; ok {
+		return fmt.Errorf("memory: series %s hosted by %s already exists", s.SeriesName, s.HostID)
+	}
+	series := *s
+	series.Start = datetime(s.Start)
+	series.GeneratedUntil = datetime(s.GeneratedUntil)
+	series.Currency = seriesCurrency(s)
+	db.series[key] = &series
+	return nil
+}
+
+// UpdateSeries updates the entry for a given series.
+func (db *memoryDB) UpdateSeries(s *Series) error {
+	if s.HostID == "" || s.SeriesName == "" {
+		return errors.New("memory: series with unassigned host ID and name passed into updateSeries")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(s.HostID, s.SeriesName)
+	if _, ok := db.series[key]; !ok {
+		return fmt.Errorf("memory: could not find series %s hosted by %s", s.SeriesName, s.HostID)
+	}
+	series := *s
+	series.Start = datetime(s.Start)
+	series.GeneratedUntil = datetime(s.GeneratedUntil)
+	series.Currency = seriesCurrency(s)
+	db.series[key] = &series
+	return nil
+}
+
+// DeleteSeries removes a given series. Its occurrences are kept.
+func (db *memoryDB) DeleteSeries(hostID, seriesName string) error {
+	if hostID == "" || seriesName == "" {
+		return errors.New("memory: series with unassigned host ID and name passed into deleteSeries")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(hostID, seriesName)
+	if _, ok := db.series[key]; !ok {
+		return fmt.Errorf("memory: could not find series %s hosted by %s", seriesName, hostID)
+	}
+	delete(db.series, key)
+	return nil
+}
+
+// ListOccurrences returns the events of a series, in order of date.
+func (db *memoryDB) ListOccurrences(hostID, seriesName string) ([]*Event, error) {
+	events := db.listEvents(func(e *Event) bool { return e.HostID == hostID && e.SeriesName == seriesName })
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date < events[j].Date })
+	return events, nil
+}
+
+// ListGroups returns all groups, including those the bot left.
+func (db *memoryDB) ListGroups() ([]*Group, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var groups []*Group
+	for _, g := range db.groups {
+		group := *g
+		groups = append(groups, &group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupID < groups[j].GroupID })
+	return groups, nil
+}
+
+// GetGroup retrieves a group by its ID.
+func (db *memoryDB) GetGroup(groupID string) (*Group, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	g, ok := db.groups[groupID]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find group %s", groupID)
+	}
+	group := *g
+	return &group, nil
+}
+
+// SetGroup saves a given group, replacing the group with the same ID.
+func (db *memoryDB) SetGroup(g *Group) error {
+	if g.GroupID == "" {
+		return errors.New("memory: group with unassigned ID passed into setGroup")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	group := *g
+	group.JoinedAt = datetime(g.JoinedAt)
+	group.LeftAt = datetime(g.LeftAt)
+	db.groups[g.GroupID] = &group
+	return nil
+}
+
+// listOrganizers returns copies of the organizers matching a filter.
+func (db *memoryDB) listOrganizers(match func(*Organizer) bool) []*Organizer {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var organizers []*Organizer
+	for _, o := range db.organizers {
+		if match(o) {
+			organizer := *o
+			organizers = append(organizers, &organizer)
+		}
+	}
+	return organizers
+}
+
+// ListOrganizers returns the organizers of a given event, in the order they
+// were added.
+func (db *memoryDB) ListOrganizers(hostID, eventName string) ([]*Organizer, error) {
+	organizers := db.listOrganizers(func(o *Organizer) bool { return o.HostID == hostID && o.EventName == eventName })
+	sort.Slice(organizers, func(i, j int) bool {
+		if organizers[i].AddedAt != organizers[j].AddedAt {
+			return organizers[i].AddedAt < organizers[j].AddedAt
+		}
+		return organizers[i].UserID < organizers[j].UserID
+	})
+	return organizers, nil
+}
+
+// ListOrganizedBy returns the events a given user helps to organize.
+func (db *memoryDB) ListOrganizedBy(userID string) ([]*Organizer, error) {
+	organizers := db.listOrganizers(func(o *Organizer) bool { return o.UserID == userID })
+	sort.Slice(organizers, func(i, j int) bool {
+		if organizers[i].HostID != organizers[j].HostID {
+			return organizers[i].HostID < organizers[j].HostID
+		}
+		return organizers[i].EventName < organizers[j].EventName
+	})
+	return organizers, nil
+}
+
+// GetOrganizer retrieves an organizer of an event by their user ID.
+func (db *memoryDB) GetOrganizer(hostID, eventName, userID string) (*Organizer, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	o, ok := db.organizers[memoryKey(hostID, eventName, userID)]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find organizer %s of event %s", userID, eventName)
+	}
+	organizer := *o
+	return &organizer, nil
+}
+
+// SetOrganizer saves a given organizer, replacing their previous role.
+func (db *memoryDB) SetOrganizer(o *Organizer) error {
+	if o.HostID == "" || o.EventName == "" || o.UserID == "" {
+		return errors.New("memory: organizer with unassigned ID passed into setOrganizer")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[o.UserID]; !ok {
+		return fmt.Errorf("memory: organizer %s is not a user", o.UserID)
+	}
+	organizer := *o
+	organizer.AddedAt = datetime(o.AddedAt)
+	db.organizers[memoryKey(o.HostID, o.EventName, o.UserID)] = &organizer
+	return nil
+}
+
+// DeleteOrganizer removes a given organizer from an event.
+func (db *memoryDB) DeleteOrganizer(hostID, eventName, userID string) error {
+	if hostID == "" || eventName == "" || userID == "" {
+		return errors.New("memory: organizer with unassigned ID passed into deleteOrganizer")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(hostID, eventName, userID)
+	if _, ok := db.organizers[key]; !ok {
+		return fmt.Errorf("memory: could not find organizer %s of event %s", userID, eventName)
+	}
+	delete(db.organizers, key)
+	return nil
+}
+
+// ListInvitations returns the invitations to a given event, newest first.
+func (db *memoryDB) ListInvitations(hostID, eventName string) ([]*Invitation, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var invitations []*Invitation
+	for _, i := range db.invitations {
+		if i.HostID == hostID && i.EventName == eventName {
+			invitation := *i
+			invitations = append(invitations, &invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool {
+		if invitations[i].CreatedAt != invitations[j].CreatedAt {
+			return invitations[i].CreatedAt > invitations[j].CreatedAt
+		}
+		return invitations[i].Code < invitations[j].Code
+	})
+	return invitations, nil
+}
+
+// GetInvitation retrieves an invitation by its code.
+func (db *memoryDB) GetInvitation(code string) (*Invitation, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	i, ok := db.invitations[code]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find invitation %s", code)
+	}
+	invitation := *i
+	return &invitation, nil
+}
+
+// AddInvitation saves a given invitation.
+func (db *memoryDB) AddInvitation(i *Invitation) error {
+	if i.Code == "" {
+		return errors.New("memory: invitation with unassigned code passed into addInvitation")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.invitations[i.Code]; ok {
+		return fmt.Errorf("memory: invitation %s already exists", i.Code)
+	}
+	invitation := *i
+	invitation.ExpiresAt = datetime(i.ExpiresAt)
+	invitation.CreatedAt = datetime(i.CreatedAt)
+	db.invitations[i.Code] = &invitation
+	return nil
+}
+
+// DeleteInvitation revokes an invitation. Its guests stay guests.
+func (db *memoryDB) DeleteInvitation(code string) error {
+	if code == "" {
+		return errors.New("memory: invitation with unassigned code passed into deleteInvitation")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.invitations[code]; !ok {
+		return fmt.Errorf("memory: could not find invitation %s", code)
+	}
+	delete(db.invitations, code)
+	return nil
+}
+
+// RedeemInvitation makes a user a guest of the event of an invitation at a
+// given time and counts the use.
+func (db *memoryDB) RedeemInvitation(code, userID, now string) (*Guest, error) {
+	at, err := ParseTime(now)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	invitation, ok := db.invitations[code]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find invitation %s", code)
+	}
+	key := memoryKey(invitation.HostID, invitation.EventName, userID)
+	if g, ok := db.guests[key]; ok {
+		guest := *g
+		return &guest, nil
+	}
+	if err := invitation.Usable(at); err != nil {
+		return nil, err
+	}
+	if _, ok := db.users[userID]; !ok {
+		return nil, fmt.Errorf("memory: guest %s is not a user", userID)
+	}
+
+	invitation.Uses++
+	guest := Guest{
+		HostID:    invitation.HostID,
+		EventName: invitation.EventName,
+		UserID:    userID,
+		Code:      code,
+		GrantedAt: datetime(now),
+	}
+	stored := guest
+	db.guests[key] = &stored
+	return &guest, nil
+}
+
+// ListGuests returns the guests of a given event.
+func (db *memoryDB) ListGuests(hostID, eventName string) ([]*Guest, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var guests []*Guest
+	for _, g := range db.guests {
+		if g.HostID == hostID && g.EventName == eventName {
+			guest := *g
+			guests = append(guests, &guest)
+		}
+	}
+	sort.Slice(guests, func(i, j int) bool {
+		if guests[i].GrantedAt != guests[j].GrantedAt {
+			return guests[i].GrantedAt < guests[j].GrantedAt
+		}
+		return guests[i].UserID < guests[j].UserID
+	})
+	return guests, nil
+}
+
+// GetGuest retrieves a guest of an event by their user ID.
+func (db *memoryDB) GetGuest(hostID, eventName, userID string) (*Guest, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	g, ok := db.guests[memoryKey(hostID, eventName, userID)]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find guest %s of event %s", userID, eventName)
+	}
+	guest := *g
+	return &guest, nil
+}
+
+// AddGuest saves a given guest without redeeming an invitation.
+func (db *memoryDB) AddGuest(g *Guest) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[g.UserID]; !ok {
+		return fmt.Errorf("memory: guest %s is not a user", g.UserID)
+	}
+	key := memoryKey(g.HostID, g.EventName, g.UserID)
+	if _, ok := db.guests[key]; ok {
+		return fmt.Errorf("memory: guest %s of event %s already exists", g.UserID, g.EventName)
+	}
+	guest := *g
+	guest.GrantedAt = datetime(g.GrantedAt)
+	db.guests[key] = &guest
+	return nil
+}
+
+// ListQuestions returns the questions of a given form of an event in the
+// order they are asked.
+func (db *memoryDB) ListQuestions(hostID, eventName, form string) ([]*Question, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var questions []*Question
+	for _, q := range db.questions[memoryKey(hostID, eventName, form)] {
+		question := *q
+		question.Options = append([]string(nil), q.Options...)
+		questions = append(questions, &question)
+	}
+	return questions, nil
+}
+
+// SetQuestions replaces the questions of a given form of an event. Answers
+// already given are kept.
+func (db *memoryDB) SetQuestions(hostID, eventName, form string, questions []*Question) error {
+	if hostID == "" || eventName == "" || form == "" {
+		return errors.New("memory: event with unassigned ID passed into setQuestions")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var stored []*Question
+	seen := make(map[int64]bool)
+	for _, other := range []string{FormRegistration, FormFeedback} {
+		if other == form {
+			continue
+		}
+		for _, q := range db.questions[memoryKey(hostID, eventName, other)] {
+			seen[q.QuestionID] = true
+		}
+	}
+	for _, q := range questions {
+		if seen[q.QuestionID] {
+			return fmt.Errorf("memory: question %d of event %s already exists", q.QuestionID, eventName)
+		}
+		seen[q.QuestionID] = true
+		question := *q
+		question.HostID = hostID
+		question.EventName = eventName
+		question.Form = form
+		question.Options = append([]string(nil), q.Options...)
+		stored = append(stored, &question)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].QuestionID < stored[j].QuestionID })
+	if len(stored) == 0 {
+		delete(db.questions, memoryKey(hostID, eventName, form))
+		return nil
+	}
+	db.questions[memoryKey(hostID, eventName, form)] = stored
+	return nil
+}
+
+// ListFeedback returns the responses to the survey of a given event, in the
+// order they were submitted.
+func (db *memoryDB) ListFeedback(hostID, eventName string) ([]*Feedback, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var feedback []*Feedback
+	for _, f := range db.feedback {
+		if f.HostID == hostID && f.EventName == eventName {
+			response := *f
+			response.Answers = copyAnswers(f.Answers)
+			feedback = append(feedback, &response)
+		}
+	}
+	sort.Slice(feedback, func(i, j int) bool {
+		if feedback[i].SubmittedAt != feedback[j].SubmittedAt {
+			return feedback[i].SubmittedAt < feedback[j].SubmittedAt
+		}
+		return feedback[i].UserID < feedback[j].UserID
+	})
+	return feedback, nil
+}
+
+// GetFeedback retrieves a participant's response to the survey of an event.
+func (db *memoryDB) GetFeedback(hostID, eventName, userID string) (*Feedback, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	f, ok := db.feedback[memoryKey(hostID, eventName, userID)]
+	if !ok {
+		return nil, fmt.Errorf("memory: could not find feedback of %s on event %s", userID, eventName)
+	}
+	response := *f
+	response.Answers = copyAnswers(f.Answers)
+	return &response, nil
+}
+
+// SetFeedback saves a given response, replacing any previous response of the
+// same participant.
+func (db *memoryDB) SetFeedback(f *Feedback) error {
+	if f.HostID == "" || f.EventName == "" || f.UserID == "" {
+		return errors.New("memory: feedback with unassigned ID passed into setFeedback")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.users[f.UserID]; !ok {
+		return fmt.Errorf("memory: respondent %s is not a user", f.UserID)
+	}
+	response := *f
+	response.Answers = copyAnswers(f.Answers)
+	response.SubmittedAt = datetime(f.SubmittedAt)
+	db.feedback[memoryKey(f.HostID, f.EventName, f.UserID)] = &response
+	return nil
+}
+
+// ListActivity returns the history of a given event, oldest first.
+func (db *memoryDB) ListActivity(hostID, eventName string) ([]*Activity, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var activity []*Activity
+	for _, a := range db.activity {
+		if a.HostID == hostID && a.EventName == eventName {
+			entry := *a
+			activity = append(activity, &entry)
+		}
+	}
+	sort.SliceStable(activity, func(i, j int) bool {
+		return activity[i].At < activity[j].At
+	})
+	return activity, nil
+}
+
+// AddActivity saves a given entry and assigns its ID.
+func (db *memoryDB) AddActivity(a *Activity) error {
+	if a.HostID == "" || a.EventName == "" {
+		return errors.New("memory: activity with unassigned event passed into addActivity")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	a.ActivityID = int64(len(db.activity)) + 1
+	entry := *a
+	entry.At = datetime(a.At)
+	db.activity = append(db.activity, &entry)
+	return nil
+}
+
+// QueryAudit returns a page of the entries matching a query, newest first.
+func (db *memoryDB) QueryAudit(q *AuditQuery) (*AuditPage, error) {
+	c, err := decodeCursor(q.Cursor, "", 1)
+	if err != nil {
+		return nil, err
+	}
+	lastID := int64(math.MaxInt64)
+	if c != nil {
+		if lastID, err = strconv.ParseInt(c.Key[0], 10, 64); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	from, to := datetime(q.From), datetime(q.To)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var matched []*AuditEntry
+	for i := len(db.audit) - 1; i >= 0; i-- {
+		a := db.audit[i]
+		switch {
+		case a.AuditID >= lastID,
+			q.Actor != "" && a.Actor != q.Actor,
+			q.RequestID != "" && a.RequestID != q.RequestID,
+			q.Entity != "" && a.Entity != q.Entity,
+			q.HostID != "" && a.HostID != q.HostID,
+			q.EventName != "" && a.EventName != q.EventName,
+			q.UserID != "" && a.UserID != q.UserID,
+			from != "" && a.At < from,
+			to != "" && a.At >= to:
+			continue
+		}
+		entry := *a
+		matched = append(matched, &entry)
+		if q.Limit > 0 && len(matched) > q.Limit {
+			break
+		}
+	}
+	return auditPage(matched, q.Limit), nil
+}
+
+// AddAudit saves a given entry and assigns its ID.
+func (db *memoryDB) AddAudit(a *AuditEntry) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.lastAuditID++
+	a.AuditID = db.lastAuditID
+	entry := *a
+	entry.At = datetime(a.At)
+	db.audit = append(db.audit, &entry)
+	return nil
+}
+
+// DeleteAudit removes a given entry by its ID.
+func (db *memoryDB) DeleteAudit(auditID int64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i, a := range db.audit {
+		if a.AuditID == auditID {
+			db.audit = append(db.audit[:i], db.audit[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("memory: could not find audit entry with id %d", auditID)
+}
+
+// ListRevisions returns the versions of a given event, oldest first.
+func (db *memoryDB) ListRevisions(hostID, eventName string) ([]*Revision, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var revisions []*Revision
+	for _, r := range db.revisions[memoryKey(hostID, eventName)] {
+		revision := *r
+		revisions = append(revisions, &revision)
+	}
+	return revisions, nil
+}
+
+// AddRevision saves a given version. It fails if the event already has a
+// version of the same number.
+func (db *memoryDB) AddRevision(r *Revision) error {
+	if r.HostID == "" || r.EventName == "" {
+		return errors.New("memory: revision with unassigned event passed into addRevision")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	key := memoryKey(r.HostID, r.EventName)
+	for _, existing := range db.revisions[key] {
+		if existing.Version == r.Version {
+			return fmt.Errorf("memory: event %s already has version %d", r.EventName, r.Version)
+		}
+	}
+	revision := *r
+	revision.Date = datetime(r.Date)
+	revision.EditedAt = datetime(r.EditedAt)
+	revisions := append(db.revisions[key], &revision)
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Version < revisions[j].Version
+	})
+	db.revisions[key] = revisions
+	return nil
+}
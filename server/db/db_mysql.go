@@ -15,6 +15,20 @@ type tables struct {
 const usersTable = "users"
 const eventsTable = "events"
 const participantsTable = "participants"
+const notificationsTable = "notifications"
+const expensesTable = "expenses"
+const paymentsTable = "payments"
+const tiersTable = "tiers"
+const seriesTable = "series"
+const tombstonesTable = "tombstones"
+const groupsTable = "line_groups" // GROUPS is reserved in MySQL 8.
+const organizersTable = "organizers"
+const invitationsTable = "invitations"
+const questionsTable = "questions"
+const feedbackTable = "feedback"
+const activityTable = "event_activity"
+const auditTable = "audit_log"
+const revisionsTable = "event_revisions"
 
 var createTableStatements = []string{
 	`CREATE DATABASE IF NOT EXISTS event_list DEFAULT CHARACTER SET = 'utf8' DEFAULT COLLATE 'utf8_general_ci';`,
@@ -33,16 +47,222 @@ var createTableStatements = []string{
 		members_max INT NULL,
 		lottery BOOL DEFAULT FALSE,
 		description VARCHAR(1024) NULL,
-		PRIMARY KEY (host_id, event_name)
+		deprioritize_no_shows BOOL NOT NULL DEFAULT FALSE,
+		split_method VARCHAR(16) NOT NULL DEFAULT 'equal',
+		fixed_share BIGINT NOT NULL DEFAULT 0,
+		fee BIGINT NOT NULL DEFAULT 0,
+		currency VARCHAR(3) NOT NULL DEFAULT 'JPY',
+		series_name VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		venue VARCHAR(255) NOT NULL DEFAULT '',
+		latitude DOUBLE NULL,
+		longitude DOUBLE NULL,
+		group_id VARCHAR(255) NOT NULL DEFAULT '',
+		visibility VARCHAR(16) NOT NULL DEFAULT 'public',
+		cancelled_at DATETIME NULL,
+		cancel_reason VARCHAR(1024) NOT NULL DEFAULT '',
+		PRIMARY KEY (host_id, event_name),
+		INDEX (host_id, series_name),
+		INDEX (date),
+		INDEX (deadline),
+		INDEX (created_at),
+		FULLTEXT INDEX (event_name, description, location) WITH PARSER ngram,
+		INDEX (latitude, longitude),
+		INDEX (group_id),
+		INDEX (visibility)
 	);`,
 	`CREATE TABLE IF NOT EXISTS participants (
 		host_id VARCHAR(255) NOT NULL, 
 		event_name VARCHAR(255) NOT NULL,
 		participant_id VARCHAR(255) NOT NULL,
+		status VARCHAR(32) NOT NULL DEFAULT 'confirmed',
+		checked_in_at DATETIME NULL,
+		applied_at DATETIME NULL,
+		cancelled_at DATETIME NULL,
+		attendance VARCHAR(32) NOT NULL DEFAULT '',
+		share_weight INT NOT NULL DEFAULT 1,
+		tier VARCHAR(255) NOT NULL DEFAULT '',
+		answers TEXT NULL,
+		held_at DATETIME NULL,
 		PRIMARY KEY (host_id,event_name,participant_id),
 		FOREIGN KEY (host_id) REFERENCES users(user_id),
 		FOREIGN KEY (participant_id) REFERENCES users(user_id)
 	);`,
+	`CREATE TABLE IF NOT EXISTS notifications (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		kind VARCHAR(64) NOT NULL,
+		recipient_id VARCHAR(255) NOT NULL,
+		sent_at DATETIME NOT NULL,
+		PRIMARY KEY (host_id, event_name, kind, recipient_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS expenses (
+		expense_id BIGINT NOT NULL AUTO_INCREMENT,
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		payer_id VARCHAR(255) NOT NULL,
+		amount BIGINT NOT NULL,
+		currency VARCHAR(3) NOT NULL,
+		description VARCHAR(1024) NULL,
+		PRIMARY KEY (expense_id),
+		INDEX (host_id, event_name),
+		FOREIGN KEY (payer_id) REFERENCES users(user_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS payments (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		participant_id VARCHAR(255) NOT NULL,
+		amount BIGINT NOT NULL,
+		currency VARCHAR(3) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		updated_at DATETIME NOT NULL,
+		updated_by VARCHAR(255) NOT NULL,
+		provider VARCHAR(32) NOT NULL DEFAULT '',
+		charge_id VARCHAR(255) NOT NULL DEFAULT '',
+		order_id VARCHAR(100) NULL,
+		PRIMARY KEY (host_id, event_name, participant_id),
+		UNIQUE (order_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS tiers (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		tier_name VARCHAR(255) NOT NULL,
+		price BIGINT NOT NULL DEFAULT 0,
+		capacity INT NOT NULL DEFAULT 0,
+		sale_start DATETIME NULL,
+		sale_end DATETIME NULL,
+		PRIMARY KEY (host_id, event_name, tier_name)
+	);`,
+	`CREATE TABLE IF NOT EXISTS series (
+		host_id VARCHAR(255) NOT NULL,
+		series_name VARCHAR(255) NOT NULL,
+		rule VARCHAR(255) NOT NULL,
+		start DATETIME NOT NULL,
+		deadline_before INT NOT NULL DEFAULT 0,
+		location VARCHAR(512) NOT NULL,
+		members_max INT NULL,
+		lottery BOOL DEFAULT FALSE,
+		description VARCHAR(1024) NULL,
+		deprioritize_no_shows BOOL NOT NULL DEFAULT FALSE,
+		fee BIGINT NOT NULL DEFAULT 0,
+		currency VARCHAR(3) NOT NULL DEFAULT 'JPY',
+		carry_participants BOOL NOT NULL DEFAULT FALSE,
+		generated_until DATETIME NULL,
+		PRIMARY KEY (host_id, series_name)
+	);`,
+	`CREATE TABLE IF NOT EXISTS tombstones (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		date DATETIME NOT NULL,
+		location VARCHAR(512) NOT NULL,
+		deleted_at DATETIME NOT NULL,
+		PRIMARY KEY (host_id, event_name)
+	);`,
+	`CREATE TABLE IF NOT EXISTS line_groups (
+		group_id VARCHAR(255) NOT NULL,
+		kind VARCHAR(16) NOT NULL,
+		joined_at DATETIME NOT NULL,
+		left_at DATETIME NULL,
+		PRIMARY KEY (group_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS organizers (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		role VARCHAR(16) NOT NULL,
+		added_by VARCHAR(255) NOT NULL,
+		added_at DATETIME NOT NULL,
+		PRIMARY KEY (host_id, event_name, user_id),
+		INDEX (user_id),
+		FOREIGN KEY (user_id) REFERENCES users(user_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS invitations (
+		code VARCHAR(32) NOT NULL,
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		max_uses INT NOT NULL DEFAULT 0,
+		uses INT NOT NULL DEFAULT 0,
+		expires_at DATETIME NULL,
+		created_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (code),
+		INDEX (host_id, event_name)
+	);`,
+	`CREATE TABLE IF NOT EXISTS guests (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		code VARCHAR(32) NOT NULL,
+		granted_at DATETIME NOT NULL,
+		PRIMARY KEY (host_id, event_name, user_id),
+		INDEX (user_id),
+		FOREIGN KEY (user_id) REFERENCES users(user_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS questions (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		question_id INT NOT NULL,
+		label VARCHAR(255) NOT NULL,
+		type VARCHAR(32) NOT NULL,
+		options TEXT NULL,
+		required BOOL NOT NULL DEFAULT FALSE,
+		form VARCHAR(16) NOT NULL DEFAULT 'registration',
+		PRIMARY KEY (host_id, event_name, question_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS feedback (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		rating INT NOT NULL,
+		comment TEXT NULL,
+		answers TEXT NULL,
+		submitted_at DATETIME NOT NULL,
+		PRIMARY KEY (host_id, event_name, user_id),
+		FOREIGN KEY (user_id) REFERENCES users(user_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS event_activity (
+		activity_id BIGINT NOT NULL AUTO_INCREMENT,
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		user_id VARCHAR(255) NOT NULL,
+		kind VARCHAR(16) NOT NULL,
+		status VARCHAR(32) NOT NULL DEFAULT '',
+		amount BIGINT NOT NULL DEFAULT 0,
+		at DATETIME NOT NULL,
+		PRIMARY KEY (activity_id),
+		INDEX (host_id, event_name, at)
+	);`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		audit_id BIGINT NOT NULL AUTO_INCREMENT,
+		actor VARCHAR(255) NOT NULL,
+		request_id VARCHAR(64) NOT NULL DEFAULT '',
+		entity VARCHAR(16) NOT NULL,
+		action VARCHAR(16) NOT NULL,
+		host_id VARCHAR(255) NOT NULL DEFAULT '',
+		event_name VARCHAR(255) NOT NULL DEFAULT '',
+		user_id VARCHAR(255) NOT NULL DEFAULT '',
+		before_data MEDIUMTEXT NULL,
+		after_data MEDIUMTEXT NULL,
+		diff MEDIUMTEXT NULL,
+		at DATETIME NOT NULL,
+		PRIMARY KEY (audit_id),
+		INDEX (host_id, event_name),
+		INDEX (user_id),
+		INDEX (actor),
+		INDEX (request_id)
+	);`,
+	`CREATE TABLE IF NOT EXISTS event_revisions (
+		host_id VARCHAR(255) NOT NULL,
+		event_name VARCHAR(255) NOT NULL,
+		version BIGINT NOT NULL,
+		date DATETIME NOT NULL,
+		location VARCHAR(512) NOT NULL,
+		members_max INT NOT NULL DEFAULT 0,
+		editor_id VARCHAR(255) NOT NULL,
+		notify BOOL NOT NULL DEFAULT FALSE,
+		edited_at DATETIME NOT NULL,
+		PRIMARY KEY (host_id, event_name, version)
+	);`,
 }
 
 // mysqlDB persists books to a MySQL instance.
@@ -59,16 +279,46 @@ type eventListDB struct {
 	*userDB
 	*eventDB
 	*participantDB
+	*notificationDB
+	*expenseDB
+	*paymentDB
+	*tierDB
+	*seriesDB
+	*groupDB
+	*organizerDB
+	*invitationDB
+	*questionDB
+	*feedbackDB
+	*activityDB
+	*auditDB
+	*revisionDB
 }
 
 type userDB mysqlDB
 type eventDB struct {
 	*mysqlDB
-	listedBy *sql.Stmt
+	listedBy   *sql.Stmt
+	bury       *sql.Stmt
+	tombstones *sql.Stmt
+	tombstone  *sql.Stmt
+
+	allTombstones *sql.Stmt
+	addTombstone  *sql.Stmt
+	addRevision   *sql.Stmt
+	setPayment    *sql.Stmt
+}
+type paymentDB struct {
+	*mysqlDB
+	getByOrder *sql.Stmt
 }
+
 type participantDB struct {
 	*mysqlDB
-	listedBy *sql.Stmt
+	listedBy  *sql.Stmt
+	listOf    *sql.Stmt
+	checkIn   *sql.Stmt
+	attendees *sql.Stmt
+	lockEvent *sql.Stmt
 }
 
 // Ensure mysqlDB conforms to the EventDatabase interface.
@@ -104,6 +354,10 @@ type rowScanner interface {
 }
 
 func newMySQLDB(config MySQLConfig) (*eventListDB, error) {
+	if _, err := config.migrate(); err != nil {
+		return nil, err
+	}
+
 	userDB, err := newMySQLUsersDB(config)
 	if err != nil {
 		return nil, err
@@ -116,11 +370,76 @@ func newMySQLDB(config MySQLConfig) (*eventListDB, error) {
 	if err != nil {
 		return nil, err
 	}
+	notificationDB, err := newMySQLNotificationsDB(config)
+	if err != nil {
+		return nil, err
+	}
+	expenseDB, err := newMySQLExpensesDB(config)
+	if err != nil {
+		return nil, err
+	}
+	paymentDB, err := newMySQLPaymentsDB(config)
+	if err != nil {
+		return nil, err
+	}
+	tierDB, err := newMySQLTiersDB(config)
+	if err != nil {
+		return nil, err
+	}
+	seriesDB, err := newMySQLSeriesDB(config)
+	if err != nil {
+		return nil, err
+	}
+	groupDB, err := newMySQLGroupsDB(config)
+	if err != nil {
+		return nil, err
+	}
+	organizerDB, err := newMySQLOrganizersDB(config)
+	if err != nil {
+		return nil, err
+	}
+	invitationDB, err := newMySQLInvitationsDB(config)
+	if err != nil {
+		return nil, err
+	}
+	questionDB, err := newMySQLQuestionsDB(config)
+	if err != nil {
+		return nil, err
+	}
+	feedbackDB, err := newMySQLFeedbackDB(config)
+	if err != nil {
+		return nil, err
+	}
+	activityDB, err := newMySQLActivityDB(config)
+	if err != nil {
+		return nil, err
+	}
+	auditDB, err := newMySQLAuditDB(config)
+	if err != nil {
+		return nil, err
+	}
+	revisionDB, err := newMySQLRevisionsDB(config)
+	if err != nil {
+		return nil, err
+	}
 
 	db := &eventListDB{
-		userDB:        userDB,
-		eventDB:       eventDB,
-		participantDB: participantDB,
+		userDB:         userDB,
+		eventDB:        eventDB,
+		participantDB:  participantDB,
+		notificationDB: notificationDB,
+		expenseDB:      expenseDB,
+		paymentDB:      paymentDB,
+		tierDB:         tierDB,
+		seriesDB:       seriesDB,
+		groupDB:        groupDB,
+		organizerDB:    organizerDB,
+		invitationDB:   invitationDB,
+		questionDB:     questionDB,
+		feedbackDB:     feedbackDB,
+		activityDB:     activityDB,
+		auditDB:        auditDB,
+		revisionDB:     revisionDB,
 	}
 
 	return db, nil
@@ -185,6 +504,11 @@ func createTable(conn *sql.DB) error {
 	return nil
 }
 
+// nullString converts an empty string to NULL for nullable columns.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 // execAffectingOneRow executes a given statement, expecting one row to be affected.
 func execAffectingOneRow(stmt *sql.Stmt, args ...interface{}) (sql.Result, error) {
 	r, err := stmt.Exec(args...)
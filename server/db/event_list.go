@@ -1,10 +1,52 @@
 package db
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/geo"
+)
+
 // EventListDatabase proviedes thread-safe access to a database of event list.
 type EventListDatabase interface {
 	UserDatabase
 	EventDatabase
 	ParticipantDatabase
+	NotificationDatabase
+	ExpenseDatabase
+	PaymentDatabase
+	TierDatabase
+	SeriesDatabase
+	TombstoneDatabase
+	GroupDatabase
+	OrganizerDatabase
+	InvitationDatabase
+	QuestionDatabase
+	FeedbackDatabase
+	ActivityDatabase
+	AuditDatabase
+	RevisionDatabase
+}
+
+// TimeLayout is the layout of event dates and deadlines as stored in the database.
+const TimeLayout = "2006-01-02 15:04:05"
+
+// Timezone is the time zone event dates and deadlines are entered in.
+var Timezone = time.FixedZone("JST", 9*60*60)
+
+// ParseTime parses an event date or deadline. Seconds may be omitted, as they
+// are when the date comes from a registration form.
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range []string{TimeLayout, "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, value, Timezone); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse time %q", value)
 }
 
 // User holds metadata about a user.
@@ -18,6 +60,9 @@ type UserDatabase interface {
 	// ListUsers() returns a list of event.
 	ListUsers() ([]*User, error)
 
+	// QueryUsers returns a page of the users matching a query.
+	QueryUsers(q *UserQuery) (*UserPage, error)
+
 	// GetUser retrieves a user by its ID.
 	GetUser(userID string) (*User, error)
 
@@ -41,6 +86,90 @@ type Event struct {
 	MembersMax  int64
 	Lottery     bool
 	Description string
+
+	// DeprioritizeNoShows gives users who often did not show up a lower
+	// chance in the lottery and a later place on the waitlist.
+	DeprioritizeNoShows bool
+
+	// SplitMethod is how the expenses of the event are shared among its
+	// confirmed participants: SplitEqual, SplitWeighted or SplitFixed.
+	SplitMethod string
+
+	// FixedShare is the amount each participant pays with SplitFixed.
+	FixedShare int64
+
+	// Fee is the participation fee each confirmed participant pays, in the
+	// smallest unit of Currency. Zero means the event is free.
+	Fee      int64
+	Currency string
+
+	// SeriesName is the name of the series the event is an occurrence of,
+	// or empty for a one-off event.
+	SeriesName string
+
+	// CreatedAt is the time the event was registered.
+	CreatedAt string
+
+	// Venue is the name of the place the event is held at, and Coordinates
+	// its position, or nil if it was not located. Location stays the address
+	// or free text the host entered.
+	Venue       string
+	Coordinates *geo.Point
+
+	// GroupID is the LINE group or room the event belongs to, or empty for
+	// an event of its host alone. Members of the group see and join the
+	// event from the chat, and announcements about it are posted there.
+	GroupID string
+
+	// Visibility is who sees the event: VisibilityPublic, VisibilityUnlisted
+	// or VisibilityPrivate.
+	Visibility string
+
+	// CancelledAt is the time the event was called off, or empty if it was
+	// not, and CancelReason why. Cancelled events are kept, but not listed.
+	CancelledAt  string
+	CancelReason string
+}
+
+// Visibilities of events.
+const (
+	// VisibilityPublic events are listed to everyone.
+	VisibilityPublic = "public"
+
+	// VisibilityUnlisted events are listed only to those who may see
+	// private events, but anyone who knows the event can see and join it.
+	VisibilityUnlisted = "unlisted"
+
+	// VisibilityPrivate events can only be seen and joined by their
+	// organizers, their participants and the users who redeemed an
+	// invitation to them.
+	VisibilityPrivate = "private"
+)
+
+// Methods of splitting the expenses of an event.
+const (
+	// SplitEqual shares expenses equally.
+	SplitEqual = "equal"
+	// SplitWeighted shares expenses in proportion to each participant's ShareWeight.
+	SplitWeighted = "weighted"
+	// SplitFixed charges every participant the event's FixedShare; the host
+	// covers the difference to the actual expenses.
+	SplitFixed = "fixed"
+)
+
+// StartTime returns the date the event is held as a time.Time.
+func (e *Event) StartTime() (time.Time, error) {
+	return ParseTime(e.Date)
+}
+
+// Cancelled reports whether the event was called off.
+func (e *Event) Cancelled() bool {
+	return e.CancelledAt != ""
+}
+
+// DeadlineTime returns the application deadline of the event as a time.Time.
+func (e *Event) DeadlineTime() (time.Time, error) {
+	return ParseTime(e.Deadline)
 }
 
 // EventDatabase provides thread-safe access to a database of events.
@@ -52,24 +181,153 @@ type EventDatabase interface {
 	// the user who created the book entry.
 	ListEventsHostedBy(hostID string) ([]*Event, error)
 
+	// QueryEvents returns a page of the events matching a query. It returns
+	// ErrInvalidCursor for a cursor of a different query.
+	QueryEvents(q *EventQuery) (*EventPage, error)
+
 	// GetEvent retrieves a event by its ID.
 	GetEvent(hostID, eventName string) (*Event, error)
 
 	// AddEvent saves a given event.
 	AddEvent(e *Event) error
 
-	// DeleteEvent removes a given event by its ID.
+	// DeleteEvent removes a given event by its ID and leaves a Tombstone
+	// in its place.
 	DeleteEvent(hostID, eventName string) error
 
+	// DiscardEvent removes an event without leaving a Tombstone, to undo
+	// adding it before anyone could see it.
+	DiscardEvent(hostID, eventName string) error
+
 	// UpdateEvent updates the entry for a given Event.
 	UpdateEvent(e *Event) error
+
+	// EditEvent updates the entry for a given Event and saves given versions
+	// of it, all or nothing. It fails if the event already has a version of
+	// the same number as one of them.
+	EditEvent(e *Event, revisions ...*Revision) error
+
+	// CancelEvent updates the entry for a given Event and saves given payment
+	// records of it, e.g. refunds, all or nothing.
+	CancelEvent(e *Event, payments ...*Payment) error
+}
+
+// Tombstone records an event that was deleted, so that calendars showing it
+// can be told it was cancelled.
+type Tombstone struct {
+	HostID    string
+	EventName string
+	Date      string
+	Location  string
+	DeletedAt string
+}
+
+// TombstoneDatabase provides thread-safe access to the tombstones of deleted
+// events.
+type TombstoneDatabase interface {
+	// ListTombstonesHostedBy returns the tombstones of the events a given
+	// host deleted.
+	ListTombstonesHostedBy(hostID string) ([]*Tombstone, error)
+
+	// GetTombstone retrieves the tombstone of a deleted event.
+	GetTombstone(hostID, eventName string) (*Tombstone, error)
+
+	// ListTombstones returns the tombstones of all deleted events.
+	ListTombstones() ([]*Tombstone, error)
+
+	// AddTombstone saves a given tombstone, replacing any previous one of
+	// the same event. DeleteEvent leaves tombstones by itself; this is for
+	// restoring them from a backup.
+	AddTombstone(t *Tombstone) error
 }
 
+// Participant statuses.
+const (
+	// StatusApplied is the status of a participant waiting for the lottery.
+	StatusApplied = "applied"
+	// StatusConfirmed is the status of a participant who has a seat.
+	StatusConfirmed = "confirmed"
+	// StatusWaitlisted is the status of a participant waiting for a seat.
+	StatusWaitlisted = "waitlisted"
+	// StatusCancelled is the status of a participant who cancelled.
+	StatusCancelled = "cancelled"
+	// StatusPendingPayment is the status of a participant whose seat is held
+	// until they pay the fee through a payment provider.
+	StatusPendingPayment = "pending_payment"
+)
+
+// Attendance outcomes of a participant, recorded after the event ended.
+const (
+	// AttendanceAttended is recorded for participants who checked in.
+	AttendanceAttended = "attended"
+	// AttendanceNoShow is recorded for confirmed participants who did not check in.
+	AttendanceNoShow = "no_show"
+	// AttendanceCancelledLate is recorded for participants who cancelled
+	// shortly before the event.
+	AttendanceCancelledLate = "cancelled_late"
+)
+
+// ErrAlreadyCheckedIn is returned by CheckInParticipant when the participant
+// has already been checked in.
+var ErrAlreadyCheckedIn = errors.New("participant has already checked in")
+
 // Participant holds metadata about a participant.
 type Participant struct {
 	HostID        string
 	EventName     string
 	ParticipantID string
+	Status        string
+
+	// CheckedInAt is the time the participant was checked in at the venue,
+	// or empty if they have not been.
+	CheckedInAt string
+
+	// AppliedAt is the time the participant applied. It orders the waitlist.
+	AppliedAt string
+
+	// CancelledAt is the time the participant cancelled, or empty.
+	CancelledAt string
+
+	// HeldAt is the time the participant's seat started to be held until
+	// they pay, or empty if it never was.
+	HeldAt string
+
+	// Attendance is the outcome recorded after the event ended, or empty
+	// while the event has not ended yet.
+	Attendance string
+
+	// ShareWeight is the participant's weight when expenses are split with
+	// SplitWeighted.
+	ShareWeight int64
+
+	// Tier is the name of the ticket tier the participant applied for, or
+	// empty if the event has no tiers.
+	Tier string
+
+	// Answers are the participant's answers to the questions of the event,
+	// in the order the questions are asked. Unanswered optional questions
+	// have no answer.
+	Answers []*Answer
+}
+
+// Answer returns the participant's answer to a given question, or nil if
+// they did not answer it.
+func (p *Participant) Answer(questionID int64) *Answer {
+	for _, a := range p.Answers {
+		if a.QuestionID == questionID {
+			return a
+		}
+	}
+	return nil
+}
+
+// Attendee is a participant joined with their user and payment record.
+type Attendee struct {
+	*Participant
+	UserName string
+
+	// Payment is the participant's payment record, or nil if there is none.
+	Payment *Payment
 }
 
 // ParticipantDatabase provides thread-safe access to a database of participants.
@@ -81,6 +339,16 @@ type ParticipantDatabase interface {
 	// the event they are going to participante in and the host who host the event.
 	ListParticipantsHostedBy(hostID, evetntName string) ([]*Participant, error)
 
+	// ListParticipationsOf returns every participation of a given user,
+	// across all events.
+	ListParticipationsOf(userID string) ([]*Participant, error)
+
+	// ScanAttendees calls fn for each participant of an event, joined with
+	// their user and payment, in order of application. Rows are read one at
+	// a time, so that large events need not fit in memory. Scanning stops at
+	// the first error fn returns.
+	ScanAttendees(hostID, eventName string, fn func(*Attendee) error) error
+
 	// Get retrieves a participant of a specific participant by its ID.
 	GetParticipant(p *Participant) (*Participant, error)
 
@@ -92,4 +360,720 @@ type ParticipantDatabase interface {
 
 	// UpdateEvent updates the entry for a given participant of a specific event .
 	UpdateParticipant(p *Participant) error
+
+	// CheckInParticipant records that a given participant arrived at the venue
+	// at a given time. It returns ErrAlreadyCheckedIn if they already did.
+	CheckInParticipant(p *Participant, at string) error
+
+	// AllocateSeats calls allocate with the participants of an event, in
+	// order of application, and saves the participants it returns, adding
+	// those who are new. Seats of the same event are allocated one at a
+	// time, so that they are not given away twice. allocate must not
+	// allocate seats itself.
+	AllocateSeats(hostID, eventName string, allocate func(participants []*Participant) ([]*Participant, error)) error
+}
+
+// Notification records that a reminder of a given kind has been delivered to
+// a recipient for an event, so that it is not sent twice.
+type Notification struct {
+	HostID      string
+	EventName   string
+	Kind        string
+	RecipientID string
+	SentAt      string
+}
+
+// NotificationDatabase provides thread-safe access to a database of delivered notifications.
+type NotificationDatabase interface {
+	// ListNotifications returns all recorded notifications.
+	ListNotifications() ([]*Notification, error)
+
+	// HasNotification reports whether a given notification has already been recorded.
+	HasNotification(n *Notification) (bool, error)
+
+	// AddNotification records a given notification.
+	AddNotification(n *Notification) error
+
+	// DeleteNotification removes a given notification, e.g. when delivery failed.
+	DeleteNotification(n *Notification) error
+}
+
+// Expense holds metadata about money paid for an event. Amount is in the
+// smallest unit of Currency, e.g. yen.
+type Expense struct {
+	ExpenseID   int64
+	HostID      string
+	EventName   string
+	PayerID     string
+	Amount      int64
+	Currency    string
+	Description string
+}
+
+// ExpenseDatabase provides thread-safe access to a database of event expenses.
+type ExpenseDatabase interface {
+	// ListExpenses returns the expenses of a given event.
+	ListExpenses(hostID, eventName string) ([]*Expense, error)
+
+	// AddExpense saves a given expense and assigns its ID.
+	AddExpense(e *Expense) error
+
+	// DeleteExpense removes an expense of a given event by its ID.
+	DeleteExpense(hostID, eventName string, expenseID int64) error
+}
+
+// Payment statuses. Confirmed participants of an event with a fee who have
+// no payment record yet are considered PaymentDue.
+const (
+	PaymentDue      = "due"
+	PaymentPaid     = "paid"
+	PaymentWaived   = "waived"
+	PaymentRefunded = "refunded"
+
+	// PaymentRefundDue is the status of a fee that was paid for an event
+	// that was cancelled, and is yet to be refunded.
+	PaymentRefundDue = "refund_due"
+)
+
+// Payment holds the status of a participant's fee for an event.
+type Payment struct {
+	HostID        string
+	EventName     string
+	ParticipantID string
+	Amount        int64
+	Currency      string
+	Status        string
+	UpdatedAt     string
+
+	// UpdatedBy is the ID of the user who last changed the status, or the
+	// name of the payment provider.
+	UpdatedBy string
+
+	// Provider, ChargeID and OrderID identify the charge when the fee is
+	// collected through a payment provider.
+	Provider string
+	ChargeID string
+	OrderID  string
+}
+
+// PaymentDatabase provides thread-safe access to a database of participant payments.
+type PaymentDatabase interface {
+	// ListPayments returns the payment records of a given event.
+	ListPayments(hostID, eventName string) ([]*Payment, error)
+
+	// GetPayment retrieves the payment record of a given participant.
+	GetPayment(hostID, eventName, participantID string) (*Payment, error)
+
+	// GetPaymentByOrderID retrieves the payment record of a given provider order.
+	GetPaymentByOrderID(orderID string) (*Payment, error)
+
+	// SetPayment saves a given payment record, replacing any previous record
+	// of the same participant.
+	SetPayment(p *Payment) error
+}
+
+// Tier holds metadata about a ticket tier of an event, e.g. early bird or
+// student tickets.
+type Tier struct {
+	HostID    string
+	EventName string
+	TierName  string
+
+	// Price is the fee of the tier, in the smallest unit of the event's currency.
+	Price int64
+
+	// Capacity is the number of seats of the tier. Zero means unlimited.
+	Capacity int64
+
+	// SaleStart and SaleEnd limit when the tier can be applied for. Either
+	// may be empty for no limit.
+	SaleStart string
+	SaleEnd   string
+}
+
+// OnSale reports whether the tier can be applied for at a given time.
+func (t *Tier) OnSale(now time.Time) bool {
+	if start, err := ParseTime(t.SaleStart); err == nil && now.Before(start) {
+		return false
+	}
+	if end, err := ParseTime(t.SaleEnd); err == nil && !now.Before(end) {
+		return false
+	}
+	return true
+}
+
+// TierDatabase provides thread-safe access to a database of ticket tiers.
+type TierDatabase interface {
+	// ListTiers returns the ticket tiers of a given event, cheapest first.
+	ListTiers(hostID, eventName string) ([]*Tier, error)
+
+	// AddTier saves a given tier.
+	AddTier(t *Tier) error
+
+	// UpdateTier updates the entry for a given tier.
+	UpdateTier(t *Tier) error
+
+	// DeleteTier removes a given tier by its name.
+	DeleteTier(hostID, eventName, tierName string) error
+}
+
+// Question holds metadata about a question participants answer when they
+// join an event, e.g. their dietary restrictions or t-shirt size, or in the
+// feedback survey after it.
+type Question struct {
+	HostID    string
+	EventName string
+
+	// QuestionID numbers the questions of an event from 1, in the order they
+	// are asked. IDs are unique across the forms of an event.
+	QuestionID int64
+
+	// Form is the form the question is asked in: FormRegistration or
+	// FormFeedback.
+	Form string
+
+	Label string
+
+	// Type is QuestionText, QuestionChoice, QuestionMultipleChoice or
+	// QuestionNumber.
+	Type string
+
+	// Options are the choices of QuestionChoice and QuestionMultipleChoice
+	// questions.
+	Options []string
+
+	// Required questions must be answered to join the event.
+	Required bool
+}
+
+// Forms questions are asked in.
+const (
+	// FormRegistration questions are asked when participants join.
+	FormRegistration = "registration"
+	// FormFeedback questions are asked in the feedback survey after the event.
+	FormFeedback = "feedback"
+)
+
+// Types of questions.
+const (
+	// QuestionText questions are answered with free text.
+	QuestionText = "text"
+	// QuestionChoice questions are answered with one of their options.
+	QuestionChoice = "choice"
+	// QuestionMultipleChoice questions are answered with any of their options.
+	QuestionMultipleChoice = "multiple_choice"
+	// QuestionNumber questions are answered with a number.
+	QuestionNumber = "number"
+)
+
+// Answer is a participant's answer to a question. Values holds the chosen
+// options of a QuestionMultipleChoice question, and the single answer to
+// any other question.
+type Answer struct {
+	QuestionID int64
+	Values     []string
+}
+
+// Validate checks that the question can be asked.
+func (q *Question) Validate() error {
+	if strings.TrimSpace(q.Label) == "" {
+		return errors.New("question has no label")
+	}
+	switch q.Type {
+	case QuestionText, QuestionNumber:
+		if len(q.Options) > 0 {
+			return fmt.Errorf("question %q of type %s cannot have options", q.Label, q.Type)
+		}
+	case QuestionChoice, QuestionMultipleChoice:
+		if len(q.Options) == 0 {
+			return fmt.Errorf("question %q has no options", q.Label)
+		}
+		seen := make(map[string]bool)
+		for _, o := range q.Options {
+			if strings.TrimSpace(o) == "" || seen[o] {
+				return fmt.Errorf("question %q has an empty or duplicate option", q.Label)
+			}
+			seen[o] = true
+		}
+	default:
+		return fmt.Errorf("question %q has invalid type %q", q.Label, q.Type)
+	}
+	return nil
+}
+
+// Check checks that a given answer, which is nil if the question was not
+// answered, is a valid answer to the question.
+func (q *Question) Check(a *Answer) error {
+	if a == nil || len(a.Values) == 0 {
+		if q.Required {
+			return fmt.Errorf("question %q must be answered", q.Label)
+		}
+		return nil
+	}
+	if q.Type != QuestionMultipleChoice && len(a.Values) > 1 {
+		return fmt.Errorf("question %q takes a single answer", q.Label)
+	}
+	for _, v := range a.Values {
+		switch q.Type {
+		case QuestionText:
+			if strings.TrimSpace(v) == "" {
+				return fmt.Errorf("answer to question %q is empty", q.Label)
+			}
+		case QuestionNumber:
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return fmt.Errorf("answer to question %q is not a number: %q", q.Label, v)
+			}
+		case QuestionChoice, QuestionMultipleChoice:
+			if !q.hasOption(v) {
+				return fmt.Errorf("answer to question %q is not one of its options: %q", q.Label, v)
+			}
+		}
+	}
+	return nil
+}
+
+func (q *Question) hasOption(value string) bool {
+	for _, o := range q.Options {
+		if o == value {
+			return true
+		}
+	}
+	return false
+}
+
+// QuestionDatabase provides thread-safe access to a database of the
+// questions of events.
+type QuestionDatabase interface {
+	// ListQuestions returns the questions of a given form of an event in the
+	// order they are asked.
+	ListQuestions(hostID, eventName, form string) ([]*Question, error)
+
+	// SetQuestions replaces the questions of a given form of an event.
+	// Answers already given are kept.
+	SetQuestions(hostID, eventName, form string, questions []*Question) error
+}
+
+// Ratings participants give events in the feedback survey.
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+// Feedback is a participant's response to the feedback survey after an event.
+type Feedback struct {
+	HostID    string
+	EventName string
+	UserID    string
+
+	// Rating is from MinRating to MaxRating.
+	Rating  int64
+	Comment string
+
+	// Answers are the participant's answers to the FormFeedback questions of
+	// the event.
+	Answers []*Answer
+
+	SubmittedAt string
+}
+
+// FeedbackDatabase provides thread-safe access to a database of responses to
+// feedback surveys.
+type FeedbackDatabase interface {
+	// ListFeedback returns the responses to the survey of a given event, in
+	// the order they were submitted.
+	ListFeedback(hostID, eventName string) ([]*Feedback, error)
+
+	// GetFeedback retrieves a participant's response to the survey of an event.
+	GetFeedback(hostID, eventName, userID string) (*Feedback, error)
+
+	// SetFeedback saves a given response, replacing any previous response of
+	// the same participant.
+	SetFeedback(f *Feedback) error
+}
+
+// Kinds of activity recorded on events.
+const (
+	// ActivityView is a user being shown an event they may apply to.
+	ActivityView = "view"
+	// ActivityStatus is a participant's status changing, including when they
+	// apply. Status is the new status.
+	ActivityStatus = "status"
+	// ActivityCheckIn is a participant checking in at the venue.
+	ActivityCheckIn = "check_in"
+	// ActivityPayment is a participant's fee being paid. Amount is the fee.
+	ActivityPayment = "payment"
+	// ActivityRefund is a participant's fee being refunded. Amount is the
+	// refunded fee.
+	ActivityRefund = "refund"
+)
+
+// Activity is an entry of the history of an event, from which its analytics
+// are computed. Entries are only ever added.
+type Activity struct {
+	ActivityID int64
+	HostID     string
+	EventName  string
+	UserID     string
+	Kind       string
+
+	// Status is the participant's new status of an ActivityStatus entry.
+	Status string
+
+	// Amount is the money paid or refunded, in the currency of the event.
+	Amount int64
+
+	At string
+}
+
+// ActivityDatabase provides thread-safe access to a database of the history
+// of events.
+type ActivityDatabase interface {
+	// ListActivity returns the history of a given event, oldest first.
+	ListActivity(hostID, eventName string) ([]*Activity, error)
+
+	// AddActivity saves a given entry and assigns its ID.
+	AddActivity(a *Activity) error
+}
+
+// Revision is a version of the date, location and capacity of an event.
+// Version 1 is the event as it was before its first edit, and every edit of
+// them adds the next version.
+type Revision struct {
+	HostID     string
+	EventName  string
+	Version    int64
+	Date       string
+	Location   string
+	MembersMax int64
+
+	// EditorID is the user who made the edit.
+	EditorID string
+
+	// Notify is set if the participants are to be told about the edit.
+	Notify bool
+
+	EditedAt string
+}
+
+// Fields of an event that are versioned.
+const (
+	FieldDate       = "date"
+	FieldLocation   = "location"
+	FieldMembersMax = "membersMax"
+)
+
+// Changed returns the fields that differ from a previous version.
+func (r *Revision) Changed(previous *Revision) []string {
+	var fields []string
+	if r.Date != previous.Date {
+		fields = append(fields, FieldDate)
+	}
+	if r.Location != previous.Location {
+		fields = append(fields, FieldLocation)
+	}
+	if r.MembersMax != previous.MembersMax {
+		fields = append(fields, FieldMembersMax)
+	}
+	return fields
+}
+
+// RevisionDatabase provides thread-safe access to a database of the versions
+// of events.
+type RevisionDatabase interface {
+	// ListRevisions returns the versions of a given event, oldest first.
+	ListRevisions(hostID, eventName string) ([]*Revision, error)
+
+	// AddRevision saves a given version. It fails if the event already has
+	// a version of the same number.
+	AddRevision(r *Revision) error
+}
+
+// Kinds of records whose changes are audited.
+const (
+	AuditUser        = "user"
+	AuditEvent       = "event"
+	AuditParticipant = "participant"
+	AuditPayment     = "payment"
+)
+
+// Changes recorded in the audit log.
+const (
+	AuditAdd     = "add"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditCheckIn = "check_in"
+)
+
+// AuditEntry records a change to a user, an event or a participant.
+type AuditEntry struct {
+	AuditID int64
+
+	// Actor is the user who made the change, or what made it, e.g.
+	// "system:attendance" or "cli:root".
+	Actor string
+
+	// RequestID is the ID of the request the change was made in, or empty
+	// if it was not made in a request.
+	RequestID string
+
+	Entity string
+	Action string
+
+	// HostID, EventName and UserID identify the record changed: a user by
+	// UserID, an event by HostID and EventName and a participant by all
+	// three.
+	HostID    string
+	EventName string
+	UserID    string
+
+	// Before and After are the JSON of the record before and after the
+	// change, or null if it did not exist. Diff maps the fields changed to
+	// their values before and after.
+	Before json.RawMessage
+	After  json.RawMessage
+	Diff   json.RawMessage
+
+	At string
+}
+
+// AuditDatabase provides thread-safe access to the audit log. Entries are
+// only removed again if the change they record could not be made.
+type AuditDatabase interface {
+	// QueryAudit returns a page of the entries matching a query, newest
+	// first.
+	QueryAudit(q *AuditQuery) (*AuditPage, error)
+
+	// AddAudit saves a given entry and assigns its ID.
+	AddAudit(a *AuditEntry) error
+
+	// DeleteAudit removes a given entry by its ID.
+	DeleteAudit(auditID int64) error
+}
+
+// Series holds metadata about a series of recurring events. Occurrences are
+// generated as events from the series' template fields.
+type Series struct {
+	HostID     string
+	SeriesName string
+
+	// Rule is the recurrence rule of the series in RRULE syntax, e.g.
+	// "FREQ=WEEKLY;BYDAY=TU".
+	Rule string
+
+	// Start is the date and time of the first occurrence.
+	Start string
+
+	// DeadlineBefore is how many minutes before an occurrence starts its
+	// applications close.
+	DeadlineBefore int64
+
+	Location            string
+	MembersMax          int64
+	Lottery             bool
+	Description         string
+	DeprioritizeNoShows bool
+	Fee                 int64
+	Currency            string
+
+	// CarryParticipants confirms the confirmed participants of an occurrence
+	// for the next occurrence too, so that a standing list of members does
+	// not need to apply every time.
+	CarryParticipants bool
+
+	// GeneratedUntil is the start of the last occurrence generated so far.
+	GeneratedUntil string
+}
+
+// StartTime returns the date of the first occurrence as a time.Time.
+func (s *Series) StartTime() (time.Time, error) {
+	return ParseTime(s.Start)
+}
+
+// SeriesDatabase provides thread-safe access to a database of event series.
+type SeriesDatabase interface {
+	// ListSeries returns all series.
+	ListSeries() ([]*Series, error)
+
+	// ListSeriesHostedBy returns the series of a given host.
+	ListSeriesHostedBy(hostID string) ([]*Series, error)
+
+	// GetSeries retrieves a series by its host ID and name.
+	GetSeries(hostID, seriesName string) (*Series, error)
+
+	// AddSeries saves a given series.
+	AddSeries(s *Series) error
+
+	// UpdateSeries updates the entry for a given series.
+	UpdateSeries(s *Series) error
+
+	// DeleteSeries removes a given series. Its occurrences are kept.
+	DeleteSeries(hostID, seriesName string) error
+
+	// ListOccurrences returns the events of a series, in order of date.
+	ListOccurrences(hostID, seriesName string) ([]*Event, error)
+}
+
+// Kinds of LINE chats with several members.
+const (
+	GroupKindGroup = "group"
+	GroupKindRoom  = "room"
+)
+
+// Group records a LINE group or room the bot was invited to.
+type Group struct {
+	// GroupID is the ID of the group or room.
+	GroupID string
+	Kind    string
+
+	JoinedAt string
+
+	// LeftAt is when the bot left or was removed from the group, or empty
+	// while it is a member. Nothing is posted to groups it left.
+	LeftAt string
+}
+
+// Active reports whether the bot is a member of the group.
+func (g *Group) Active() bool {
+	return g.LeftAt == ""
+}
+
+// GroupDatabase provides thread-safe access to a database of LINE groups.
+type GroupDatabase interface {
+	// ListGroups returns all groups, including those the bot left.
+	ListGroups() ([]*Group, error)
+
+	// GetGroup retrieves a group by its ID.
+	GetGroup(groupID string) (*Group, error)
+
+	// SetGroup saves a given group, replacing the group with the same ID.
+	SetGroup(g *Group) error
+}
+
+// Roles of the organizers of an event.
+const (
+	// RoleOwner is the role of the host of an event. It is implied by the
+	// HostID of the event and never stored as an organizer.
+	RoleOwner = "owner"
+
+	// RoleCoHost may do everything the owner may, except delete the event
+	// and add or remove co-hosts.
+	RoleCoHost = "cohost"
+
+	// RoleStaff may only check participants in.
+	RoleStaff = "staff"
+)
+
+// Organizer records a user who helps the host to run an event.
+type Organizer struct {
+	HostID    string
+	EventName string
+	UserID    string
+	Role      string
+
+	// AddedBy is the user who invited the organizer.
+	AddedBy string
+	AddedAt string
+}
+
+// OrganizerDatabase provides thread-safe access to a database of the
+// organizers of events.
+type OrganizerDatabase interface {
+	// ListOrganizers returns the organizers of a given event, in the order
+	// they were added.
+	ListOrganizers(hostID, eventName string) ([]*Organizer, error)
+
+	// ListOrganizedBy returns the events a given user helps to organize.
+	ListOrganizedBy(userID string) ([]*Organizer, error)
+
+	// GetOrganizer retrieves an organizer of an event by their user ID.
+	GetOrganizer(hostID, eventName, userID string) (*Organizer, error)
+
+	// SetOrganizer saves a given organizer, replacing their previous role.
+	SetOrganizer(o *Organizer) error
+
+	// DeleteOrganizer removes a given organizer from an event.
+	DeleteOrganizer(hostID, eventName, userID string) error
+}
+
+// Invitation is a code that lets users see and join an event, whatever its
+// visibility.
+type Invitation struct {
+	Code      string
+	HostID    string
+	EventName string
+
+	// MaxUses is how many users may redeem the invitation. Zero means
+	// unlimited.
+	MaxUses int64
+	Uses    int64
+
+	// ExpiresAt is when the invitation stops working, or empty if it does
+	// not expire.
+	ExpiresAt string
+
+	CreatedBy string
+	CreatedAt string
+}
+
+// Usable returns ErrInvitationExpired or ErrInvitationUsedUp if the
+// invitation cannot be redeemed at a given time, and nil if it can.
+func (i *Invitation) Usable(now time.Time) error {
+	if expires, err := ParseTime(i.ExpiresAt); err == nil && !now.Before(expires) {
+		return ErrInvitationExpired
+	}
+	if i.MaxUses > 0 && i.Uses >= i.MaxUses {
+		return ErrInvitationUsedUp
+	}
+	return nil
+}
+
+// Errors returned for invitations that cannot be redeemed.
+var (
+	ErrInvitationExpired = errors.New("invitation has expired")
+	ErrInvitationUsedUp  = errors.New("invitation has been used up")
+)
+
+// Guest records a user who redeemed an invitation to an event.
+type Guest struct {
+	HostID    string
+	EventName string
+	UserID    string
+
+	// Code is the invitation the user redeemed.
+	Code      string
+	GrantedAt string
+}
+
+// InvitationDatabase provides thread-safe access to a database of
+// invitations and the guests who redeemed them.
+type InvitationDatabase interface {
+	// ListInvitations returns the invitations to a given event, newest
+	// first.
+	ListInvitations(hostID, eventName string) ([]*Invitation, error)
+
+	// GetInvitation retrieves an invitation by its code.
+	GetInvitation(code string) (*Invitation, error)
+
+	// AddInvitation saves a given invitation.
+	AddInvitation(i *Invitation) error
+
+	// DeleteInvitation revokes an invitation. Its guests stay guests.
+	DeleteInvitation(code string) error
+
+	// RedeemInvitation makes a user a guest of the event of an invitation
+	// at a given time and counts the use. It returns ErrInvitationExpired
+	// or ErrInvitationUsedUp if the invitation cannot be redeemed. A user
+	// who is a guest of the event already is returned as they are, and the
+	// use is not counted.
+	RedeemInvitation(code, userID, now string) (*Guest, error)
+
+	// ListGuests returns the guests of a given event.
+	ListGuests(hostID, eventName string) ([]*Guest, error)
+
+	// GetGuest retrieves a guest of an event by their user ID.
+	GetGuest(hostID, eventName, userID string) (*Guest, error)
+
+	// AddGuest saves a given guest without redeeming an invitation, as when
+	// they are restored from a backup.
+	AddGuest(g *Guest) error
 }
@@ -4,6 +4,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/geo"
 )
 
 // newMySQLDB creates a new BookDatabase backed by a given MySQL server.
@@ -13,6 +17,15 @@ func newMySQLEventsDB(config MySQLConfig) (*eventDB, error) {
 	if err := config.ensureTableExisits(eventsTable); err != nil {
 		return nil, err
 	}
+	if err := config.ensureTableExisits(tombstonesTable); err != nil {
+		return nil, err
+	}
+	if err := config.ensureTableExisits(revisionsTable); err != nil {
+		return nil, err
+	}
+	if err := config.ensureTableExisits(paymentsTable); err != nil {
+		return nil, err
+	}
 
 	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
 	if err != nil {
@@ -48,6 +61,27 @@ func newMySQLEventsDB(config MySQLConfig) (*eventDB, error) {
 	if eventDB.delete, err = conn.Prepare(deleteEventStatement); err != nil {
 		return nil, fmt.Errorf("mysql: prepare delete event db: %v", err)
 	}
+	if eventDB.bury, err = conn.Prepare(buryEventStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare bury event db: %v", err)
+	}
+	if eventDB.tombstones, err = conn.Prepare(listTombstonesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list tombstones event db: %v", err)
+	}
+	if eventDB.tombstone, err = conn.Prepare(getTombstoneStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get tombstone event db: %v", err)
+	}
+	if eventDB.allTombstones, err = conn.Prepare(listAllTombstonesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list all tombstones event db: %v", err)
+	}
+	if eventDB.addTombstone, err = conn.Prepare(addTombstoneStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare add tombstone event db: %v", err)
+	}
+	if eventDB.addRevision, err = conn.Prepare(insertRevisionStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare add revision event db: %v", err)
+	}
+	if eventDB.setPayment, err = conn.Prepare(setPaymentStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare set payment event db: %v", err)
+	}
 
 	return eventDB, nil
 
@@ -64,8 +98,25 @@ func scanEvent(s rowScanner) (*Event, error) {
 		membersMax  int64
 		lottery     bool
 		description string
+
+		deprioritizeNoShows bool
+		splitMethod         string
+		fixedShare          int64
+		fee                 int64
+		currency            string
+		seriesName          string
+		createdAt           string
+		venue               string
+		latitude            sql.NullFloat64
+		longitude           sql.NullFloat64
+		groupID             string
+		visibility          string
+		cancelledAt         sql.NullString
+		cancelReason        string
 	)
-	if err := s.Scan(&hostID, &eventName, &date, &deadline, &location, &membersMax, &lottery, &description); err != nil {
+	if err := s.Scan(&hostID, &eventName, &date, &deadline, &location, &membersMax, &lottery, &description,
+		&deprioritizeNoShows, &splitMethod, &fixedShare, &fee, &currency, &seriesName, &createdAt,
+		&venue, &latitude, &longitude, &groupID, &visibility, &cancelledAt, &cancelReason); err != nil {
 		return nil, err
 	}
 
@@ -78,6 +129,22 @@ func scanEvent(s rowScanner) (*Event, error) {
 		MembersMax:  membersMax,
 		Lottery:     lottery,
 		Description: description,
+
+		DeprioritizeNoShows: deprioritizeNoShows,
+		SplitMethod:         splitMethod,
+		FixedShare:          fixedShare,
+		Fee:                 fee,
+		Currency:            currency,
+		SeriesName:          seriesName,
+		CreatedAt:           createdAt,
+		Venue:               venue,
+		GroupID:             groupID,
+		Visibility:          visibility,
+		CancelledAt:         cancelledAt.String,
+		CancelReason:        cancelReason,
+	}
+	if latitude.Valid && longitude.Valid {
+		event.Coordinates = &geo.Point{Latitude: latitude.Float64, Longitude: longitude.Float64}
 	}
 
 	return event, nil
@@ -137,13 +204,167 @@ func (eventDB *eventDB) ListEventsHostedBy(hostID string) ([]*Event, error) {
 	return events, nil
 }
 
+// visibleTo selects the events a viewer may see listed: public events, and
+// the events they host, organize, joined or were invited to.
+const visibleTo = `(visibility = ? OR host_id = ?
+	OR EXISTS (SELECT 1 FROM organizers o
+		WHERE o.host_id = events.host_id AND o.event_name = events.event_name AND o.user_id = ?)
+	OR EXISTS (SELECT 1 FROM participants p
+		WHERE p.host_id = events.host_id AND p.event_name = events.event_name AND p.participant_id = ?)
+	OR EXISTS (SELECT 1 FROM guests g
+		WHERE g.host_id = events.host_id AND g.event_name = events.event_name AND g.user_id = ?))`
+
+// QueryEvents returns a page of the events matching a query. Filters and
+// the order are applied by MySQL, so that a page is read without reading the
+// events before it.
+func (eventDB *eventDB) QueryEvents(q *EventQuery) (*EventPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	column, desc, _ := sortColumn(q.Sort)
+	keyLen := 2
+	if computed(column) {
+		keyLen = 0
+	}
+	c, err := decodeCursor(q.Cursor, q.Sort, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	search := booleanQuery(searchTerms(q.Keywords))
+	if search != "" {
+		where = append(where, matchEvents)
+		args = append(args, search)
+	}
+	if q.Viewer == "" {
+		where = append(where, "visibility = ?")
+		args = append(args, VisibilityPublic)
+	} else {
+		where = append(where, visibleTo)
+		args = append(args, VisibilityPublic, q.Viewer, q.Viewer, q.Viewer, q.Viewer)
+	}
+	if !q.IncludeCancelled {
+		where = append(where, "cancelled_at IS NULL")
+	}
+	if q.HostID != "" {
+		where = append(where, "host_id = ?")
+		args = append(args, q.HostID)
+	}
+	if q.GroupID != "" {
+		where = append(where, "group_id = ?")
+		args = append(args, q.GroupID)
+	}
+	if q.From != "" {
+		where = append(where, "date >= ?")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where = append(where, "date < ?")
+		args = append(args, q.To)
+	}
+	if q.Location != "" {
+		where = append(where, "location LIKE ?")
+		args = append(args, likePattern(q.Location))
+	}
+	switch q.Status {
+	case EventOpen:
+		where = append(where, "deadline > ?")
+		args = append(args, q.Now.In(Timezone).Format(TimeLayout))
+	case EventClosed:
+		where = append(where, "deadline <= ?")
+		args = append(args, q.Now.In(Timezone).Format(TimeLayout))
+	}
+	if q.HasCapacity {
+		where = append(where, `(members_max IS NULL OR members_max <= 0 OR members_max > (
+			SELECT COUNT(*) FROM participants p
+			WHERE p.host_id = events.host_id AND p.event_name = events.event_name AND p.status IN (?, ?)))`)
+		args = append(args, StatusConfirmed, StatusPendingPayment)
+	}
+	if q.Radius > 0 {
+		// The box lets MySQL use the index on the coordinates.
+		sw, ne := q.Near.Bounds(q.Radius)
+		where = append(where, "latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", distanceFrom+" <= ?")
+		args = append(args, sw.Latitude, ne.Latitude, sw.Longitude, ne.Longitude,
+			q.Near.Longitude, q.Near.Latitude, q.Radius)
+	}
+
+	order, after := "ASC", ">"
+	if desc {
+		order, after = "DESC", "<"
+	}
+	if c != nil && !computed(column) {
+		where = append(where, fmt.Sprintf("(%s, host_id, event_name) %s (?, ?, ?)", column, after))
+		args = append(args, c.Value, c.Key[0], c.Key[1])
+	}
+
+	query := "SELECT * FROM events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	switch column {
+	case relevance:
+		query += " ORDER BY " + matchEvents + " DESC, host_id, event_name"
+		args = append(args, search)
+	case distance:
+		// Events that were not located come last.
+		query += " ORDER BY latitude IS NULL, " + distanceFrom + ", host_id, event_name"
+		args = append(args, q.Near.Longitude, q.Near.Latitude)
+	default:
+		query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, host_id %[2]s, event_name %[2]s", column, order)
+	}
+	offset := 0
+	if q.Limit > 0 {
+		// One more row tells whether there is a next page.
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+		if c != nil && computed(column) {
+			offset = c.Offset
+			query += " OFFSET ?"
+			args = append(args, offset)
+		}
+	}
+
+	rows, err := eventDB.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not query events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: could not read rows: %v", err)
+	}
+	return eventPage(events, q.Limit, q.Sort, column, offset), nil
+}
+
+// matchEvents matches events against a boolean mode search, using the
+// FULLTEXT index with the ngram parser so that Japanese text, which is not
+// separated by spaces, can be searched.
+const matchEvents = "MATCH (event_name, description, location) AGAINST (? IN BOOLEAN MODE)"
+
+// distanceFrom is the distance of an event in meters from a point given by
+// its longitude and latitude.
+const distanceFrom = "ST_Distance_Sphere(POINT(longitude, latitude), POINT(?, ?))"
+
 const getEventStatementWithHostId = "SELECT * FROM events WHERE host_id = ? AND event_name = ?"
 
 // GetEvent retrieves a event by its ID.
 func (eventDB *eventDB) GetEvent(hostID, eventName string) (*Event, error) {
 	event, err := scanEvent(eventDB.get.QueryRow(hostID, eventName))
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("mysql: could not find event with id %d", hostID)
+		return nil, fmt.Errorf("mysql: could not find event %s hosted by %s", eventName, hostID)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("mysql: could not get event: %v", err)
@@ -153,14 +374,20 @@ func (eventDB *eventDB) GetEvent(hostID, eventName string) (*Event, error) {
 
 const insertEventStatement = `
 	INSERT INTO events (
-	host_id, event_name, date, deadline, location, members_max, lottery, description 
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	host_id, event_name, date, deadline, location, members_max, lottery, description,
+	deprioritize_no_shows, split_method, fixed_share, fee, currency, series_name, created_at,
+	venue, latitude, longitude, group_id, visibility, cancelled_at, cancel_reason
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-// AddEvent saves a given event.
+// AddEvent saves a given event. Its creation time is now unless set, as it
+// is when the event is restored from a backup.
 func (eventDB *eventDB) AddEvent(e *Event) error {
+	latitude, longitude := coordinates(e)
 	_, err := execAffectingOneRow(eventDB.insert, e.HostID, e.EventName,
-		e.Date, e.Deadline, e.Location, e.MembersMax, e.Lottery, e.Description)
+		e.Date, e.Deadline, e.Location, e.MembersMax, e.Lottery, e.Description, e.DeprioritizeNoShows,
+		splitMethod(e), e.FixedShare, e.Fee, currency(e), e.SeriesName, createdAt(e),
+		e.Venue, latitude, longitude, e.GroupID, visibility(e), nullString(e.CancelledAt), e.CancelReason)
 	if err != nil {
 		return err
 	}
@@ -169,7 +396,9 @@ func (eventDB *eventDB) AddEvent(e *Event) error {
 
 const updateEventStatement = `
 	UPDATE events 
-	SET host_id=?, event_name=?, date=?, deadline=?, location=?, members_max=?, lottery=?, description=?
+	SET date=?, deadline=?, location=?, members_max=?, lottery=?, description=?, deprioritize_no_shows=?,
+	split_method=?, fixed_share=?, fee=?, currency=?, series_name=?, venue=?, latitude=?, longitude=?, group_id=?,
+	visibility=?, cancelled_at=?, cancel_reason=?
 	WHERE host_id = ? AND event_name = ?`
 
 // UpdateEvent updates the entry for a given event.
@@ -178,18 +407,233 @@ func (eventDB *eventDB) UpdateEvent(e *Event) error {
 		return errors.New("mysql: event with unassigned host ID and event name passed into updateEvent")
 	}
 
-	_, err := execAffectingOneRow(eventDB.update, e.HostID, e.EventName)
+	return updateEvent(eventDB.update, e)
+}
+
+// updateEvent updates the entry for a given event with update, the prepared
+// updateEventStatement or the same in a transaction.
+func updateEvent(update *sql.Stmt, e *Event) error {
+	latitude, longitude := coordinates(e)
+	_, err := execAffectingOneRow(update, e.Date, e.Deadline, e.Location, e.MembersMax, e.Lottery,
+		e.Description, e.DeprioritizeNoShows, splitMethod(e), e.FixedShare,
+		e.Fee, currency(e), e.SeriesName, e.Venue, latitude, longitude, e.GroupID, visibility(e),
+		nullString(e.CancelledAt), e.CancelReason, e.HostID, e.EventName)
 	return err
 }
 
+// EditEvent updates the entry for a given event and saves given versions of
+// it in one transaction.
+func (eventDB *eventDB) EditEvent(e *Event, revisions ...*Revision) error {
+	if e.HostID == "" && e.EventName == "" {
+		return errors.New("mysql: event with unassigned host ID and event name passed into editEvent")
+	}
+
+	tx, err := eventDB.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("mysql: could not begin transaction: %v", err)
+	}
+	if err := updateEvent(tx.Stmt(eventDB.update), e); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, r := range revisions {
+		if r.HostID != e.HostID || r.EventName != e.EventName {
+			tx.Rollback()
+			return fmt.Errorf("mysql: revision of event %s passed into editEvent of %s", r.EventName, e.EventName)
+		}
+		if _, err := execAffectingOneRow(tx.Stmt(eventDB.addRevision), r.HostID, r.EventName, r.Version, r.Date, r.Location, r.MembersMax, r.EditorID, r.Notify, r.EditedAt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CancelEvent updates the entry for a given event and saves given payment
+// records of it in one transaction.
+func (eventDB *eventDB) CancelEvent(e *Event, payments ...*Payment) error {
+	if e.HostID == "" && e.EventName == "" {
+		return errors.New("mysql: event with unassigned host ID and event name passed into cancelEvent")
+	}
+
+	tx, err := eventDB.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("mysql: could not begin transaction: %v", err)
+	}
+	if err := updateEvent(tx.Stmt(eventDB.update), e); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, p := range payments {
+		if p.HostID != e.HostID || p.EventName != e.EventName || p.ParticipantID == "" {
+			tx.Rollback()
+			return fmt.Errorf("mysql: payment of event %s passed into cancelEvent of %s", p.EventName, e.EventName)
+		}
+		if _, err := tx.Stmt(eventDB.setPayment).Exec(p.HostID, p.EventName, p.ParticipantID, p.Amount, p.Currency,
+			p.Status, p.UpdatedAt, p.UpdatedBy, p.Provider, p.ChargeID, nullString(p.OrderID)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("mysql: could not execute statement: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// splitMethod returns the split method of an event, defaulting to SplitEqual.
+func splitMethod(e *Event) string {
+	if e.SplitMethod == "" {
+		return SplitEqual
+	}
+	return e.SplitMethod
+}
+
+// visibility returns the visibility of an event, defaulting to
+// VisibilityPublic.
+func visibility(e *Event) string {
+	if e.Visibility == "" {
+		return VisibilityPublic
+	}
+	return e.Visibility
+}
+
+// coordinates returns the latitude and longitude of an event, which are NULL
+// if it was not located.
+func coordinates(e *Event) (latitude, longitude sql.NullFloat64) {
+	if e.Coordinates == nil {
+		return latitude, longitude
+	}
+	return sql.NullFloat64{Float64: e.Coordinates.Latitude, Valid: true},
+		sql.NullFloat64{Float64: e.Coordinates.Longitude, Valid: true}
+}
+
+// createdAt returns the creation time of an event, defaulting to now.
+func createdAt(e *Event) string {
+	if e.CreatedAt == "" {
+		return time.Now().In(Timezone).Format(TimeLayout)
+	}
+	return e.CreatedAt
+}
+
+// currency returns the currency of an event's fee, defaulting to JPY.
+func currency(e *Event) string {
+	if e.Currency == "" {
+		return "JPY"
+	}
+	return e.Currency
+}
+
 const deleteEventStatement = "DELETE FROM events WHERE host_id = ? AND event_name = ?"
 
-// DeleteEvent removes a given event by its host ID and event Name
+const buryEventStatement = `
+	REPLACE INTO tombstones (host_id, event_name, date, location, deleted_at)
+	SELECT host_id, event_name, date, location, ? FROM events
+	WHERE host_id = ? AND event_name = ?`
+
+// DeleteEvent removes a given event by its host ID and event Name, and
+// leaves a tombstone in its place.
 func (eventDB *eventDB) DeleteEvent(hostID, eventName string) error {
 	if hostID == "" && eventName == "" {
 		return errors.New("mysql: book with unassigned ID passed into deleteEvent")
 	}
 
+	tx, err := eventDB.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("mysql: could not begin transaction: %v", err)
+	}
+	now := time.Now().In(Timezone).Format(TimeLayout)
+	if _, err := tx.Stmt(eventDB.bury).Exec(now, hostID, eventName); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("mysql: could not bury event: %v", err)
+	}
+	if _, err := execAffectingOneRow(tx.Stmt(eventDB.delete), hostID, eventName); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DiscardEvent removes an event by its host ID and event name without
+// leaving a tombstone.
+func (eventDB *eventDB) DiscardEvent(hostID, eventName string) error {
+	if hostID == "" && eventName == "" {
+		return errors.New("mysql: event with unassigned ID passed into discardEvent")
+	}
+
 	_, err := execAffectingOneRow(eventDB.delete, hostID, eventName)
 	return err
 }
+
+// scanTombstone reads a tombstone from a sql.Row or sql.Rows
+func scanTombstone(s rowScanner) (*Tombstone, error) {
+	var t Tombstone
+	if err := s.Scan(&t.HostID, &t.EventName, &t.Date, &t.Location, &t.DeletedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+const listTombstonesStatement = "SELECT * FROM tombstones WHERE host_id = ? ORDER BY date"
+
+// ListTombstonesHostedBy returns the tombstones of the events a given host
+// deleted.
+func (eventDB *eventDB) ListTombstonesHostedBy(hostID string) ([]*Tombstone, error) {
+	return listTombstones(eventDB.tombstones, hostID)
+}
+
+const listAllTombstonesStatement = "SELECT * FROM tombstones ORDER BY host_id, date"
+
+// ListTombstones returns the tombstones of all deleted events.
+func (eventDB *eventDB) ListTombstones() ([]*Tombstone, error) {
+	return listTombstones(eventDB.allTombstones)
+}
+
+// listTombstones runs a query listing tombstones.
+func listTombstones(stmt *sql.Stmt, args ...interface{}) ([]*Tombstone, error) {
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tombstones []*Tombstone
+	for rows.Next() {
+		t, err := scanTombstone(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		tombstones = append(tombstones, t)
+	}
+
+	return tombstones, nil
+}
+
+const getTombstoneStatement = "SELECT * FROM tombstones WHERE host_id = ? AND event_name = ?"
+
+// GetTombstone retrieves the tombstone of a deleted event.
+func (eventDB *eventDB) GetTombstone(hostID, eventName string) (*Tombstone, error) {
+	t, err := scanTombstone(eventDB.tombstone.QueryRow(hostID, eventName))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find tombstone of event %s hosted by %s", eventName, hostID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get tombstone: %v", err)
+	}
+	return t, nil
+}
+
+const addTombstoneStatement = `
+	REPLACE INTO tombstones (host_id, event_name, date, location, deleted_at)
+	VALUES (?, ?, ?, ?, ?)`
+
+// AddTombstone saves a given tombstone.
+func (eventDB *eventDB) AddTombstone(t *Tombstone) error {
+	if t.HostID == "" || t.EventName == "" {
+		return errors.New("mysql: tombstone with unassigned host ID and event name passed into addTombstone")
+	}
+
+	_, err := eventDB.addTombstone.Exec(t.HostID, t.EventName, t.Date, t.Location, t.DeletedAt)
+	if err != nil {
+		return fmt.Errorf("mysql: could not execute statement: %v", err)
+	}
+	return nil
+}
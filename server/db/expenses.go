@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type expenseDB struct {
+	*mysqlDB
+}
+
+// newMySQLExpensesDB creates a new ExpenseDatabase backed by a given MySQL server.
+func newMySQLExpensesDB(config MySQLConfig) (*expenseDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(expensesTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	expenseDB := &expenseDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. addExpense)
+
+	if expenseDB.list, err = conn.Prepare(listExpensesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in expense db: %v", err)
+	}
+	if expenseDB.insert, err = conn.Prepare(insertExpenseStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in expense db: %v", err)
+	}
+	if expenseDB.delete, err = conn.Prepare(deleteExpenseStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare delete in expense db: %v", err)
+	}
+
+	return expenseDB, nil
+}
+
+// scanExpense reads an expense from a sql.Row or sql.Rows
+func scanExpense(s rowScanner) (*Expense, error) {
+	var (
+		expenseID   int64
+		hostID      string
+		eventName   string
+		payerID     string
+		amount      int64
+		currency    string
+		description sql.NullString
+	)
+	if err := s.Scan(&expenseID, &hostID, &eventName, &payerID, &amount, &currency, &description); err != nil {
+		return nil, err
+	}
+
+	expense := &Expense{
+		ExpenseID:   expenseID,
+		HostID:      hostID,
+		EventName:   eventName,
+		PayerID:     payerID,
+		Amount:      amount,
+		Currency:    currency,
+		Description: description.String,
+	}
+
+	return expense, nil
+}
+
+const listExpensesStatement = `
+	SELECT * FROM expenses
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY expense_id
+`
+
+// ListExpenses returns the expenses of a given event, in the order they were added.
+func (expenseDB *expenseDB) ListExpenses(hostID, eventName string) ([]*Expense, error) {
+	rows, err := expenseDB.list.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expenses []*Expense
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		expenses = append(expenses, expense)
+	}
+
+	return expenses, nil
+}
+
+const insertExpenseStatement = `
+	INSERT INTO expenses (
+	host_id, event_name, payer_id, amount, currency, description
+	) VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+// AddExpense saves a given expense and assigns its ID.
+func (expenseDB *expenseDB) AddExpense(e *Expense) error {
+	r, err := execAffectingOneRow(expenseDB.insert, e.HostID, e.EventName, e.PayerID, e.Amount, e.Currency, e.Description)
+	if err != nil {
+		return err
+	}
+
+	lastInsertID, err := r.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("mysql: could not get last insert ID: %v", err)
+	}
+	e.ExpenseID = lastInsertID
+	return nil
+}
+
+const deleteExpenseStatement = "DELETE FROM expenses WHERE host_id = ? AND event_name = ? AND expense_id = ?"
+
+// DeleteExpense removes an expense of a given event by its ID.
+func (expenseDB *expenseDB) DeleteExpense(hostID, eventName string, expenseID int64) error {
+	if expenseID == 0 {
+		return errors.New("mysql: expense with unassigned ID passed into deleteExpense")
+	}
+
+	_, err := execAffectingOneRow(expenseDB.delete, hostID, eventName, expenseID)
+	return err
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type feedbackDB struct {
+	*mysqlDB
+}
+
+// newMySQLFeedbackDB creates a new FeedbackDatabase backed by a given MySQL server.
+func newMySQLFeedbackDB(config MySQLConfig) (*feedbackDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(feedbackTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	feedbackDB := &feedbackDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. setFeedback)
+
+	if feedbackDB.list, err = conn.Prepare(listFeedbackStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in feedback db: %v", err)
+	}
+	if feedbackDB.get, err = conn.Prepare(getFeedbackStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get in feedback db: %v", err)
+	}
+	if feedbackDB.insert, err = conn.Prepare(setFeedbackStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in feedback db: %v", err)
+	}
+
+	return feedbackDB, nil
+}
+
+// scanFeedback reads a response to a survey from a sql.Row or sql.Rows
+func scanFeedback(s rowScanner) (*Feedback, error) {
+	var (
+		hostID      string
+		eventName   string
+		userID      string
+		rating      int64
+		comment     sql.NullString
+		answers     sql.NullString
+		submittedAt string
+	)
+	err := s.Scan(&hostID, &eventName, &userID, &rating, &comment, &answers, &submittedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	feedback := &Feedback{
+		HostID:      hostID,
+		EventName:   eventName,
+		UserID:      userID,
+		Rating:      rating,
+		Comment:     comment.String,
+		SubmittedAt: submittedAt,
+	}
+	if feedback.Answers, err = decodeAnswers(answers); err != nil {
+		return nil, err
+	}
+
+	return feedback, nil
+}
+
+const listFeedbackStatement = `
+	SELECT * FROM feedback
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY submitted_at, user_id
+`
+
+// ListFeedback returns the responses to the survey of a given event, in the
+// order they were submitted.
+func (feedbackDB *feedbackDB) ListFeedback(hostID, eventName string) ([]*Feedback, error) {
+	rows, err := feedbackDB.list.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feedback []*Feedback
+	for rows.Next() {
+		response, err := scanFeedback(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		feedback = append(feedback, response)
+	}
+
+	return feedback, nil
+}
+
+const getFeedbackStatement = "SELECT * FROM feedback WHERE host_id = ? AND event_name = ? AND user_id = ?"
+
+// GetFeedback retrieves a participant's response to the survey of an event.
+func (feedbackDB *feedbackDB) GetFeedback(hostID, eventName, userID string) (*Feedback, error) {
+	feedback, err := scanFeedback(feedbackDB.get.QueryRow(hostID, eventName, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find feedback of %s on event %s", userID, eventName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get feedback: %v", err)
+	}
+	return feedback, nil
+}
+
+const setFeedbackStatement = `
+	INSERT INTO feedback (host_id, event_name, user_id, rating, comment, answers, submitted_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE rating=VALUES(rating), comment=VALUES(comment), answers=VALUES(answers),
+	submitted_at=VALUES(submitted_at)
+	`
+
+// SetFeedback saves a given response, replacing any previous response of the
+// same participant.
+func (feedbackDB *feedbackDB) SetFeedback(f *Feedback) error {
+	if f.HostID == "" || f.EventName == "" || f.UserID == "" {
+		return errors.New("mysql: feedback with unassigned ID passed into setFeedback")
+	}
+
+	answers, err := encodeAnswers(f.Answers)
+	if err != nil {
+		return err
+	}
+	_, err = feedbackDB.insert.Exec(f.HostID, f.EventName, f.UserID, f.Rating, nullString(f.Comment), answers, f.SubmittedAt)
+	if err != nil {
+		return fmt.Errorf("mysql: could not execute statement: %v", err)
+	}
+	return nil
+}
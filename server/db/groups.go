@@ -0,0 +1,124 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type groupDB struct {
+	*mysqlDB
+}
+
+// newMySQLGroupsDB creates a new GroupDatabase backed by a given MySQL server.
+func newMySQLGroupsDB(config MySQLConfig) (*groupDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(groupsTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	groupDB := &groupDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. setGroup)
+
+	if groupDB.list, err = conn.Prepare(listGroupsStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in group db: %v", err)
+	}
+	if groupDB.get, err = conn.Prepare(getGroupStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get in group db: %v", err)
+	}
+	if groupDB.insert, err = conn.Prepare(setGroupStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in group db: %v", err)
+	}
+
+	return groupDB, nil
+}
+
+// scanGroup reads a group from a sql.Row or sql.Rows
+func scanGroup(s rowScanner) (*Group, error) {
+	var (
+		groupID  string
+		kind     string
+		joinedAt string
+		leftAt   sql.NullString
+	)
+	if err := s.Scan(&groupID, &kind, &joinedAt, &leftAt); err != nil {
+		return nil, err
+	}
+
+	group := &Group{
+		GroupID:  groupID,
+		Kind:     kind,
+		JoinedAt: joinedAt,
+		LeftAt:   leftAt.String,
+	}
+
+	return group, nil
+}
+
+const listGroupsStatement = "SELECT * FROM line_groups ORDER BY group_id"
+
+// ListGroups returns all groups, including those the bot left.
+func (groupDB *groupDB) ListGroups() ([]*Group, error) {
+	rows, err := groupDB.list.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*Group
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+const getGroupStatement = "SELECT * FROM line_groups WHERE group_id = ?"
+
+// GetGroup retrieves a group by its ID.
+func (groupDB *groupDB) GetGroup(groupID string) (*Group, error) {
+	group, err := scanGroup(groupDB.get.QueryRow(groupID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find group %s", groupID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get group: %v", err)
+	}
+	return group, nil
+}
+
+const setGroupStatement = `
+	INSERT INTO line_groups (group_id, kind, joined_at, left_at) VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE kind=VALUES(kind), joined_at=VALUES(joined_at), left_at=VALUES(left_at)
+	`
+
+// SetGroup saves a given group, replacing the group with the same ID.
+func (groupDB *groupDB) SetGroup(g *Group) error {
+	if g.GroupID == "" {
+		return errors.New("mysql: group with unassigned ID passed into setGroup")
+	}
+
+	_, err := groupDB.insert.Exec(g.GroupID, g.Kind, g.JoinedAt, nullString(g.LeftAt))
+	if err != nil {
+		return fmt.Errorf("mysql: could not execute statement: %v", err)
+	}
+	return nil
+}
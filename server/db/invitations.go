@@ -0,0 +1,289 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type invitationDB struct {
+	*mysqlDB
+	lock     *sql.Stmt
+	use      *sql.Stmt
+	guests   *sql.Stmt
+	guest    *sql.Stmt
+	addGuest *sql.Stmt
+}
+
+// newMySQLInvitationsDB creates a new InvitationDatabase backed by a given MySQL server.
+func newMySQLInvitationsDB(config MySQLConfig) (*invitationDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(invitationsTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	invitationDB := &invitationDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. redeemInvitation)
+
+	if invitationDB.list, err = conn.Prepare(listInvitationsStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in invitation db: %v", err)
+	}
+	if invitationDB.get, err = conn.Prepare(getInvitationStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get in invitation db: %v", err)
+	}
+	if invitationDB.insert, err = conn.Prepare(insertInvitationStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in invitation db: %v", err)
+	}
+	if invitationDB.delete, err = conn.Prepare(deleteInvitationStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare delete in invitation db: %v", err)
+	}
+	if invitationDB.lock, err = conn.Prepare(lockInvitationStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare lock in invitation db: %v", err)
+	}
+	if invitationDB.use, err = conn.Prepare(useInvitationStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare use in invitation db: %v", err)
+	}
+	if invitationDB.guests, err = conn.Prepare(listGuestsStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list guests in invitation db: %v", err)
+	}
+	if invitationDB.guest, err = conn.Prepare(getGuestStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get guest in invitation db: %v", err)
+	}
+	if invitationDB.addGuest, err = conn.Prepare(addGuestStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare add guest in invitation db: %v", err)
+	}
+
+	return invitationDB, nil
+}
+
+// scanInvitation reads an invitation from a sql.Row or sql.Rows
+func scanInvitation(s rowScanner) (*Invitation, error) {
+	var (
+		code      string
+		hostID    string
+		eventName string
+		maxUses   int64
+		uses      int64
+		expiresAt sql.NullString
+		createdBy string
+		createdAt string
+	)
+	if err := s.Scan(&code, &hostID, &eventName, &maxUses, &uses, &expiresAt, &createdBy, &createdAt); err != nil {
+		return nil, err
+	}
+
+	invitation := &Invitation{
+		Code:      code,
+		HostID:    hostID,
+		EventName: eventName,
+		MaxUses:   maxUses,
+		Uses:      uses,
+		ExpiresAt: expiresAt.String,
+		CreatedBy: createdBy,
+		CreatedAt: createdAt,
+	}
+
+	return invitation, nil
+}
+
+const listInvitationsStatement = `
+	SELECT * FROM invitations
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY created_at DESC, code
+`
+
+// ListInvitations returns the invitations to a given event, newest first.
+func (invitationDB *invitationDB) ListInvitations(hostID, eventName string) ([]*Invitation, error) {
+	rows, err := invitationDB.list.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []*Invitation
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, nil
+}
+
+const getInvitationStatement = "SELECT * FROM invitations WHERE code = ?"
+
+// GetInvitation retrieves an invitation by its code.
+func (invitationDB *invitationDB) GetInvitation(code string) (*Invitation, error) {
+	invitation, err := scanInvitation(invitationDB.get.QueryRow(code))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find invitation %s", code)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get invitation: %v", err)
+	}
+	return invitation, nil
+}
+
+const insertInvitationStatement = `
+	INSERT INTO invitations (
+	code, host_id, event_name, max_uses, uses, expires_at, created_by, created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+// AddInvitation saves a given invitation.
+func (invitationDB *invitationDB) AddInvitation(i *Invitation) error {
+	if i.Code == "" {
+		return errors.New("mysql: invitation with unassigned code passed into addInvitation")
+	}
+
+	_, err := execAffectingOneRow(invitationDB.insert, i.Code, i.HostID, i.EventName, i.MaxUses, i.Uses,
+		nullString(i.ExpiresAt), i.CreatedBy, i.CreatedAt)
+	return err
+}
+
+const deleteInvitationStatement = "DELETE FROM invitations WHERE code = ?"
+
+// DeleteInvitation revokes an invitation. Its guests stay guests.
+func (invitationDB *invitationDB) DeleteInvitation(code string) error {
+	if code == "" {
+		return errors.New("mysql: invitation with unassigned code passed into deleteInvitation")
+	}
+
+	_, err := execAffectingOneRow(invitationDB.delete, code)
+	return err
+}
+
+const lockInvitationStatement = "SELECT * FROM invitations WHERE code = ? FOR UPDATE"
+
+const useInvitationStatement = "UPDATE invitations SET uses = uses + 1 WHERE code = ?"
+
+// RedeemInvitation makes a user a guest of the event of an invitation at a
+// given time and counts the use. The invitation is locked until the guest is
+// saved, so that it is not redeemed more often than it may be.
+func (invitationDB *invitationDB) RedeemInvitation(code, userID, now string) (*Guest, error) {
+	at, err := ParseTime(now)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := invitationDB.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not begin transaction: %v", err)
+	}
+	invitation, err := scanInvitation(tx.Stmt(invitationDB.lock).QueryRow(code))
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, fmt.Errorf("mysql: could not find invitation %s", code)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("mysql: could not get invitation: %v", err)
+	}
+
+	guest, err := scanGuest(tx.Stmt(invitationDB.guest).QueryRow(invitation.HostID, invitation.EventName, userID))
+	if err == nil {
+		return guest, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		tx.Rollback()
+		return nil, fmt.Errorf("mysql: could not get guest: %v", err)
+	}
+
+	if err := invitation.Usable(at); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := execAffectingOneRow(tx.Stmt(invitationDB.use), code); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	guest = &Guest{
+		HostID:    invitation.HostID,
+		EventName: invitation.EventName,
+		UserID:    userID,
+		Code:      code,
+		GrantedAt: now,
+	}
+	if _, err := execAffectingOneRow(tx.Stmt(invitationDB.addGuest),
+		guest.HostID, guest.EventName, guest.UserID, guest.Code, guest.GrantedAt); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return guest, tx.Commit()
+}
+
+// scanGuest reads a guest from a sql.Row or sql.Rows
+func scanGuest(s rowScanner) (*Guest, error) {
+	var g Guest
+	if err := s.Scan(&g.HostID, &g.EventName, &g.UserID, &g.Code, &g.GrantedAt); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+const listGuestsStatement = `
+	SELECT * FROM guests
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY granted_at, user_id
+`
+
+// ListGuests returns the guests of a given event.
+func (invitationDB *invitationDB) ListGuests(hostID, eventName string) ([]*Guest, error) {
+	rows, err := invitationDB.guests.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var guests []*Guest
+	for rows.Next() {
+		guest, err := scanGuest(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		guests = append(guests, guest)
+	}
+
+	return guests, nil
+}
+
+const getGuestStatement = "SELECT * FROM guests WHERE host_id = ? AND event_name = ? AND user_id = ?"
+
+// GetGuest retrieves a guest of an event by their user ID.
+func (invitationDB *invitationDB) GetGuest(hostID, eventName, userID string) (*Guest, error) {
+	guest, err := scanGuest(invitationDB.guest.QueryRow(hostID, eventName, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find guest %s of event %s", userID, eventName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get guest: %v", err)
+	}
+	return guest, nil
+}
+
+const addGuestStatement = `
+	INSERT INTO guests (host_id, event_name, user_id, code, granted_at) VALUES (?, ?, ?, ?, ?)
+	`
+
+// AddGuest saves a given guest without redeeming an invitation.
+func (invitationDB *invitationDB) AddGuest(g *Guest) error {
+	_, err := execAffectingOneRow(invitationDB.addGuest, g.HostID, g.EventName, g.UserID, g.Code, g.GrantedAt)
+	return err
+}
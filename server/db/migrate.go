@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migration brings a table created by an earlier version of hashbill up to
+// date. CREATE TABLE IF NOT EXISTS leaves existing tables alone, so every
+// column or index added to a table after it was first created needs one.
+type migration struct {
+	name string
+
+	// applied counts the rows of information_schema that show the migration
+	// was applied, with the table name as its only argument.
+	applied string
+
+	statement string
+	table     string
+}
+
+// addColumn returns the migration adding a column after another one, so that
+// columns end up in the order SELECT * is scanned in.
+func addColumn(table, column, definition, after string) migration {
+	return migration{
+		name: fmt.Sprintf("add %s.%s", table, column),
+		applied: `SELECT COUNT(*) FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = 'event_list' AND TABLE_NAME = ? AND COLUMN_NAME = '` + column + `'`,
+		statement: fmt.Sprintf("ALTER TABLE event_list.%s ADD COLUMN %s %s AFTER %s", table, column, definition, after),
+		table:     table,
+	}
+}
+
+// addIndex returns the migration adding an index on some columns. The index
+// is taken to exist if its last column is the last column of any index.
+func addIndex(table, kind string, columns ...string) migration {
+	last := columns[len(columns)-1]
+	list := columns[0]
+	for _, c := range columns[1:] {
+		list += ", " + c
+	}
+	return migration{
+		name: fmt.Sprintf("add %s (%s) to %s", kind, list, table),
+		applied: `SELECT COUNT(*) FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = 'event_list' AND TABLE_NAME = ? AND COLUMN_NAME = '` + last + `'
+			AND SEQ_IN_INDEX = ` + fmt.Sprint(len(columns)),
+		statement: fmt.Sprintf("ALTER TABLE event_list.%s ADD %s (%s)", table, kind, list),
+		table:     table,
+	}
+}
+
+// addFullTextIndex returns a migration adding a FULLTEXT index with the ngram
+// parser, which splits text into bigrams and so works for Japanese.
+func addFullTextIndex(table string, columns ...string) migration {
+	m := addIndex(table, "FULLTEXT INDEX", columns...)
+	m.statement += " WITH PARSER ngram"
+	return m
+}
+
+// migrations are applied in order.
+var migrations = []migration{
+	addColumn(participantsTable, "status", "VARCHAR(32) NOT NULL DEFAULT 'confirmed'", "participant_id"),
+	addColumn(participantsTable, "checked_in_at", "DATETIME NULL", "status"),
+	addColumn(eventsTable, "deprioritize_no_shows", "BOOL NOT NULL DEFAULT FALSE", "description"),
+	addColumn(participantsTable, "applied_at", "DATETIME NULL", "checked_in_at"),
+	addColumn(participantsTable, "cancelled_at", "DATETIME NULL", "applied_at"),
+	addColumn(participantsTable, "attendance", "VARCHAR(32) NOT NULL DEFAULT ''", "cancelled_at"),
+	addColumn(eventsTable, "split_method", "VARCHAR(16) NOT NULL DEFAULT 'equal'", "deprioritize_no_shows"),
+	addColumn(eventsTable, "fixed_share", "BIGINT NOT NULL DEFAULT 0", "split_method"),
+	addColumn(participantsTable, "share_weight", "INT NOT NULL DEFAULT 1", "attendance"),
+	addColumn(eventsTable, "fee", "BIGINT NOT NULL DEFAULT 0", "fixed_share"),
+	addColumn(eventsTable, "currency", "VARCHAR(3) NOT NULL DEFAULT 'JPY'", "fee"),
+	addColumn(paymentsTable, "provider", "VARCHAR(32) NOT NULL DEFAULT ''", "updated_by"),
+	addColumn(paymentsTable, "charge_id", "VARCHAR(255) NOT NULL DEFAULT ''", "provider"),
+	addColumn(paymentsTable, "order_id", "VARCHAR(100) NULL", "charge_id"),
+	addIndex(paymentsTable, "UNIQUE", "order_id"),
+	addColumn(participantsTable, "tier", "VARCHAR(255) NOT NULL DEFAULT ''", "share_weight"),
+	addColumn(eventsTable, "series_name", "VARCHAR(255) NOT NULL DEFAULT ''", "currency"),
+	addIndex(eventsTable, "INDEX", "host_id", "series_name"),
+	addColumn(eventsTable, "created_at", "DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP", "series_name"),
+	addIndex(eventsTable, "INDEX", "date"),
+	addIndex(eventsTable, "INDEX", "deadline"),
+	addIndex(eventsTable, "INDEX", "created_at"),
+	addFullTextIndex(eventsTable, "event_name", "description", "location"),
+	addColumn(eventsTable, "venue", "VARCHAR(255) NOT NULL DEFAULT ''", "created_at"),
+	addColumn(eventsTable, "latitude", "DOUBLE NULL", "venue"),
+	addColumn(eventsTable, "longitude", "DOUBLE NULL", "latitude"),
+	addIndex(eventsTable, "INDEX", "latitude", "longitude"),
+	addColumn(eventsTable, "group_id", "VARCHAR(255) NOT NULL DEFAULT ''", "longitude"),
+	addIndex(eventsTable, "INDEX", "group_id"),
+	addColumn(eventsTable, "visibility", "VARCHAR(16) NOT NULL DEFAULT 'public'", "group_id"),
+	addIndex(eventsTable, "INDEX", "visibility"),
+	addColumn(participantsTable, "answers", "TEXT NULL", "tier"),
+	addColumn(questionsTable, "form", "VARCHAR(16) NOT NULL DEFAULT 'registration'", "required"),
+	addColumn(eventsTable, "cancelled_at", "DATETIME NULL", "visibility"),
+	addColumn(eventsTable, "cancel_reason", "VARCHAR(1024) NOT NULL DEFAULT ''", "cancelled_at"),
+	addColumn(participantsTable, "held_at", "DATETIME NULL", "answers"),
+}
+
+// migrate creates the tables that do not exist yet and applies the
+// migrations that were not applied yet. It returns the names of the
+// migrations it applied.
+func (config MySQLConfig) migrate() ([]string, error) {
+	if err := config.ensureTableExisits(usersTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName(""))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	defer conn.Close()
+	// createTable selects the database with USE, which holds only for the
+	// connection it runs on.
+	conn.SetMaxOpenConns(1)
+	if err := createTable(conn); err != nil {
+		return nil, fmt.Errorf("mysql: could not create tables: %v", err)
+	}
+
+	var applied []string
+	for _, m := range migrations {
+		var n int
+		if err := conn.QueryRow(m.applied, m.table).Scan(&n); err != nil {
+			return applied, fmt.Errorf("mysql: could not check migration %q: %v", m.name, err)
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := conn.Exec(m.statement); err != nil {
+			return applied, fmt.Errorf("mysql: could not apply migration %q: %v", m.name, err)
+		}
+		log.Printf("mysql: applied migration %q", m.name)
+		applied = append(applied, m.name)
+	}
+	return applied, nil
+}
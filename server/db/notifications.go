@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type notificationDB struct {
+	*mysqlDB
+}
+
+// newMySQLNotificationsDB creates a new NotificationDatabase backed by a given MySQL server.
+func newMySQLNotificationsDB(config MySQLConfig) (*notificationDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(notificationsTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	notificationDB := &notificationDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. addNotification)
+
+	if notificationDB.list, err = conn.Prepare(listNotificationsStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in notification db: %v", err)
+	}
+	if notificationDB.get, err = conn.Prepare(getNotificationStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get in notification db: %v", err)
+	}
+	if notificationDB.insert, err = conn.Prepare(insertNotificationStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in notification db: %v", err)
+	}
+	if notificationDB.delete, err = conn.Prepare(deleteNotificationStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare delete in notification db: %v", err)
+	}
+
+	return notificationDB, nil
+}
+
+const listNotificationsStatement = "SELECT * FROM notifications ORDER BY sent_at"
+
+// ListNotifications returns all recorded notifications.
+func (notificationDB *notificationDB) ListNotifications() ([]*Notification, error) {
+	rows, err := notificationDB.list.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.HostID, &n.EventName, &n.Kind, &n.RecipientID, &n.SentAt); err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		notifications = append(notifications, &n)
+	}
+
+	return notifications, nil
+}
+
+const getNotificationStatement = `
+	SELECT COUNT(*) FROM notifications
+	WHERE host_id = ? AND event_name = ? AND kind = ? AND recipient_id = ?`
+
+// HasNotification reports whether a given notification has already been recorded.
+func (notificationDB *notificationDB) HasNotification(n *Notification) (bool, error) {
+	var count int
+	err := notificationDB.get.QueryRow(n.HostID, n.EventName, n.Kind, n.RecipientID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("mysql: could not get notification: %v", err)
+	}
+	return count > 0, nil
+}
+
+const insertNotificationStatement = `
+	INSERT INTO notifications (
+	host_id, event_name, kind, recipient_id, sent_at
+	) VALUES (?, ?, ?, ?, ?)
+	`
+
+// AddNotification records a given notification.
+func (notificationDB *notificationDB) AddNotification(n *Notification) error {
+	_, err := execAffectingOneRow(notificationDB.insert, n.HostID, n.EventName, n.Kind, n.RecipientID, n.SentAt)
+	return err
+}
+
+const deleteNotificationStatement = `
+	DELETE FROM notifications
+	WHERE host_id = ? AND event_name = ? AND kind = ? AND recipient_id = ?`
+
+// DeleteNotification removes a given notification.
+func (notificationDB *notificationDB) DeleteNotification(n *Notification) error {
+	if n.HostID == "" || n.EventName == "" || n.Kind == "" || n.RecipientID == "" {
+		return errors.New("mysql: notification with unassigned ID passed into deleteNotification")
+	}
+
+	_, err := execAffectingOneRow(notificationDB.delete, n.HostID, n.EventName, n.Kind, n.RecipientID)
+	return err
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type organizerDB struct {
+	*mysqlDB
+	listedBy *sql.Stmt
+}
+
+// newMySQLOrganizersDB creates a new OrganizerDatabase backed by a given MySQL server.
+func newMySQLOrganizersDB(config MySQLConfig) (*organizerDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(organizersTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	organizerDB := &organizerDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. setOrganizer)
+
+	if organizerDB.list, err = conn.Prepare(listOrganizersStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in organizer db: %v", err)
+	}
+	if organizerDB.listedBy, err = conn.Prepare(listOrganizedByStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare listedBy in organizer db: %v", err)
+	}
+	if organizerDB.get, err = conn.Prepare(getOrganizerStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get in organizer db: %v", err)
+	}
+	if organizerDB.insert, err = conn.Prepare(setOrganizerStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in organizer db: %v", err)
+	}
+	if organizerDB.delete, err = conn.Prepare(deleteOrganizerStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare delete in organizer db: %v", err)
+	}
+
+	return organizerDB, nil
+}
+
+// scanOrganizer reads an organizer from a sql.Row or sql.Rows
+func scanOrganizer(s rowScanner) (*Organizer, error) {
+	var (
+		hostID    string
+		eventName string
+		userID    string
+		role      string
+		addedBy   string
+		addedAt   string
+	)
+	if err := s.Scan(&hostID, &eventName, &userID, &role, &addedBy, &addedAt); err != nil {
+		return nil, err
+	}
+
+	organizer := &Organizer{
+		HostID:    hostID,
+		EventName: eventName,
+		UserID:    userID,
+		Role:      role,
+		AddedBy:   addedBy,
+		AddedAt:   addedAt,
+	}
+
+	return organizer, nil
+}
+
+// queryOrganizers runs a statement listing organizers.
+func queryOrganizers(stmt *sql.Stmt, args ...interface{}) ([]*Organizer, error) {
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var organizers []*Organizer
+	for rows.Next() {
+		organizer, err := scanOrganizer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		organizers = append(organizers, organizer)
+	}
+
+	return organizers, nil
+}
+
+const listOrganizersStatement = `
+	SELECT * FROM organizers
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY added_at, user_id
+`
+
+// ListOrganizers returns the organizers of a given event, in the order they
+// were added.
+func (organizerDB *organizerDB) ListOrganizers(hostID, eventName string) ([]*Organizer, error) {
+	return queryOrganizers(organizerDB.list, hostID, eventName)
+}
+
+const listOrganizedByStatement = `
+	SELECT * FROM organizers
+	WHERE user_id = ?
+	ORDER BY host_id, event_name
+`
+
+// ListOrganizedBy returns the events a given user helps to organize.
+func (organizerDB *organizerDB) ListOrganizedBy(userID string) ([]*Organizer, error) {
+	return queryOrganizers(organizerDB.listedBy, userID)
+}
+
+const getOrganizerStatement = "SELECT * FROM organizers WHERE host_id = ? AND event_name = ? AND user_id = ?"
+
+// GetOrganizer retrieves an organizer of an event by their user ID.
+func (organizerDB *organizerDB) GetOrganizer(hostID, eventName, userID string) (*Organizer, error) {
+	organizer, err := scanOrganizer(organizerDB.get.QueryRow(hostID, eventName, userID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find organizer %s of event %s", userID, eventName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get organizer: %v", err)
+	}
+	return organizer, nil
+}
+
+const setOrganizerStatement = `
+	INSERT INTO organizers (host_id, event_name, user_id, role, added_by, added_at) VALUES (?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE role=VALUES(role), added_by=VALUES(added_by), added_at=VALUES(added_at)
+	`
+
+// SetOrganizer saves a given organizer, replacing their previous role.
+func (organizerDB *organizerDB) SetOrganizer(o *Organizer) error {
+	if o.HostID == "" || o.EventName == "" || o.UserID == "" {
+		return errors.New("mysql: organizer with unassigned ID passed into setOrganizer")
+	}
+
+	_, err := organizerDB.insert.Exec(o.HostID, o.EventName, o.UserID, o.Role, o.AddedBy, o.AddedAt)
+	if err != nil {
+		return fmt.Errorf("mysql: could not execute statement: %v", err)
+	}
+	return nil
+}
+
+const deleteOrganizerStatement = "DELETE FROM organizers WHERE host_id = ? AND event_name = ? AND user_id = ?"
+
+// DeleteOrganizer removes a given organizer from an event.
+func (organizerDB *organizerDB) DeleteOrganizer(hostID, eventName, userID string) error {
+	if hostID == "" || eventName == "" || userID == "" {
+		return errors.New("mysql: organizer with unassigned ID passed into deleteOrganizer")
+	}
+
+	_, err := execAffectingOneRow(organizerDB.delete, hostID, eventName, userID)
+	return err
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 )
@@ -35,6 +36,9 @@ func newMySQLParticipantsDB(config MySQLConfig) (*participantDB, error) {
 	if participantDB.listedBy, err = conn.Prepare(listParticipantHostedByStatement); err != nil {
 		return nil, fmt.Errorf("mysql: prepare listedby in participant db: %v", err)
 	}
+	if participantDB.listOf, err = conn.Prepare(listParticipationsOfStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list of in participant db: %v", err)
+	}
 	if participantDB.get, err = conn.Prepare(getParticipantStatement); err != nil {
 		return nil, fmt.Errorf("mysql: prepare get in participant db: %v", err)
 	}
@@ -47,6 +51,15 @@ func newMySQLParticipantsDB(config MySQLConfig) (*participantDB, error) {
 	if participantDB.delete, err = conn.Prepare(deleteParticipantStatement); err != nil {
 		return nil, fmt.Errorf("mysql: prepare delete in participant db: %v", err)
 	}
+	if participantDB.checkIn, err = conn.Prepare(checkInParticipantStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare check in in participant db: %v", err)
+	}
+	if participantDB.attendees, err = conn.Prepare(scanAttendeesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare attendees in participant db: %v", err)
+	}
+	if participantDB.lockEvent, err = conn.Prepare(lockEventStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare lock event in participant db: %v", err)
+	}
 
 	return participantDB, nil
 
@@ -58,8 +71,19 @@ func scanParticipant(s rowScanner) (*Participant, error) {
 		hostID        string
 		eventName     string
 		participantID string
+		status        string
+		checkedInAt   sql.NullString
+		appliedAt     sql.NullString
+		cancelledAt   sql.NullString
+		attendance    string
+		shareWeight   int64
+		tier          string
+		answers       sql.NullString
+		heldAt        sql.NullString
 	)
-	if err := s.Scan(&hostID, &eventName, &participantID); err != nil {
+	err := s.Scan(&hostID, &eventName, &participantID, &status, &checkedInAt,
+		&appliedAt, &cancelledAt, &attendance, &shareWeight, &tier, &answers, &heldAt)
+	if err != nil {
 		return nil, err
 	}
 
@@ -67,11 +91,47 @@ func scanParticipant(s rowScanner) (*Participant, error) {
 		HostID:        hostID,
 		EventName:     eventName,
 		ParticipantID: participantID,
+		Status:        status,
+		CheckedInAt:   checkedInAt.String,
+		AppliedAt:     appliedAt.String,
+		CancelledAt:   cancelledAt.String,
+		HeldAt:        heldAt.String,
+		Attendance:    attendance,
+		ShareWeight:   shareWeight,
+		Tier:          tier,
+	}
+	if participant.Answers, err = decodeAnswers(answers); err != nil {
+		return nil, err
 	}
 
 	return participant, nil
 }
 
+// encodeAnswers encodes answers to questions for an answers column, which is
+// NULL if there are none.
+func encodeAnswers(answers []*Answer) (sql.NullString, error) {
+	if len(answers) == 0 {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(answers)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("mysql: could not encode answers: %v", err)
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// decodeAnswers decodes an answers column.
+func decodeAnswers(s sql.NullString) ([]*Answer, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	var answers []*Answer
+	if err := json.Unmarshal([]byte(s.String), &answers); err != nil {
+		return nil, fmt.Errorf("could not decode answers: %v", err)
+	}
+	return answers, nil
+}
+
 const listParticipantStatement = "SELECT * FROM participants ORDER BY participant_id"
 
 // ListParticipants returns a list of users.
@@ -98,7 +158,7 @@ func (participantDB *participantDB) ListParticipants() ([]*Participant, error) {
 const listParticipantHostedByStatement = `
 	SELECT * FROM participants 
 	WHERE host_id = ? AND event_name = ?
-	ORDER BY event_name
+	ORDER BY applied_at, participant_id
 `
 
 // ListEventsHostedBy returns a list of participants, ordered by name, filtered by
@@ -108,7 +168,34 @@ func (participantDB *participantDB) ListParticipantsHostedBy(hostID, eventName s
 		return participantDB.ListParticipants()
 	}
 
-	rows, err := participantDB.listedBy.Query(hostID)
+	rows, err := participantDB.listedBy.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []*Participant
+	for rows.Next() {
+		participant, err := scanParticipant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		participants = append(participants, participant)
+	}
+
+	return participants, nil
+}
+
+const listParticipationsOfStatement = `
+	SELECT * FROM participants
+	WHERE participant_id = ?
+	ORDER BY applied_at
+`
+
+// ListParticipationsOf returns every participation of a given user.
+func (participantDB *participantDB) ListParticipationsOf(userID string) ([]*Participant, error) {
+	rows, err := participantDB.listOf.Query(userID)
 	if err != nil {
 		return nil, err
 	}
@@ -127,13 +214,13 @@ func (participantDB *participantDB) ListParticipantsHostedBy(hostID, eventName s
 	return participants, nil
 }
 
-const getParticipantStatement = "SELECT * FROM participants WHERE host_id = ? AND event_name"
+const getParticipantStatement = "SELECT * FROM participants WHERE host_id = ? AND event_name = ? AND participant_id = ?"
 
 // GetParticipant retrieves a participant by its ID.
 func (participantDB *participantDB) GetParticipant(p *Participant) (*Participant, error) {
 	participant, err := scanParticipant(participantDB.get.QueryRow(p.HostID, p.EventName, p.ParticipantID))
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("mysql: could not find participant with ID %s in event %s hosted by host %s", p.HostID, p.EventName, p.ParticipantID)
+		return nil, fmt.Errorf("mysql: could not find participant with ID %s in event %s hosted by host %s", p.ParticipantID, p.EventName, p.HostID)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("mysql: could not get user: %v", err)
@@ -143,36 +230,63 @@ func (participantDB *participantDB) GetParticipant(p *Participant) (*Participant
 
 const insertParticipantStatement = `
 	INSERT INTO participants (
-	host_id, event_name, participant_id
-	) VALUES (?, ?, ?)
+	host_id, event_name, participant_id, status, applied_at, share_weight, tier, answers, held_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 // AddParticipant saves a given participant.
 func (participantDB *participantDB) AddParticipant(p *Participant) error {
-	_, err := execAffectingOneRow(participantDB.insert, p.HostID, p.EventName, p.ParticipantID)
+	return insertParticipant(participantDB.insert, p)
+}
+
+// insertParticipant saves a given participant with the insert statement.
+func insertParticipant(insert *sql.Stmt, p *Participant) error {
+	answers, err := encodeAnswers(p.Answers)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = execAffectingOneRow(insert, p.HostID, p.EventName, p.ParticipantID, p.Status,
+		nullString(p.AppliedAt), shareWeight(p), p.Tier, answers, nullString(p.HeldAt))
+	return err
 }
 
 const updateParticipantStatement = `
 	UPDATE participants 
-	SET host_id=?, event_name=?, participant_id=? 
+	SET status=?, checked_in_at=?, applied_at=?, cancelled_at=?, attendance=?, share_weight=?, tier=?, answers=?,
+	held_at=?
 	WHERE host_id=? AND event_name=? AND participant_id=?`
 
-func (participantDB *userDB) UpdateParticipant(p *Participant) error {
+// UpdateParticipant updates the entry for a given participant.
+func (participantDB *participantDB) UpdateParticipant(p *Participant) error {
 	if p.ParticipantID == "" {
 		return errors.New("mysql: user with unassigned ID passed into updateBook")
 	}
+	return updateParticipant(participantDB.update, p)
+}
 
-	_, err := execAffectingOneRow(participantDB.update, p.HostID, p.EventName, p.ParticipantID)
+// updateParticipant updates a given participant with the update statement.
+func updateParticipant(update *sql.Stmt, p *Participant) error {
+	answers, err := encodeAnswers(p.Answers)
+	if err != nil {
+		return err
+	}
+	_, err = execAffectingOneRow(update, p.Status, nullString(p.CheckedInAt),
+		nullString(p.AppliedAt), nullString(p.CancelledAt), p.Attendance, shareWeight(p), p.Tier, answers,
+		nullString(p.HeldAt), p.HostID, p.EventName, p.ParticipantID)
 	return err
 }
 
+// shareWeight returns the share weight of a participant, defaulting to 1.
+func shareWeight(p *Participant) int64 {
+	if p.ShareWeight <= 0 {
+		return 1
+	}
+	return p.ShareWeight
+}
+
 const deleteParticipantStatement = "DELETE FROM participants WHERE host_id = ? AND event_name = ? AND participant_id = ?"
 
-func (participantDB *userDB) DeleteParticipant(p *Participant) error {
+func (participantDB *participantDB) DeleteParticipant(p *Participant) error {
 	if p.HostID == "" || p.EventName == "" || p.ParticipantID == "" {
 		return errors.New("mysql: book with unassigned ID passed into deleteParticipant")
 	}
@@ -180,3 +294,155 @@ func (participantDB *userDB) DeleteParticipant(p *Participant) error {
 	_, err := execAffectingOneRow(participantDB.delete, p.HostID, p.EventName, p.ParticipantID)
 	return err
 }
+
+const checkInParticipantStatement = `
+	UPDATE participants
+	SET checked_in_at=?
+	WHERE host_id=? AND event_name=? AND participant_id=? AND checked_in_at IS NULL`
+
+// CheckInParticipant records the time a given participant arrived at the venue.
+func (participantDB *participantDB) CheckInParticipant(p *Participant, at string) error {
+	r, err := participantDB.checkIn.Exec(at, p.HostID, p.EventName, p.ParticipantID)
+	if err != nil {
+		return fmt.Errorf("mysql: could not execute statement: %v", err)
+	}
+
+	rowsAffected, err := r.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("mysql: could not get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		// Either the participant does not exist or they checked in already.
+		if _, err := participantDB.GetParticipant(p); err != nil {
+			return err
+		}
+		return ErrAlreadyCheckedIn
+	}
+	return nil
+}
+
+// extraScanner scans the columns of a row following those read by another
+// scan function into extra destinations.
+type extraScanner struct {
+	rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+const scanAttendeesStatement = `
+	SELECT p.*, COALESCE(u.user_name, ''),
+	pay.amount, pay.currency, pay.status, pay.updated_at, pay.updated_by
+	FROM participants p
+	LEFT JOIN users u ON u.user_id = p.participant_id
+	LEFT JOIN payments pay ON pay.host_id = p.host_id AND pay.event_name = p.event_name
+	AND pay.participant_id = p.participant_id
+	WHERE p.host_id = ? AND p.event_name = ?
+	ORDER BY p.applied_at, p.participant_id
+`
+
+// ScanAttendees calls fn for each participant of an event, joined with their
+// user and payment, in order of application.
+func (participantDB *participantDB) ScanAttendees(hostID, eventName string, fn func(*Attendee) error) error {
+	rows, err := participantDB.attendees.Query(hostID, eventName)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			userName  string
+			amount    sql.NullInt64
+			currency  sql.NullString
+			status    sql.NullString
+			updatedAt sql.NullString
+			updatedBy sql.NullString
+		)
+		participant, err := scanParticipant(extraScanner{rows, []interface{}{
+			&userName, &amount, &currency, &status, &updatedAt, &updatedBy,
+		}})
+		if err != nil {
+			return fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		attendee := &Attendee{Participant: participant, UserName: userName}
+		if status.Valid {
+			attendee.Payment = &Payment{
+				HostID:        hostID,
+				EventName:     eventName,
+				ParticipantID: participant.ParticipantID,
+				Amount:        amount.Int64,
+				Currency:      currency.String,
+				Status:        status.String,
+				UpdatedAt:     updatedAt.String,
+				UpdatedBy:     updatedBy.String,
+			}
+		}
+		if err := fn(attendee); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+const lockEventStatement = "SELECT host_id FROM events WHERE host_id = ? AND event_name = ? FOR UPDATE"
+
+// AllocateSeats calls allocate with the participants of an event and saves
+// the participants it returns. The event is locked until they are saved.
+func (participantDB *participantDB) AllocateSeats(hostID, eventName string, allocate func(participants []*Participant) ([]*Participant, error)) error {
+	tx, err := participantDB.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("mysql: could not begin transaction: %v", err)
+	}
+	var locked string
+	err = tx.Stmt(participantDB.lockEvent).QueryRow(hostID, eventName).Scan(&locked)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return fmt.Errorf("mysql: could not find event %s hosted by %s", eventName, hostID)
+	}
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("mysql: could not lock event: %v", err)
+	}
+
+	rows, err := tx.Stmt(participantDB.listedBy).Query(hostID, eventName)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var participants []*Participant
+	existing := make(map[string]bool)
+	for rows.Next() {
+		participant, err := scanParticipant(rows)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return fmt.Errorf("mysql: could not read row: %v", err)
+		}
+		participants = append(participants, participant)
+		existing[participant.ParticipantID] = true
+	}
+	rows.Close()
+
+	changed, err := allocate(participants)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, p := range changed {
+		if existing[p.ParticipantID] {
+			err = updateParticipant(tx.Stmt(participantDB.update), p)
+		} else {
+			err = insertParticipant(tx.Stmt(participantDB.insert), p)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// newMySQLPaymentsDB creates a new PaymentDatabase backed by a given MySQL server.
+func newMySQLPaymentsDB(config MySQLConfig) (*paymentDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(paymentsTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	paymentDB := &paymentDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. setPayment)
+
+	if paymentDB.list, err = conn.Prepare(listPaymentsStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in payment db: %v", err)
+	}
+	if paymentDB.get, err = conn.Prepare(getPaymentStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get in payment db: %v", err)
+	}
+	if paymentDB.getByOrder, err = conn.Prepare(getPaymentByOrderIDStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get by order in payment db: %v", err)
+	}
+	if paymentDB.insert, err = conn.Prepare(setPaymentStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in payment db: %v", err)
+	}
+
+	return paymentDB, nil
+}
+
+// scanPayment reads a payment from a sql.Row or sql.Rows
+func scanPayment(s rowScanner) (*Payment, error) {
+	var (
+		hostID        string
+		eventName     string
+		participantID string
+		amount        int64
+		currency      string
+		status        string
+		updatedAt     string
+		updatedBy     string
+		provider      string
+		chargeID      string
+		orderID       sql.NullString
+	)
+	if err := s.Scan(&hostID, &eventName, &participantID, &amount, &currency, &status, &updatedAt, &updatedBy,
+		&provider, &chargeID, &orderID); err != nil {
+		return nil, err
+	}
+
+	payment := &Payment{
+		HostID:        hostID,
+		EventName:     eventName,
+		ParticipantID: participantID,
+		Amount:        amount,
+		Currency:      currency,
+		Status:        status,
+		UpdatedAt:     updatedAt,
+		UpdatedBy:     updatedBy,
+		Provider:      provider,
+		ChargeID:      chargeID,
+		OrderID:       orderID.String,
+	}
+
+	return payment, nil
+}
+
+const listPaymentsStatement = `
+	SELECT * FROM payments
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY participant_id
+`
+
+// ListPayments returns the payment records of a given event.
+func (paymentDB *paymentDB) ListPayments(hostID, eventName string) ([]*Payment, error) {
+	rows, err := paymentDB.list.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []*Payment
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+const getPaymentStatement = "SELECT * FROM payments WHERE host_id = ? AND event_name = ? AND participant_id = ?"
+
+// GetPayment retrieves the payment record of a given participant.
+func (paymentDB *paymentDB) GetPayment(hostID, eventName, participantID string) (*Payment, error) {
+	payment, err := scanPayment(paymentDB.get.QueryRow(hostID, eventName, participantID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find payment of %s for event %s hosted by %s", participantID, eventName, hostID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get payment: %v", err)
+	}
+	return payment, nil
+}
+
+const getPaymentByOrderIDStatement = "SELECT * FROM payments WHERE order_id = ?"
+
+// GetPaymentByOrderID retrieves the payment record of a given provider order.
+func (paymentDB *paymentDB) GetPaymentByOrderID(orderID string) (*Payment, error) {
+	payment, err := scanPayment(paymentDB.getByOrder.QueryRow(orderID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find payment with order ID %s", orderID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get payment: %v", err)
+	}
+	return payment, nil
+}
+
+const setPaymentStatement = `
+	INSERT INTO payments (
+	host_id, event_name, participant_id, amount, currency, status, updated_at, updated_by,
+	provider, charge_id, order_id
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+	amount=VALUES(amount), currency=VALUES(currency), status=VALUES(status),
+	updated_at=VALUES(updated_at), updated_by=VALUES(updated_by),
+	provider=VALUES(provider), charge_id=VALUES(charge_id), order_id=VALUES(order_id)
+	`
+
+// SetPayment saves a given payment record.
+func (paymentDB *paymentDB) SetPayment(p *Payment) error {
+	if p.HostID == "" || p.EventName == "" || p.ParticipantID == "" {
+		return errors.New("mysql: payment with unassigned ID passed into setPayment")
+	}
+
+	_, err := paymentDB.insert.Exec(p.HostID, p.EventName, p.ParticipantID, p.Amount, p.Currency,
+		p.Status, p.UpdatedAt, p.UpdatedBy, p.Provider, p.ChargeID, nullString(p.OrderID))
+	if err != nil {
+		return fmt.Errorf("mysql: could not execute statement: %v", err)
+	}
+	return nil
+}
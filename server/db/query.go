@@ -0,0 +1,332 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shinyamizuno1008/hashbill/server/geo"
+)
+
+// Orders events can be listed in. A leading "-" reverses the order, except
+// for SortRelevance, which always puts the best matches first, and
+// SortDistance, which always puts the nearest events first.
+const (
+	SortDate      = "date"
+	SortDeadline  = "deadline"
+	SortCreated   = "created"
+	SortRelevance = "relevance"
+	SortDistance  = "distance"
+)
+
+// Sort columns of SortRelevance and SortDistance, which are computed rather
+// than stored.
+const (
+	relevance = "relevance"
+	distance  = "distance"
+)
+
+// computed reports whether a sort column is computed. Pages of events sorted
+// by it are counted rather than keyed by the last row.
+func computed(column string) bool {
+	return column == relevance || column == distance
+}
+
+// Statuses to filter events by.
+const (
+	// EventOpen events still take applications.
+	EventOpen = "open"
+	// EventClosed events are past their deadline.
+	EventClosed = "closed"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not returned with the
+// previous page of the same query.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EventQuery selects a page of events. Empty fields do not filter, except
+// Viewer: unlisted and private events are only listed to the users who may
+// see them.
+type EventQuery struct {
+	// Viewer is the user the events are listed to. Besides public events,
+	// they see the unlisted and private events they host, organize,
+	// joined or were invited to. Anonymous viewers see public events only.
+	Viewer string
+
+	HostID string
+
+	// GroupID selects the events of a LINE group or room.
+	GroupID string
+
+	// From and To limit the dates of the events to [From, To).
+	From, To string
+
+	// Location is a substring of the location.
+	Location string
+
+	// Status is EventOpen or EventClosed, as of Now.
+	Status string
+	Now    time.Time
+
+	// HasCapacity selects events with unlimited seats or seats left.
+	HasCapacity bool
+
+	// IncludeCancelled lists cancelled events too.
+	IncludeCancelled bool
+
+	// Keywords are words separated by spaces, all of which must appear in
+	// the name, description or location of the events.
+	Keywords string
+
+	// Near and Radius select located events within Radius meters of Near.
+	// Near without a Radius only sorts by distance.
+	Near   *geo.Point
+	Radius float64
+
+	// Sort is one of SortDate, SortDeadline and SortCreated, optionally
+	// preceded by "-" for descending order, SortRelevance if there are
+	// Keywords or SortDistance if there is a point Near. It defaults to
+	// SortDate.
+	Sort string
+
+	// Limit is the size of the page; Cursor is the NextCursor of the
+	// previous page, or empty for the first one.
+	Limit  int
+	Cursor string
+}
+
+// EventPage is a page of events.
+type EventPage struct {
+	Events []*Event
+
+	// NextCursor selects the next page, or is empty on the last one.
+	NextCursor string
+}
+
+// UserQuery selects a page of users, ordered by name.
+type UserQuery struct {
+	// Name is a substring of the user name.
+	Name string
+
+	Limit  int
+	Cursor string
+}
+
+// UserPage is a page of users.
+type UserPage struct {
+	Users      []*User
+	NextCursor string
+}
+
+// AuditQuery selects a page of the audit log, newest first. Empty fields do
+// not filter.
+type AuditQuery struct {
+	Actor     string
+	RequestID string
+	Entity    string
+	HostID    string
+	EventName string
+	UserID    string
+
+	// From and To limit the times of the changes to [From, To).
+	From, To string
+
+	Limit  int
+	Cursor string
+}
+
+// AuditPage is a page of the audit log.
+type AuditPage struct {
+	Entries    []*AuditEntry
+	NextCursor string
+}
+
+// Validate checks the sort order, status and date range of a query.
+func (q *EventQuery) Validate() error {
+	column, _, err := sortColumn(q.Sort)
+	if err != nil {
+		return err
+	}
+	if column == relevance && len(searchTerms(q.Keywords)) == 0 {
+		return fmt.Errorf("sorting by relevance needs keywords")
+	}
+	if (column == distance || q.Radius != 0) && q.Near == nil {
+		return fmt.Errorf("sorting or filtering by distance needs a point")
+	}
+	if q.Near != nil && !q.Near.Valid() {
+		return fmt.Errorf("invalid point %v, %v", q.Near.Latitude, q.Near.Longitude)
+	}
+	if q.Radius < 0 {
+		return fmt.Errorf("invalid radius %v", q.Radius)
+	}
+	switch q.Status {
+	case "", EventOpen, EventClosed:
+	default:
+		return fmt.Errorf("invalid status %q", q.Status)
+	}
+	for _, t := range []string{q.From, q.To} {
+		if t == "" {
+			continue
+		}
+		if _, err := ParseTime(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortColumn returns the column events are sorted by and whether the order is
+// descending.
+func sortColumn(sort string) (column string, desc bool, err error) {
+	switch sort {
+	case SortRelevance:
+		return relevance, false, nil
+	case SortDistance:
+		return distance, false, nil
+	}
+	if len(sort) > 0 && sort[0] == '-' {
+		desc = true
+		sort = sort[1:]
+	}
+	switch sort {
+	case "", SortDate:
+		return "date", desc, nil
+	case SortDeadline:
+		return "deadline", desc, nil
+	case SortCreated:
+		return "created_at", desc, nil
+	}
+	return "", false, fmt.Errorf("invalid sort order %q", sort)
+}
+
+// sortValue returns the value of an event an order sorts by.
+func sortValue(e *Event, column string) string {
+	switch column {
+	case "deadline":
+		return e.Deadline
+	case "created_at":
+		return e.CreatedAt
+	}
+	return e.Date
+}
+
+// cursor is the position after the last row of a page. Rows are ordered by
+// a sort value and then by their key, so that the position is unique. Rows
+// ordered by a computed column are counted instead.
+type cursor struct {
+	Sort   string   `json:"s"`
+	Value  string   `json:"v"`
+	Key    []string `json:"k"`
+	Offset int      `json:"o,omitempty"`
+}
+
+func (c *cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor decodes a cursor of a given sort order and key length. An
+// empty cursor decodes to nil.
+func decodeCursor(s, sort string, keyLen int) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort || len(c.Key) != keyLen {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// likePattern returns a LIKE pattern matching strings containing s.
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+// searchTerms splits keywords into terms to search for. Characters MySQL
+// treats as operators in boolean mode are dropped.
+func searchTerms(keywords string) []string {
+	var terms []string
+	for _, word := range strings.Fields(keywords) {
+		word = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`"+-<>()~*@`, r) {
+				return -1
+			}
+			return r
+		}, word)
+		if word != "" {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// booleanQuery returns a MySQL boolean mode search requiring every term.
+// Terms shorter than the ngram token size of two characters are searched as
+// prefixes, as MySQL cannot match them otherwise.
+func booleanQuery(terms []string) string {
+	query := make([]string, len(terms))
+	for i, term := range terms {
+		if utf8.RuneCountInString(term) < 2 {
+			query[i] = "+" + term + "*"
+		} else {
+			query[i] = `+"` + term + `"`
+		}
+	}
+	return strings.Join(query, " ")
+}
+
+// eventPage returns the page of at most limit of the given events, which
+// may include the first event of the next page. offset is the number of
+// events before the page, which is used for events ordered by a computed
+// column.
+func eventPage(events []*Event, limit int, sort, column string, offset int) *EventPage {
+	page := &EventPage{Events: events}
+	if limit > 0 && len(events) > limit {
+		page.Events = events[:limit]
+		if computed(column) {
+			page.NextCursor = (&cursor{Sort: sort, Offset: offset + limit}).encode()
+			return page
+		}
+		last := page.Events[limit-1]
+		page.NextCursor = (&cursor{
+			Sort:  sort,
+			Value: sortValue(last, column),
+			Key:   []string{last.HostID, last.EventName},
+		}).encode()
+	}
+	return page
+}
+
+// auditPage returns the page of at most limit of the given entries, which
+// may include the first entry of the next page.
+func auditPage(entries []*AuditEntry, limit int) *AuditPage {
+	page := &AuditPage{Entries: entries}
+	if limit > 0 && len(entries) > limit {
+		page.Entries = entries[:limit]
+		last := page.Entries[limit-1]
+		page.NextCursor = (&cursor{Key: []string{strconv.FormatInt(last.AuditID, 10)}}).encode()
+	}
+	return page
+}
+
+// userPage returns the page of at most limit of the given users, which may
+// include the first user of the next page.
+func userPage(users []*User, limit int) *UserPage {
+	page := &UserPage{Users: users}
+	if limit > 0 && len(users) > limit {
+		page.Users = users[:limit]
+		last := page.Users[limit-1]
+		page.NextCursor = (&cursor{Value: last.UserName, Key: []string{last.UserID}}).encode()
+	}
+	return page
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type questionDB struct {
+	*mysqlDB
+}
+
+// newMySQLQuestionsDB creates a new QuestionDatabase backed by a given MySQL server.
+func newMySQLQuestionsDB(config MySQLConfig) (*questionDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(questionsTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	questionDB := &questionDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. setQuestions)
+
+	if questionDB.list, err = conn.Prepare(listQuestionsStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in question db: %v", err)
+	}
+	if questionDB.insert, err = conn.Prepare(insertQuestionStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in question db: %v", err)
+	}
+	if questionDB.delete, err = conn.Prepare(deleteQuestionsStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare delete in question db: %v", err)
+	}
+
+	return questionDB, nil
+}
+
+// scanQuestion reads a question from a sql.Row or sql.Rows
+func scanQuestion(s rowScanner) (*Question, error) {
+	var (
+		hostID     string
+		eventName  string
+		questionID int64
+		label      string
+		typ        string
+		options    sql.NullString
+		required   bool
+		form       string
+	)
+	if err := s.Scan(&hostID, &eventName, &questionID, &label, &typ, &options, &required, &form); err != nil {
+		return nil, err
+	}
+
+	question := &Question{
+		HostID:     hostID,
+		EventName:  eventName,
+		QuestionID: questionID,
+		Form:       form,
+		Label:      label,
+		Type:       typ,
+		Required:   required,
+	}
+	if options.Valid {
+		if err := json.Unmarshal([]byte(options.String), &question.Options); err != nil {
+			return nil, fmt.Errorf("could not decode options: %v", err)
+		}
+	}
+
+	return question, nil
+}
+
+const listQuestionsStatement = `
+	SELECT * FROM questions
+	WHERE host_id = ? AND event_name = ? AND form = ?
+	ORDER BY question_id
+`
+
+// ListQuestions returns the questions of a given form of an event in the
+// order they are asked.
+func (questionDB *questionDB) ListQuestions(hostID, eventName, form string) ([]*Question, error) {
+	rows, err := questionDB.list.Query(hostID, eventName, form)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []*Question
+	for rows.Next() {
+		question, err := scanQuestion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		questions = append(questions, question)
+	}
+
+	return questions, nil
+}
+
+const insertQuestionStatement = `
+	INSERT INTO questions (
+	host_id, event_name, question_id, label, type, options, required, form
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+const deleteQuestionsStatement = "DELETE FROM questions WHERE host_id = ? AND event_name = ? AND form = ?"
+
+// SetQuestions replaces the questions of a given form of an event. Answers
+// already given are kept.
+func (questionDB *questionDB) SetQuestions(hostID, eventName, form string, questions []*Question) error {
+	if hostID == "" || eventName == "" || form == "" {
+		return errors.New("mysql: event with unassigned ID passed into setQuestions")
+	}
+
+	tx, err := questionDB.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("mysql: could not begin transaction: %v", err)
+	}
+	if _, err := tx.Stmt(questionDB.delete).Exec(hostID, eventName, form); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("mysql: could not execute statement: %v", err)
+	}
+	for _, q := range questions {
+		var options sql.NullString
+		if len(q.Options) > 0 {
+			b, err := json.Marshal(q.Options)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("mysql: could not encode options: %v", err)
+			}
+			options = sql.NullString{String: string(b), Valid: true}
+		}
+		if _, err := execAffectingOneRow(tx.Stmt(questionDB.insert), hostID, eventName, q.QuestionID,
+			q.Label, q.Type, options, q.Required, form); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type revisionDB struct {
+	*mysqlDB
+}
+
+// newMySQLRevisionsDB creates a new RevisionDatabase backed by a given MySQL server.
+func newMySQLRevisionsDB(config MySQLConfig) (*revisionDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(revisionsTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	revisionDB := &revisionDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. addRevision)
+
+	if revisionDB.list, err = conn.Prepare(listRevisionsStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in revision db: %v", err)
+	}
+	if revisionDB.insert, err = conn.Prepare(insertRevisionStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in revision db: %v", err)
+	}
+
+	return revisionDB, nil
+}
+
+// scanRevision reads a version of an event from a sql.Row or sql.Rows
+func scanRevision(s rowScanner) (*Revision, error) {
+	var (
+		hostID     string
+		eventName  string
+		version    int64
+		date       string
+		location   string
+		membersMax int64
+		editorID   string
+		notify     bool
+		editedAt   string
+	)
+	if err := s.Scan(&hostID, &eventName, &version, &date, &location, &membersMax, &editorID, &notify, &editedAt); err != nil {
+		return nil, err
+	}
+
+	revision := &Revision{
+		HostID:     hostID,
+		EventName:  eventName,
+		Version:    version,
+		Date:       date,
+		Location:   location,
+		MembersMax: membersMax,
+		EditorID:   editorID,
+		Notify:     notify,
+		EditedAt:   editedAt,
+	}
+	return revision, nil
+}
+
+const listRevisionsStatement = `
+	SELECT * FROM event_revisions
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY version
+`
+
+// ListRevisions returns the versions of a given event, oldest first.
+func (revisionDB *revisionDB) ListRevisions(hostID, eventName string) ([]*Revision, error) {
+	rows, err := revisionDB.list.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*Revision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+const insertRevisionStatement = `
+	INSERT INTO event_revisions (
+	host_id, event_name, version, date, location, members_max, editor_id, notify, edited_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+// AddRevision saves a given version. It fails if the event already has a
+// version of the same number.
+func (revisionDB *revisionDB) AddRevision(r *Revision) error {
+	if r.HostID == "" || r.EventName == "" {
+		return errors.New("mysql: revision with unassigned event passed into addRevision")
+	}
+
+	_, err := execAffectingOneRow(revisionDB.insert, r.HostID, r.EventName, r.Version, r.Date, r.Location, r.MembersMax, r.EditorID, r.Notify, r.EditedAt)
+	return err
+}
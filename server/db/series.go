@@ -0,0 +1,234 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type seriesDB struct {
+	*mysqlDB
+	listedBy    *sql.Stmt
+	occurrences *sql.Stmt
+}
+
+// newMySQLSeriesDB creates a new SeriesDatabase backed by a given MySQL server.
+func newMySQLSeriesDB(config MySQLConfig) (*seriesDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(seriesTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	seriesDB := &seriesDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. addSeries)
+
+	if seriesDB.list, err = conn.Prepare(listSeriesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in series db: %v", err)
+	}
+	if seriesDB.listedBy, err = conn.Prepare(listSeriesByHostStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list by in series db: %v", err)
+	}
+	if seriesDB.get, err = conn.Prepare(getSeriesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare get in series db: %v", err)
+	}
+	if seriesDB.insert, err = conn.Prepare(insertSeriesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in series db: %v", err)
+	}
+	if seriesDB.update, err = conn.Prepare(updateSeriesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare update in series db: %v", err)
+	}
+	if seriesDB.delete, err = conn.Prepare(deleteSeriesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare delete in series db: %v", err)
+	}
+	if seriesDB.occurrences, err = conn.Prepare(listOccurrencesStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare occurrences in series db: %v", err)
+	}
+
+	return seriesDB, nil
+}
+
+// scanSeries reads a series from a sql.Row or sql.Rows
+func scanSeries(s rowScanner) (*Series, error) {
+	var (
+		hostID         string
+		seriesName     string
+		rule           string
+		start          string
+		deadlineBefore int64
+		location       string
+		membersMax     sql.NullInt64
+		lottery        bool
+		description    sql.NullString
+
+		deprioritizeNoShows bool
+		fee                 int64
+		currency            string
+		carryParticipants   bool
+		generatedUntil      sql.NullString
+	)
+	if err := s.Scan(&hostID, &seriesName, &rule, &start, &deadlineBefore, &location, &membersMax, &lottery,
+		&description, &deprioritizeNoShows, &fee, &currency, &carryParticipants, &generatedUntil); err != nil {
+		return nil, err
+	}
+
+	series := &Series{
+		HostID:         hostID,
+		SeriesName:     seriesName,
+		Rule:           rule,
+		Start:          start,
+		DeadlineBefore: deadlineBefore,
+		Location:       location,
+		MembersMax:     membersMax.Int64,
+		Lottery:        lottery,
+		Description:    description.String,
+
+		DeprioritizeNoShows: deprioritizeNoShows,
+		Fee:                 fee,
+		Currency:            currency,
+		CarryParticipants:   carryParticipants,
+		GeneratedUntil:      generatedUntil.String,
+	}
+
+	return series, nil
+}
+
+// listSeries runs a query returning series and reads them.
+func listSeries(stmt *sql.Stmt, args ...interface{}) ([]*Series, error) {
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var series []*Series
+	for rows.Next() {
+		s, err := scanSeries(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		series = append(series, s)
+	}
+
+	return series, nil
+}
+
+const listSeriesStatement = "SELECT * FROM series ORDER BY host_id, series_name"
+
+// ListSeries returns all series.
+func (seriesDB *seriesDB) ListSeries() ([]*Series, error) {
+	return listSeries(seriesDB.list)
+}
+
+const listSeriesByHostStatement = "SELECT * FROM series WHERE host_id = ? ORDER BY series_name"
+
+// ListSeriesHostedBy returns the series of a given host.
+func (seriesDB *seriesDB) ListSeriesHostedBy(hostID string) ([]*Series, error) {
+	return listSeries(seriesDB.listedBy, hostID)
+}
+
+const getSeriesStatement = "SELECT * FROM series WHERE host_id = ? AND series_name = ?"
+
+// GetSeries retrieves a series by its host ID and name.
+func (seriesDB *seriesDB) GetSeries(hostID, seriesName string) (*Series, error) {
+	series, err := scanSeries(seriesDB.get.QueryRow(hostID, seriesName))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("mysql: could not find series %s hosted by %s", seriesName, hostID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get series: %v", err)
+	}
+	return series, nil
+}
+
+const insertSeriesStatement = `
+	INSERT INTO series (
+	host_id, series_name, rule, start, deadline_before, location, members_max, lottery, description,
+	deprioritize_no_shows, fee, currency, carry_participants, generated_until
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+// AddSeries saves a given series.
+func (seriesDB *seriesDB) AddSeries(s *Series) error {
+	_, err := execAffectingOneRow(seriesDB.insert, s.HostID, s.SeriesName, s.Rule, s.Start, s.DeadlineBefore,
+		s.Location, s.MembersMax, s.Lottery, s.Description, s.DeprioritizeNoShows, s.Fee, seriesCurrency(s),
+		s.CarryParticipants, nullString(s.GeneratedUntil))
+	return err
+}
+
+const updateSeriesStatement = `
+	UPDATE series
+	SET rule=?, start=?, deadline_before=?, location=?, members_max=?, lottery=?, description=?,
+	deprioritize_no_shows=?, fee=?, currency=?, carry_participants=?, generated_until=?
+	WHERE host_id = ? AND series_name = ?`
+
+// UpdateSeries updates the entry for a given series.
+func (seriesDB *seriesDB) UpdateSeries(s *Series) error {
+	if s.HostID == "" || s.SeriesName == "" {
+		return errors.New("mysql: series with unassigned host ID and name passed into updateSeries")
+	}
+
+	_, err := execAffectingOneRow(seriesDB.update, s.Rule, s.Start, s.DeadlineBefore, s.Location, s.MembersMax,
+		s.Lottery, s.Description, s.DeprioritizeNoShows, s.Fee, seriesCurrency(s), s.CarryParticipants,
+		nullString(s.GeneratedUntil), s.HostID, s.SeriesName)
+	return err
+}
+
+// seriesCurrency returns the currency of a series' fee, defaulting to JPY.
+func seriesCurrency(s *Series) string {
+	if s.Currency == "" {
+		return "JPY"
+	}
+	return s.Currency
+}
+
+const deleteSeriesStatement = "DELETE FROM series WHERE host_id = ? AND series_name = ?"
+
+// DeleteSeries removes a given series. Its occurrences are kept.
+func (seriesDB *seriesDB) DeleteSeries(hostID, seriesName string) error {
+	if hostID == "" || seriesName == "" {
+		return errors.New("mysql: series with unassigned host ID and name passed into deleteSeries")
+	}
+
+	_, err := execAffectingOneRow(seriesDB.delete, hostID, seriesName)
+	return err
+}
+
+const listOccurrencesStatement = `
+	SELECT * FROM events
+	WHERE host_id = ? AND series_name = ? ORDER BY date
+`
+
+// ListOccurrences returns the events of a series, in order of date.
+func (seriesDB *seriesDB) ListOccurrences(hostID, seriesName string) ([]*Event, error) {
+	rows, err := seriesDB.occurrences.Query(hostID, seriesName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+type tierDB struct {
+	*mysqlDB
+}
+
+// newMySQLTiersDB creates a new TierDatabase backed by a given MySQL server.
+func newMySQLTiersDB(config MySQLConfig) (*tierDB, error) {
+	// Check database and table exists. If not, create it.
+	if err := config.ensureTableExisits(tiersTable); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("mysql", config.dataStoreName("event_list"))
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not get a connection: %v", err)
+	}
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mysql: could not establish a good connection: %v", err)
+	}
+
+	tierDB := &tierDB{
+		mysqlDB: &mysqlDB{conn: conn},
+	}
+
+	// Prepared statements. The actual SQL queries are in the code near the
+	// relevant method (e.g. addTier)
+
+	if tierDB.list, err = conn.Prepare(listTiersStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare list in tier db: %v", err)
+	}
+	if tierDB.insert, err = conn.Prepare(insertTierStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare insert in tier db: %v", err)
+	}
+	if tierDB.update, err = conn.Prepare(updateTierStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare update in tier db: %v", err)
+	}
+	if tierDB.delete, err = conn.Prepare(deleteTierStatement); err != nil {
+		return nil, fmt.Errorf("mysql: prepare delete in tier db: %v", err)
+	}
+
+	return tierDB, nil
+}
+
+// scanTier reads a tier from a sql.Row or sql.Rows
+func scanTier(s rowScanner) (*Tier, error) {
+	var (
+		hostID    string
+		eventName string
+		tierName  string
+		price     int64
+		capacity  int64
+		saleStart sql.NullString
+		saleEnd   sql.NullString
+	)
+	if err := s.Scan(&hostID, &eventName, &tierName, &price, &capacity, &saleStart, &saleEnd); err != nil {
+		return nil, err
+	}
+
+	tier := &Tier{
+		HostID:    hostID,
+		EventName: eventName,
+		TierName:  tierName,
+		Price:     price,
+		Capacity:  capacity,
+		SaleStart: saleStart.String,
+		SaleEnd:   saleEnd.String,
+	}
+
+	return tier, nil
+}
+
+const listTiersStatement = `
+	SELECT * FROM tiers
+	WHERE host_id = ? AND event_name = ?
+	ORDER BY price, tier_name
+`
+
+// ListTiers returns the ticket tiers of a given event, cheapest first.
+func (tierDB *tierDB) ListTiers(hostID, eventName string) ([]*Tier, error) {
+	rows, err := tierDB.list.Query(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tiers []*Tier
+	for rows.Next() {
+		tier, err := scanTier(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		tiers = append(tiers, tier)
+	}
+
+	return tiers, nil
+}
+
+const insertTierStatement = `
+	INSERT INTO tiers (
+	host_id, event_name, tier_name, price, capacity, sale_start, sale_end
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+// AddTier saves a given tier.
+func (tierDB *tierDB) AddTier(t *Tier) error {
+	_, err := execAffectingOneRow(tierDB.insert, t.HostID, t.EventName, t.TierName, t.Price, t.Capacity,
+		nullString(t.SaleStart), nullString(t.SaleEnd))
+	return err
+}
+
+const updateTierStatement = `
+	UPDATE tiers
+	SET price=?, capacity=?, sale_start=?, sale_end=?
+	WHERE host_id = ? AND event_name = ? AND tier_name = ?`
+
+// UpdateTier updates the entry for a given tier.
+func (tierDB *tierDB) UpdateTier(t *Tier) error {
+	if t.HostID == "" || t.EventName == "" || t.TierName == "" {
+		return errors.New("mysql: tier with unassigned ID passed into updateTier")
+	}
+
+	_, err := execAffectingOneRow(tierDB.update, t.Price, t.Capacity, nullString(t.SaleStart), nullString(t.SaleEnd),
+		t.HostID, t.EventName, t.TierName)
+	return err
+}
+
+const deleteTierStatement = "DELETE FROM tiers WHERE host_id = ? AND event_name = ? AND tier_name = ?"
+
+// DeleteTier removes a given tier by its name.
+func (tierDB *tierDB) DeleteTier(hostID, eventName, tierName string) error {
+	if hostID == "" || eventName == "" || tierName == "" {
+		return errors.New("mysql: tier with unassigned ID passed into deleteTier")
+	}
+
+	_, err := execAffectingOneRow(tierDB.delete, hostID, eventName, tierName)
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 )
 
 // newMySQLDB creates a new BookDatabase backed by a given MySQL server.
@@ -90,6 +91,57 @@ func (userDB *userDB) ListUsers() ([]*User, error) {
 	return users, nil
 }
 
+// QueryUsers returns a page of the users matching a query, ordered by name.
+func (userDB *userDB) QueryUsers(q *UserQuery) (*UserPage, error) {
+	c, err := decodeCursor(q.Cursor, "", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	if q.Name != "" {
+		where = append(where, "user_name LIKE ?")
+		args = append(args, likePattern(q.Name))
+	}
+	if c != nil {
+		where = append(where, "(user_name, user_id) > (?, ?)")
+		args = append(args, c.Value, c.Key[0])
+	}
+
+	query := "SELECT * FROM users"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY user_name, user_id"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := userDB.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("mysql: could not query users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("mysql: could not read row: %v", err)
+		}
+
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("mysql: could not read rows: %v", err)
+	}
+	return userPage(users, q.Limit), nil
+}
+
 const getUserStatement = "SELECT * FROM users WHERE user_id = ?"
 
 // GetUser retrieves a user by its ID.
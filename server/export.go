@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/export"
+)
+
+type exportResponse struct {
+	URL string `json:"url"`
+}
+
+// exportLinkHandler returns the download link of the participant list of an
+// event. Only its host and co-hosts get one.
+func exportLinkHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	resJSON, err := json.Marshal(exportResponse{URL: exportURL(event.HostID, event.EventName)})
+	if err != nil {
+		return appErrorf(err, "could not encode export link: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// exportParticipantsHandler streams the participant list of an event as CSV.
+// The request must carry the key of the download link.
+func exportParticipantsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	hostID := r.FormValue("hostID")
+	eventName := r.FormValue("eventName")
+	if !ticketSigner.VerifyExportKey(hostID, eventName, r.FormValue("key")) {
+		return appErrorf(nil, "invalid export key").withCode(http.StatusForbidden)
+	}
+	event, err := db.DB.GetEvent(hostID, eventName)
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename*=UTF-8''%s.csv", url.PathEscape(event.EventName)))
+	if err := export.WriteParticipants(w, db.DB, event); err != nil {
+		return appErrorf(err, "could not export participants: %v", err)
+	}
+	return nil
+}
+
+// exportURL returns the download link of the participant list of an event.
+func exportURL(hostID, eventName string) string {
+	query := url.Values{
+		"hostID":    {hostID},
+		"eventName": {eventName},
+		"key":       {ticketSigner.ExportKey(hostID, eventName)},
+	}
+	return serverURL() + "/event/participants.csv?" + query.Encode()
+}
@@ -0,0 +1,111 @@
+// Package export writes the participant lists of events as spreadsheets.
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/ledger"
+	"github.com/shinyamizuno1008/hashbill/server/spreadsheet"
+)
+
+// bom is the UTF-8 byte order mark. Excel needs it to read CSV files as UTF-8
+// rather than Shift_JIS.
+const bom = "\ufeff"
+
+// answerSeparator separates the options chosen in answer to a multiple
+// choice question.
+const answerSeparator = "; "
+
+// flushEvery is the number of rows written between flushes, so that large
+// lists are sent as they are read.
+const flushEvery = 100
+
+// Header is the header row of a participant list. A column follows for each
+// question of the event, headed by its label.
+var Header = []string{
+	"user_id", "user_name", "status", "tier", "payment_status", "amount", "currency",
+	"applied_at", "checked_in_at", "cancelled_at", "attendance",
+}
+
+// WriteParticipants writes the participants of an event as CSV for Excel,
+// one row per participant in order of application. Participants without a
+// payment record owe the fee of their tier as ledger.OwesFee decides. The
+// options chosen in answer to a multiple choice question are separated by
+// answerSeparator. Text entered by users is escaped as by spreadsheet.Cell.
+func WriteParticipants(w io.Writer, database db.EventListDatabase, event *db.Event) error {
+	tiers, err := database.ListTiers(event.HostID, event.EventName)
+	if err != nil {
+		return err
+	}
+	questions, err := database.ListQuestions(event.HostID, event.EventName, db.FormRegistration)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, bom); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	header := append([]string(nil), Header...)
+	for _, q := range questions {
+		header = append(header, spreadsheet.Cell(q.Label))
+	}
+	cw.Write(header)
+
+	n := 0
+	err = database.ScanAttendees(event.HostID, event.EventName, func(a *db.Attendee) error {
+		paymentStatus, amount, currency := "", "", ""
+		fee := ledger.Fee(event, tiers, a.Tier)
+		if a.Payment != nil {
+			paymentStatus = a.Payment.Status
+			amount = strconv.FormatInt(a.Payment.Amount, 10)
+			currency = a.Payment.Currency
+		} else if ledger.OwesFee(event, a.Participant) && fee > 0 {
+			paymentStatus = db.PaymentDue
+			amount = strconv.FormatInt(fee, 10)
+			currency = event.Currency
+		}
+
+		row := []string{
+			a.ParticipantID, spreadsheet.Cell(a.UserName), a.Status, spreadsheet.Cell(a.Tier), paymentStatus, amount, currency,
+			a.AppliedAt, a.CheckedInAt, a.CancelledAt, a.Attendance,
+		}
+		for _, q := range questions {
+			answer := ""
+			if ans := a.Answer(q.QuestionID); ans != nil {
+				answer = strings.Join(ans.Values, answerSeparator)
+			}
+			row = append(row, spreadsheet.Cell(answer))
+		}
+		cw.Write(row)
+
+		n++
+		if n%flushEvery == 0 {
+			return flush(w, cw)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush(w, cw)
+}
+
+// flush sends the rows written so far, through to the client if w is an
+// HTTP response.
+func flush(w io.Writer, cw *csv.Writer) error {
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/survey"
+)
+
+// submitFeedbackHandler saves the response of the participant in "userID" to
+// the survey of an event: a "rating", a "comment" and the "answers" to the
+// feedback questions of the event. Only participants who checked in may
+// respond, once the event was held. Responding again replaces the response.
+func submitFeedbackHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	userID := r.FormValue("userID")
+	participant, err := db.DB.GetParticipant(&db.Participant{
+		HostID:        event.HostID,
+		EventName:     event.EventName,
+		ParticipantID: userID,
+	})
+	if err != nil || participant.CheckedInAt == "" {
+		return appErrorf(err, "user %s did not check in to event %s", userID, event.EventName).withCode(http.StatusForbidden)
+	}
+	if start, err := event.StartTime(); err == nil && time.Now().Before(start) {
+		return appErrorf(nil, "event %s has not been held yet", event.EventName).withCode(http.StatusBadRequest)
+	}
+
+	rating, err := strconv.ParseInt(r.FormValue("rating"), 10, 64)
+	if err != nil || rating < db.MinRating || rating > db.MaxRating {
+		return appErrorf(err, "rating must be from %d to %d", db.MinRating, db.MaxRating).withCode(http.StatusBadRequest)
+	}
+	questions, err := db.DB.ListQuestions(event.HostID, event.EventName, db.FormFeedback)
+	if err != nil {
+		return appErrorf(err, "could not get questions from database: %v", err)
+	}
+	answers, err := answersFromForm(r, questions)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+
+	feedback := &db.Feedback{
+		HostID:      event.HostID,
+		EventName:   event.EventName,
+		UserID:      userID,
+		Rating:      rating,
+		Comment:     strings.TrimSpace(r.FormValue("comment")),
+		Answers:     answers,
+		SubmittedAt: time.Now().In(db.Timezone).Format(db.TimeLayout),
+	}
+	if err := db.DB.SetFeedback(feedback); err != nil {
+		return appErrorf(err, "could not save feedback: %v", err)
+	}
+
+	feedbackJSON, err := json.Marshal(feedback)
+	if err != nil {
+		return appErrorf(err, "could not encode feedback: %v", err)
+	}
+	w.Write(feedbackJSON)
+	return nil
+}
+
+// feedbackResultsHandler shows the host and co-hosts of an event the
+// aggregated responses to its survey. Responses are anonymous.
+func feedbackResultsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	questions, err := db.DB.ListQuestions(event.HostID, event.EventName, db.FormFeedback)
+	if err != nil {
+		return appErrorf(err, "could not get questions from database: %v", err)
+	}
+	feedback, err := db.DB.ListFeedback(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get feedback from database: %v", err)
+	}
+	participants, err := db.DB.ListParticipantsHostedBy(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get participants from database: %v", err)
+	}
+	invited := 0
+	for _, p := range participants {
+		if p.CheckedInAt != "" {
+			invited++
+		}
+	}
+
+	resJSON, err := json.Marshal(survey.Summarize(questions, feedback, invited))
+	if err != nil {
+		return appErrorf(err, "could not encode feedback: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
@@ -0,0 +1,63 @@
+// Package geo locates event venues and measures distances between them.
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+// earthRadius is the mean radius of the earth in meters, the same MySQL's
+// ST_Distance_Sphere uses, so that distances agree between backends.
+const earthRadius = 6370986
+
+// Point is a position on the earth in degrees.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Valid reports whether the latitude and longitude are in range.
+func (p Point) Valid() bool {
+	return p.Latitude >= -90 && p.Latitude <= 90 && p.Longitude >= -180 && p.Longitude <= 180
+}
+
+// Distance returns the great-circle distance between two points in meters.
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Latitude), radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLng := radians(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Bounds returns the corners of a box containing every point within radius
+// meters of p, which narrows a search before distances are measured. The box
+// does not wrap around the 180th meridian.
+func (p Point) Bounds(radius float64) (southWest, northEast Point) {
+	dLat := degrees(radius / earthRadius)
+	dLng := 180.0
+	if c := math.Cos(radians(p.Latitude)); c > 1e-9 {
+		dLng = math.Min(180, dLat/c)
+	}
+	southWest = Point{math.Max(-90, p.Latitude-dLat), math.Max(-180, p.Longitude-dLng)}
+	northEast = Point{math.Min(90, p.Latitude+dLat), math.Min(180, p.Longitude+dLng)}
+	return southWest, northEast
+}
+
+func radians(d float64) float64 { return d * math.Pi / 180 }
+func degrees(r float64) float64 { return r * 180 / math.Pi }
+
+// Place is a located venue.
+type Place struct {
+	Name    string
+	Address string
+	Point
+}
+
+// ErrNotFound is returned by a Geocoder for an address it cannot locate.
+var ErrNotFound = errors.New("geo: address not found")
+
+// Geocoder locates addresses, such as the free-text location of an event.
+type Geocoder interface {
+	Geocode(address string) (*Place, error)
+}
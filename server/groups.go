@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// joinGroupHandler records that the bot was invited to a LINE group or room,
+// so that announcements about the group's events are posted there.
+func joinGroupHandler(w http.ResponseWriter, r *http.Request) *appError {
+	group := &db.Group{
+		GroupID:  r.FormValue("groupID"),
+		Kind:     r.FormValue("kind"),
+		JoinedAt: time.Now().In(db.Timezone).Format(db.TimeLayout),
+	}
+	if group.GroupID == "" {
+		return appErrorf(nil, "groupID is required").withCode(http.StatusBadRequest)
+	}
+	if group.Kind != db.GroupKindGroup && group.Kind != db.GroupKindRoom {
+		return appErrorf(nil, "invalid kind %q", group.Kind).withCode(http.StatusBadRequest)
+	}
+
+	if err := db.DB.SetGroup(group); err != nil {
+		return appErrorf(err, "could not save group: %v", err)
+	}
+	return nil
+}
+
+// leaveGroupHandler records that the bot left or was removed from a LINE
+// group or room. The group's events are kept, but nothing is posted to it any
+// more.
+func leaveGroupHandler(w http.ResponseWriter, r *http.Request) *appError {
+	groupID := r.FormValue("groupID")
+	now := time.Now().In(db.Timezone).Format(db.TimeLayout)
+
+	group, err := db.DB.GetGroup(groupID)
+	if err != nil {
+		// The bot joined before groups were recorded.
+		group = &db.Group{GroupID: groupID, Kind: r.FormValue("kind"), JoinedAt: now}
+	}
+	group.LeftAt = now
+
+	if err := db.DB.SetGroup(group); err != nil {
+		return appErrorf(err, "could not save group: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+// Package ical writes events as iCalendar (RFC 5545) data, to be imported
+// as .ics files or subscribed to as feeds.
+package ical
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/geo"
+)
+
+// Duration is how long events are shown in calendars. Events have no end
+// time, so they all last this long.
+const Duration = 2 * time.Hour
+
+// TZID is the time zone event dates are written in.
+const TZID = "Asia/Tokyo"
+
+// Statuses of an event.
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Event is an entry of a calendar.
+type Event struct {
+	HostID      string
+	EventName   string
+	Start       time.Time
+	Location    string
+	Description string
+	URL         string
+	Status      string
+
+	// Geo is the position of the venue, or nil if it is unknown.
+	Geo *geo.Point
+
+	// Updated is when the entry last changed. Calendars use it to tell
+	// which copy of an event is newer.
+	Updated time.Time
+}
+
+// FromEvent returns the calendar entry of an event. Cancelled events are
+// shown as cancelled.
+func FromEvent(e *db.Event) (*Event, error) {
+	start, err := e.StartTime()
+	if err != nil {
+		return nil, err
+	}
+	if e.Cancelled() {
+		cancelledAt, err := db.ParseTime(e.CancelledAt)
+		if err != nil {
+			return nil, err
+		}
+		return &Event{
+			HostID:      e.HostID,
+			EventName:   e.EventName,
+			Start:       start,
+			Location:    e.Location,
+			Description: e.CancelReason,
+			Status:      StatusCancelled,
+			Geo:         e.Coordinates,
+			Updated:     cancelledAt,
+		}, nil
+	}
+	return &Event{
+		HostID:      e.HostID,
+		EventName:   e.EventName,
+		Start:       start,
+		Location:    e.Location,
+		Description: e.Description,
+		Status:      StatusConfirmed,
+		Geo:         e.Coordinates,
+	}, nil
+}
+
+// FromTombstone returns the calendar entry of a deleted event, which
+// calendars show as cancelled.
+func FromTombstone(t *db.Tombstone) (*Event, error) {
+	start, err := db.ParseTime(t.Date)
+	if err != nil {
+		return nil, err
+	}
+	deletedAt, err := db.ParseTime(t.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		HostID:    t.HostID,
+		EventName: t.EventName,
+		Start:     start,
+		Location:  t.Location,
+		Status:    StatusCancelled,
+		Updated:   deletedAt,
+	}, nil
+}
+
+// UID returns the unique ID of an event in calendars. It depends only on the
+// host and name of the event, so it stays the same when the event is edited.
+func UID(hostID, eventName string) string {
+	sum := sha256.Sum256([]byte(hostID + "\x00" + eventName))
+	return fmt.Sprintf("%x@hashbill", sum[:16])
+}
+
+// Write writes a calendar with a given name and events.
+func Write(w io.Writer, name string, events []*Event, now time.Time) error {
+	cw := &writer{w: bufio.NewWriter(w)}
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//hashbill//hashbill//JA")
+	cw.line("CALSCALE:GREGORIAN")
+	cw.line("METHOD:PUBLISH")
+	cw.property("X-WR-CALNAME", text(name))
+	cw.line("X-WR-TIMEZONE:" + TZID)
+
+	// Japan has not observed daylight saving time since 1951.
+	cw.line("BEGIN:VTIMEZONE")
+	cw.line("TZID:" + TZID)
+	cw.line("BEGIN:STANDARD")
+	cw.line("DTSTART:19510908T000000")
+	cw.line("TZOFFSETFROM:+0900")
+	cw.line("TZOFFSETTO:+0900")
+	cw.line("TZNAME:JST")
+	cw.line("END:STANDARD")
+	cw.line("END:VTIMEZONE")
+
+	stamp := now.UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		start := e.Start.In(db.Timezone)
+		cw.line("BEGIN:VEVENT")
+		cw.line("UID:" + UID(e.HostID, e.EventName))
+		cw.line("DTSTAMP:" + stamp)
+		cw.line("DTSTART;TZID=" + TZID + ":" + start.Format("20060102T150405"))
+		cw.line("DTEND;TZID=" + TZID + ":" + start.Add(Duration).Format("20060102T150405"))
+		cw.property("SUMMARY", text(e.EventName))
+		if e.Location != "" {
+			cw.property("LOCATION", text(e.Location))
+		}
+		if e.Geo != nil {
+			cw.line(fmt.Sprintf("GEO:%.6f;%.6f", e.Geo.Latitude, e.Geo.Longitude))
+		}
+		if e.Description != "" {
+			cw.property("DESCRIPTION", text(e.Description))
+		}
+		if e.URL != "" {
+			cw.property("URL", e.URL)
+		}
+		status := e.Status
+		if status == "" {
+			status = StatusConfirmed
+		}
+		cw.line("STATUS:" + status)
+		if status == StatusCancelled {
+			// A higher sequence tells calendars the cancellation supersedes
+			// the event they have.
+			cw.line("SEQUENCE:1")
+		}
+		if !e.Updated.IsZero() {
+			cw.line("LAST-MODIFIED:" + e.Updated.UTC().Format("20060102T150405Z"))
+		}
+		cw.line("END:VEVENT")
+	}
+
+	cw.line("END:VCALENDAR")
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+// text escapes a TEXT value.
+func text(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// maxLineOctets is the length lines are folded at.
+const maxLineOctets = 75
+
+type writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (cw *writer) property(name, value string) {
+	cw.line(name + ":" + value)
+}
+
+// line writes a content line, folded so that no line is longer than 75
+// octets without splitting UTF-8 characters.
+func (cw *writer) line(s string) {
+	if cw.err != nil {
+		return
+	}
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		_, cw.err = cw.w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space.
+		limit = maxLineOctets - 1
+	}
+	if cw.err == nil {
+		_, cw.err = cw.w.WriteString(s + "\r\n")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/importer"
+)
+
+// maxImportMemory is how much of an uploaded import is kept in memory. The
+// rest is stored in temporary files.
+const maxImportMemory = 8 << 20
+
+type importResponse struct {
+	DryRun       bool              `json:"dryRun"`
+	Events       int               `json:"events"`
+	Users        int               `json:"users"`
+	Participants int               `json:"participants"`
+	Errors       []*importer.Error `json:"errors"`
+}
+
+// importHandler imports events and participants from the CSV files uploaded
+// as "events" and "participants". Valid rows are saved all together and
+// invalid ones are reported by line. With dryRun set, nothing is saved.
+func importHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if err := r.ParseMultipartForm(maxImportMemory); err != nil {
+		return appErrorf(err, "could not parse upload: %v", err).withCode(http.StatusBadRequest)
+	}
+	var dryRun bool
+	if v := r.FormValue("dryRun"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			return appErrorf(err, "could not parse dryRun: %v", err).withCode(http.StatusBadRequest)
+		}
+	}
+
+	var files [2]io.Reader
+	for i, name := range []string{importer.EventsFile, importer.ParticipantsFile} {
+		f, _, err := r.FormFile(name)
+		if err == http.ErrMissingFile {
+			continue
+		}
+		if err != nil {
+			return appErrorf(err, "could not read %s: %v", name, err).withCode(http.StatusBadRequest)
+		}
+		defer f.Close()
+		files[i] = f
+	}
+	if files[0] == nil && files[1] == nil {
+		return appErrorf(nil, "no events or participants file").withCode(http.StatusBadRequest)
+	}
+
+	plan, err := importer.Prepare(db.DB, files[0], files[1])
+	if err != nil {
+		return appErrorf(err, "could not read import: %v", err).withCode(http.StatusBadRequest)
+	}
+	if !dryRun {
+		if err := plan.Apply(audited(r)); err != nil {
+			return appErrorf(err, "could not import: %v", err)
+		}
+	}
+
+	resJSON, err := json.Marshal(importResponse{
+		DryRun:       dryRun,
+		Events:       len(plan.Events),
+		Users:        len(plan.Users),
+		Participants: len(plan.Participants),
+		Errors:       plan.Errors,
+	})
+	if err != nil {
+		return appErrorf(err, "could not encode import result: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
@@ -0,0 +1,376 @@
+// Package importer imports events and participants in bulk from CSV files,
+// e.g. spreadsheets kept before moving to hashbill.
+//
+// The first row of a file names its columns, in any order. Event files have
+// the columns host_id, event_name, date, deadline and location, and
+// optionally members_max, lottery, description, fee, currency, venue,
+// latitude, longitude and visibility.
+// Participant files have the columns host_id, event_name and user_id, and
+// optionally user_name, status, tier and applied_at. Participants may join
+// events from the same import.
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/geo"
+)
+
+// Error is a problem with a row of an import file.
+type Error struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// Plan is what an import would change: the valid rows to save and the errors
+// of the others.
+type Plan struct {
+	Events       []*db.Event       `json:"events"`
+	Users        []*db.User        `json:"users"`
+	Participants []*db.Participant `json:"participants"`
+	Errors       []*Error          `json:"errors"`
+}
+
+// Names of import files in errors.
+const (
+	EventsFile       = "events"
+	ParticipantsFile = "participants"
+)
+
+var (
+	eventColumns       = []string{"host_id", "event_name", "date", "deadline", "location"}
+	participantColumns = []string{"host_id", "event_name", "user_id"}
+)
+
+// record is a row of a CSV file, keyed by column name.
+type record struct {
+	line   int
+	values map[string]string
+}
+
+func (r record) get(column string) string {
+	return strings.TrimSpace(r.values[column])
+}
+
+// readCSV reads the rows of a CSV file after its header. Missing required
+// columns are an error of the whole file.
+func readCSV(r io.Reader, required []string) ([]record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	for _, column := range required {
+		if !contains(header, column) {
+			return nil, fmt.Errorf("missing column %s", column)
+		}
+	}
+
+	var records []record
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		rec := record{line: line, values: make(map[string]string)}
+		for i, v := range row {
+			if i < len(header) {
+				rec.values[header[i]] = v
+			}
+		}
+		records = append(records, rec)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Prepare validates every row of the given files against each other and the
+// database, and returns the plan of the import. Either file may be nil. An
+// error is returned only if a file cannot be read at all.
+func Prepare(database db.EventListDatabase, events, participants io.Reader) (*Plan, error) {
+	plan := &Plan{}
+	newEvents := make(map[string]*db.Event)
+
+	if events != nil {
+		records, err := readCSV(events, eventColumns)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", EventsFile, err)
+		}
+		for _, rec := range records {
+			event, err := parseEvent(rec)
+			if err == nil {
+				err = checkEvent(database, newEvents, event)
+			}
+			if err != nil {
+				plan.Errors = append(plan.Errors, &Error{File: EventsFile, Line: rec.line, Message: err.Error()})
+				continue
+			}
+			newEvents[key(event.HostID, event.EventName)] = event
+			plan.Events = append(plan.Events, event)
+		}
+	}
+
+	if participants != nil {
+		records, err := readCSV(participants, participantColumns)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ParticipantsFile, err)
+		}
+		newUsers := make(map[string]bool)
+		newParticipants := make(map[string]bool)
+		for _, rec := range records {
+			p, user, err := parseParticipant(rec)
+			if err == nil {
+				user, err = checkParticipant(database, newEvents, newUsers, newParticipants, p, user)
+			}
+			if err != nil {
+				plan.Errors = append(plan.Errors, &Error{File: ParticipantsFile, Line: rec.line, Message: err.Error()})
+				continue
+			}
+			if user != nil {
+				newUsers[user.UserID] = true
+				plan.Users = append(plan.Users, user)
+			}
+			newParticipants[key(p.HostID, p.EventName, p.ParticipantID)] = true
+			plan.Participants = append(plan.Participants, p)
+		}
+	}
+
+	return plan, nil
+}
+
+func key(ids ...string) string {
+	return strings.Join(ids, "\x00")
+}
+
+// parseEvent reads an event from a row.
+func parseEvent(rec record) (*db.Event, error) {
+	event := &db.Event{
+		HostID:      rec.get("host_id"),
+		EventName:   rec.get("event_name"),
+		Location:    rec.get("location"),
+		Description: rec.get("description"),
+		Currency:    strings.ToUpper(rec.get("currency")),
+	}
+	if event.HostID == "" || event.EventName == "" || event.Location == "" {
+		return nil, fmt.Errorf("host_id, event_name and location are required")
+	}
+
+	date, err := db.ParseTime(rec.get("date"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid date: %v", err)
+	}
+	deadline, err := db.ParseTime(rec.get("deadline"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid deadline: %v", err)
+	}
+	if deadline.After(date) {
+		return nil, fmt.Errorf("deadline %s is after the date %s", rec.get("deadline"), rec.get("date"))
+	}
+	event.Date = date.Format(db.TimeLayout)
+	event.Deadline = deadline.Format(db.TimeLayout)
+
+	if v := rec.get("members_max"); v != "" {
+		if event.MembersMax, err = strconv.ParseInt(v, 10, 64); err != nil || event.MembersMax < 0 {
+			return nil, fmt.Errorf("invalid members_max %q", v)
+		}
+	}
+	if v := rec.get("lottery"); v != "" {
+		if event.Lottery, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid lottery %q", v)
+		}
+	}
+	if v := rec.get("fee"); v != "" {
+		if event.Fee, err = strconv.ParseInt(v, 10, 64); err != nil || event.Fee < 0 {
+			return nil, fmt.Errorf("invalid fee %q", v)
+		}
+	}
+	if event.Currency != "" && len(event.Currency) != 3 {
+		return nil, fmt.Errorf("invalid currency %q", event.Currency)
+	}
+	event.Venue = rec.get("venue")
+	if lat, lng := rec.get("latitude"), rec.get("longitude"); lat != "" || lng != "" {
+		var p geo.Point
+		if p.Latitude, err = strconv.ParseFloat(lat, 64); err != nil {
+			return nil, fmt.Errorf("invalid latitude %q", lat)
+		}
+		if p.Longitude, err = strconv.ParseFloat(lng, 64); err != nil {
+			return nil, fmt.Errorf("invalid longitude %q", lng)
+		}
+		if !p.Valid() {
+			return nil, fmt.Errorf("latitude and longitude %s, %s out of range", lat, lng)
+		}
+		event.Coordinates = &p
+	}
+	switch event.Visibility = rec.get("visibility"); event.Visibility {
+	case "", db.VisibilityPublic, db.VisibilityUnlisted, db.VisibilityPrivate:
+	default:
+		return nil, fmt.Errorf("invalid visibility %q", event.Visibility)
+	}
+	return event, nil
+}
+
+// checkEvent checks that an event is new.
+func checkEvent(database db.EventListDatabase, newEvents map[string]*db.Event, event *db.Event) error {
+	if newEvents[key(event.HostID, event.EventName)] != nil {
+		return fmt.Errorf("event %s is listed more than once", event.EventName)
+	}
+	if _, err := database.GetEvent(event.HostID, event.EventName); err == nil {
+		return fmt.Errorf("event %s already exists", event.EventName)
+	}
+	return nil
+}
+
+// parseParticipant reads a participant from a row, and the user to create
+// for them if the row names one.
+func parseParticipant(rec record) (*db.Participant, *db.User, error) {
+	p := &db.Participant{
+		HostID:        rec.get("host_id"),
+		EventName:     rec.get("event_name"),
+		ParticipantID: rec.get("user_id"),
+		Status:        rec.get("status"),
+		Tier:          rec.get("tier"),
+	}
+	if p.HostID == "" || p.EventName == "" || p.ParticipantID == "" {
+		return nil, nil, fmt.Errorf("host_id, event_name and user_id are required")
+	}
+
+	switch p.Status {
+	case "":
+		p.Status = db.StatusConfirmed
+	case db.StatusApplied, db.StatusConfirmed, db.StatusWaitlisted, db.StatusCancelled, db.StatusPendingPayment:
+	default:
+		return nil, nil, fmt.Errorf("invalid status %q", p.Status)
+	}
+
+	if v := rec.get("applied_at"); v != "" {
+		appliedAt, err := db.ParseTime(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid applied_at: %v", err)
+		}
+		p.AppliedAt = appliedAt.Format(db.TimeLayout)
+	} else {
+		p.AppliedAt = time.Now().In(db.Timezone).Format(db.TimeLayout)
+	}
+
+	var user *db.User
+	if name := rec.get("user_name"); name != "" {
+		user = &db.User{UserID: p.ParticipantID, UserName: name}
+	}
+	return p, user, nil
+}
+
+// checkParticipant checks that a participant joins an existing or imported
+// event only once, that an existing event was not cancelled, and that they
+// and the host are users. user is the user
+// the row names, or nil. It returns the user to create, which is nil if the
+// user already exists.
+func checkParticipant(database db.EventListDatabase, newEvents map[string]*db.Event, newUsers, newParticipants map[string]bool,
+	p *db.Participant, user *db.User) (*db.User, error) {
+	if newParticipants[key(p.HostID, p.EventName, p.ParticipantID)] {
+		return nil, fmt.Errorf("user %s is listed more than once for event %s", p.ParticipantID, p.EventName)
+	}
+
+	if newEvents[key(p.HostID, p.EventName)] == nil {
+		event, err := database.GetEvent(p.HostID, p.EventName)
+		if err != nil {
+			return nil, fmt.Errorf("event %s hosted by %s does not exist", p.EventName, p.HostID)
+		}
+		if event.Cancelled() {
+			return nil, fmt.Errorf("event %s was cancelled", p.EventName)
+		}
+		if _, err := database.GetParticipant(p); err == nil {
+			return nil, fmt.Errorf("user %s already joined event %s", p.ParticipantID, p.EventName)
+		}
+	}
+	if p.Tier != "" {
+		tiers, err := database.ListTiers(p.HostID, p.EventName)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, t := range tiers {
+			found = found || t.TierName == p.Tier
+		}
+		if !found {
+			return nil, fmt.Errorf("event %s has no tier %s", p.EventName, p.Tier)
+		}
+	}
+
+	if _, err := database.GetUser(p.HostID); err != nil && !newUsers[p.HostID] {
+		return nil, fmt.Errorf("host %s is not a user", p.HostID)
+	}
+	if _, err := database.GetUser(p.ParticipantID); err == nil || newUsers[p.ParticipantID] {
+		return nil, nil
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %s does not exist; give their user_name to create them", p.ParticipantID)
+	}
+	return user, nil
+}
+
+// Apply saves the rows of a plan. Either all of them are saved or, if one
+// fails, the ones saved before it are removed again and the error returned.
+// Events removed again leave no tombstone, so calendars never show them.
+func (plan *Plan) Apply(database db.EventListDatabase) error {
+	var undo []func() error
+	rollback := func(err error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if uerr := undo[i](); uerr != nil {
+				return fmt.Errorf("%v; rolling back also failed: %v", err, uerr)
+			}
+		}
+		return err
+	}
+
+	for _, event := range plan.Events {
+		if err := database.AddEvent(event); err != nil {
+			return rollback(fmt.Errorf("could not add event %s: %v", event.EventName, err))
+		}
+		event := event
+		undo = append(undo, func() error { return database.DiscardEvent(event.HostID, event.EventName) })
+	}
+	for _, user := range plan.Users {
+		if err := database.AddUser(user); err != nil {
+			return rollback(fmt.Errorf("could not add user %s: %v", user.UserID, err))
+		}
+		user := user
+		undo = append(undo, func() error { return database.DeleteUser(user.UserID) })
+	}
+	for _, p := range plan.Participants {
+		if err := database.AddParticipant(p); err != nil {
+			return rollback(fmt.Errorf("could not add participant %s to %s: %v", p.ParticipantID, p.EventName, err))
+		}
+		p := p
+		undo = append(undo, func() error { return database.DeleteParticipant(p) })
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// viewerFromForm returns the user an authenticated request asks to see
+// events as, given by "viewer", or an empty string, who sees only events that
+// are not private.
+func viewerFromForm(r *http.Request) string {
+	if !authenticated(r) {
+		return ""
+	}
+	return r.FormValue("viewer")
+}
+
+// canView reports whether a user may see and join an event. Anyone may see
+// public and unlisted events; private events only their organizers, their
+// participants and their guests.
+func canView(event *db.Event, userID string) bool {
+	if event.Visibility != db.VisibilityPrivate {
+		return true
+	}
+	if userID == "" {
+		return false
+	}
+	if roleOf(event, userID) != "" {
+		return true
+	}
+	if _, err := db.DB.GetParticipant(&db.Participant{
+		HostID:        event.HostID,
+		EventName:     event.EventName,
+		ParticipantID: userID,
+	}); err == nil {
+		return true
+	}
+	_, err := db.DB.GetGuest(event.HostID, event.EventName, userID)
+	return err == nil
+}
+
+// admit checks that a user may join an event. A user who may not see a
+// private event is admitted by redeeming the invitation in "code".
+func admit(r *http.Request, event *db.Event, userID string) *appError {
+	if canView(event, userID) {
+		return nil
+	}
+	code := codeFromForm(r)
+	if code == "" {
+		return appErrorf(nil, "event %s is private", event.EventName).withCode(http.StatusForbidden)
+	}
+	invitation, err := db.DB.GetInvitation(code)
+	if err != nil || invitation.HostID != event.HostID || invitation.EventName != event.EventName {
+		return appErrorf(err, "invalid invitation to event %s", event.EventName).withCode(http.StatusForbidden)
+	}
+	_, aerr := redeem(code, userID)
+	return aerr
+}
+
+// redeem redeems an invitation for a user.
+func redeem(code, userID string) (*db.Guest, *appError) {
+	if _, err := db.DB.GetUser(userID); err != nil {
+		return nil, appErrorf(err, "could not find user: %v", err).withCode(http.StatusNotFound)
+	}
+	guest, err := db.DB.RedeemInvitation(code, userID, time.Now().In(db.Timezone).Format(db.TimeLayout))
+	if err == db.ErrInvitationExpired || err == db.ErrInvitationUsedUp {
+		return nil, appErrorf(err, "%v", err).withCode(http.StatusGone)
+	}
+	if err != nil {
+		return nil, appErrorf(err, "could not redeem invitation: %v", err).withCode(http.StatusNotFound)
+	}
+	return guest, nil
+}
+
+// setVisibilityHandler changes who sees an event. Only its host and
+// co-hosts may change it.
+func setVisibilityHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	switch visibility := r.FormValue("visibility"); visibility {
+	case db.VisibilityPublic, db.VisibilityUnlisted, db.VisibilityPrivate:
+		event.Visibility = visibility
+	default:
+		return appErrorf(nil, "invalid visibility %q", visibility).withCode(http.StatusBadRequest)
+	}
+	if err := audited(r).UpdateEvent(event); err != nil {
+		return appErrorf(err, "could not save event: %v", err)
+	}
+	return nil
+}
+
+// newInvitationCode returns a random code that is easy to type.
+func newInvitationCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.EncodeToString(b), nil
+}
+
+// codeFromForm returns the invitation code in "code". Codes are not case
+// sensitive, as users may type them.
+func codeFromForm(r *http.Request) string {
+	return strings.ToUpper(strings.TrimSpace(r.FormValue("code")))
+}
+
+// invitationURL returns the link to an invitation.
+func invitationURL(code string) string {
+	return serverURL() + "/invitation/" + url.PathEscape(code)
+}
+
+type invitationResponse struct {
+	*db.Invitation
+	URL string `json:"url"`
+}
+
+// createInvitationHandler creates an invitation to an event. It may be
+// limited to "maxUses" users and expire at "expiresAt". Only the host and
+// co-hosts of the event may invite users.
+func createInvitationHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	actorID, aerr := authorize(r, event, permManage)
+	if aerr != nil {
+		return aerr
+	}
+
+	now := time.Now().In(db.Timezone)
+	invitation := &db.Invitation{
+		HostID:    event.HostID,
+		EventName: event.EventName,
+		ExpiresAt: r.FormValue("expiresAt"),
+		CreatedBy: actorID,
+		CreatedAt: now.Format(db.TimeLayout),
+	}
+	if v := r.FormValue("maxUses"); v != "" {
+		if invitation.MaxUses, err = strconv.ParseInt(v, 10, 64); err != nil || invitation.MaxUses < 0 {
+			return appErrorf(err, "invalid maxUses %q", v).withCode(http.StatusBadRequest)
+		}
+	}
+	if invitation.ExpiresAt != "" {
+		expires, err := db.ParseTime(invitation.ExpiresAt)
+		if err != nil {
+			return appErrorf(err, "invalid expiresAt: %v", err).withCode(http.StatusBadRequest)
+		}
+		if !expires.After(now) {
+			return appErrorf(nil, "expiresAt %s has passed", invitation.ExpiresAt).withCode(http.StatusBadRequest)
+		}
+	}
+	if invitation.Code, err = newInvitationCode(); err != nil {
+		return appErrorf(err, "could not generate invitation code: %v", err)
+	}
+	if err := db.DB.AddInvitation(invitation); err != nil {
+		return appErrorf(err, "could not save invitation: %v", err)
+	}
+
+	resJSON, err := json.Marshal(invitationResponse{Invitation: invitation, URL: invitationURL(invitation.Code)})
+	if err != nil {
+		return appErrorf(err, "could not encode invitation: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// listInvitationsHandler shows the invitations to an event to its host and
+// co-hosts.
+func listInvitationsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+	invitations, err := db.DB.ListInvitations(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get invitations from database: %v", err)
+	}
+
+	res := []*invitationResponse{}
+	for _, i := range invitations {
+		res = append(res, &invitationResponse{Invitation: i, URL: invitationURL(i.Code)})
+	}
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode invitations: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// deleteInvitationHandler revokes an invitation. Users who redeemed it keep
+// seeing the event.
+func deleteInvitationHandler(w http.ResponseWriter, r *http.Request) *appError {
+	invitation, err := db.DB.GetInvitation(codeFromForm(r))
+	if err != nil {
+		return appErrorf(err, "could not find invitation: %v", err).withCode(http.StatusNotFound)
+	}
+	event, err := db.DB.GetEvent(invitation.HostID, invitation.EventName)
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	if err := db.DB.DeleteInvitation(invitation.Code); err != nil {
+		return appErrorf(err, "could not delete invitation: %v", err)
+	}
+	return nil
+}
+
+type invitedEventResponse struct {
+	Event *db.Event `json:"event"`
+
+	// Error tells why the invitation cannot be redeemed, if it cannot.
+	Error string `json:"error,omitempty"`
+}
+
+// showInvitationHandler shows the event an invitation link is for, and
+// whether the invitation can still be redeemed.
+func showInvitationHandler(w http.ResponseWriter, r *http.Request) *appError {
+	invitation, err := db.DB.GetInvitation(strings.ToUpper(mux.Vars(r)["code"]))
+	if err != nil {
+		return appErrorf(err, "could not find invitation: %v", err).withCode(http.StatusNotFound)
+	}
+	event, err := db.DB.GetEvent(invitation.HostID, invitation.EventName)
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+
+	res := invitedEventResponse{Event: event}
+	if err := invitation.Usable(time.Now()); err != nil {
+		res.Error = err.Error()
+	}
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode invitation: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// redeemInvitationHandler lets the user in "userID" see and join the event
+// of the invitation in "code". Redeeming an invitation again does not use it
+// up further.
+func redeemInvitationHandler(w http.ResponseWriter, r *http.Request) *appError {
+	guest, aerr := redeem(codeFromForm(r), r.FormValue("userID"))
+	if aerr != nil {
+		return aerr
+	}
+	event, err := db.DB.GetEvent(guest.HostID, guest.EventName)
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+
+	resJSON, err := json.Marshal(invitedEventResponse{Event: event})
+	if err != nil {
+		return appErrorf(err, "could not encode event: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package ledger lists who has paid the fee of an event.
+package ledger
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/spreadsheet"
+)
+
+// Entry is a line of the ledger of an event.
+type Entry struct {
+	UserID            string `json:"userID"`
+	UserName          string `json:"userName"`
+	ParticipantStatus string `json:"participantStatus"`
+	PaymentStatus     string `json:"paymentStatus"`
+	Amount            int64  `json:"amount"`
+	Currency          string `json:"currency"`
+	UpdatedAt         string `json:"updatedAt"`
+	UpdatedBy         string `json:"updatedBy"`
+}
+
+// Entries returns the ledger of an event: every confirmed participant, every
+// participant with a seat held until they pay, and everyone else with a
+// payment record, e.g. a refunded participant who cancelled. Participants
+// without a record owe the event's fee, unless the event was cancelled. A fee
+// still due from a participant who no longer has a seat, e.g. whose hold
+// expired, is not owed and left out.
+func Entries(database db.EventListDatabase, event *db.Event) ([]*Entry, error) {
+	participants, err := database.ListParticipantsHostedBy(event.HostID, event.EventName)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := database.ListPayments(event.HostID, event.EventName)
+	if err != nil {
+		return nil, err
+	}
+	tiers, err := database.ListTiers(event.HostID, event.EventName)
+	if err != nil {
+		return nil, err
+	}
+
+	byParticipant := make(map[string]*db.Payment)
+	for _, p := range payments {
+		byParticipant[p.ParticipantID] = p
+	}
+
+	var entries []*Entry
+	for _, p := range participants {
+		payment, ok := byParticipant[p.ParticipantID]
+		fee := Fee(event, tiers, p.Tier)
+		if !ok && (!OwesFee(event, p) || fee == 0) {
+			continue
+		}
+		if ok && payment.Status == db.PaymentDue && !hasSeat(p.Status) {
+			continue
+		}
+
+		entry := &Entry{
+			UserID:            p.ParticipantID,
+			ParticipantStatus: p.Status,
+			PaymentStatus:     db.PaymentDue,
+			Amount:            fee,
+			Currency:          event.Currency,
+		}
+		if ok {
+			entry.PaymentStatus = payment.Status
+			entry.Amount = payment.Amount
+			entry.Currency = payment.Currency
+			entry.UpdatedAt = payment.UpdatedAt
+			entry.UpdatedBy = payment.UpdatedBy
+		}
+		if user, err := database.GetUser(p.ParticipantID); err == nil {
+			entry.UserName = user.UserName
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// OwesFee reports whether a participant of an event owes its fee when they
+// have no payment record: participants with a seat do, unless the event was
+// cancelled.
+func OwesFee(event *db.Event, p *db.Participant) bool {
+	return !event.Cancelled() && hasSeat(p.Status)
+}
+
+// hasSeat reports whether participants with a given status have a seat,
+// confirmed or held until they pay.
+func hasSeat(status string) bool {
+	return status == db.StatusConfirmed || status == db.StatusPendingPayment
+}
+
+// Fee returns the fee of a participant of an event who applied for a given
+// ticket tier. Participants without a tier owe the event's fee.
+func Fee(event *db.Event, tiers []*db.Tier, tierName string) int64 {
+	for _, t := range tiers {
+		if tierName != "" && t.TierName == tierName {
+			return t.Price
+		}
+	}
+	return event.Fee
+}
+
+// Unpaid returns the entries of a ledger whose fee is still due from
+// participants who have a seat.
+func Unpaid(entries []*Entry) []*Entry {
+	var unpaid []*Entry
+	for _, e := range entries {
+		if e.PaymentStatus == db.PaymentDue && hasSeat(e.ParticipantStatus) {
+			unpaid = append(unpaid, e)
+		}
+	}
+	return unpaid
+}
+
+// WriteCSV writes a ledger as CSV with a header row. User names are escaped
+// as by spreadsheet.Cell.
+func WriteCSV(w io.Writer, entries []*Entry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"user_id", "user_name", "participant_status", "payment_status", "amount", "currency", "updated_at", "updated_by"})
+	for _, e := range entries {
+		cw.Write([]string{e.UserID, spreadsheet.Cell(e.UserName), e.ParticipantStatus, e.PaymentStatus,
+			strconv.FormatInt(e.Amount, 10), e.Currency, e.UpdatedAt, e.UpdatedBy})
+	}
+	cw.Flush()
+	return cw.Error()
+}
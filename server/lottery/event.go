@@ -0,0 +1,148 @@
+package lottery
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/attendance"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// SeatsLeft returns how many more participants of a given tier can get a
+// seat, limited by both the capacity of the tier and that of the event, or
+// -1 if there is no limit.
+func SeatsLeft(event *db.Event, tier *db.Tier, participants []*db.Participant) int64 {
+	left := int64(-1)
+	limit := func(capacity, taken int64) {
+		if capacity <= 0 {
+			return
+		}
+		n := capacity - taken
+		if n < 0 {
+			n = 0
+		}
+		if left < 0 || n < left {
+			left = n
+		}
+	}
+	limit(event.MembersMax, SeatsTaken(participants))
+	if tier != nil {
+		limit(tier.Capacity, SeatsTaken(InTier(participants, tier.TierName)))
+	}
+	return left
+}
+
+// Seat gives a participant a seat of a given tier of an event at now. The
+// tier is nil if the event has no tiers. When fees are collected through a
+// payment provider, the seat is only held until the participant pays.
+func Seat(p *db.Participant, event *db.Event, tier *db.Tier, collectsFees bool, now time.Time) {
+	fee := event.Fee
+	if tier != nil {
+		fee = tier.Price
+	}
+	if fee > 0 && collectsFees {
+		p.Status = db.StatusPendingPayment
+		p.HeldAt = now.In(db.Timezone).Format(db.TimeLayout)
+		return
+	}
+	p.Status = db.StatusConfirmed
+}
+
+// SeatsTaken counts the participants who have or hold a seat.
+func SeatsTaken(participants []*db.Participant) int64 {
+	return countParticipants(participants, db.StatusConfirmed) +
+		countParticipants(participants, db.StatusPendingPayment)
+}
+
+// countParticipants returns the number of participants with a given status.
+func countParticipants(participants []*db.Participant, status string) int64 {
+	var n int64
+	for _, p := range participants {
+		if p.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// InTier returns the participants who applied for a given tier.
+func InTier(participants []*db.Participant, tierName string) []*db.Participant {
+	var in []*db.Participant
+	for _, p := range participants {
+		if p.Tier == tierName {
+			in = append(in, p)
+		}
+	}
+	return in
+}
+
+// noShowWeight lowers the lottery chance of a participant by how reliably
+// they attended past events.
+func noShowWeight(database db.EventListDatabase) Weight {
+	return func(p *db.Participant) float64 {
+		stats, err := attendance.UserStats(database, p.ParticipantID)
+		if err != nil {
+			return 1
+		}
+		return 1 / float64(1+stats.NoShows+stats.CancelledLate)
+	}
+}
+
+// DrawEvent draws the seats of an event among its applicants and saves the
+// outcome. Each tier is drawn separately among the applicants for it, and
+// applicants who do not win are put on the waitlist. Winners get their seats
+// as Seat gives them.
+func DrawEvent(database db.EventListDatabase, event *db.Event, rng *rand.Rand, collectsFees bool) (winners, losers []*db.Participant, err error) {
+	tiers, err := database.ListTiers(event.HostID, event.EventName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	weight := Weight(Equal)
+	if event.DeprioritizeNoShows {
+		weight = noShowWeight(database)
+	}
+
+	now := time.Now()
+	err = database.AllocateSeats(event.HostID, event.EventName, func(participants []*db.Participant) ([]*db.Participant, error) {
+		winners, losers = nil, nil
+		// Participants who applied without a tier are drawn first.
+		drawTier := func(tier *db.Tier) {
+			tierName := ""
+			if tier != nil {
+				tierName = tier.TierName
+			}
+			var applicants []*db.Participant
+			for _, p := range InTier(participants, tierName) {
+				if p.Status == db.StatusApplied {
+					applicants = append(applicants, p)
+				}
+			}
+
+			seats := len(applicants)
+			if left := SeatsLeft(event, tier, participants); left >= 0 {
+				seats = int(left)
+			}
+			won, lost := Draw(applicants, seats, weight, rng)
+			// Winners take their seats before the next tier is drawn.
+			for _, p := range won {
+				Seat(p, event, tier, collectsFees, now)
+			}
+			winners = append(winners, won...)
+			losers = append(losers, lost...)
+		}
+		drawTier(nil)
+		for _, t := range tiers {
+			drawTier(t)
+		}
+
+		for _, p := range losers {
+			p.Status = db.StatusWaitlisted
+		}
+		return append(append([]*db.Participant(nil), winners...), losers...), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return winners, losers, nil
+}
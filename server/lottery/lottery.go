@@ -0,0 +1,72 @@
+// Package lottery decides which applicants get a seat at an event and in
+// which order waitlisted participants are promoted.
+package lottery
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// Weight returns the relative chance of a participant to win, greater than 0.
+type Weight func(p *db.Participant) float64
+
+// Equal gives every participant the same chance.
+func Equal(*db.Participant) float64 { return 1 }
+
+// Draw picks up to seats winners among candidates at random, weighted by
+// weight. The losers are returned in the order they were drawn, which is the
+// order they should be promoted from the waitlist in.
+func Draw(candidates []*db.Participant, seats int, weight Weight, rng *rand.Rand) (winners, losers []*db.Participant) {
+	// Weighted sampling without replacement (Efraimidis and Spirakis): every
+	// candidate gets the key u^(1/w) and the largest keys win.
+	type entry struct {
+		p   *db.Participant
+		key float64
+	}
+	entries := make([]entry, len(candidates))
+	for i, p := range candidates {
+		w := weight(p)
+		if w <= 0 {
+			w = math.SmallestNonzeroFloat64
+		}
+		entries[i] = entry{p: p, key: math.Pow(rng.Float64(), 1/w)}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].key > entries[j].key })
+
+	for i, e := range entries {
+		if i < seats {
+			winners = append(winners, e.p)
+		} else {
+			losers = append(losers, e.p)
+		}
+	}
+	return winners, losers
+}
+
+// Next returns the waitlisted participant to promote next, or nil if nobody
+// is waiting. Participants are promoted in the order they applied; penalty,
+// if not nil, moves participants back, e.g. by how often they did not show up.
+func Next(participants []*db.Participant, penalty func(p *db.Participant) int) *db.Participant {
+	var waitlist []*db.Participant
+	for _, p := range participants {
+		if p.Status == db.StatusWaitlisted {
+			waitlist = append(waitlist, p)
+		}
+	}
+	if len(waitlist) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(waitlist, func(i, j int) bool {
+		if penalty != nil {
+			if pi, pj := penalty(waitlist[i]), penalty(waitlist[j]); pi != pj {
+				return pi < pj
+			}
+		}
+		return waitlist[i].AppliedAt < waitlist[j].AppliedAt
+	})
+	return waitlist[0]
+}
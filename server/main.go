@@ -5,20 +5,98 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/shinyamizuno1008/hashbill/server/attendance"
+	"github.com/shinyamizuno1008/hashbill/server/backup"
 	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/series"
 )
 
 func main() {
+	if err := db.Open(); err != nil {
+		log.Fatal(err)
+	}
+
 	r := mux.NewRouter()
 
 	r.Methods("GET").Path("/user/{userID}").Handler(appHandler(getUserHandler))
 	r.Methods("GET").Path("/userlist").Handler(appHandler(getAllUserHandler))
+	r.Methods("GET").Path("/event").Handler(appHandler(getEventHandler))
 	r.Methods("GET").Path("/event/list").Handler(appHandler(getEventsHandler))
+	r.Methods("GET").Path("/event/search").Handler(appHandler(searchEventsHandler))
 	r.Methods("POST").Path("/event/register").Handler(appHandler(registerEventHandler))
+	r.Methods("POST").Path("/event/delete").Handler(appHandler(deleteEventHandler))
+	r.Methods("POST").Path("/event/cancellation").Handler(appHandler(cancelEventHandler))
+	r.Methods("POST").Path("/event/update").Handler(appHandler(updateEventHandler))
+	r.Methods("GET").Path("/event/revisions").Handler(appHandler(listRevisionsHandler))
+	r.Methods("GET").Path("/event/ics").Handler(appHandler(eventICSHandler))
+	r.Methods("GET").Path("/calendar/{userID}/{key}").Handler(appHandler(userFeedHandler))
 	r.Methods("POST").Path("/signup").Handler(appHandler(signupHandler))
+	r.Methods("POST").Path("/event/join").Handler(appHandler(joinEventHandler))
+	r.Methods("GET").Path("/event/organizers").Handler(appHandler(listOrganizersHandler))
+	r.Methods("POST").Path("/event/organizer").Handler(appHandler(setOrganizerHandler))
+	r.Methods("POST").Path("/event/organizer/delete").Handler(appHandler(deleteOrganizerHandler))
+	r.Methods("GET").Path("/event/organizing").Handler(appHandler(organizingHandler))
+	r.Methods("POST").Path("/event/visibility").Handler(appHandler(setVisibilityHandler))
+	r.Methods("GET").Path("/event/invitations").Handler(appHandler(listInvitationsHandler))
+	r.Methods("POST").Path("/event/invitation").Handler(appHandler(createInvitationHandler))
+	r.Methods("POST").Path("/event/invitation/delete").Handler(appHandler(deleteInvitationHandler))
+	r.Methods("GET").Path("/invitation/{code}").Handler(appHandler(showInvitationHandler))
+	r.Methods("POST").Path("/invitation/redeem").Handler(appHandler(redeemInvitationHandler))
+	r.Methods("GET").Path("/event/tiers").Handler(appHandler(listTiersHandler))
+	r.Methods("POST").Path("/event/tier").Handler(appHandler(setTierHandler))
+	r.Methods("POST").Path("/event/tier/delete").Handler(appHandler(deleteTierHandler))
+	r.Methods("GET").Path("/event/questions").Handler(appHandler(listQuestionsHandler))
+	r.Methods("POST").Path("/event/questions").Handler(appHandler(setQuestionsHandler))
+	r.Methods("GET").Path("/event/feedback").Handler(appHandler(feedbackResultsHandler))
+	r.Methods("POST").Path("/event/feedback").Handler(appHandler(submitFeedbackHandler))
+	r.Methods("POST").Path("/event/view").Handler(appHandler(viewEventsHandler))
+	r.Methods("GET").Path("/event/analytics").Handler(appHandler(eventAnalyticsHandler))
+	r.Methods("GET").Path("/analytics").Handler(appHandler(hostAnalyticsHandler))
+	r.Methods("GET").Path("/series/list").Handler(appHandler(listSeriesHandler))
+	r.Methods("POST").Path("/series/register").Handler(appHandler(registerSeriesHandler))
+	r.Methods("POST").Path("/series/edit").Handler(appHandler(editOccurrenceHandler))
+	r.Methods("POST").Path("/series/delete").Handler(appHandler(deleteSeriesHandler))
+	r.Methods("GET").Path("/ticket/{hostID}/{eventName}/{userID}").Handler(appHandler(getTicketHandler))
+	r.Methods("POST").Path("/event/checkin").Handler(appHandler(checkInHandler))
+	r.Methods("POST").Path("/event/cancel").Handler(appHandler(cancelParticipationHandler))
+	r.Methods("POST").Path("/event/lottery").Handler(appHandler(drawLotteryHandler))
+	r.Methods("GET").Path("/event/expenses").Handler(appHandler(listExpensesHandler))
+	r.Methods("POST").Path("/event/expense").Handler(appHandler(addExpenseHandler))
+	r.Methods("POST").Path("/event/expense/delete").Handler(appHandler(deleteExpenseHandler))
+	r.Methods("POST").Path("/event/split").Handler(appHandler(splitSettingsHandler))
+	r.Methods("GET").Path("/event/bill").Handler(appHandler(getBillHandler))
+	r.Methods("POST").Path("/event/payment").Handler(appHandler(setPaymentHandler))
+	r.Methods("GET").Path("/event/ledger").Handler(appHandler(getLedgerHandler))
+	r.Methods("GET").Path("/event/export").Handler(appHandler(exportLinkHandler))
+	r.Methods("GET").Path("/event/participants.csv").Handler(appHandler(exportParticipantsHandler))
+	r.Methods("POST").Path("/import").Handler(appHandler(importHandler))
+	r.Methods("GET").Path("/admin/audit").Handler(appHandler(auditLogHandler))
+	r.Methods("POST").Path("/group/join").Handler(appHandler(joinGroupHandler))
+	r.Methods("POST").Path("/group/leave").Handler(appHandler(leaveGroupHandler))
+	r.Methods("POST").Path("/payment/charge").Handler(appHandler(chargeHandler))
+	r.Methods("GET", "POST").Path("/payment/callback").Handler(appHandler(paymentCallbackHandler))
+	r.Methods("GET").Path("/payment/cancelled").Handler(appHandler(paymentCancelledHandler))
+	r.Methods("POST").Path("/payment/refund").Handler(appHandler(refundHandler))
+
+	configureTickets(r)
+	configurePayments(r)
+	configureGeocoder()
+	seedDatabase()
+
+	// Record who attended events that are over.
+	go attendance.Run(db.Audited(db.DB, "system:attendance", ""), 10*time.Minute)
+
+	// Give seats that were not paid for in time to the waitlist.
+	go runHoldExpiry(db.Audited(db.DB, "system:payment", ""), 10*time.Minute)
+
+	// Generate upcoming occurrences of recurring events.
+	go series.Run(db.Audited(db.DB, "system:series", ""), time.Hour)
+
 	// r.PathPrefix("/").Handler(http.FileServer(http.Dir("../client/dist")))
 	http.Handle("/", r)
 	log.Fatal(http.ListenAndServe(":8000", r))
@@ -29,7 +107,7 @@ func signupHandler(w http.ResponseWriter, r *http.Request) *appError {
 	userID := r.FormValue("userID")
 	userName := r.FormValue("userName")
 
-	if err := db.DB.AddUser(&db.User{
+	if err := audited(r).AddUser(&db.User{
 		UserID:   userID,
 		UserName: userName,
 	}); err != nil {
@@ -45,7 +123,7 @@ func registerEventHandler(w http.ResponseWriter, r *http.Request) *appError {
 		return appErrorf(err, "%v", err)
 	}
 
-	if err := db.DB.AddEvent(event); err != nil {
+	if err := audited(r).AddEvent(event); err != nil {
 		return appErrorf(err, "could not add event: %v", err)
 	}
 	return nil
@@ -70,7 +148,7 @@ func addUserRequest(w http.ResponseWriter, r *http.Request) *appError {
 		UserName: r.FormValue("userName"),
 	}
 
-	err := db.DB.AddUser(user)
+	err := audited(r).AddUser(user)
 	if err != nil {
 		return appErrorf(err, "could not add user: %v", err)
 	}
@@ -88,6 +166,18 @@ func eventFromForm(r *http.Request) (*db.Event, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not parse lottery max: %v", err)
 	}
+	var deprioritizeNoShows bool
+	if v := r.FormValue("deprioritizeNoShows"); v != "" {
+		if deprioritizeNoShows, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("could not parse deprioritize no-shows: %v", err)
+		}
+	}
+	var fee int64
+	if v := r.FormValue("fee"); v != "" {
+		if fee, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("could not parse fee: %v", err)
+		}
+	}
 
 	event := &db.Event{
 		HostID:      r.FormValue("hostID"),
@@ -98,83 +188,240 @@ func eventFromForm(r *http.Request) (*db.Event, error) {
 		MembersMax:  membersMax,
 		Lottery:     lottery,
 		Description: r.FormValue("description"),
+		GroupID:     r.FormValue("groupID"),
+		Visibility:  r.FormValue("visibility"),
+
+		DeprioritizeNoShows: deprioritizeNoShows,
+		Fee:                 fee,
+		Currency:            r.FormValue("currency"),
+	}
+	switch event.Visibility {
+	case "":
+		event.Visibility = db.VisibilityPublic
+	case db.VisibilityPublic, db.VisibilityUnlisted, db.VisibilityPrivate:
+	default:
+		return nil, fmt.Errorf("invalid visibility %q", event.Visibility)
+	}
+	if err := locateEvent(event, r); err != nil {
+		return nil, err
 	}
 
 	return event, nil
 }
 
-// updateEventHandler updates the details of a given event.
-func updateEventHanlder(w http.ResponseWriter, r *http.Request) *appError {
-	hostID := mux.Vars(r)["hostID"]
-	eventName := mux.Vars(r)["eventName"]
-
-	event, err := eventFromForm(r)
+// deleteHandler deletes a given event. Calendars showing it are told it was
+// cancelled. Only its owner may delete it.
+func deleteEventHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
 	if err != nil {
-		return appErrorf(err, "could not parse event from form: %v", err)
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permOwn); aerr != nil {
+		return aerr
 	}
 
-	event.HostID = hostID
-	event.EventName = eventName
-
-	err = db.DB.UpdateEvent(event)
+	// Organizers of the event must not organize a new event of the same
+	// name.
+	organizers, err := db.DB.ListOrganizers(event.HostID, event.EventName)
 	if err != nil {
-		return appErrorf(err, "could not save event: %v", err)
+		return appErrorf(err, "could not get organizers from database: %v", err)
+	}
+	for _, o := range organizers {
+		if err := db.DB.DeleteOrganizer(o.HostID, o.EventName, o.UserID); err != nil {
+			return appErrorf(err, "could not delete organizer: %v", err)
+		}
 	}
-	http.Redirect(w, r, fmt.Sprintf("/events/%s", event.HostID+eventName), http.StatusFound)
-	return nil
-}
-
-// deleteHandler deletes a given event.
-func deleteEventHandler(w http.ResponseWriter, r *http.Request) *appError {
-	hostID := mux.Vars(r)["hostID"]
-	eventName := mux.Vars(r)["eventName"]
 
-	err := db.DB.DeleteEvent(hostID, eventName)
+	err = audited(r).DeleteEvent(event.HostID, event.EventName)
 	if err != nil {
-		return appErrorf(err, "could not save event: %v", err)
+		return appErrorf(err, "could not delete event: %v", err).withCode(http.StatusNotFound)
 	}
-	http.Redirect(w, r, "/events", http.StatusFound)
 	return nil
 }
 
-// getUserHanlder show user.
+type userResponse struct {
+	db.User
+	Stats attendance.Stats `json:"stats"`
+}
+
+// getUserHanlder show user and how reliably they attend events.
 func getUserHandler(w http.ResponseWriter, r *http.Request) *appError {
 	userID := mux.Vars(r)["userID"]
 	user, err := db.DB.GetUser(userID)
 	if err != nil {
 		return appErrorf(err, "could not get user from database: %v", err)
 	}
+	stats, err := attendance.UserStats(db.DB, userID)
+	if err != nil {
+		return appErrorf(err, "could not get attendance of user: %v", err)
+	}
 
-	userJSON, err := json.Marshal(*user)
+	userJSON, err := json.Marshal(userResponse{User: *user, Stats: stats})
 	w.Write(userJSON)
 	return nil
 }
 
-//getAllUserHandler show all users.
+// getAllUserHandler show users ordered by name, a page at a time.
 func getAllUserHandler(w http.ResponseWriter, r *http.Request) *appError {
-	users, err := db.DB.ListUsers()
+	limit, err := pageLimit(r)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	page, err := db.DB.QueryUsers(&db.UserQuery{
+		Name:   r.FormValue("name"),
+		Limit:  limit,
+		Cursor: r.FormValue("cursor"),
+	})
+	if err == db.ErrInvalidCursor {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
 	if err != nil {
 		return appErrorf(err, "could not get users from database: %v", err)
 	}
 
+	users := page.Users
+	if users == nil {
+		users = []*db.User{}
+	}
 	usersJSON, err := json.Marshal(users)
+	if err != nil {
+		return appErrorf(err, "could not encode users: %v", err)
+	}
+	w.Header().Set(nextCursorHeader, page.NextCursor)
 	w.Write(usersJSON)
 	return nil
 }
 
-// getEventsHandler show all registered evetns.
+// getEventHandler shows an event by its host and name, whether or not it was
+// cancelled. Private events are only shown to the user in "viewer" if they
+// may see them.
+func getEventHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil || !canView(event, viewerFromForm(r)) {
+		return appErrorf(err, "could not find event %s", r.FormValue("eventName")).withCode(http.StatusNotFound)
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return appErrorf(err, "could not encode event: %v", err)
+	}
+	w.Write(eventJSON)
+	return nil
+}
+
+// getEventsHandler show registered events, a page at a time. Events can be
+// filtered by host, LINE group, date range, location, distance, whether they are open and
+// whether they have seats left, and sorted by date, deadline, creation or
+// distance. Besides public events, the unlisted and private events the user
+// in "viewer" may see are listed. Cancelled events are only listed with
+// "includeCancelled".
 func getEventsHandler(w http.ResponseWriter, r *http.Request) *appError {
-	fmt.Println("hello from event handler")
-	events, err := db.DB.ListEvents()
+	q, err := eventQueryFromForm(r)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	return writeEventPage(w, q)
+}
+
+// searchEventsHandler searches the name, description and location of events
+// for the keywords in "q", best matches first. It takes the same filters as
+// getEventsHandler.
+func searchEventsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	q, err := eventQueryFromForm(r)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	if q.Keywords == "" {
+		return appErrorf(nil, "q is required").withCode(http.StatusBadRequest)
+	}
+	if q.Sort == "" {
+		q.Sort = db.SortRelevance
+	}
+	return writeEventPage(w, q)
+}
+
+// eventQueryFromForm reads the filters, order and page of a list of events
+// from form values.
+func eventQueryFromForm(r *http.Request) (*db.EventQuery, error) {
+	limit, err := pageLimit(r)
+	if err != nil {
+		return nil, err
+	}
+	hasCapacity, _ := strconv.ParseBool(r.FormValue("hasCapacity"))
+	includeCancelled, _ := strconv.ParseBool(r.FormValue("includeCancelled"))
+	near, radius, err := nearFromForm(r)
+	if err != nil {
+		return nil, err
+	}
+	return &db.EventQuery{
+		Viewer:      viewerFromForm(r),
+		HostID:      r.FormValue("host"),
+		GroupID:     r.FormValue("group"),
+		From:        r.FormValue("from"),
+		To:          r.FormValue("to"),
+		Location:    r.FormValue("location"),
+		Status:      r.FormValue("status"),
+		Now:         time.Now(),
+		HasCapacity: hasCapacity,
+		Keywords:    r.FormValue("q"),
+		Near:        near,
+		Radius:      radius,
+		Sort:        r.FormValue("sort"),
+		Limit:       limit,
+		Cursor:      r.FormValue("cursor"),
+
+		IncludeCancelled: includeCancelled,
+	}, nil
+}
+
+// writeEventPage writes the page of events a query selects.
+func writeEventPage(w http.ResponseWriter, q *db.EventQuery) *appError {
+	if err := q.Validate(); err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	page, err := db.DB.QueryEvents(q)
+	if err == db.ErrInvalidCursor {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
 	if err != nil {
 		return appErrorf(err, "could not get events from database: %v", err)
 	}
 
+	events := page.Events
+	if events == nil {
+		events = []*db.Event{}
+	}
 	eventsJSON, err := json.Marshal(events)
+	if err != nil {
+		return appErrorf(err, "could not encode events: %v", err)
+	}
+	w.Header().Set(nextCursorHeader, page.NextCursor)
 	w.Write(eventsJSON)
 	return nil
 }
 
+// nextCursorHeader carries the cursor of the next page of a list, which is
+// empty on the last page. Lists stay JSON arrays for older clients.
+const nextCursorHeader = "X-Next-Cursor"
+
+// Sizes of the pages of lists.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 500
+)
+
+// pageLimit returns the page size requested with the "limit" parameter.
+func pageLimit(r *http.Request) (int, error) {
+	v := r.FormValue("limit")
+	if v == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	return limit, nil
+}
+
 // http://blog.golang.org/error-handling-and-go
 type appHandler func(http.ResponseWriter, *http.Request) *appError
 
@@ -185,6 +432,7 @@ type appError struct {
 }
 
 func (fn appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	withRequestID(w, r)
 	if e := fn(w, r); e != nil { // e is *appError, not os.Error.
 		log.Printf("Handler error: status code: %d, message: %s, underlying err: %#v",
 			e.Code, e.Message, e.Error)
@@ -200,3 +448,28 @@ func appErrorf(err error, format string, v ...interface{}) *appError {
 		Code:    500,
 	}
 }
+
+// withCode sets the HTTP status code the error is reported with.
+func (e *appError) withCode(code int) *appError {
+	e.Code = code
+	return e
+}
+
+// seedDatabase restores the backup archive named by HASHBILL_SEED, if any,
+// e.g. to start a server with an in-memory database on a copy of production.
+func seedDatabase() {
+	path := os.Getenv("HASHBILL_SEED")
+	if path == "" {
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("could not open seed: %v", err)
+	}
+	defer f.Close()
+	_, counts, err := backup.Restore(f, db.Audited(db.DB, "system:seed", ""))
+	if err != nil {
+		log.Fatalf("could not restore seed: %v", err)
+	}
+	log.Printf("restored seed %s: %v", path, counts)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// permission is what a user needs to be allowed to do with an event. Each
+// role has the permissions of the roles below it.
+type permission int
+
+const (
+	permNone permission = iota
+
+	// permCheckIn lets staff check participants in.
+	permCheckIn
+
+	// permManage lets co-hosts change the event and its tiers, draw its
+	// lottery, handle its payments, see its ledger and export its
+	// participants.
+	permManage
+
+	// permOwn lets the host delete the event and add or remove co-hosts.
+	permOwn
+)
+
+// rolePermissions maps each role to the highest permission it has.
+var rolePermissions = map[string]permission{
+	db.RoleStaff:  permCheckIn,
+	db.RoleCoHost: permManage,
+	db.RoleOwner:  permOwn,
+}
+
+// permissionRoles names the least role having each permission, for errors.
+var permissionRoles = map[permission]string{
+	permCheckIn: "staff",
+	permManage:  "a co-host",
+	permOwn:     "the owner",
+}
+
+// authenticated tells whether a request comes from a trusted client, such as
+// the LINE bot, which sends the CLIENT_TOKEN as a bearer token. Only trusted
+// clients may say which user they act for; without CLIENT_TOKEN none are.
+func authenticated(r *http.Request) bool {
+	token := os.Getenv("CLIENT_TOKEN")
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// actorFromForm returns the ID of the user an authenticated request acts
+// for, given by "actorID", or an empty string if the request is not
+// authenticated or names nobody.
+func actorFromForm(r *http.Request) string {
+	if !authenticated(r) {
+		return ""
+	}
+	return r.FormValue("actorID")
+}
+
+// unauthenticatedError is returned for requests that have to act for a user
+// but do not authenticate one.
+func unauthenticatedError() *appError {
+	return appErrorf(nil, "the request must be authenticated and name the user it acts for in actorID").withCode(http.StatusUnauthorized)
+}
+
+// roleOf returns the role of a user in an event, or an empty string if they
+// do not organize it.
+func roleOf(event *db.Event, userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if userID == event.HostID {
+		return db.RoleOwner
+	}
+	organizer, err := db.DB.GetOrganizer(event.HostID, event.EventName, userID)
+	if err != nil {
+		return ""
+	}
+	return organizer.Role
+}
+
+// authorize checks that the user a request acts for has a permission on an
+// event, and returns their ID.
+func authorize(r *http.Request, event *db.Event, need permission) (string, *appError) {
+	actorID := actorFromForm(r)
+	if actorID == "" {
+		return "", unauthenticatedError()
+	}
+	if rolePermissions[roleOf(event, actorID)] < need {
+		return "", appErrorf(nil, "user %s must be %s of event %s", actorID, permissionRoles[need], event.EventName).withCode(http.StatusForbidden)
+	}
+	return actorID, nil
+}
+
+// authorizeHost checks that the user a request acts for is a given host, who
+// owns everything they host.
+func authorizeHost(r *http.Request, hostID string) *appError {
+	actorID := actorFromForm(r)
+	if actorID == "" {
+		return unauthenticatedError()
+	}
+	if actorID != hostID {
+		return appErrorf(nil, "user %s must be %s", actorID, permissionRoles[permOwn]).withCode(http.StatusForbidden)
+	}
+	return nil
+}
+
+type organizerResponse struct {
+	UserID   string `json:"userID"`
+	UserName string `json:"userName"`
+	Role     string `json:"role"`
+	AddedBy  string `json:"addedBy,omitempty"`
+	AddedAt  string `json:"addedAt,omitempty"`
+}
+
+// listOrganizersHandler shows the organizers of an event, its host first.
+// Organizers of private events are only shown to the user in "viewer" if
+// they may see the event.
+func listOrganizersHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil || !canView(event, viewerFromForm(r)) {
+		return appErrorf(err, "could not find event %s", r.FormValue("eventName")).withCode(http.StatusNotFound)
+	}
+	organizers, err := db.DB.ListOrganizers(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get organizers from database: %v", err)
+	}
+
+	res := []*organizerResponse{{UserID: event.HostID, Role: db.RoleOwner}}
+	for _, o := range organizers {
+		res = append(res, &organizerResponse{UserID: o.UserID, Role: o.Role, AddedBy: o.AddedBy, AddedAt: o.AddedAt})
+	}
+	for _, o := range res {
+		if user, err := db.DB.GetUser(o.UserID); err == nil {
+			o.UserName = user.UserName
+		}
+	}
+
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode organizers: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// setOrganizerHandler makes a user a co-host or staff of an event, or
+// changes their role. Only the owner may add co-hosts, and co-hosts may add
+// staff.
+func setOrganizerHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+
+	role := r.FormValue("role")
+	need := permManage
+	switch role {
+	case db.RoleCoHost:
+		need = permOwn
+	case db.RoleStaff:
+	default:
+		return appErrorf(nil, "invalid role %q", role).withCode(http.StatusBadRequest)
+	}
+	userID := r.FormValue("userID")
+	if current := roleOf(event, userID); current == db.RoleOwner {
+		return appErrorf(nil, "user %s owns event %s", userID, event.EventName).withCode(http.StatusBadRequest)
+	} else if current == db.RoleCoHost {
+		// Demoting a co-host takes as much as removing them.
+		need = permOwn
+	}
+	actorID, aerr := authorize(r, event, need)
+	if aerr != nil {
+		return aerr
+	}
+	if _, err := db.DB.GetUser(userID); err != nil {
+		return appErrorf(err, "could not find user: %v", err).withCode(http.StatusNotFound)
+	}
+
+	organizer := &db.Organizer{
+		HostID:    event.HostID,
+		EventName: event.EventName,
+		UserID:    userID,
+		Role:      role,
+		AddedBy:   actorID,
+		AddedAt:   time.Now().In(db.Timezone).Format(db.TimeLayout),
+	}
+	if err := db.DB.SetOrganizer(organizer); err != nil {
+		return appErrorf(err, "could not save organizer: %v", err)
+	}
+
+	organizerJSON, err := json.Marshal(organizer)
+	if err != nil {
+		return appErrorf(err, "could not encode organizer: %v", err)
+	}
+	w.Write(organizerJSON)
+	return nil
+}
+
+// deleteOrganizerHandler removes a co-host or staff from an event. Only the
+// owner may remove co-hosts, and co-hosts may remove staff. Anyone may step
+// down themselves.
+func deleteOrganizerHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+
+	userID := r.FormValue("userID")
+	switch roleOf(event, userID) {
+	case db.RoleOwner:
+		return appErrorf(nil, "user %s owns event %s", userID, event.EventName).withCode(http.StatusBadRequest)
+	case db.RoleCoHost:
+		if actorID := actorFromForm(r); actorID == "" || actorID != userID {
+			if _, aerr := authorize(r, event, permOwn); aerr != nil {
+				return aerr
+			}
+		}
+	case db.RoleStaff:
+		if actorID := actorFromForm(r); actorID == "" || actorID != userID {
+			if _, aerr := authorize(r, event, permManage); aerr != nil {
+				return aerr
+			}
+		}
+	default:
+		return appErrorf(nil, "user %s does not organize event %s", userID, event.EventName).withCode(http.StatusNotFound)
+	}
+
+	if err := db.DB.DeleteOrganizer(event.HostID, event.EventName, userID); err != nil {
+		return appErrorf(err, "could not delete organizer: %v", err)
+	}
+	return nil
+}
+
+type organizedEvent struct {
+	*db.Event
+	Role string `json:"role"`
+}
+
+// organizingHandler shows the events a user hosts or helps to organize, with
+// their role in each.
+func organizingHandler(w http.ResponseWriter, r *http.Request) *appError {
+	userID := r.FormValue("userID")
+	hosted, err := db.DB.ListEventsHostedBy(userID)
+	if err != nil {
+		return appErrorf(err, "could not get events from database: %v", err)
+	}
+	res := []*organizedEvent{}
+	for _, e := range hosted {
+		res = append(res, &organizedEvent{Event: e, Role: db.RoleOwner})
+	}
+
+	organizers, err := db.DB.ListOrganizedBy(userID)
+	if err != nil {
+		return appErrorf(err, "could not get organizers from database: %v", err)
+	}
+	for _, o := range organizers {
+		e, err := db.DB.GetEvent(o.HostID, o.EventName)
+		if err != nil {
+			// The event was deleted.
+			continue
+		}
+		res = append(res, &organizedEvent{Event: e, Role: o.Role})
+	}
+
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode events: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shinyamizuno1008/hashbill/server/attendance"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/lottery"
+)
+
+// joinEventHandler applies a user to an event. The participant gets a seat
+// right away unless the event is decided by lottery or is already full.
+// Users who may not see a private event join it with an invitation code.
+// The answers to the questions of the event are given in "answers".
+func joinEventHandler(w http.ResponseWriter, r *http.Request) *appError {
+	hostID := r.FormValue("hostID")
+	eventName := r.FormValue("eventName")
+	userID := r.FormValue("userID")
+
+	event, err := db.DB.GetEvent(hostID, eventName)
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if event.Cancelled() {
+		return cancelledError(event)
+	}
+	if aerr := admit(r, event, userID); aerr != nil {
+		return aerr
+	}
+	if deadline, err := event.DeadlineTime(); err == nil && time.Now().After(deadline) {
+		return appErrorf(nil, "the deadline of event %s has passed", eventName).withCode(http.StatusBadRequest)
+	}
+
+	tiers, err := db.DB.ListTiers(hostID, eventName)
+	if err != nil {
+		return appErrorf(err, "could not get tiers from database: %v", err)
+	}
+	tier, err := pickTier(tiers, r.FormValue("tier"), time.Now())
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	questions, err := db.DB.ListQuestions(hostID, eventName, db.FormRegistration)
+	if err != nil {
+		return appErrorf(err, "could not get questions from database: %v", err)
+	}
+	answers, err := answersFromForm(r, questions)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+
+	participant := &db.Participant{
+		HostID:        hostID,
+		EventName:     eventName,
+		ParticipantID: userID,
+		AppliedAt:     time.Now().In(db.Timezone).Format(db.TimeLayout),
+		Answers:       answers,
+	}
+	if tier != nil {
+		participant.Tier = tier.TierName
+	}
+
+	// The seats left are counted while seats are allocated, so that users
+	// joining at the same time do not get the same seat. Users who cancelled
+	// may join again.
+	var joined bool
+	err = audited(r).AllocateSeats(hostID, eventName, func(participants []*db.Participant) ([]*db.Participant, error) {
+		for _, p := range participants {
+			if p.ParticipantID == userID && p.Status != db.StatusCancelled {
+				joined = true
+				return nil, nil
+			}
+		}
+		joinStatus(participant, event, tier, participants)
+		return []*db.Participant{participant}, nil
+	})
+	if err != nil {
+		return appErrorf(err, "could not add participant: %v", err)
+	}
+	if joined {
+		return appErrorf(nil, "user %s has already joined event %s", userID, eventName).withCode(http.StatusConflict)
+	}
+
+	participantJSON, err := json.Marshal(participant)
+	if err != nil {
+		return appErrorf(err, "could not encode participant: %v", err)
+	}
+	w.Write(participantJSON)
+	return nil
+}
+
+// joinStatus decides the status of a new participant of an event who applied
+// for a given tier, which is nil if the event has no tiers. When fees are
+// collected through a payment provider, the seat is only held until the
+// participant pays.
+func joinStatus(p *db.Participant, event *db.Event, tier *db.Tier, participants []*db.Participant) {
+	switch {
+	case event.Lottery:
+		p.Status = db.StatusApplied
+	case lottery.SeatsLeft(event, tier, participants) == 0:
+		p.Status = db.StatusWaitlisted
+	default:
+		lottery.Seat(p, event, tier, paymentProvider != nil, time.Now())
+	}
+}
+
+// participantFromRequest retrieves a participant from the database given the
+// host ID, event name and user ID in the URL's path.
+func participantFromRequest(r *http.Request) (*db.Participant, error) {
+	vars := mux.Vars(r)
+	participant, err := db.DB.GetParticipant(&db.Participant{
+		HostID:        vars["hostID"],
+		EventName:     vars["eventName"],
+		ParticipantID: vars["userID"],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not find participant: %v", err)
+	}
+	return participant, nil
+}
+
+// cancelParticipationHandler cancels a user's participation in an event. If
+// they had a seat, it is given to the next participant on the waitlist. Only
+// the participant themself or a co-host may cancel it.
+func cancelParticipationHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	userID := r.FormValue("userID")
+	if actorID := actorFromForm(r); actorID == "" || actorID != userID {
+		if _, aerr := authorize(r, event, permManage); aerr != nil {
+			return aerr
+		}
+	}
+	participant, err := db.DB.GetParticipant(&db.Participant{
+		HostID:        event.HostID,
+		EventName:     event.EventName,
+		ParticipantID: userID,
+	})
+	if err != nil {
+		return appErrorf(err, "could not find participant: %v", err).withCode(http.StatusNotFound)
+	}
+	if participant.Status == db.StatusCancelled {
+		return appErrorf(nil, "participant %s has already cancelled", participant.ParticipantID).withCode(http.StatusConflict)
+	}
+
+	hadSeat := participant.Status == db.StatusConfirmed || participant.Status == db.StatusPendingPayment
+	participant.Status = db.StatusCancelled
+	participant.CancelledAt = time.Now().In(db.Timezone).Format(db.TimeLayout)
+	if err := audited(r).UpdateParticipant(participant); err != nil {
+		return appErrorf(err, "could not cancel participant: %v", err)
+	}
+
+	if hadSeat {
+		if _, err := promoteFromWaitlist(audited(r), participant.HostID, participant.EventName); err != nil {
+			return appErrorf(err, "could not promote from waitlist: %v", err)
+		}
+	}
+	return nil
+}
+
+// promoteFromWaitlist gives a free seat of an event to the next participant
+// on its waitlist and returns them, or nil if nobody is waiting. Only
+// participants whose tier still has a free seat are considered. The seat is
+// given through database, and held until they pay like when joining. Nobody
+// is promoted into a cancelled event.
+func promoteFromWaitlist(database db.EventListDatabase, hostID, eventName string) (*db.Participant, error) {
+	event, err := db.DB.GetEvent(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	if event.Cancelled() {
+		return nil, nil
+	}
+	tiers, err := db.DB.ListTiers(hostID, eventName)
+	if err != nil {
+		return nil, err
+	}
+	var penalty func(*db.Participant) int
+	if event.DeprioritizeNoShows {
+		penalty = noShowPenalty
+	}
+
+	var next *db.Participant
+	err = database.AllocateSeats(hostID, eventName, func(participants []*db.Participant) ([]*db.Participant, error) {
+		var candidates []*db.Participant
+		for _, p := range participants {
+			if p.Status == db.StatusWaitlisted && lottery.SeatsLeft(event, findTier(tiers, p.Tier), participants) != 0 {
+				candidates = append(candidates, p)
+			}
+		}
+		if next = lottery.Next(candidates, penalty); next == nil {
+			return nil, nil
+		}
+		lottery.Seat(next, event, findTier(tiers, next.Tier), paymentProvider != nil, time.Now())
+		return []*db.Participant{next}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// noShowPenalty counts how often a participant did not turn up to events.
+func noShowPenalty(p *db.Participant) int {
+	stats, err := attendance.UserStats(db.DB, p.ParticipantID)
+	if err != nil {
+		return 0
+	}
+	return stats.NoShows + stats.CancelledLate
+}
+
+type lotteryResponse struct {
+	Winners    []*db.Participant `json:"winners"`
+	Waitlisted []*db.Participant `json:"waitlisted"`
+}
+
+// drawLotteryHandler decides which applicants of a lottery event get a seat.
+// Applicants who do not win are put on the waitlist.
+func drawLotteryHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+	if event.Cancelled() {
+		return cancelledError(event)
+	}
+	if !event.Lottery {
+		return appErrorf(nil, "event %s is not decided by lottery", event.EventName).withCode(http.StatusBadRequest)
+	}
+
+	winners, losers, err := lottery.DrawEvent(audited(r), event, rand.New(rand.NewSource(time.Now().UnixNano())), paymentProvider != nil)
+	if err != nil {
+		return appErrorf(err, "could not draw lottery: %v", err)
+	}
+
+	resJSON, err := json.Marshal(lotteryResponse{Winners: winners, Waitlisted: losers})
+	if err != nil {
+		return appErrorf(err, "could not encode lottery result: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
@@ -0,0 +1,168 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Fake is an in-process provider for running the payment flow offline.
+// Charges get sequential IDs and are completed by Simulate, or by visiting
+// their payment URL, which sends a signed webhook to the callback URL the way
+// a real provider would.
+type Fake struct {
+	secret      []byte
+	payURL      string
+	callbackURL string
+	client      *http.Client
+
+	mu      sync.Mutex
+	charges map[string]*Charge
+	next    int
+}
+
+// NewFake creates a fake provider. Its payment pages are served by the Fake
+// itself at payURL, and webhooks are sent to callbackURL.
+func NewFake(secret, payURL, callbackURL string) *Fake {
+	return &Fake{
+		secret:      []byte(secret),
+		payURL:      payURL,
+		callbackURL: callbackURL,
+		client:      http.DefaultClient,
+		charges:     make(map[string]*Charge),
+	}
+}
+
+// Name returns "fake".
+func (f *Fake) Name() string { return "fake" }
+
+// CreateCharge registers a pending charge.
+func (f *Fake) CreateCharge(c *Charge) (*Charge, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	charge := *c
+	charge.ID = fmt.Sprintf("fake-%d", f.next)
+	charge.Status = ChargePending
+	charge.PaymentURL = f.payURL + "?" + url.Values{"chargeID": {charge.ID}}.Encode()
+	f.charges[charge.ID] = &charge
+
+	created := charge
+	return &created, nil
+}
+
+// Simulate completes a pending charge as if the payer approved it, or
+// cancelled it if approve is false, and sends the webhook for it.
+func (f *Fake) Simulate(chargeID string, approve bool) error {
+	f.mu.Lock()
+	charge, ok := f.charges[chargeID]
+	if !ok {
+		f.mu.Unlock()
+		return ErrUnknownCharge
+	}
+	if charge.Status != ChargePending {
+		f.mu.Unlock()
+		return fmt.Errorf("payment: charge %s is %s", chargeID, charge.Status)
+	}
+	charge.Status = ChargeCaptured
+	if !approve {
+		charge.Status = ChargeFailed
+	}
+	form := url.Values{
+		"chargeID":  {charge.ID},
+		"orderID":   {charge.OrderID},
+		"status":    {charge.Status},
+		"signature": {f.sign(charge.ID, charge.OrderID, charge.Status)},
+	}
+	f.mu.Unlock()
+
+	res, err := f.client.PostForm(f.callbackURL, form)
+	if err != nil {
+		return fmt.Errorf("payment: could not send webhook: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("payment: webhook failed with %s: %s", res.Status, body)
+	}
+	return nil
+}
+
+// HandleCallback verifies a webhook sent by Simulate.
+func (f *Fake) HandleCallback(r *http.Request, lookup Lookup) (*Charge, error) {
+	chargeID := r.FormValue("chargeID")
+	orderID := r.FormValue("orderID")
+	status := r.FormValue("status")
+
+	signature, err := hex.DecodeString(r.FormValue("signature"))
+	expected, _ := hex.DecodeString(f.sign(chargeID, orderID, status))
+	if err != nil || !hmac.Equal(signature, expected) {
+		return nil, fmt.Errorf("payment: invalid webhook signature")
+	}
+
+	charge, err := lookup(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if charge.ID != chargeID {
+		return nil, ErrUnknownCharge
+	}
+	charge.Status = status
+	return charge, nil
+}
+
+// HandleCancel verifies a webhook sent by Simulate for a charge the payer
+// cancelled.
+func (f *Fake) HandleCancel(r *http.Request, lookup Lookup) (*Charge, error) {
+	charge, err := f.HandleCallback(r, lookup)
+	if err != nil {
+		return nil, err
+	}
+	if charge.Status != ChargeFailed {
+		return nil, fmt.Errorf("payment: charge %s was not cancelled", charge.ID)
+	}
+	return charge, nil
+}
+
+// Refund marks a captured charge as refunded.
+func (f *Fake) Refund(c *Charge) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	charge, ok := f.charges[c.ID]
+	if !ok {
+		return ErrUnknownCharge
+	}
+	if charge.Status != ChargeCaptured {
+		return fmt.Errorf("payment: cannot refund charge %s that is %s", c.ID, charge.Status)
+	}
+	charge.Status = ChargeRefunded
+	return nil
+}
+
+// ServeHTTP serves the payment page of a charge. Visiting it approves the
+// charge, unless the "cancel" parameter is set.
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	approve := r.FormValue("cancel") == ""
+	if err := f.Simulate(r.FormValue("chargeID"), approve); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if approve {
+		fmt.Fprintln(w, "お支払いが完了しました。（テスト用の決済です）")
+	} else {
+		fmt.Fprintln(w, "お支払いをキャンセルしました。（テスト用の決済です）")
+	}
+}
+
+func (f *Fake) sign(chargeID, orderID, status string) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte(chargeID + "\x00" + orderID + "\x00" + status))
+	return hex.EncodeToString(mac.Sum(nil))
+}
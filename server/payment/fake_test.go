@@ -0,0 +1,94 @@
+package payment
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// callbackServer serves the callback URL of a Fake, handing the charges it
+// verifies to handled.
+func callbackServer(t *testing.T, f **Fake, handled chan<- *Charge) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		charge, err := (*f).HandleCallback(r, func(orderID string) (*Charge, error) {
+			if orderID != "order-1" {
+				return nil, ErrUnknownCharge
+			}
+			return &Charge{ID: "fake-1", OrderID: orderID, Amount: 1000, Currency: "JPY", Status: ChargePending}, nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handled <- charge
+	}))
+}
+
+func TestFakeChargeIsConfirmedByCallback(t *testing.T) {
+	var f *Fake
+	handled := make(chan *Charge, 1)
+	server := callbackServer(t, &f, handled)
+	defer server.Close()
+	f = NewFake("secret", "http://pay.example/", server.URL)
+
+	charge, err := f.CreateCharge(&Charge{OrderID: "order-1", Amount: 1000, Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if charge.Status != ChargePending {
+		t.Fatalf("new charge is %s, want %s", charge.Status, ChargePending)
+	}
+	if err := f.Simulate(charge.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := (<-handled).Status; got != ChargeCaptured {
+		t.Errorf("callback got a %s charge, want %s", got, ChargeCaptured)
+	}
+
+	if err := f.Simulate(charge.ID, true); err == nil {
+		t.Error("completed a charge twice")
+	}
+	if err := f.Refund(charge); err != nil {
+		t.Errorf("could not refund captured charge: %v", err)
+	}
+}
+
+func TestFakeCancelledChargeFails(t *testing.T) {
+	var f *Fake
+	handled := make(chan *Charge, 1)
+	server := callbackServer(t, &f, handled)
+	defer server.Close()
+	f = NewFake("secret", "http://pay.example/", server.URL)
+
+	charge, err := f.CreateCharge(&Charge{OrderID: "order-1", Amount: 1000, Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Simulate(charge.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := (<-handled).Status; got != ChargeFailed {
+		t.Errorf("callback got a %s charge, want %s", got, ChargeFailed)
+	}
+	if err := f.Refund(charge); err == nil {
+		t.Error("refunded a failed charge")
+	}
+}
+
+func TestFakeRejectsForgedCallback(t *testing.T) {
+	var f *Fake
+	handled := make(chan *Charge, 1)
+	server := callbackServer(t, &f, handled)
+	defer server.Close()
+	f = NewFake("secret", "http://pay.example/", server.URL)
+
+	forger := NewFake("other secret", "http://pay.example/", server.URL)
+	charge, err := forger.CreateCharge(&Charge{OrderID: "order-1", Amount: 1000, Currency: "JPY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := forger.Simulate(charge.ID, true); err == nil {
+		t.Error("callback accepted a webhook signed with another secret")
+	}
+}
@@ -0,0 +1,230 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	linePayAPI        = "https://api-pay.line.me"
+	linePaySandboxAPI = "https://sandbox-api-pay.line.me"
+)
+
+// LinePayConfig configures the LINE Pay adapter.
+type LinePayConfig struct {
+	ChannelID     string
+	ChannelSecret string
+
+	// Sandbox sends requests to the LINE Pay sandbox.
+	Sandbox bool
+
+	// ConfirmURL is where LINE Pay sends the payer after they approved the
+	// payment. It must be routed to HandleCallback.
+	ConfirmURL string
+
+	// CancelURL is where LINE Pay sends the payer if they cancel. It must be
+	// routed to HandleCancel.
+	CancelURL string
+}
+
+// LinePay collects charges through the LINE Pay online API (v3).
+type LinePay struct {
+	config  LinePayConfig
+	baseURL string
+	client  *http.Client
+}
+
+// NewLinePay creates a LINE Pay adapter.
+func NewLinePay(config LinePayConfig) *LinePay {
+	baseURL := linePayAPI
+	if config.Sandbox {
+		baseURL = linePaySandboxAPI
+	}
+	return &LinePay{
+		config:  config,
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+// Name returns "linepay".
+func (p *LinePay) Name() string { return "linepay" }
+
+type linePayProduct struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Price    int64  `json:"price"`
+}
+
+type linePayPackage struct {
+	ID       string           `json:"id"`
+	Amount   int64            `json:"amount"`
+	Products []linePayProduct `json:"products"`
+}
+
+type linePayRequest struct {
+	Amount       int64            `json:"amount"`
+	Currency     string           `json:"currency"`
+	OrderID      string           `json:"orderId"`
+	Packages     []linePayPackage `json:"packages"`
+	RedirectURLs struct {
+		ConfirmURL string `json:"confirmUrl"`
+		CancelURL  string `json:"cancelUrl"`
+	} `json:"redirectUrls"`
+}
+
+type linePayResponse struct {
+	ReturnCode    string `json:"returnCode"`
+	ReturnMessage string `json:"returnMessage"`
+	Info          struct {
+		TransactionID json.Number `json:"transactionId"`
+		PaymentURL    struct {
+			Web string `json:"web"`
+			App string `json:"app"`
+		} `json:"paymentUrl"`
+	} `json:"info"`
+}
+
+// CreateCharge requests a payment from LINE Pay.
+func (p *LinePay) CreateCharge(c *Charge) (*Charge, error) {
+	req := linePayRequest{
+		Amount:   c.Amount,
+		Currency: c.Currency,
+		OrderID:  c.OrderID,
+		Packages: []linePayPackage{{
+			ID:       c.OrderID,
+			Amount:   c.Amount,
+			Products: []linePayProduct{{Name: c.Description, Quantity: 1, Price: c.Amount}},
+		}},
+	}
+	req.RedirectURLs.ConfirmURL = p.config.ConfirmURL
+	// LINE Pay does not tell the cancel URL which payment was cancelled, so
+	// the URL names it, signed so that nobody else can cancel it.
+	req.RedirectURLs.CancelURL = p.config.CancelURL + "?" + url.Values{
+		"orderId":   {c.OrderID},
+		"signature": {p.cancelSignature(c.OrderID)},
+	}.Encode()
+
+	var res linePayResponse
+	if err := p.post("/v3/payments/request", req, &res); err != nil {
+		return nil, err
+	}
+
+	charge := *c
+	charge.ID = res.Info.TransactionID.String()
+	charge.PaymentURL = res.Info.PaymentURL.Web
+	charge.Status = ChargePending
+	return &charge, nil
+}
+
+// HandleCallback confirms a payment the payer approved. LINE Pay redirects
+// the payer to the confirm URL with the transaction and order IDs.
+func (p *LinePay) HandleCallback(r *http.Request, lookup Lookup) (*Charge, error) {
+	transactionID := r.FormValue("transactionId")
+	orderID := r.FormValue("orderId")
+
+	charge, err := lookup(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if charge.ID != transactionID {
+		return nil, ErrUnknownCharge
+	}
+
+	body := struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}{charge.Amount, charge.Currency}
+
+	var res linePayResponse
+	if err := p.post("/v3/payments/"+url.PathEscape(transactionID)+"/confirm", body, &res); err != nil {
+		charge.Status = ChargeFailed
+		return charge, err
+	}
+	charge.Status = ChargeCaptured
+	return charge, nil
+}
+
+// HandleCancel verifies the signed order ID LINE Pay sends the payer back
+// with when they cancel.
+func (p *LinePay) HandleCancel(r *http.Request, lookup Lookup) (*Charge, error) {
+	orderID := r.FormValue("orderId")
+	signature, err := hex.DecodeString(r.FormValue("signature"))
+	expected, _ := hex.DecodeString(p.cancelSignature(orderID))
+	if err != nil || !hmac.Equal(signature, expected) {
+		return nil, fmt.Errorf("linepay: invalid cancel signature")
+	}
+
+	charge, err := lookup(orderID)
+	if err != nil {
+		return nil, err
+	}
+	charge.Status = ChargeFailed
+	return charge, nil
+}
+
+// cancelSignature signs the order ID in the cancel URL of a charge.
+func (p *LinePay) cancelSignature(orderID string) string {
+	mac := hmac.New(sha256.New, []byte(p.config.ChannelSecret))
+	mac.Write([]byte("cancel\x00" + orderID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Refund refunds the full amount of a captured charge.
+func (p *LinePay) Refund(c *Charge) error {
+	body := struct {
+		RefundAmount int64 `json:"refundAmount"`
+	}{c.Amount}
+
+	var res linePayResponse
+	return p.post("/v3/payments/"+url.PathEscape(c.ID)+"/refund", body, &res)
+}
+
+// post sends a signed request to the LINE Pay API and decodes the response.
+func (p *LinePay) post(path string, body, res interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("linepay: could not encode request: %v", err)
+	}
+
+	nonce := strconv.FormatInt(time.Now().UnixNano(), 10)
+	mac := hmac.New(sha256.New, []byte(p.config.ChannelSecret))
+	mac.Write([]byte(p.config.ChannelSecret + path + string(payload) + nonce))
+
+	req, err := http.NewRequest("POST", p.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("linepay: could not create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-LINE-ChannelId", p.config.ChannelID)
+	req.Header.Set("X-LINE-Authorization-Nonce", nonce)
+	req.Header.Set("X-LINE-Authorization", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("linepay: could not send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("linepay: could not read response: %v", err)
+	}
+	if err := json.Unmarshal(b, res); err != nil {
+		return fmt.Errorf("linepay: could not decode response: %v", err)
+	}
+	if r, ok := res.(*linePayResponse); ok && r.ReturnCode != "0000" {
+		return fmt.Errorf("linepay: %s: %s", r.ReturnCode, r.ReturnMessage)
+	}
+	return nil
+}
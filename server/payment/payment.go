@@ -0,0 +1,83 @@
+// Package payment collects participation fees through a payment provider.
+package payment
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Charge statuses.
+const (
+	// ChargePending is the status of a charge the payer has not completed.
+	ChargePending = "pending"
+	// ChargeCaptured is the status of a charge whose money was collected.
+	ChargeCaptured = "captured"
+	// ChargeFailed is the status of a charge the payer cancelled or that was declined.
+	ChargeFailed = "failed"
+	// ChargeRefunded is the status of a charge whose money was returned.
+	ChargeRefunded = "refunded"
+)
+
+// ErrUnknownCharge is returned when a callback refers to a charge that was
+// never created.
+var ErrUnknownCharge = errors.New("payment: unknown charge")
+
+// Charge is a request to collect an amount from a participant.
+type Charge struct {
+	// ID is the ID the provider assigned to the charge.
+	ID string `json:"id"`
+
+	// OrderID is our ID of the charge, unique per attempt to pay.
+	OrderID string `json:"orderID"`
+
+	// Description is shown to the payer.
+	Description string `json:"description"`
+
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+
+	// PaymentURL is where the payer completes the payment.
+	PaymentURL string `json:"paymentURL"`
+}
+
+// Lookup returns the charge with a given order ID as it was created, so that
+// a provider can check a callback against it.
+type Lookup func(orderID string) (*Charge, error)
+
+// Provider collects and refunds charges.
+type Provider interface {
+	// Name identifies the provider in payment records.
+	Name() string
+
+	// CreateCharge registers a charge with the provider and returns it with
+	// its ID and payment URL set.
+	CreateCharge(c *Charge) (*Charge, error)
+
+	// HandleCallback verifies a request the provider sent when a payer
+	// completed or cancelled a payment, and returns the charge with its new
+	// status. It finishes the payment with the provider if needed; if that
+	// fails, it returns the charge as failed along with the error.
+	HandleCallback(r *http.Request, lookup Lookup) (*Charge, error)
+
+	// HandleCancel verifies that a request comes from a payer the provider
+	// sent back because they cancelled a payment, and returns the charge as
+	// failed.
+	HandleCancel(r *http.Request, lookup Lookup) (*Charge, error)
+
+	// Refund returns the money of a captured charge to the payer.
+	Refund(c *Charge) error
+}
+
+// NewOrderID returns a new order ID for a participant's fee. Order IDs are
+// derived from the participant and the time so that a participant who
+// abandoned a payment can start a new one.
+func NewOrderID(hostID, eventName, participantID string, now time.Time) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{hostID, eventName, participantID}, "\x00")))
+	return fmt.Sprintf("%x-%s", sum[:10], strconv.FormatInt(now.UnixNano(), 36))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/ledger"
+)
+
+// setPaymentHandler lets the host or a co-host of an event mark the fee of a
+// participant as paid, waived, refunded or due again.
+func setPaymentHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	actorID, aerr := authorize(r, event, permManage)
+	if aerr != nil {
+		return aerr
+	}
+	participant, err := db.DB.GetParticipant(&db.Participant{
+		HostID:        event.HostID,
+		EventName:     event.EventName,
+		ParticipantID: r.FormValue("userID"),
+	})
+	if err != nil {
+		return appErrorf(err, "could not find participant: %v", err).withCode(http.StatusNotFound)
+	}
+
+	status := r.FormValue("status")
+	switch status {
+	case db.PaymentDue, db.PaymentPaid, db.PaymentWaived, db.PaymentRefunded, db.PaymentRefundDue:
+	default:
+		return appErrorf(nil, "unknown payment status %q", status).withCode(http.StatusBadRequest)
+	}
+
+	amount, err := participantFee(event, participant)
+	if err != nil {
+		return appErrorf(err, "could not get fee: %v", err)
+	}
+	if v := r.FormValue("amount"); v != "" {
+		if amount, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return appErrorf(err, "could not parse amount: %v", err).withCode(http.StatusBadRequest)
+		}
+	}
+
+	previous, err := db.DB.GetPayment(event.HostID, event.EventName, participant.ParticipantID)
+	if err != nil {
+		previous = &db.Payment{Status: db.PaymentDue}
+	}
+
+	payment := &db.Payment{
+		HostID:        event.HostID,
+		EventName:     event.EventName,
+		ParticipantID: participant.ParticipantID,
+		Amount:        amount,
+		Currency:      event.Currency,
+		Status:        status,
+		UpdatedAt:     time.Now().In(db.Timezone).Format(db.TimeLayout),
+		UpdatedBy:     actorID,
+	}
+	if err := db.DB.SetPayment(payment); err != nil {
+		return appErrorf(err, "could not save payment: %v", err)
+	}
+	switch {
+	case status == db.PaymentPaid && previous.Status != db.PaymentPaid:
+		recordPayment(payment, db.ActivityPayment, amount)
+	case status != db.PaymentPaid && previous.Status == db.PaymentPaid:
+		// The fee paid no longer counts once marked anything else.
+		recordPayment(payment, db.ActivityRefund, previous.Amount)
+	}
+
+	paymentJSON, err := json.Marshal(payment)
+	if err != nil {
+		return appErrorf(err, "could not encode payment: %v", err)
+	}
+	w.Write(paymentJSON)
+	return nil
+}
+
+// getLedgerHandler shows the payment status of every participant of an
+// event, as JSON or, with format=csv, as a CSV file. Only its host and
+// co-hosts may see it.
+func getLedgerHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+
+	entries, err := ledger.Entries(db.DB, event)
+	if err != nil {
+		return appErrorf(err, "could not get ledger: %v", err)
+	}
+
+	if r.FormValue("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", event.EventName+"-ledger.csv"))
+		if err := ledger.WriteCSV(w, entries); err != nil {
+			return appErrorf(err, "could not write ledger: %v", err)
+		}
+		return nil
+	}
+
+	entriesJSON, err := json.Marshal(entries)
+	if err != nil {
+		return appErrorf(err, "could not encode ledger: %v", err)
+	}
+	w.Write(entriesJSON)
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/geo"
+)
+
+// geocoder locates the free-text locations of events. It is nil when no
+// geocoding is configured, and events are then only located by coordinates
+// sent with them.
+var geocoder geo.Geocoder
+
+// configureGeocoder sets up the geocoder named by GEOCODER: "fixtures" for a
+// fixed table of places read from GEOCODER_FIXTURES, or empty for none.
+func configureGeocoder() {
+	switch name := os.Getenv("GEOCODER"); name {
+	case "":
+	case "fixtures":
+		path := os.Getenv("GEOCODER_FIXTURES")
+		if path == "" {
+			path = "geo/fixtures.json"
+		}
+		fixtures, err := geo.LoadFixtures(path)
+		if err != nil {
+			log.Fatalf("could not load geocoder fixtures: %v", err)
+		}
+		geocoder = fixtures
+	default:
+		log.Fatalf("unknown geocoder %q", name)
+	}
+}
+
+// locateEvent sets the venue and coordinates of an event from the "venue",
+// "latitude" and "longitude" form values, as sent for a LINE location
+// message. Without coordinates, the location of the event is geocoded if
+// possible. Events that cannot be located are still valid.
+func locateEvent(event *db.Event, r *http.Request) error {
+	event.Venue = r.FormValue("venue")
+	point, err := pointFromForm(r, "latitude", "longitude")
+	if err != nil {
+		return err
+	}
+	if point != nil {
+		event.Coordinates = point
+		return nil
+	}
+	if geocoder == nil || event.Location == "" {
+		return nil
+	}
+
+	place, err := geocoder.Geocode(event.Location)
+	if err == geo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		log.Printf("could not geocode %q: %v", event.Location, err)
+		return nil
+	}
+	event.Coordinates = &place.Point
+	if event.Venue == "" {
+		event.Venue = place.Name
+	}
+	return nil
+}
+
+// nearFromForm returns the point and radius in meters to search events
+// around. The point is given by "lat" and "lng", or by an address in "near"
+// which is geocoded. The radius is in meters, or in kilometers with a "km"
+// suffix, e.g. "3km".
+func nearFromForm(r *http.Request) (*geo.Point, float64, error) {
+	point, err := pointFromForm(r, "lat", "lng")
+	if err != nil {
+		return nil, 0, err
+	}
+	if address := r.FormValue("near"); point == nil && address != "" {
+		if geocoder == nil {
+			return nil, 0, fmt.Errorf("no geocoder is configured to locate %q", address)
+		}
+		place, err := geocoder.Geocode(address)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not locate %q: %v", address, err)
+		}
+		point = &place.Point
+	}
+
+	v := r.FormValue("radius")
+	if v == "" {
+		return point, 0, nil
+	}
+	unit := 1.0
+	if strings.HasSuffix(v, "km") {
+		v, unit = strings.TrimSuffix(v, "km"), 1000
+	} else {
+		v = strings.TrimSuffix(v, "m")
+	}
+	radius, err := strconv.ParseFloat(v, 64)
+	if err != nil || radius <= 0 {
+		return nil, 0, fmt.Errorf("invalid radius %q", r.FormValue("radius"))
+	}
+	return point, radius * unit, nil
+}
+
+// pointFromForm returns the point given by latitude and longitude form
+// values, or nil if neither is given.
+func pointFromForm(r *http.Request, latitudeKey, longitudeKey string) (*geo.Point, error) {
+	lat, lng := r.FormValue(latitudeKey), r.FormValue(longitudeKey)
+	if lat == "" && lng == "" {
+		return nil, nil
+	}
+	var (
+		p   geo.Point
+		err error
+	)
+	if p.Latitude, err = strconv.ParseFloat(lat, 64); err != nil {
+		return nil, fmt.Errorf("invalid %s %q", latitudeKey, lat)
+	}
+	if p.Longitude, err = strconv.ParseFloat(lng, 64); err != nil {
+		return nil, fmt.Errorf("invalid %s %q", longitudeKey, lng)
+	}
+	if !p.Valid() {
+		return nil, fmt.Errorf("%s, %s out of range", lat, lng)
+	}
+	return &p, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// maxQuestions is the most questions an event may ask, so that joining stays
+// quick in a chat.
+const maxQuestions = 20
+
+// formFromForm returns the form of questions in "form", which defaults to
+// the registration form.
+func formFromForm(r *http.Request) (string, error) {
+	switch form := r.FormValue("form"); form {
+	case "":
+		return db.FormRegistration, nil
+	case db.FormRegistration, db.FormFeedback:
+		return form, nil
+	default:
+		return "", fmt.Errorf("invalid form %q", form)
+	}
+}
+
+// listQuestionsHandler lists the questions of a form of an event in the order
+// they are asked: those participants answer when they join it, or in the
+// feedback survey after it. The questions of private events are only shown
+// to the user in "viewer" if they may see the event.
+func listQuestionsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil || !canView(event, viewerFromForm(r)) {
+		return appErrorf(err, "could not find event %s", r.FormValue("eventName")).withCode(http.StatusNotFound)
+	}
+	form, err := formFromForm(r)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+	questions, err := db.DB.ListQuestions(event.HostID, event.EventName, form)
+	if err != nil {
+		return appErrorf(err, "could not get questions from database: %v", err)
+	}
+	if questions == nil {
+		questions = []*db.Question{}
+	}
+
+	resJSON, err := json.Marshal(questions)
+	if err != nil {
+		return appErrorf(err, "could not encode questions: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// setQuestionsHandler replaces the questions of a form of an event with the
+// JSON array in "questions", in the order they are to be asked. A question
+// keeps its QuestionID, and the answers to it, if it is given; new questions
+// have none. Only the host and co-hosts of the event may change its
+// questions.
+func setQuestionsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+	form, err := formFromForm(r)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+
+	var questions []*db.Question
+	if err := json.Unmarshal([]byte(r.FormValue("questions")), &questions); err != nil {
+		return appErrorf(err, "could not parse questions: %v", err).withCode(http.StatusBadRequest)
+	}
+	if len(questions) > maxQuestions {
+		return appErrorf(nil, "an event may ask at most %d questions", maxQuestions).withCode(http.StatusBadRequest)
+	}
+	current, err := db.DB.ListQuestions(event.HostID, event.EventName, form)
+	if err != nil {
+		return appErrorf(err, "could not get questions from database: %v", err)
+	}
+	lastID, err := lastQuestionID(event)
+	if err != nil {
+		return appErrorf(err, "could not get questions from database: %v", err)
+	}
+
+	kept := make(map[int64]bool)
+	for _, q := range questions {
+		q.HostID = event.HostID
+		q.EventName = event.EventName
+		q.Form = form
+		q.Label = strings.TrimSpace(q.Label)
+		if err := q.Validate(); err != nil {
+			return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+		}
+		if q.QuestionID == 0 {
+			continue
+		}
+		if findQuestion(current, q.QuestionID) == nil || kept[q.QuestionID] {
+			return appErrorf(nil, "invalid question ID %d", q.QuestionID).withCode(http.StatusBadRequest)
+		}
+		kept[q.QuestionID] = true
+	}
+	for _, q := range questions {
+		if q.QuestionID == 0 {
+			lastID++
+			q.QuestionID = lastID
+		}
+	}
+
+	if err := db.DB.SetQuestions(event.HostID, event.EventName, form, questions); err != nil {
+		return appErrorf(err, "could not save questions: %v", err)
+	}
+	questionsJSON, err := json.Marshal(questions)
+	if err != nil {
+		return appErrorf(err, "could not encode questions: %v", err)
+	}
+	w.Write(questionsJSON)
+	return nil
+}
+
+// lastQuestionID returns the highest ID of the questions of an event. New
+// questions are numbered after every question of any form the event has or
+// had, as participants may still hold answers to removed ones.
+func lastQuestionID(event *db.Event) (int64, error) {
+	var lastID int64
+	see := func(questionID int64) {
+		if questionID > lastID {
+			lastID = questionID
+		}
+	}
+
+	for _, form := range []string{db.FormRegistration, db.FormFeedback} {
+		questions, err := db.DB.ListQuestions(event.HostID, event.EventName, form)
+		if err != nil {
+			return 0, err
+		}
+		for _, q := range questions {
+			see(q.QuestionID)
+		}
+	}
+	err := db.DB.ScanAttendees(event.HostID, event.EventName, func(a *db.Attendee) error {
+		for _, answer := range a.Answers {
+			see(answer.QuestionID)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	feedback, err := db.DB.ListFeedback(event.HostID, event.EventName)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range feedback {
+		for _, answer := range f.Answers {
+			see(answer.QuestionID)
+		}
+	}
+	return lastID, nil
+}
+
+// findQuestion returns the question with a given ID, or nil.
+func findQuestion(questions []*db.Question, questionID int64) *db.Question {
+	for _, q := range questions {
+		if q.QuestionID == questionID {
+			return q
+		}
+	}
+	return nil
+}
+
+// answersFromForm parses the JSON array of answers in "answers" and checks
+// them against the questions of an event. It returns the answers in the
+// order the questions are asked.
+func answersFromForm(r *http.Request, questions []*db.Question) ([]*db.Answer, error) {
+	var given []*db.Answer
+	if v := r.FormValue("answers"); v != "" {
+		if err := json.Unmarshal([]byte(v), &given); err != nil {
+			return nil, fmt.Errorf("could not parse answers: %v", err)
+		}
+	}
+
+	byQuestion := make(map[int64]*db.Answer)
+	for _, a := range given {
+		if findQuestion(questions, a.QuestionID) == nil {
+			return nil, fmt.Errorf("question %d does not exist", a.QuestionID)
+		}
+		if byQuestion[a.QuestionID] != nil {
+			return nil, fmt.Errorf("question %d is answered twice", a.QuestionID)
+		}
+		byQuestion[a.QuestionID] = a
+	}
+
+	var answers []*db.Answer
+	for _, q := range questions {
+		a := byQuestion[q.QuestionID]
+		if err := q.Check(a); err != nil {
+			return nil, err
+		}
+		if a != nil && len(a.Values) > 0 {
+			answers = append(answers, a)
+		}
+	}
+	return answers, nil
+}
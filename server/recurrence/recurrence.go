@@ -0,0 +1,336 @@
+// Package recurrence expands the recurrence rules of event series. Rules are
+// written in a subset of the iCalendar RRULE syntax (RFC 5545):
+//
+//	FREQ=DAILY|WEEKLY|MONTHLY
+//	INTERVAL=n
+//	BYDAY=MO,WE or, with FREQ=MONTHLY, 2SA,-1FR
+//	BYMONTHDAY=1,15,-1
+//	COUNT=n
+//	UNTIL=20061231 or 20061231T150405
+//
+// Weeks start on Monday.
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies of a rule.
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// maxPeriods bounds how far a rule is expanded, so that a rule that never
+// matches, e.g. the 5th Monday of every 12th month, cannot loop forever.
+const maxPeriods = 10000
+
+// WeekdayNum is a day of the week, optionally the Nth one of a month. N is
+// negative to count from the end of the month and zero for every such day.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+
+	// Count limits the number of occurrences. Zero means no limit.
+	Count int
+
+	// Until is the last time an occurrence may start. The zero time means
+	// no limit.
+	Until time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Parse parses a rule. Times in UNTIL are in loc.
+func Parse(rule string, loc *time.Location) (*Rule, error) {
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(rule, "RRULE:"), ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("recurrence: invalid rule part %q", part)
+		}
+		key, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+
+		var err error
+		switch key {
+		case "FREQ":
+			switch value {
+			case FreqDaily, FreqWeekly, FreqMonthly:
+				r.Freq = value
+			default:
+				return nil, fmt.Errorf("recurrence: unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(value); err != nil || r.Interval < 1 {
+				return nil, fmt.Errorf("recurrence: invalid interval %q", value)
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(value); err != nil || r.Count < 1 {
+				return nil, fmt.Errorf("recurrence: invalid count %q", value)
+			}
+		case "UNTIL":
+			if r.Until, err = parseUntil(value, loc); err != nil {
+				return nil, err
+			}
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := parseWeekdayNum(v)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("recurrence: invalid month day %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		default:
+			return nil, fmt.Errorf("recurrence: unsupported rule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("recurrence: FREQ is required")
+	}
+	if r.Freq != FreqMonthly {
+		if len(r.ByMonthDay) > 0 {
+			return nil, fmt.Errorf("recurrence: BYMONTHDAY requires FREQ=MONTHLY")
+		}
+		for _, d := range r.ByDay {
+			if d.N != 0 {
+				return nil, fmt.Errorf("recurrence: numbered BYDAY requires FREQ=MONTHLY")
+			}
+		}
+	}
+	return r, nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		// A date includes the whole day.
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("recurrence: invalid until %q", value)
+}
+
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	if len(value) < 2 {
+		return WeekdayNum{}, fmt.Errorf("recurrence: invalid day %q", value)
+	}
+	day, ok := weekdays[value[len(value)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("recurrence: invalid day %q", value)
+	}
+	n := 0
+	if prefix := value[:len(value)-2]; prefix != "" {
+		var err error
+		if n, err = strconv.Atoi(prefix); err != nil || n == 0 || n < -5 || n > 5 {
+			return WeekdayNum{}, fmt.Errorf("recurrence: invalid day %q", value)
+		}
+	}
+	return WeekdayNum{N: n, Day: day}, nil
+}
+
+// String formats a rule in RRULE syntax.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		var days []string
+		for _, d := range r.ByDay {
+			days = append(days, d.String())
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		var days []string
+		for _, d := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(d))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102T150405"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// String formats a day in RRULE syntax, e.g. "2SA".
+func (d WeekdayNum) String() string {
+	name := strings.ToUpper(d.Day.String()[:2])
+	if d.N == 0 {
+		return name
+	}
+	return strconv.Itoa(d.N) + name
+}
+
+// Weekly returns a rule repeating every week on the given days.
+func Weekly(days ...time.Weekday) string {
+	r := &Rule{Freq: FreqWeekly, Interval: 1}
+	for _, d := range days {
+		r.ByDay = append(r.ByDay, WeekdayNum{Day: d})
+	}
+	return r.String()
+}
+
+// MonthlyByWeekday returns a rule repeating every month on its nth weekday,
+// e.g. the 2nd Saturday. n is -1 for the last one.
+func MonthlyByWeekday(n int, day time.Weekday) string {
+	r := &Rule{Freq: FreqMonthly, Interval: 1, ByDay: []WeekdayNum{{N: n, Day: day}}}
+	return r.String()
+}
+
+// Between returns the start times of the occurrences of a series starting at
+// start that fall within [from, to). The first occurrence is start itself,
+// whether or not it matches the rule, and every occurrence has the time of
+// day of start.
+func (r *Rule) Between(start, from, to time.Time) []time.Time {
+	var times []time.Time
+	n := 0
+	emit := func(t time.Time) bool {
+		if r.Count > 0 && n >= r.Count {
+			return false
+		}
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		if !t.Before(to) {
+			return false
+		}
+		n++
+		if !t.Before(from) {
+			times = append(times, t)
+		}
+		return true
+	}
+
+	if !emit(start) {
+		return times
+	}
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.period(start, period) {
+			if !t.After(start) {
+				continue
+			}
+			if !emit(t) {
+				return times
+			}
+		}
+	}
+	return times
+}
+
+// period returns the candidate occurrences of the period-th period of a
+// series, in order.
+func (r *Rule) period(start time.Time, period int) []time.Time {
+	y, m, d := start.Date()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+
+	var times []time.Time
+	switch r.Freq {
+	case FreqDaily:
+		times = append(times, at(y, m, d+period*r.Interval))
+	case FreqWeekly:
+		monday := d - (int(start.Weekday())+6)%7 + 7*period*r.Interval
+		if len(r.ByDay) == 0 {
+			times = append(times, at(y, m, d+7*period*r.Interval))
+		}
+		for _, wd := range r.ByDay {
+			times = append(times, at(y, m, monday+(int(wd.Day)+6)%7))
+		}
+	case FreqMonthly:
+		first := time.Date(y, m+time.Month(period*r.Interval), 1, 0, 0, 0, 0, start.Location())
+		year, month := first.Year(), first.Month()
+		days := daysIn(year, month)
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 && d <= days {
+			times = append(times, at(year, month, d))
+		}
+		for _, md := range r.ByMonthDay {
+			if md < 0 {
+				md = days + md + 1
+			}
+			if md >= 1 && md <= days {
+				times = append(times, at(year, month, md))
+			}
+		}
+		for _, wd := range r.ByDay {
+			for _, day := range weekdaysOf(year, month, wd, start.Location()) {
+				times = append(times, at(year, month, day))
+			}
+		}
+	}
+
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return dedupe(times)
+}
+
+// weekdaysOf returns the days of a month matching a weekday.
+func weekdaysOf(year int, month time.Month, wd WeekdayNum, loc *time.Location) []int {
+	var days []int
+	for day := 1; day <= daysIn(year, month); day++ {
+		if time.Date(year, month, day, 0, 0, 0, 0, loc).Weekday() == wd.Day {
+			days = append(days, day)
+		}
+	}
+	switch {
+	case wd.N > 0 && wd.N <= len(days):
+		return days[wd.N-1 : wd.N]
+	case wd.N < 0 && -wd.N <= len(days):
+		return days[len(days)+wd.N : len(days)+wd.N+1]
+	case wd.N == 0:
+		return days
+	}
+	return nil
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func dedupe(times []time.Time) []time.Time {
+	var out []time.Time
+	for i, t := range times {
+		if i == 0 || !t.Equal(times[i-1]) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
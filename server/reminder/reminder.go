@@ -0,0 +1,461 @@
+// Package reminder scans registered events and pushes reminders about them to
+// hosts and participants, and announcements about them to their LINE groups.
+package reminder
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/attendance"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/ledger"
+	"github.com/shinyamizuno1008/hashbill/server/lottery"
+)
+
+// Clock tells the scheduler what time it is.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is a Clock backed by time.Now.
+var SystemClock Clock = systemClock{}
+
+// Pusher delivers a text message to a LINE user, group or room.
+type Pusher interface {
+	Push(to, text string) error
+}
+
+// Kind identifies a type of reminder.
+type Kind string
+
+const (
+	// DeadlineApproaching tells the host that applications close soon.
+	DeadlineApproaching Kind = "deadline_approaching"
+	// DeadlinePassed tells the host that applications closed and how many applied.
+	DeadlinePassed Kind = "deadline_passed"
+	// EventTomorrow tells participants that the event is held tomorrow.
+	EventTomorrow Kind = "event_tomorrow"
+	// EventSoon tells participants that the event starts soon.
+	EventSoon Kind = "event_soon"
+	// FeeUnpaid tells participants who have not paid the fee yet to pay it.
+	FeeUnpaid Kind = "fee_unpaid"
+	// FeedbackRequest asks participants who checked in to respond to the
+	// survey of the event once it is over.
+	FeedbackRequest Kind = "feedback_request"
+
+	// EventAnnounced tells the group of an event that it was created.
+	EventAnnounced Kind = "event_announced"
+	// EventFull tells the group of an event that it has no seats left.
+	EventFull Kind = "event_full"
+
+	// EventChanged tells participants what changed in an edit of an event.
+	// It is delivered once per version of the event.
+	EventChanged Kind = "event_changed"
+	// EventCancelled tells participants that an event was cancelled.
+	EventCancelled Kind = "event_cancelled"
+)
+
+// Anchor is the point in time of an event a rule is relative to.
+type Anchor int
+
+const (
+	// Deadline anchors a rule to the application deadline.
+	Deadline Anchor = iota
+	// Start anchors a rule to the date the event is held.
+	Start
+)
+
+// Rule describes when a reminder of a given kind is sent.
+type Rule struct {
+	Kind   Kind
+	Anchor Anchor
+
+	// Offset is added to the anchor to get the time the reminder is due.
+	// Negative offsets send the reminder before the anchor.
+	Offset time.Duration
+
+	// Window is how long after it is due the reminder may still be sent,
+	// e.g. when the scheduler was not running at the due time.
+	Window time.Duration
+}
+
+// DefaultRules are the reminders sent when no rules are configured.
+var DefaultRules = []Rule{
+	{Kind: DeadlineApproaching, Anchor: Deadline, Offset: -24 * time.Hour, Window: 24 * time.Hour},
+	{Kind: DeadlinePassed, Anchor: Deadline, Offset: 0, Window: 24 * time.Hour},
+	{Kind: EventTomorrow, Anchor: Start, Offset: -24 * time.Hour, Window: 12 * time.Hour},
+	{Kind: EventSoon, Anchor: Start, Offset: -time.Hour, Window: time.Hour},
+	{Kind: FeeUnpaid, Anchor: Start, Offset: -72 * time.Hour, Window: 48 * time.Hour},
+	{Kind: FeedbackRequest, Anchor: Start, Offset: attendance.EndDelay, Window: 24 * time.Hour},
+}
+
+// Scheduler periodically scans events and sends the reminders that are due.
+type Scheduler struct {
+	DB     db.EventListDatabase
+	Pusher Pusher
+	Clock  Clock
+	Rules  []Rule
+
+	// Interval is the time between two scans.
+	Interval time.Duration
+}
+
+// New creates a Scheduler with the default rules that scans every minute.
+func New(database db.EventListDatabase, pusher Pusher) *Scheduler {
+	return &Scheduler{
+		DB:       database,
+		Pusher:   pusher,
+		Clock:    SystemClock,
+		Rules:    DefaultRules,
+		Interval: time.Minute,
+	}
+}
+
+// Run scans events every s.Interval until stop is closed.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Tick(); err != nil {
+			log.Printf("reminder: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick scans all events once and sends every reminder that is due and has
+// not been sent yet. Of cancelled events, only the cancellation is sent.
+func (s *Scheduler) Tick() error {
+	events, err := s.DB.ListEvents()
+	if err != nil {
+		return fmt.Errorf("could not list events: %v", err)
+	}
+
+	now := s.Clock.Now()
+	for _, event := range events {
+		if event.Cancelled() {
+			if err := s.notifyCancellation(event, now); err != nil {
+				log.Printf("reminder: could not notify cancellation of event %s: %v", event.EventName, err)
+			}
+			continue
+		}
+		for _, rule := range s.Rules {
+			due, err := rule.dueTime(event)
+			if err != nil {
+				log.Printf("reminder: skipping %s for event %s of %s: %v", rule.Kind, event.EventName, event.HostID, err)
+				continue
+			}
+			if now.Before(due) || !now.Before(due.Add(rule.Window)) {
+				continue
+			}
+			if err := s.send(event, rule.Kind, now); err != nil {
+				log.Printf("reminder: could not send %s for event %s: %v", rule.Kind, event.EventName, err)
+			}
+		}
+		if err := s.notifyChanges(event, now); err != nil {
+			log.Printf("reminder: could not notify changes of event %s: %v", event.EventName, err)
+		}
+		if event.GroupID != "" {
+			if err := s.announce(event, now); err != nil {
+				log.Printf("reminder: could not announce event %s: %v", event.EventName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// announce posts to the group of an event that it was created, while it
+// takes applications, and that it filled up, until it is held. Nothing is
+// posted to groups the bot left, nor about private events, as not every
+// member of the group may be invited to them.
+func (s *Scheduler) announce(event *db.Event, now time.Time) error {
+	if event.Visibility == db.VisibilityPrivate {
+		return nil
+	}
+	if group, err := s.DB.GetGroup(event.GroupID); err == nil && !group.Active() {
+		return nil
+	}
+	deadline, err := event.DeadlineTime()
+	if err != nil {
+		return err
+	}
+	start, err := event.StartTime()
+	if err != nil {
+		return err
+	}
+
+	if now.Before(deadline) {
+		text := fmt.Sprintf("新しいイベント「%s」が登録されました。\n開催日時: %s\n開催場所: %s\n「参加 %s」と送ると参加できます。",
+			event.EventName, event.Date, event.Location, event.EventName)
+		if err := s.deliver(event, EventAnnounced, event.GroupID, text, now); err != nil {
+			return err
+		}
+	}
+	if now.Before(start) && event.MembersMax > 0 {
+		participants, err := s.DB.ListParticipantsHostedBy(event.HostID, event.EventName)
+		if err != nil {
+			return fmt.Errorf("could not list participants: %v", err)
+		}
+		if lottery.SeatsLeft(event, nil, participants) == 0 {
+			text := fmt.Sprintf("イベント「%s」は定員（%d人）に達しました。", event.EventName, event.MembersMax)
+			if !event.Lottery {
+				text += "\nこれからの申し込みはキャンセル待ちになります。"
+			}
+			if err := s.deliver(event, EventFull, event.GroupID, text, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// notifyChanges tells the participants of an event, who have not cancelled,
+// what changed in the edits that the host chose to notify them about, until
+// the event is over. Each edit is told once, as recorded by deliver, and only
+// to those who applied before it.
+func (s *Scheduler) notifyChanges(event *db.Event, now time.Time) error {
+	if over(event, now) {
+		return nil
+	}
+	revisions, err := s.DB.ListRevisions(event.HostID, event.EventName)
+	if err != nil {
+		return fmt.Errorf("could not list revisions: %v", err)
+	}
+
+	var participants []*db.Participant
+	for i, revision := range revisions {
+		if i == 0 || !revision.Notify {
+			continue
+		}
+		editedAt, err := db.ParseTime(revision.EditedAt)
+		if err != nil {
+			return err
+		}
+		if now.Before(editedAt) {
+			continue
+		}
+		if participants == nil {
+			if participants, err = s.DB.ListParticipantsHostedBy(event.HostID, event.EventName); err != nil {
+				return fmt.Errorf("could not list participants: %v", err)
+			}
+		}
+
+		text := changeSummary(event, revisions[i-1], revision)
+		kind := Kind(fmt.Sprintf("%s_%d", EventChanged, revision.Version))
+		for _, p := range participants {
+			if p.Status == db.StatusCancelled || p.AppliedAt >= revision.EditedAt {
+				continue
+			}
+			if err := s.deliver(event, kind, p.ParticipantID, text, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// notifyCancellation tells the participants of a cancelled event, who had
+// not cancelled themselves, that it was cancelled and why, and those who paid
+// its fee that it is refunded, until the event would have been over. Each
+// participant is told once, as recorded by deliver.
+func (s *Scheduler) notifyCancellation(event *db.Event, now time.Time) error {
+	cancelledAt, err := db.ParseTime(event.CancelledAt)
+	if err != nil {
+		return err
+	}
+	if now.Before(cancelledAt) || over(event, now) {
+		return nil
+	}
+	participants, err := s.DB.ListParticipantsHostedBy(event.HostID, event.EventName)
+	if err != nil {
+		return fmt.Errorf("could not list participants: %v", err)
+	}
+	payments, err := s.DB.ListPayments(event.HostID, event.EventName)
+	if err != nil {
+		return fmt.Errorf("could not list payments: %v", err)
+	}
+	refunds := make(map[string]*db.Payment)
+	for _, p := range payments {
+		if p.Status == db.PaymentRefundDue || p.Status == db.PaymentRefunded {
+			refunds[p.ParticipantID] = p
+		}
+	}
+
+	for _, p := range participants {
+		if p.Status == db.StatusCancelled {
+			continue
+		}
+		text := fmt.Sprintf("イベント「%s」（%s）は中止になりました。", event.EventName, event.Date)
+		if event.CancelReason != "" {
+			text += "\n理由: " + event.CancelReason
+		}
+		if refund, ok := refunds[p.ParticipantID]; ok {
+			text += fmt.Sprintf("\nお支払いいただいた参加費 %d %s は返金されます。", refund.Amount, refund.Currency)
+		}
+		if err := s.deliver(event, EventCancelled, p.ParticipantID, text, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changeSummary describes what changed between two versions of an event.
+func changeSummary(event *db.Event, previous, revision *db.Revision) string {
+	text := fmt.Sprintf("イベント「%s」の内容が変更されました。", event.EventName)
+	for _, field := range revision.Changed(previous) {
+		switch field {
+		case db.FieldDate:
+			text += fmt.Sprintf("\n開催日時: %s → %s", previous.Date, revision.Date)
+		case db.FieldLocation:
+			text += fmt.Sprintf("\n開催場所: %s → %s", previous.Location, revision.Location)
+		case db.FieldMembersMax:
+			text += fmt.Sprintf("\n定員: %s → %s", capacity(previous.MembersMax), capacity(revision.MembersMax))
+		}
+	}
+	return text
+}
+
+// capacity describes the maximum number of participants of an event.
+func capacity(membersMax int64) string {
+	if membersMax <= 0 {
+		return "制限なし"
+	}
+	return fmt.Sprintf("%d人", membersMax)
+}
+
+func (r Rule) dueTime(event *db.Event) (time.Time, error) {
+	var anchor time.Time
+	var err error
+	switch r.Anchor {
+	case Deadline:
+		anchor, err = event.DeadlineTime()
+	default:
+		anchor, err = event.StartTime()
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return anchor.Add(r.Offset), nil
+}
+
+// over tells whether an event has started by a given time, after which
+// telling its participants that it changed or was cancelled is moot. Events
+// without a valid start time are never over.
+func over(event *db.Event, now time.Time) bool {
+	start, err := event.StartTime()
+	return err == nil && !now.Before(start)
+}
+
+// send delivers a reminder of a given kind to everyone it concerns.
+func (s *Scheduler) send(event *db.Event, kind Kind, now time.Time) error {
+	participants, err := s.DB.ListParticipantsHostedBy(event.HostID, event.EventName)
+	if err != nil {
+		return fmt.Errorf("could not list participants: %v", err)
+	}
+
+	// messages maps each recipient to the text they are sent.
+	messages := make(map[string]string)
+	switch kind {
+	case DeadlineApproaching:
+		messages[event.HostID] = fmt.Sprintf("イベント「%s」の締め切り（%s）が近づいています。\n現在の申込者は %d 人です。", event.EventName, event.Deadline, applicants(participants))
+	case DeadlinePassed:
+		messages[event.HostID] = fmt.Sprintf("イベント「%s」の申し込みを締め切りました。\n申込者は %d 人です。", event.EventName, applicants(participants))
+	case EventTomorrow:
+		for _, id := range confirmedIDs(participants) {
+			messages[id] = fmt.Sprintf("明日はイベント「%s」の開催日です。\n開催日時: %s\n開催場所: %s", event.EventName, event.Date, event.Location)
+		}
+	case EventSoon:
+		for _, id := range confirmedIDs(participants) {
+			messages[id] = fmt.Sprintf("イベント「%s」はまもなく始まります。\n開催日時: %s\n開催場所: %s", event.EventName, event.Date, event.Location)
+		}
+	case FeeUnpaid:
+		entries, err := ledger.Entries(s.DB, event)
+		if err != nil {
+			return fmt.Errorf("could not get ledger: %v", err)
+		}
+		for _, e := range ledger.Unpaid(entries) {
+			messages[e.UserID] = fmt.Sprintf("イベント「%s」の参加費 %d %s のお支払いがまだ確認できていません。\n開催日時: %s", event.EventName, e.Amount, e.Currency, event.Date)
+		}
+	case FeedbackRequest:
+		for _, p := range participants {
+			if p.CheckedInAt != "" {
+				messages[p.ParticipantID] = fmt.Sprintf("イベント「%s」にご参加いただきありがとうございました。\nよろしければアンケートにご協力ください。「アンケート %s」と送ると回答できます。", event.EventName, event.EventName)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown reminder kind %q", kind)
+	}
+
+	for recipient, text := range messages {
+		if err := s.deliver(event, kind, recipient, text, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver pushes text to recipient unless it has already been delivered.
+// The notification is recorded before pushing so that a restart during
+// delivery does not send it twice; it is removed again if the push fails so
+// that the next tick retries.
+func (s *Scheduler) deliver(event *db.Event, kind Kind, recipient, text string, now time.Time) error {
+	notification := &db.Notification{
+		HostID:      event.HostID,
+		EventName:   event.EventName,
+		Kind:        string(kind),
+		RecipientID: recipient,
+		SentAt:      now.In(db.Timezone).Format(db.TimeLayout),
+	}
+
+	sent, err := s.DB.HasNotification(notification)
+	if err != nil {
+		return err
+	}
+	if sent {
+		return nil
+	}
+	if err := s.DB.AddNotification(notification); err != nil {
+		return err
+	}
+
+	if err := s.Pusher.Push(recipient, text); err != nil {
+		if err := s.DB.DeleteNotification(notification); err != nil {
+			log.Printf("reminder: could not remove undelivered notification: %v", err)
+		}
+		return fmt.Errorf("could not push to %s: %v", recipient, err)
+	}
+	return nil
+}
+
+// confirmedIDs returns the IDs of the participants who have a seat.
+func confirmedIDs(participants []*db.Participant) []string {
+	var ids []string
+	for _, p := range participants {
+		if p.Status == db.StatusConfirmed {
+			ids = append(ids, p.ParticipantID)
+		}
+	}
+	return ids
+}
+
+// applicants counts the participants who have not cancelled.
+func applicants(participants []*db.Participant) int {
+	var n int
+	for _, p := range participants {
+		if p.Status != db.StatusCancelled {
+			n++
+		}
+	}
+	return n
+}
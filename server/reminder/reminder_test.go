@@ -0,0 +1,221 @@
+package reminder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// fakeClock is a Clock that tells the time it is set to.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+// fakePusher records the messages pushed to each recipient.
+type fakePusher struct {
+	pushed map[string][]string
+}
+
+func (p *fakePusher) Push(to, text string) error {
+	p.pushed[to] = append(p.pushed[to], text)
+	return nil
+}
+
+// recipients lists who were pushed a message containing text.
+func (p *fakePusher) recipients(text string) []string {
+	var ids []string
+	for id, messages := range p.pushed {
+		for _, m := range messages {
+			if strings.Contains(m, text) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// at parses a time in db.TimeLayout.
+func at(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := db.ParseTime(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// newScheduler returns a scheduler with given rules on a database holding
+// an event by "host" on 2030-06-10 19:00 with the given participants, keyed
+// by user ID to their status.
+func newScheduler(t *testing.T, event *db.Event, participants map[string]string, rules ...Rule) (*Scheduler, *fakeClock, *fakePusher) {
+	t.Helper()
+	database := db.NewMemoryDB()
+	users := []string{"host"}
+	for id := range participants {
+		users = append(users, id)
+	}
+	for _, id := range users {
+		if err := database.AddUser(&db.User{UserID: id, UserName: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	event.HostID = "host"
+	if event.EventName == "" {
+		event.EventName = "hash"
+	}
+	if event.Date == "" {
+		event.Date = "2030-06-10 19:00:00"
+	}
+	if err := database.AddEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	for id, status := range participants {
+		if err := database.AddParticipant(&db.Participant{
+			HostID:        event.HostID,
+			EventName:     event.EventName,
+			ParticipantID: id,
+			Status:        status,
+			AppliedAt:     "2030-06-01 12:00:00",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock := &fakeClock{}
+	pusher := &fakePusher{pushed: make(map[string][]string)}
+	s := &Scheduler{DB: database, Pusher: pusher, Clock: clock, Rules: rules}
+	return s, clock, pusher
+}
+
+func TestTickSendsDueRemindersOnce(t *testing.T) {
+	s, clock, pusher := newScheduler(t, &db.Event{Location: "Shibuya"}, map[string]string{
+		"alice": db.StatusConfirmed,
+		"bob":   db.StatusWaitlisted,
+		"carol": db.StatusCancelled,
+	}, Rule{Kind: EventTomorrow, Anchor: Start, Offset: -24 * time.Hour, Window: 12 * time.Hour})
+
+	clock.now = at(t, "2030-06-09 18:00:00")
+	if err := s.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(pusher.pushed); got != 0 {
+		t.Fatalf("pushed to %d recipients before the reminder was due", got)
+	}
+
+	for _, now := range []string{"2030-06-09 19:00:00", "2030-06-09 20:00:00"} {
+		clock.now = at(t, now)
+		if err := s.Tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := fmt.Sprint(pusher.recipients("明日はイベント")), "[alice]"; got != want {
+		t.Errorf("reminded %s, want %s", got, want)
+	}
+	if got := len(pusher.pushed["alice"]); got != 1 {
+		t.Errorf("alice was reminded %d times, want 1", got)
+	}
+}
+
+func TestTickSkipsReminderOutsideWindow(t *testing.T) {
+	s, clock, pusher := newScheduler(t, &db.Event{}, map[string]string{
+		"alice": db.StatusConfirmed,
+	}, Rule{Kind: EventSoon, Anchor: Start, Offset: -time.Hour, Window: time.Hour})
+
+	clock.now = at(t, "2030-06-10 19:00:00")
+	if err := s.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(pusher.pushed); got != 0 {
+		t.Errorf("pushed to %d recipients after the window closed", got)
+	}
+}
+
+func TestTickSendsOtherRulesWhenOneHasNoDueTime(t *testing.T) {
+	// The event has no deadline, so the deadline rule cannot be timed.
+	s, clock, pusher := newScheduler(t, &db.Event{}, map[string]string{
+		"alice": db.StatusConfirmed,
+	},
+		Rule{Kind: DeadlinePassed, Anchor: Deadline, Window: 24 * time.Hour},
+		Rule{Kind: EventSoon, Anchor: Start, Offset: -time.Hour, Window: time.Hour},
+	)
+
+	clock.now = at(t, "2030-06-10 18:30:00")
+	if err := s.Tick(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(pusher.recipients("まもなく始まります")), "[alice]"; got != want {
+		t.Errorf("reminded %s, want %s", got, want)
+	}
+}
+
+func TestTickNotifiesCancellation(t *testing.T) {
+	s, clock, pusher := newScheduler(t, &db.Event{
+		CancelledAt:  "2030-06-01 09:00:00",
+		CancelReason: "rain",
+	}, map[string]string{
+		"alice": db.StatusConfirmed,
+		"bob":   db.StatusWaitlisted,
+		"carol": db.StatusCancelled,
+	}, Rule{Kind: EventTomorrow, Anchor: Start, Offset: -24 * time.Hour, Window: 12 * time.Hour})
+
+	// Days after the cancellation, while the scheduler was down, the
+	// participants are still told; other reminders are not sent.
+	clock.now = at(t, "2030-06-09 19:00:00")
+	for i := 0; i < 2; i++ {
+		if err := s.Tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := fmt.Sprint(pusher.recipients("中止になりました")), "[alice bob]"; got != want {
+		t.Errorf("told %s of the cancellation, want %s", got, want)
+	}
+	if got := len(pusher.pushed["alice"]); got != 1 {
+		t.Errorf("alice was pushed %d messages, want 1", got)
+	}
+}
+
+func TestTickNotifiesChanges(t *testing.T) {
+	s, clock, pusher := newScheduler(t, &db.Event{Location: "Ebisu"}, map[string]string{
+		"alice": db.StatusConfirmed,
+	})
+	for _, r := range []*db.Revision{
+		{Version: 1, Date: "2030-06-10 19:00:00", Location: "Shibuya", EditedAt: "2030-05-01 12:00:00"},
+		{Version: 2, Date: "2030-06-10 19:00:00", Location: "Ebisu", Notify: true, EditedAt: "2030-06-02 12:00:00"},
+	} {
+		r.HostID, r.EventName, r.EditorID = "host", "hash", "host"
+		if err := s.DB.AddRevision(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// dave applied after the edit and saw the new location.
+	if err := s.DB.AddUser(&db.User{UserID: "dave", UserName: "dave"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.AddParticipant(&db.Participant{
+		HostID: "host", EventName: "hash", ParticipantID: "dave",
+		Status: db.StatusConfirmed, AppliedAt: "2030-06-03 12:00:00",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.now = at(t, "2030-06-05 12:00:00")
+	for i := 0; i < 2; i++ {
+		if err := s.Tick(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := fmt.Sprint(pusher.recipients("Shibuya → Ebisu")), "[alice]"; got != want {
+		t.Errorf("told %s of the change, want %s", got, want)
+	}
+	if got := len(pusher.pushed["alice"]); got != 1 {
+		t.Errorf("alice was pushed %d messages, want 1", got)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/lottery"
+)
+
+type revisionResponse struct {
+	Version    int64  `json:"version"`
+	Date       string `json:"date"`
+	Location   string `json:"location"`
+	MembersMax int64  `json:"membersMax"`
+	EditorID   string `json:"editorID"`
+	Notify     bool   `json:"notify"`
+	EditedAt   string `json:"editedAt"`
+
+	// Changed are the fields that differ from the previous version.
+	Changed []string `json:"changed"`
+}
+
+func newRevisionResponse(revision, previous *db.Revision) *revisionResponse {
+	res := &revisionResponse{
+		Version:    revision.Version,
+		Date:       revision.Date,
+		Location:   revision.Location,
+		MembersMax: revision.MembersMax,
+		EditorID:   revision.EditorID,
+		Notify:     revision.Notify,
+		EditedAt:   revision.EditedAt,
+		Changed:    []string{},
+	}
+	if previous != nil {
+		res.Changed = append(res.Changed, revision.Changed(previous)...)
+	}
+	return res
+}
+
+// updateEventHandler changes the date, location or capacity of an event and
+// records the result as a new version of it. Only its host and co-hosts may
+// change it. Participants are told what changed, unless "mode" is "silent".
+// The capacity may not drop below the participants who have or hold a seat,
+// unless "force" is set. A date or time given alone keeps the other part of
+// the current start, and the deadline moves along with the start.
+func updateEventHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	actorID, aerr := authorize(r, event, permManage)
+	if aerr != nil {
+		return aerr
+	}
+	if event.Cancelled() {
+		return cancelledError(event)
+	}
+	notify, force, aerr := editMode(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	edited := *event
+	if date, clock := r.FormValue("eventDate"), r.FormValue("eventTime"); date != "" || clock != "" {
+		start, err := event.StartTime()
+		if err != nil {
+			return appErrorf(err, "could not parse event date: %v", err)
+		}
+		deadline, err := event.DeadlineTime()
+		if err != nil {
+			return appErrorf(err, "could not parse event deadline: %v", err)
+		}
+		if date == "" {
+			date = start.Format("2006-01-02")
+		}
+		if clock == "" {
+			clock = start.Format("15:04:05")
+		}
+		moved, err := db.ParseTime(date + " " + clock)
+		if err != nil {
+			return appErrorf(err, "could not parse event date: %v", err).withCode(http.StatusBadRequest)
+		}
+		edited.Date = moved.Format(db.TimeLayout)
+		edited.Deadline = moved.Add(deadline.Sub(start)).Format(db.TimeLayout)
+	}
+	if location := r.FormValue("location"); location != "" && location != event.Location {
+		edited.Location = location
+		edited.Coordinates = nil
+		if err := locateEvent(&edited, r); err != nil {
+			return appErrorf(err, "could not locate event: %v", err).withCode(http.StatusBadRequest)
+		}
+	}
+	if v := r.FormValue("membersMax"); v != "" {
+		membersMax, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || membersMax < 0 {
+			return appErrorf(err, "invalid members max %q", v).withCode(http.StatusBadRequest)
+		}
+		edited.MembersMax = membersMax
+	}
+	if len(revisionOf(&edited).Changed(revisionOf(event))) == 0 {
+		return appErrorf(nil, "nothing to change on event %s", event.EventName).withCode(http.StatusBadRequest)
+	}
+
+	if aerr := checkCapacity(event, &edited, force); aerr != nil {
+		return aerr
+	}
+	revision, previous, aerr := saveEdit(audited(r), event, &edited, actorID, notify)
+	if aerr != nil {
+		return aerr
+	}
+
+	resJSON, err := json.Marshal(newRevisionResponse(revision, previous))
+	if err != nil {
+		return appErrorf(err, "could not encode revision: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// editMode reads whether participants are to be told about an edit, unless
+// "mode" is "silent", and whether "force" allows the capacity to drop below
+// the participants who have or hold a seat.
+func editMode(r *http.Request) (notify, force bool, aerr *appError) {
+	switch mode := r.FormValue("mode"); mode {
+	case "", "notify":
+		notify = true
+	case "silent":
+	default:
+		return false, false, appErrorf(nil, "invalid mode %q", mode).withCode(http.StatusBadRequest)
+	}
+	if v := r.FormValue("force"); v != "" {
+		var err error
+		if force, err = strconv.ParseBool(v); err != nil {
+			return false, false, appErrorf(err, "could not parse force: %v", err).withCode(http.StatusBadRequest)
+		}
+	}
+	return notify, force, nil
+}
+
+// revisionOf returns the fields of an event that are versioned.
+func revisionOf(e *db.Event) *db.Revision {
+	return &db.Revision{
+		HostID:     e.HostID,
+		EventName:  e.EventName,
+		Date:       e.Date,
+		Location:   e.Location,
+		MembersMax: e.MembersMax,
+	}
+}
+
+// checkCapacity checks that an edit of an event does not lower its capacity
+// below the participants who have or hold a seat, unless force is set.
+func checkCapacity(event, edited *db.Event, force bool) *appError {
+	if force || edited.MembersMax <= 0 || edited.MembersMax == event.MembersMax {
+		return nil
+	}
+	participants, err := db.DB.ListParticipantsHostedBy(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get participants from database: %v", err)
+	}
+	if taken := lottery.SeatsTaken(participants); taken > edited.MembersMax {
+		return appErrorf(nil, "event %s has %d participants with a seat, more than %d", event.EventName, taken, edited.MembersMax).withCode(http.StatusConflict)
+	}
+	return nil
+}
+
+// saveEdit saves an edited event through database. If its date, location or
+// capacity changed, the edit is recorded as a new version by actorID along
+// with it, which participants are told about if notify is set. It returns
+// the new version and the one before it, or nil if no versioned field
+// changed. Events get their first version, as they were before, when they
+// are first edited.
+func saveEdit(database db.EventListDatabase, event, edited *db.Event, actorID string, notify bool) (revision, previous *db.Revision, aerr *appError) {
+	if len(revisionOf(edited).Changed(revisionOf(event))) == 0 {
+		if err := database.UpdateEvent(edited); err != nil {
+			return nil, nil, appErrorf(err, "could not save event %s: %v", edited.EventName, err)
+		}
+		return nil, nil, nil
+	}
+
+	revisions, err := database.ListRevisions(event.HostID, event.EventName)
+	if err != nil {
+		return nil, nil, appErrorf(err, "could not get revisions from database: %v", err)
+	}
+	now := time.Now().In(db.Timezone).Format(db.TimeLayout)
+	var added []*db.Revision
+	if len(revisions) == 0 {
+		previous = revisionOf(event)
+		previous.Version = 1
+		previous.EditorID = event.HostID
+		previous.EditedAt = now
+		added = append(added, previous)
+	} else {
+		previous = revisions[len(revisions)-1]
+	}
+	revision = revisionOf(edited)
+	revision.Version = previous.Version + 1
+	revision.EditorID = actorID
+	revision.Notify = notify
+	revision.EditedAt = now
+	added = append(added, revision)
+	if err := database.EditEvent(edited, added...); err != nil {
+		return nil, nil, appErrorf(err, "could not save event %s: %v", edited.EventName, err)
+	}
+	return revision, previous, nil
+}
+
+// listRevisionsHandler shows the host and co-hosts of an event its versions,
+// oldest first, with what changed in each.
+func listRevisionsHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+	revisions, err := db.DB.ListRevisions(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get revisions from database: %v", err)
+	}
+
+	res := []*revisionResponse{}
+	var previous *db.Revision
+	for _, revision := range revisions {
+		res = append(res, newRevisionResponse(revision, previous))
+		previous = revision
+	}
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode revisions: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
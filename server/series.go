@@ -0,0 +1,433 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/recurrence"
+	"github.com/shinyamizuno1008/hashbill/server/series"
+)
+
+// Scopes of an edit to an occurrence of a series.
+const (
+	scopeThis   = "this"
+	scopeFuture = "future"
+)
+
+type seriesResponse struct {
+	*db.Series
+	Occurrences []*db.Event `json:"occurrences"`
+}
+
+// registerSeriesHandler adds a series of recurring events and generates its
+// first occurrences. The series is either described by the form like an
+// event, or copied from the event named by "fromEvent", which then becomes
+// its first occurrence. Only the host may add a series, or the host and
+// co-hosts of the event it is copied from.
+func registerSeriesHandler(w http.ResponseWriter, r *http.Request) *appError {
+	var first *db.Event
+	if name := r.FormValue("fromEvent"); name != "" {
+		var err error
+		if first, err = db.DB.GetEvent(r.FormValue("hostID"), name); err != nil {
+			return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+		}
+		if _, aerr := authorize(r, first, permManage); aerr != nil {
+			return aerr
+		}
+		if first.SeriesName != "" {
+			return appErrorf(nil, "event %s is already part of series %s", name, first.SeriesName).withCode(http.StatusConflict)
+		}
+	} else if aerr := authorizeHost(r, r.FormValue("hostID")); aerr != nil {
+		return aerr
+	}
+
+	s, err := seriesFromForm(r, first)
+	if err != nil {
+		return appErrorf(err, "could not parse series from form: %v", err).withCode(http.StatusBadRequest)
+	}
+	if _, err := recurrence.Parse(s.Rule, db.Timezone); err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+	}
+
+	if err := db.DB.AddSeries(s); err != nil {
+		return appErrorf(err, "could not add series: %v", err)
+	}
+	if first != nil {
+		first.SeriesName = s.SeriesName
+		if err := audited(r).UpdateEvent(first); err != nil {
+			return appErrorf(err, "could not add event to series: %v", err)
+		}
+	}
+
+	if _, err := series.Extend(audited(r), s, time.Now()); err != nil {
+		return appErrorf(err, "could not generate occurrences: %v", err)
+	}
+	return writeSeries(w, s)
+}
+
+// seriesFromForm populates the fields of a series from form values, or from
+// a given first occurrence if it is not nil. The recurrence is given either
+// as a rule in "rule", or as "repeat": "weekly" on the weekday of the first
+// occurrence, or "monthly" on the same weekday of the month, e.g. every 2nd
+// Saturday. "count" and "until" limit it.
+func seriesFromForm(r *http.Request, first *db.Event) (*db.Series, error) {
+	s := &db.Series{
+		HostID:     r.FormValue("hostID"),
+		SeriesName: r.FormValue("seriesName"),
+	}
+	if s.HostID == "" || s.SeriesName == "" {
+		return nil, fmt.Errorf("hostID and seriesName are required")
+	}
+	if first != nil {
+		copyEventToSeries(first, s)
+	} else if err := seriesTemplateFromForm(r, s); err != nil {
+		return nil, err
+	}
+	if v := r.FormValue("carryParticipants"); v != "" {
+		var err error
+		if s.CarryParticipants, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("could not parse carry participants: %v", err)
+		}
+	}
+
+	start, err := s.StartTime()
+	if err != nil {
+		return nil, err
+	}
+	s.Rule = r.FormValue("rule")
+	switch repeat := r.FormValue("repeat"); repeat {
+	case "":
+	case "weekly":
+		s.Rule = recurrence.Weekly(start.Weekday())
+	case "monthly":
+		s.Rule = recurrence.MonthlyByWeekday((start.Day()-1)/7+1, start.Weekday())
+	default:
+		return nil, fmt.Errorf("unknown repeat %q", repeat)
+	}
+	if v := r.FormValue("count"); v != "" {
+		s.Rule += ";COUNT=" + v
+	}
+	if v := r.FormValue("until"); v != "" {
+		until, err := db.ParseTime(v + " 23:59:59")
+		if err != nil {
+			return nil, fmt.Errorf("could not parse until: %v", err)
+		}
+		s.Rule += ";UNTIL=" + until.Format("20060102T150405")
+	}
+	return s, nil
+}
+
+// seriesTemplateFromForm populates the template fields of a series from form
+// values named like those of an event.
+func seriesTemplateFromForm(r *http.Request, s *db.Series) error {
+	s.Location = r.FormValue("location")
+	s.Description = r.FormValue("description")
+	s.Currency = r.FormValue("currency")
+
+	start, err := db.ParseTime(r.FormValue("eventDate") + " " + r.FormValue("eventTime"))
+	if err != nil {
+		return err
+	}
+	s.Start = start.Format(db.TimeLayout)
+
+	if v := r.FormValue("membersMax"); v != "" {
+		if s.MembersMax, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("could not parse members max: %v", err)
+		}
+	}
+	if v := r.FormValue("lottery"); v != "" {
+		if s.Lottery, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("could not parse lottery: %v", err)
+		}
+	}
+	if v := r.FormValue("deprioritizeNoShows"); v != "" {
+		if s.DeprioritizeNoShows, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("could not parse deprioritize no-shows: %v", err)
+		}
+	}
+	if v := r.FormValue("fee"); v != "" {
+		if s.Fee, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("could not parse fee: %v", err)
+		}
+	}
+	if v := r.FormValue("deadlineBefore"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("could not parse deadline before: %v", err)
+		}
+		s.DeadlineBefore = int64(d / time.Minute)
+	}
+	return nil
+}
+
+// copyEventToSeries fills the template of a series from an existing event.
+func copyEventToSeries(e *db.Event, s *db.Series) {
+	start, _ := e.StartTime()
+	s.Start = start.Format(db.TimeLayout)
+	if deadline, err := e.DeadlineTime(); err == nil && deadline.Before(start) {
+		s.DeadlineBefore = int64(start.Sub(deadline) / time.Minute)
+	}
+	s.Location = e.Location
+	s.MembersMax = e.MembersMax
+	s.Lottery = e.Lottery
+	s.Description = e.Description
+	s.DeprioritizeNoShows = e.DeprioritizeNoShows
+	s.Fee = e.Fee
+	s.Currency = e.Currency
+
+	// The event is the first occurrence.
+	s.GeneratedUntil = e.Date
+}
+
+// listSeriesHandler lists the series of a host with their occurrences. Only
+// the occurrences the user in "viewer" may see are listed, and series none of
+// whose occurrences they may see are left out, unless they are the host.
+func listSeriesHandler(w http.ResponseWriter, r *http.Request) *appError {
+	hostID, viewer := r.FormValue("hostID"), viewerFromForm(r)
+	all, err := db.DB.ListSeriesHostedBy(hostID)
+	if err != nil {
+		return appErrorf(err, "could not list series: %v", err)
+	}
+
+	res := []seriesResponse{}
+	for _, s := range all {
+		occurrences, err := db.DB.ListOccurrences(s.HostID, s.SeriesName)
+		if err != nil {
+			return appErrorf(err, "could not list occurrences: %v", err)
+		}
+		visible := []*db.Event{}
+		for _, e := range occurrences {
+			if canView(e, viewer) {
+				visible = append(visible, e)
+			}
+		}
+		if len(visible) == 0 && viewer != s.HostID {
+			continue
+		}
+		res = append(res, seriesResponse{Series: s, Occurrences: visible})
+	}
+
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode series: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// editOccurrenceHandler edits an occurrence of a series. With scope "this"
+// only the given occurrence changes; with scope "future" it and all later
+// occurrences change, and so do the occurrences generated from then on.
+// Only the fields present in the form are changed. Only the host and
+// co-hosts of the occurrence may edit it. Changes to the date, location or
+// capacity of an occurrence are versioned and told to its participants as
+// by updateEventHandler, with the same "mode" and "force".
+func editOccurrenceHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	actorID, aerr := authorize(r, event, permManage)
+	if aerr != nil {
+		return aerr
+	}
+	if event.SeriesName == "" {
+		return appErrorf(nil, "event %s is not part of a series", event.EventName).withCode(http.StatusBadRequest)
+	}
+	notify, force, aerr := editMode(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	switch scope := r.FormValue("scope"); scope {
+	case scopeThis:
+		if event.Cancelled() {
+			return cancelledError(event)
+		}
+		edited := *event
+		if err := editEvent(&edited, r, true); err != nil {
+			return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+		}
+		if aerr := checkCapacity(event, &edited, force); aerr != nil {
+			return aerr
+		}
+		if _, _, aerr := saveEdit(audited(r), event, &edited, actorID, notify); aerr != nil {
+			return aerr
+		}
+		event = &edited
+	case scopeFuture:
+		s, err := db.DB.GetSeries(event.HostID, event.SeriesName)
+		if err != nil {
+			return appErrorf(err, "could not find series: %v", err).withCode(http.StatusNotFound)
+		}
+		occurrences, err := db.DB.ListOccurrences(s.HostID, s.SeriesName)
+		if err != nil {
+			return appErrorf(err, "could not list occurrences: %v", err)
+		}
+		// Every occurrence is checked before any is saved.
+		var originals, edits []*db.Event
+		for _, e := range series.Future(occurrences, event) {
+			// Cancelled occurrences are kept as they were called off.
+			if e.Cancelled() {
+				continue
+			}
+			edited := *e
+			if err := editEvent(&edited, r, false); err != nil {
+				return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+			}
+			if aerr := checkCapacity(e, &edited, force); aerr != nil {
+				return aerr
+			}
+			originals = append(originals, e)
+			edits = append(edits, &edited)
+		}
+		if err := editSeries(s, r); err != nil {
+			return appErrorf(err, "%v", err).withCode(http.StatusBadRequest)
+		}
+		for i, edited := range edits {
+			if _, _, aerr := saveEdit(audited(r), originals[i], edited, actorID, notify); aerr != nil {
+				return aerr
+			}
+			if edited.EventName == event.EventName {
+				event = edited
+			}
+		}
+		if err := db.DB.UpdateSeries(s); err != nil {
+			return appErrorf(err, "could not save series: %v", err)
+		}
+	default:
+		return appErrorf(nil, "unknown scope %q", scope).withCode(http.StatusBadRequest)
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return appErrorf(err, "could not encode event: %v", err)
+	}
+	w.Write(eventJSON)
+	return nil
+}
+
+// editEvent applies the fields present in a form to an event. The date can
+// only be moved to another day when editing a single occurrence; otherwise
+// only the time of day changes.
+func editEvent(e *db.Event, r *http.Request, single bool) error {
+	start, err := e.StartTime()
+	if err != nil {
+		return err
+	}
+	deadline, err := e.DeadlineTime()
+	if err != nil {
+		return err
+	}
+	deadlineBefore := start.Sub(deadline)
+
+	date := start.Format("2006-01-02")
+	if v := r.FormValue("eventDate"); v != "" {
+		if !single {
+			return fmt.Errorf("the date can only be changed for a single occurrence")
+		}
+		date = v
+	}
+	clock := start.Format("15:04:05")
+	if v := r.FormValue("eventTime"); v != "" {
+		clock = v
+	}
+	if start, err = db.ParseTime(date + " " + clock); err != nil {
+		return err
+	}
+	if v := r.FormValue("deadlineBefore"); v != "" {
+		if deadlineBefore, err = time.ParseDuration(v); err != nil {
+			return fmt.Errorf("could not parse deadline before: %v", err)
+		}
+	}
+	e.Date = start.Format(db.TimeLayout)
+	e.Deadline = start.Add(-deadlineBefore).Format(db.TimeLayout)
+
+	if v := r.FormValue("location"); v != "" {
+		e.Location = v
+	}
+	if v := r.FormValue("description"); v != "" {
+		e.Description = v
+	}
+	if v := r.FormValue("currency"); v != "" {
+		e.Currency = v
+	}
+	if v := r.FormValue("membersMax"); v != "" {
+		if e.MembersMax, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("could not parse members max: %v", err)
+		}
+	}
+	if v := r.FormValue("lottery"); v != "" {
+		if e.Lottery, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("could not parse lottery: %v", err)
+		}
+	}
+	if v := r.FormValue("fee"); v != "" {
+		if e.Fee, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("could not parse fee: %v", err)
+		}
+	}
+	return nil
+}
+
+// editSeries applies the fields present in a form to the template of a
+// series, so that occurrences generated later get them too.
+func editSeries(s *db.Series, r *http.Request) error {
+	template := series.Occurrence(s, time.Time{})
+	start, err := s.StartTime()
+	if err != nil {
+		return err
+	}
+	template.Date = start.Format(db.TimeLayout)
+	template.Deadline = start.Add(-time.Duration(s.DeadlineBefore) * time.Minute).Format(db.TimeLayout)
+	if err := editEvent(template, r, false); err != nil {
+		return err
+	}
+
+	start, _ = template.StartTime()
+	deadline, _ := template.DeadlineTime()
+	s.Start = template.Date
+	s.DeadlineBefore = int64(start.Sub(deadline) / time.Minute)
+	s.Location = template.Location
+	s.MembersMax = template.MembersMax
+	s.Lottery = template.Lottery
+	s.Description = template.Description
+	s.Fee = template.Fee
+	s.Currency = template.Currency
+	if v := r.FormValue("carryParticipants"); v != "" {
+		if s.CarryParticipants, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("could not parse carry participants: %v", err)
+		}
+	}
+	return nil
+}
+
+// deleteSeriesHandler stops generating occurrences of a series. Occurrences
+// that were already generated are kept. Only the host may delete it.
+func deleteSeriesHandler(w http.ResponseWriter, r *http.Request) *appError {
+	if aerr := authorizeHost(r, r.FormValue("hostID")); aerr != nil {
+		return aerr
+	}
+	if err := db.DB.DeleteSeries(r.FormValue("hostID"), r.FormValue("seriesName")); err != nil {
+		return appErrorf(err, "could not delete series: %v", err).withCode(http.StatusNotFound)
+	}
+	return nil
+}
+
+// writeSeries writes a series and its occurrences as JSON.
+func writeSeries(w http.ResponseWriter, s *db.Series) *appError {
+	occurrences, err := db.DB.ListOccurrences(s.HostID, s.SeriesName)
+	if err != nil {
+		return appErrorf(err, "could not list occurrences: %v", err)
+	}
+	resJSON, err := json.Marshal(seriesResponse{Series: s, Occurrences: occurrences})
+	if err != nil {
+		return appErrorf(err, "could not encode series: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
@@ -0,0 +1,174 @@
+// Package series generates the occurrences of recurring events.
+package series
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/recurrence"
+)
+
+// Horizon is how far ahead occurrences are generated. Later occurrences are
+// generated as time passes, so that an open-ended series does not fill the
+// event list.
+const Horizon = 8 * 7 * 24 * time.Hour
+
+// OccurrenceName returns the event name of the occurrence of a series that
+// starts at a given time.
+func OccurrenceName(seriesName string, start time.Time) string {
+	return seriesName + " " + start.Format("2006-01-02")
+}
+
+// Occurrence returns the event of the occurrence of a series that starts at a
+// given time.
+func Occurrence(s *db.Series, start time.Time) *db.Event {
+	deadline := start.Add(-time.Duration(s.DeadlineBefore) * time.Minute)
+	return &db.Event{
+		HostID:      s.HostID,
+		EventName:   OccurrenceName(s.SeriesName, start),
+		Date:        start.Format(db.TimeLayout),
+		Deadline:    deadline.Format(db.TimeLayout),
+		Location:    s.Location,
+		MembersMax:  s.MembersMax,
+		Lottery:     s.Lottery,
+		Description: s.Description,
+
+		DeprioritizeNoShows: s.DeprioritizeNoShows,
+		Fee:                 s.Fee,
+		Currency:            s.Currency,
+		SeriesName:          s.SeriesName,
+	}
+}
+
+// Extend generates the occurrences of a series that start before now plus
+// Horizon and were not generated yet, and returns them. Occurrences that were
+// generated once are not generated again, even if they were deleted.
+func Extend(database db.EventListDatabase, s *db.Series, now time.Time) ([]*db.Event, error) {
+	start, err := s.StartTime()
+	if err != nil {
+		return nil, err
+	}
+	rule, err := recurrence.Parse(s.Rule, db.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Occurrences are named by their day, so generation resumes on the day
+	// after the last one even if the time of day was edited since.
+	from := start
+	if s.GeneratedUntil != "" {
+		generatedUntil, err := db.ParseTime(s.GeneratedUntil)
+		if err != nil {
+			return nil, err
+		}
+		y, m, d := generatedUntil.Date()
+		from = time.Date(y, m, d+1, 0, 0, 0, 0, db.Timezone)
+	}
+
+	occurrences, err := database.ListOccurrences(s.HostID, s.SeriesName)
+	if err != nil {
+		return nil, fmt.Errorf("could not list occurrences: %v", err)
+	}
+	var previous *db.Event
+	if len(occurrences) > 0 {
+		previous = occurrences[len(occurrences)-1]
+	}
+
+	var created []*db.Event
+	for _, t := range rule.Between(start, from, now.Add(Horizon)) {
+		event := Occurrence(s, t)
+		if err := database.AddEvent(event); err != nil {
+			return created, fmt.Errorf("could not add occurrence %s: %v", event.EventName, err)
+		}
+		// The occurrence is recorded as generated before anything else can
+		// fail, so that it is not added again on the next run.
+		s.GeneratedUntil = event.Date
+		if err := database.UpdateSeries(s); err != nil {
+			return created, fmt.Errorf("could not update series: %v", err)
+		}
+		created = append(created, event)
+
+		if s.CarryParticipants && previous != nil {
+			if err := carryParticipants(database, previous, event, now); err != nil {
+				return created, err
+			}
+		}
+		previous = event
+	}
+	return created, nil
+}
+
+// carryParticipants applies the confirmed participants of an occurrence to
+// the next one. They are confirmed as long as there are seats, and put on the
+// waitlist after that.
+func carryParticipants(database db.EventListDatabase, from, to *db.Event, now time.Time) error {
+	participants, err := database.ListParticipantsHostedBy(from.HostID, from.EventName)
+	if err != nil {
+		return fmt.Errorf("could not list participants of %s: %v", from.EventName, err)
+	}
+
+	var seated int64
+	for _, p := range participants {
+		if p.Status != db.StatusConfirmed {
+			continue
+		}
+		status := db.StatusConfirmed
+		if to.Lottery {
+			status = db.StatusApplied
+		} else if to.MembersMax > 0 && seated >= to.MembersMax {
+			status = db.StatusWaitlisted
+		} else {
+			seated++
+		}
+		if err := database.AddParticipant(&db.Participant{
+			HostID:        to.HostID,
+			EventName:     to.EventName,
+			ParticipantID: p.ParticipantID,
+			Status:        status,
+			AppliedAt:     now.In(db.Timezone).Format(db.TimeLayout),
+			ShareWeight:   p.ShareWeight,
+		}); err != nil {
+			return fmt.Errorf("could not carry participant %s to %s: %v", p.ParticipantID, to.EventName, err)
+		}
+	}
+	return nil
+}
+
+// Future returns the occurrences of a series from a given one on, in order
+// of date.
+func Future(occurrences []*db.Event, from *db.Event) []*db.Event {
+	var future []*db.Event
+	for _, e := range occurrences {
+		if e.Date >= from.Date {
+			future = append(future, e)
+		}
+	}
+	return future
+}
+
+// ExtendAll extends every series. A series that cannot be extended is logged
+// and skipped, so that it does not hold up the others.
+func ExtendAll(database db.EventListDatabase, now time.Time) error {
+	all, err := database.ListSeries()
+	if err != nil {
+		return fmt.Errorf("could not list series: %v", err)
+	}
+	for _, s := range all {
+		if _, err := Extend(database, s, now); err != nil {
+			log.Printf("series: could not extend series %s of %s: %v", s.SeriesName, s.HostID, err)
+		}
+	}
+	return nil
+}
+
+// Run extends every series every interval, forever.
+func Run(database db.EventListDatabase, interval time.Duration) {
+	for {
+		if err := ExtendAll(database, time.Now()); err != nil {
+			log.Printf("series: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
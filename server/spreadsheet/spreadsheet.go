@@ -0,0 +1,14 @@
+// Package spreadsheet escapes text for the CSV files opened in spreadsheets.
+package spreadsheet
+
+import "strings"
+
+// Cell escapes text entered by users so that spreadsheets do not run it as a
+// formula: text starting with a character that starts formulas is prefixed
+// with an apostrophe, which Excel does not show.
+func Cell(text string) string {
+	if text != "" && strings.ContainsRune("=+-@", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
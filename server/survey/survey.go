@@ -0,0 +1,137 @@
+// Package survey summarizes the responses to the feedback surveys participants
+// are sent after events.
+package survey
+
+import (
+	"strconv"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+)
+
+// Summary aggregates the responses to the survey of an event.
+type Summary struct {
+	Responses int `json:"responses"`
+
+	// Invited is the number of participants asked to respond, i.e. those who
+	// checked in.
+	Invited int `json:"invited"`
+
+	// AverageRating is the mean rating, or 0 if nobody responded.
+	AverageRating float64 `json:"averageRating"`
+
+	// Ratings counts the responses giving each rating, from db.MinRating to
+	// db.MaxRating.
+	Ratings []int `json:"ratings"`
+
+	// Comments are the comments left, newest first.
+	Comments []*Comment `json:"comments"`
+
+	Questions []*QuestionSummary `json:"questions"`
+}
+
+// Comment is a comment left in a response. Responses are anonymous to hosts.
+type Comment struct {
+	Rating      int64  `json:"rating"`
+	Comment     string `json:"comment"`
+	SubmittedAt string `json:"submittedAt"`
+}
+
+// QuestionSummary aggregates the answers to a custom question of a survey.
+type QuestionSummary struct {
+	QuestionID int64    `json:"questionID"`
+	Label      string   `json:"label"`
+	Type       string   `json:"type"`
+	Options    []string `json:"options,omitempty"`
+
+	// Answered is the number of responses answering the question.
+	Answered int `json:"answered"`
+
+	// Counts counts the responses choosing each option of a choice question,
+	// in the order of Options.
+	Counts []int `json:"counts,omitempty"`
+
+	// Average is the mean answer to a number question.
+	Average float64 `json:"average,omitempty"`
+
+	// Texts are the answers to a text question, newest first.
+	Texts []string `json:"texts,omitempty"`
+}
+
+// Summarize aggregates the responses to a survey with the given questions,
+// which invited participants were asked to respond to.
+func Summarize(questions []*db.Question, feedback []*db.Feedback, invited int) *Summary {
+	s := &Summary{
+		Responses: len(feedback),
+		Invited:   invited,
+		Ratings:   make([]int, db.MaxRating-db.MinRating+1),
+		Comments:  []*Comment{},
+		Questions: []*QuestionSummary{},
+	}
+
+	var total int64
+	for i := len(feedback) - 1; i >= 0; i-- {
+		f := feedback[i]
+		total += f.Rating
+		if f.Rating >= db.MinRating && f.Rating <= db.MaxRating {
+			s.Ratings[f.Rating-db.MinRating]++
+		}
+		if f.Comment != "" {
+			s.Comments = append(s.Comments, &Comment{Rating: f.Rating, Comment: f.Comment, SubmittedAt: f.SubmittedAt})
+		}
+	}
+	if len(feedback) > 0 {
+		s.AverageRating = float64(total) / float64(len(feedback))
+	}
+
+	for _, q := range questions {
+		s.Questions = append(s.Questions, summarizeQuestion(q, feedback))
+	}
+	return s
+}
+
+func summarizeQuestion(q *db.Question, feedback []*db.Feedback) *QuestionSummary {
+	qs := &QuestionSummary{QuestionID: q.QuestionID, Label: q.Label, Type: q.Type, Options: q.Options}
+	if q.Type == db.QuestionChoice || q.Type == db.QuestionMultipleChoice {
+		qs.Counts = make([]int, len(q.Options))
+	}
+
+	var sum float64
+	var numbers int
+	for i := len(feedback) - 1; i >= 0; i-- {
+		a := answerTo(feedback[i], q.QuestionID)
+		if a == nil || len(a.Values) == 0 {
+			continue
+		}
+		qs.Answered++
+		for _, v := range a.Values {
+			switch q.Type {
+			case db.QuestionChoice, db.QuestionMultipleChoice:
+				for j, o := range q.Options {
+					if o == v {
+						qs.Counts[j]++
+					}
+				}
+			case db.QuestionNumber:
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					sum += n
+					numbers++
+				}
+			default:
+				qs.Texts = append(qs.Texts, v)
+			}
+		}
+	}
+	if numbers > 0 {
+		qs.Average = sum / float64(numbers)
+	}
+	return qs
+}
+
+func answerTo(f *db.Feedback, questionID int64) *db.Answer {
+	for _, a := range f.Answers {
+		if a.QuestionID == questionID {
+			return a
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ticket
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// Store saves rendered tickets and returns the URL they can be viewed at.
+type Store interface {
+	Save(name string, png []byte) (string, error)
+}
+
+// BucketStore stores tickets as publicly readable objects in a Cloud Storage bucket.
+type BucketStore struct {
+	Bucket     *storage.BucketHandle
+	BucketName string
+}
+
+// Save uploads png to the bucket under name.
+func (s *BucketStore) Save(name string, png []byte) (string, error) {
+	ctx := context.Background()
+	w := s.Bucket.Object(name).NewWriter(ctx)
+
+	// Warning: storage.AllUsers gives public read access to anyone.
+	w.ACL = []storage.ACLRule{{Entity: storage.AllUsers, Role: storage.RoleReader}}
+	w.ContentType = "image/png"
+
+	// Entries are immutable, be aggressive about caching (1 day).
+	w.CacheControl = "public, max-age=86400"
+
+	if _, err := w.Write(png); err != nil {
+		w.Close()
+		return "", fmt.Errorf("could not write ticket to bucket: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("could not write ticket to bucket: %v", err)
+	}
+
+	const publicURL = "https://storage.googleapis.com/%s/%s"
+	return fmt.Sprintf(publicURL, s.BucketName, name), nil
+}
+
+// DiskStore stores tickets in a local directory. It stands in for BucketStore
+// when running locally; the directory must be served under BaseURL.
+type DiskStore struct {
+	Dir     string
+	BaseURL string
+}
+
+// Save writes png to a file under s.Dir.
+func (s *DiskStore) Save(name string, png []byte) (string, error) {
+	path := filepath.Join(s.Dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("could not create ticket directory: %v", err)
+	}
+	if err := ioutil.WriteFile(path, png, 0644); err != nil {
+		return "", fmt.Errorf("could not write ticket: %v", err)
+	}
+	return strings.TrimSuffix(s.BaseURL, "/") + "/" + name, nil
+}
@@ -0,0 +1,121 @@
+// Package ticket issues signed ticket tokens to event participants and renders
+// them as QR codes to be scanned at the venue.
+package ticket
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// ErrInvalidToken is returned when a token is malformed or its signature
+// does not match.
+var ErrInvalidToken = errors.New("ticket: invalid token")
+
+// signatureSize is the number of bytes of the HMAC kept in a token. It keeps
+// the QR code small while still making tokens impossible to guess.
+const signatureSize = 16
+
+// Signer issues and verifies ticket tokens.
+type Signer struct {
+	key []byte
+}
+
+// NewSigner creates a Signer that signs tokens with a given secret key.
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+// Token returns the ticket token of a participant of an event. The token is
+// the same every time it is issued for the same participant.
+func (s *Signer) Token(hostID, eventName, participantID string) string {
+	payload := []byte(strings.Join([]string{hostID, eventName, participantID}, "\x00"))
+	return encode(payload) + "." + encode(s.sign(payload))
+}
+
+// Verify checks the signature of a token and returns the participant it was
+// issued to. Only the IDs of the returned participant are set.
+func (s *Signer) Verify(token string) (*db.Participant, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	}
+	payload, err := decode(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signature, err := decode(parts[1])
+	if err != nil || !hmac.Equal(signature, s.sign(payload)) {
+		return nil, ErrInvalidToken
+	}
+
+	ids := bytes.Split(payload, []byte{0})
+	if len(ids) != 3 {
+		return nil, ErrInvalidToken
+	}
+	return &db.Participant{
+		HostID:        string(ids[0]),
+		EventName:     string(ids[1]),
+		ParticipantID: string(ids[2]),
+	}, nil
+}
+
+// FeedKey returns the secret key in the URL of a user's calendar feed, so
+// that feeds cannot be found by guessing user IDs.
+func (s *Signer) FeedKey(userID string) string {
+	return s.urlKey("calendar", userID)
+}
+
+// VerifyFeedKey reports whether a key is the feed key of a user.
+func (s *Signer) VerifyFeedKey(userID, key string) bool {
+	return hmac.Equal([]byte(key), []byte(s.FeedKey(userID)))
+}
+
+// ExportKey returns the secret key in the URL of an event's participant
+// list, so that the host can open it in a browser without logging in.
+func (s *Signer) ExportKey(hostID, eventName string) string {
+	return s.urlKey("export", hostID, eventName)
+}
+
+// VerifyExportKey reports whether a key is the export key of an event.
+func (s *Signer) VerifyExportKey(hostID, eventName, key string) bool {
+	return hmac.Equal([]byte(key), []byte(s.ExportKey(hostID, eventName)))
+}
+
+// urlKey signs a purpose and IDs into a URL-safe key.
+func (s *Signer) urlKey(purpose string, ids ...string) string {
+	return encode(s.sign([]byte(strings.Join(append([]string{purpose}, ids...), "\x00"))))
+}
+
+func (s *Signer) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)[:signatureSize]
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// QRCode renders a token as a PNG image of a QR code.
+func QRCode(token string) ([]byte, error) {
+	return qrcode.Encode(token, qrcode.Medium, 512)
+}
+
+// ObjectName returns the name the QR code of a token is stored under. It is
+// derived from the token so that reissuing a ticket overwrites the same object.
+func ObjectName(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "tickets/" + hex.EncodeToString(sum[:]) + ".png"
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/ticket"
+)
+
+var (
+	ticketSigner *ticket.Signer
+	ticketStore  ticket.Store
+)
+
+// configureTickets sets up signing and storage of tickets. QR codes are
+// stored in the Cloud Storage bucket unless TICKET_DIR names a local
+// directory, which is then served under /tickets/.
+func configureTickets(r *mux.Router) {
+	key := os.Getenv("TICKET_SECRET")
+	if key == "" {
+		if os.Getenv("GAE_INSTANCE") != "" {
+			log.Fatal("TICKET_SECRET must be set in production")
+		}
+		key = "development"
+	}
+	ticketSigner = ticket.NewSigner([]byte(key))
+
+	if dir := os.Getenv("TICKET_DIR"); dir != "" {
+		ticketStore = &ticket.DiskStore{Dir: dir, BaseURL: serverURL()}
+		r.PathPrefix("/tickets/").Handler(http.FileServer(http.Dir(dir)))
+		return
+	}
+	ticketStore = &ticket.BucketStore{
+		Bucket:     db.StorageBucket,
+		BucketName: db.StorageBucketName,
+	}
+}
+
+// serverURL returns the URL this server is reachable at from outside.
+func serverURL() string {
+	if url := os.Getenv("SERVER_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8000"
+}
+
+type ticketResponse struct {
+	Token string `json:"token"`
+	QRURL string `json:"qrURL"`
+	Tier  string `json:"tier,omitempty"`
+
+	// CalendarURL is the .ics file of the event, and FeedURL the calendar
+	// feed of the participant.
+	CalendarURL string `json:"calendarURL"`
+	FeedURL     string `json:"feedURL"`
+}
+
+// getTicketHandler issues the ticket of a confirmed participant and returns
+// its token and the URL of its QR code. Only the participant and the
+// organizers of the event may get it, as the token checks them in.
+// Cancelled events have no tickets.
+func getTicketHandler(w http.ResponseWriter, r *http.Request) *appError {
+	participant, err := participantFromRequest(r)
+	if err != nil {
+		return appErrorf(err, "%v", err).withCode(http.StatusNotFound)
+	}
+	event, err := db.DB.GetEvent(participant.HostID, participant.EventName)
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if actorID := actorFromForm(r); actorID == "" || actorID != participant.ParticipantID {
+		if _, aerr := authorize(r, event, permCheckIn); aerr != nil {
+			return aerr
+		}
+	}
+	if event.Cancelled() {
+		return cancelledError(event)
+	}
+	if participant.Status != db.StatusConfirmed {
+		return appErrorf(nil, "participant %s is not confirmed", participant.ParticipantID).withCode(http.StatusForbidden)
+	}
+
+	token := ticketSigner.Token(participant.HostID, participant.EventName, participant.ParticipantID)
+	png, err := ticket.QRCode(token)
+	if err != nil {
+		return appErrorf(err, "could not render ticket: %v", err)
+	}
+	qrURL, err := ticketStore.Save(ticket.ObjectName(token), png)
+	if err != nil {
+		return appErrorf(err, "could not store ticket: %v", err)
+	}
+
+	ticketJSON, err := json.Marshal(ticketResponse{
+		Token:       token,
+		QRURL:       qrURL,
+		Tier:        participant.Tier,
+		CalendarURL: calendarURL(participant.HostID, participant.EventName, participant.ParticipantID),
+		FeedURL:     feedURL(participant.ParticipantID),
+	})
+	if err != nil {
+		return appErrorf(err, "could not encode ticket: %v", err)
+	}
+	w.Write(ticketJSON)
+	return nil
+}
+
+type checkInResponse struct {
+	ParticipantID string `json:"participantID"`
+	UserName      string `json:"userName"`
+	EventName     string `json:"eventName"`
+	CheckedInAt   string `json:"checkedInAt"`
+}
+
+// checkInHandler checks in the holder of a ticket. Only the organizers of the
+// event may check participants in. Tickets of cancelled events are void.
+func checkInHandler(w http.ResponseWriter, r *http.Request) *appError {
+	holder, err := ticketSigner.Verify(r.FormValue("token"))
+	if err != nil {
+		return appErrorf(err, "invalid ticket").withCode(http.StatusBadRequest)
+	}
+	event, err := db.DB.GetEvent(holder.HostID, holder.EventName)
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permCheckIn); aerr != nil {
+		return aerr
+	}
+	if event.Cancelled() {
+		return cancelledError(event)
+	}
+
+	participant, err := db.DB.GetParticipant(holder)
+	if err != nil {
+		return appErrorf(err, "could not find participant: %v", err).withCode(http.StatusNotFound)
+	}
+	if participant.Status != db.StatusConfirmed {
+		return appErrorf(nil, "participant %s is not confirmed", participant.ParticipantID).withCode(http.StatusForbidden)
+	}
+
+	now := time.Now().In(db.Timezone).Format(db.TimeLayout)
+	if err := audited(r).CheckInParticipant(participant, now); err == db.ErrAlreadyCheckedIn {
+		return appErrorf(err, "participant %s has already checked in at %s", participant.ParticipantID, participant.CheckedInAt).withCode(http.StatusConflict)
+	} else if err != nil {
+		return appErrorf(err, "could not check in participant: %v", err)
+	}
+
+	res := checkInResponse{
+		ParticipantID: participant.ParticipantID,
+		EventName:     participant.EventName,
+		CheckedInAt:   now,
+	}
+	if user, err := db.DB.GetUser(participant.ParticipantID); err == nil {
+		res.UserName = user.UserName
+	}
+
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode check-in: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/shinyamizuno1008/hashbill/server/db"
+	"github.com/shinyamizuno1008/hashbill/server/ledger"
+	"github.com/shinyamizuno1008/hashbill/server/lottery"
+)
+
+type tierResponse struct {
+	*db.Tier
+	OnSale bool `json:"onSale"`
+
+	// SeatsLeft is the number of seats still free in the tier, or -1 if it
+	// is unlimited.
+	SeatsLeft int64 `json:"seatsLeft"`
+}
+
+// listTiersHandler lists the ticket tiers of an event with the seats left in
+// each of them. The tiers of private events are only shown to the user in
+// "viewer" if they may see the event.
+func listTiersHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil || !canView(event, viewerFromForm(r)) {
+		return appErrorf(err, "could not find event %s", r.FormValue("eventName")).withCode(http.StatusNotFound)
+	}
+	tiers, err := db.DB.ListTiers(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get tiers from database: %v", err)
+	}
+	participants, err := db.DB.ListParticipantsHostedBy(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get participants from database: %v", err)
+	}
+
+	now := time.Now()
+	res := []tierResponse{}
+	for _, t := range tiers {
+		res = append(res, tierResponse{
+			Tier:      t,
+			OnSale:    t.OnSale(now),
+			SeatsLeft: lottery.SeatsLeft(event, t, participants),
+		})
+	}
+
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return appErrorf(err, "could not encode tiers: %v", err)
+	}
+	w.Write(resJSON)
+	return nil
+}
+
+// setTierHandler adds a ticket tier to an event, or updates it if the event
+// already has a tier with the same name.
+func setTierHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+	tier, err := tierFromForm(event, r)
+	if err != nil {
+		return appErrorf(err, "could not parse tier from form: %v", err).withCode(http.StatusBadRequest)
+	}
+
+	tiers, err := db.DB.ListTiers(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get tiers from database: %v", err)
+	}
+	if findTier(tiers, tier.TierName) != nil {
+		err = db.DB.UpdateTier(tier)
+	} else {
+		err = db.DB.AddTier(tier)
+	}
+	if err != nil {
+		return appErrorf(err, "could not save tier: %v", err)
+	}
+
+	tierJSON, err := json.Marshal(tier)
+	if err != nil {
+		return appErrorf(err, "could not encode tier: %v", err)
+	}
+	w.Write(tierJSON)
+	return nil
+}
+
+// tierFromForm populates the fields of a Tier from form values.
+func tierFromForm(event *db.Event, r *http.Request) (*db.Tier, error) {
+	tier := &db.Tier{
+		HostID:    event.HostID,
+		EventName: event.EventName,
+		TierName:  r.FormValue("tierName"),
+		SaleStart: r.FormValue("saleStart"),
+		SaleEnd:   r.FormValue("saleEnd"),
+	}
+	if tier.TierName == "" {
+		return nil, fmt.Errorf("tierName is required")
+	}
+
+	var err error
+	if v := r.FormValue("price"); v != "" {
+		if tier.Price, err = strconv.ParseInt(v, 10, 64); err != nil || tier.Price < 0 {
+			return nil, fmt.Errorf("invalid price %q", v)
+		}
+	}
+	if v := r.FormValue("capacity"); v != "" {
+		if tier.Capacity, err = strconv.ParseInt(v, 10, 64); err != nil || tier.Capacity < 0 {
+			return nil, fmt.Errorf("invalid capacity %q", v)
+		}
+	}
+	for _, v := range []string{tier.SaleStart, tier.SaleEnd} {
+		if v == "" {
+			continue
+		}
+		if _, err := db.ParseTime(v); err != nil {
+			return nil, fmt.Errorf("invalid sale window: %v", err)
+		}
+	}
+	return tier, nil
+}
+
+// deleteTierHandler removes a ticket tier from an event. Tiers that
+// participants applied for cannot be removed.
+func deleteTierHandler(w http.ResponseWriter, r *http.Request) *appError {
+	event, err := db.DB.GetEvent(r.FormValue("hostID"), r.FormValue("eventName"))
+	if err != nil {
+		return appErrorf(err, "could not find event: %v", err).withCode(http.StatusNotFound)
+	}
+	if _, aerr := authorize(r, event, permManage); aerr != nil {
+		return aerr
+	}
+	tierName := r.FormValue("tierName")
+
+	participants, err := db.DB.ListParticipantsHostedBy(event.HostID, event.EventName)
+	if err != nil {
+		return appErrorf(err, "could not get participants from database: %v", err)
+	}
+	for _, p := range lottery.InTier(participants, tierName) {
+		if p.Status != db.StatusCancelled {
+			return appErrorf(nil, "tier %s has participants", tierName).withCode(http.StatusConflict)
+		}
+	}
+
+	if err := db.DB.DeleteTier(event.HostID, event.EventName, tierName); err != nil {
+		return appErrorf(err, "could not delete tier: %v", err).withCode(http.StatusNotFound)
+	}
+	return nil
+}
+
+// pickTier returns the tier a participant applies for. Events without tiers
+// take no tier, and nil is returned for them.
+func pickTier(tiers []*db.Tier, tierName string, now time.Time) (*db.Tier, error) {
+	if len(tiers) == 0 {
+		if tierName != "" {
+			return nil, fmt.Errorf("the event has no tier %s", tierName)
+		}
+		return nil, nil
+	}
+	if tierName == "" {
+		return nil, fmt.Errorf("a tier is required")
+	}
+	tier := findTier(tiers, tierName)
+	if tier == nil {
+		return nil, fmt.Errorf("the event has no tier %s", tierName)
+	}
+	if !tier.OnSale(now) {
+		return nil, fmt.Errorf("tier %s is not on sale", tierName)
+	}
+	return tier, nil
+}
+
+// findTier returns the tier with a given name, or nil if there is none.
+func findTier(tiers []*db.Tier, tierName string) *db.Tier {
+	for _, t := range tiers {
+		if t.TierName == tierName {
+			return t
+		}
+	}
+	return nil
+}
+
+// participantFee returns the fee a participant of an event owes, which is the
+// price of their tier if they applied for one.
+func participantFee(event *db.Event, participant *db.Participant) (int64, error) {
+	tiers, err := db.DB.ListTiers(event.HostID, event.EventName)
+	if err != nil {
+		return 0, err
+	}
+	return ledger.Fee(event, tiers, participant.Tier), nil
+}